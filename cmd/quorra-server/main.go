@@ -3,12 +3,14 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -21,10 +23,17 @@ import (
 	_ "github.com/lib/pq"
 	"github.com/redis/go-redis/v9"
 	"google.golang.org/grpc"
+	_ "modernc.org/sqlite"
 )
 
+// shutdownTimeout bounds graceful shutdown, including waiting for leased jobs to be acked
+const shutdownTimeout = 10 * time.Second
+
 func main() {
-	cfg := config.Load()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	// Setup structured logging
 	logger := log.New(os.Stdout, "[quorra] ", log.LstdFlags|log.Lshortfile)
@@ -43,7 +52,52 @@ func main() {
 	logger.Println("Connected to PostgreSQL")
 
 	// Initialize store
-	jobStore := store.NewPostgresStore(db)
+	pgStore := store.NewPostgresStore(db)
+	pgStore.SetBackoffPolicy(store.BackoffPolicy{Min: cfg.MinBackoff, Max: cfg.MaxBackoff})
+	pgStore.SetDedupWindow(cfg.DedupWindow)
+	pgStore.SetMaxFrontRequeues(cfg.MaxFrontRequeues)
+	pgStore.SetGraceRedeliveries(cfg.GraceRedeliveries)
+	pgStore.SetMaxRetryAfter(cfg.MaxNackRetryAfter)
+	pgStore.SetMaxDeferrals(cfg.MaxNackDeferrals)
+	pgStore.SetRequireLeaseEpoch(cfg.RequireLeaseEpoch)
+	deadRetryDelays, _ := cfg.DeadRetryDelays() // already checked by config.Load
+	pgStore.SetDeadRetrySchedule(deadRetryDelays)
+
+	// pgStores holds the primary and, if configured, the replica store, for
+	// settings both need
+	pgStores := []*store.PostgresStore{pgStore}
+	var jobStore store.Store = pgStore
+	if cfg.DatabaseReplicaURL != "" {
+		replicaDB, err := sql.Open("postgres", cfg.DatabaseReplicaURL)
+		if err != nil {
+			logger.Fatalf("Failed to connect to read replica: %v", err)
+		}
+		defer replicaDB.Close()
+
+		if err := replicaDB.Ping(); err != nil {
+			logger.Fatalf("Failed to ping read replica: %v", err)
+		}
+		replicaStore := store.NewPostgresStore(replicaDB)
+		pgStores = append(pgStores, replicaStore)
+		jobStore = store.NewReplicaStore(pgStore, replicaStore, cfg.ReplicaReadYourWrites)
+		logger.Printf("Serving read-heavy queries from the read replica (read-your-writes=%t)", cfg.ReplicaReadYourWrites)
+	}
+	var failoverStore *store.FailoverStore
+	if cfg.FailoverSpoolPath != "" {
+		spoolDB, err := sql.Open("sqlite", cfg.FailoverSpoolPath)
+		if err != nil {
+			logger.Fatalf("Failed to open failover spool: %v", err)
+		}
+		defer spoolDB.Close()
+
+		spool, err := store.NewSQLiteSpool(context.Background(), spoolDB)
+		if err != nil {
+			logger.Fatalf("Failed to initialize failover spool: %v", err)
+		}
+		failoverStore = store.NewFailoverStore(jobStore, spool, logger)
+		jobStore = failoverStore
+		logger.Printf("Failover spool enabled at %s", cfg.FailoverSpoolPath)
+	}
 
 	// Connect to Redis (optional)
 	var redisClient *redis.Client
@@ -64,19 +118,71 @@ func main() {
 		}
 	}
 
+	// Initialize metrics
+	metricsCollector := metrics.NewCollector()
+	metricsCollector.SetWorkerLeaseLimit(cfg.LeaseMetricsMaxWorkers)
+
 	// Initialize queue manager
-	queueManager := queue.NewManager(jobStore, redisClient, logger)
+	queueManager := queue.NewManager(jobStore, redisClient, metricsCollector, logger)
+	queueManager.SetFIFOQueues(strings.Split(cfg.FIFOQueues, ","))
+	queueManager.SetSerialQueues(strings.Split(cfg.SerialQueues, ","))
+	enrichmentLabels, _ := cfg.EnrichmentLabels() // already checked by config.Load
+	queueManager.SetEnrichment(queue.Enrichment{Labels: enrichmentLabels, StampEnqueuedBy: cfg.StampEnqueuedBy})
+	queueManager.SetStuckTTLMultiple(cfg.StuckJobTTLMultiple)
+	queueManager.SetTraceSampleRate(cfg.TraceSampleRate)
+	queueManager.SetRetryBudgetWindow(cfg.RetryBudgetWindow)
+	queueManager.SetRecentJobsCacheTTL(cfg.RecentJobsCacheTTL)
+	queueLimits, _ := cfg.QueueRateLimitsByQueue() // already checked by config.Load
+	queueManager.SetQueueRateLimits(queueLimits)
+	pgStore.SetRetryBudget(queueManager.RetryBudgetExhausted)
+	queueManager.SetAdaptiveBackoff(queue.AdaptiveBackoff{
+		MaxMultiplier: cfg.AdaptiveBackoffMaxMultiplier,
+		Window:        cfg.AdaptiveBackoffWindow,
+	})
+	pgStore.SetBackoffMultiplier(queueManager.BackoffMultiplier)
+	if cfg.CorruptRowMode == "skip" {
+		for _, s := range pgStores {
+			s.SetSkipCorruptRows(func(query, jobID string, err error) {
+				logger.Printf("Skipping corrupt job %s in %s query: %v", jobID, query, err)
+				metricsCollector.RecordCorruptRow(query)
+			})
+		}
+	}
+	for _, s := range pgStores {
+		s.SetQueryObserver(func(operation string, duration time.Duration) {
+			metricsCollector.RecordDBQueryDuration(operation, duration)
+			if cfg.SlowQueryThreshold > 0 && duration >= cfg.SlowQueryThreshold {
+				logSlowQuery(logger, operation, duration, cfg.SlowQueryThreshold)
+			}
+		})
+	}
+	queueManager.SetAgingPolicy(queue.AgingPolicy{
+		Interval:    cfg.AgingInterval,
+		Increment:   cfg.AgingIncrement,
+		MaxPriority: cfg.AgingMaxPriority,
+	})
+	queueManager.SetStatsSampling(queue.StatsSampling{
+		Interval:  cfg.StatsSampleInterval,
+		Retention: cfg.StatsRetention,
+	})
+	if cfg.CreateBatchWindow > 0 {
+		queueManager.EnableCreateBatching(cfg.CreateBatchWindow, cfg.CreateBatchMaxSize)
+	}
+	if cfg.InlineExecution {
+		logger.Println("Warning: inline job execution is enabled; this is meant for tests and development only")
+		queueManager.EnableInlineExecution()
+	}
 
 	// Start scheduler
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go queueManager.StartScheduler(ctx)
-
-	// Initialize metrics
-	metricsCollector := metrics.NewCollector()
+	if failoverStore != nil {
+		go failoverStore.StartReconciler(ctx, cfg.FailoverReplayInterval)
+	}
 
 	// Setup HTTP server with API
-	apiHandler := api.NewHandler(jobStore, queueManager, metricsCollector, cfg.APIKey, logger)
+	apiHandler := api.NewHandler(jobStore, queueManager, metricsCollector, cfg, logger)
 	httpServer := &http.Server{
 		Addr:    cfg.HTTPAddr,
 		Handler: apiHandler.Router(),
@@ -88,9 +194,20 @@ func main() {
 		logger.Fatalf("Failed to listen on gRPC port: %v", err)
 	}
 
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(
+		grpc.MaxRecvMsgSize(cfg.GRPCMaxMsgBytes),
+		grpc.MaxSendMsgSize(cfg.GRPCMaxMsgBytes),
+	)
 	workerService := grpcserver.NewWorkerService(queueManager, metricsCollector, logger)
+	workerService.SetCompression(cfg.GRPCCompression)
+	workerService.SetMaxPayloadBytes(cfg.MaxPayloadBytes())
+	workerService.SetMaxLeaseBatch(cfg.MaxLeaseBatch)
+	workerService.SetTraceSampleRate(cfg.TraceSampleRate)
 	grpcserver.RegisterWorkerServiceServer(grpcServer, workerService)
+	healthReporter := grpcserver.NewHealthReporter(pgStore.Ping, logger)
+	healthReporter.Register(grpcServer)
+	go healthReporter.Run(ctx)
+	apiHandler.SetStreamCounter(workerService)
 
 	// Start servers
 	go func() {
@@ -112,16 +229,35 @@ func main() {
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	<-sigChan
 
-	logger.Println("Shutting down gracefully...")
+	// Tell workers and probes to stop sending work before anything stops
+	healthReporter.Shutdown()
 	cancel()
+	queueManager.StopLeasing()
 
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer shutdownCancel()
 
+	if inFlight, err := queueManager.CountInFlightJobs(shutdownCtx); err != nil {
+		logger.Printf("Shutting down gracefully (failed to count in-flight jobs: %v)", err)
+	} else {
+		logger.Printf("Shutting down gracefully with %d jobs leased by this server in flight; waiting up to %v for acks", inFlight, shutdownTimeout)
+	}
+
 	if err := httpServer.Shutdown(shutdownCtx); err != nil {
 		logger.Printf("HTTP server shutdown error: %v", err)
 	}
 
+	// Keep serving gRPC acks until the leased jobs drain or time runs out
+	remaining, err := queueManager.WaitForInFlight(shutdownCtx)
+	switch {
+	case err != nil:
+		logger.Printf("Failed to wait for in-flight jobs: %v", err)
+	case remaining > 0:
+		logger.Printf("Gave up waiting with %d jobs still in flight; their leases will be reclaimed", remaining)
+	default:
+		logger.Println("All in-flight jobs acked")
+	}
+
 	grpcServer.GracefulStop()
 
 	if redisClient != nil {
@@ -131,3 +267,18 @@ func main() {
 	logger.Println("Server stopped")
 	fmt.Println("GoQuorra shutdown complete")
 }
+
+// logSlowQuery logs a slow store operation as a single JSON line, so it can
+// be picked out of the log and aggregated by operation
+func logSlowQuery(logger *log.Logger, operation string, duration, threshold time.Duration) {
+	line, err := json.Marshal(struct {
+		Event       string  `json:"event"`
+		Operation   string  `json:"operation"`
+		DurationMs  float64 `json:"duration_ms"`
+		ThresholdMs int64   `json:"threshold_ms"`
+	}{"slow_query", operation, float64(duration.Microseconds()) / 1000, threshold.Milliseconds()})
+	if err != nil {
+		return
+	}
+	logger.Printf("%s", line)
+}
@@ -3,17 +3,23 @@ package main
 import (
 	"context"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
 
 	"github.com/goquorra/goquorra/internal/config"
+	"github.com/goquorra/goquorra/internal/metrics"
 	"github.com/goquorra/goquorra/internal/worker"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
-	cfg := config.Load()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	logger := log.New(os.Stdout, "[worker] ", log.LstdFlags)
 	logger.Printf("Starting GoQuorra worker: %s", cfg.WorkerID)
@@ -23,6 +29,33 @@ func main() {
 		queues[i] = strings.TrimSpace(queues[i])
 	}
 
+	var capabilities []string
+	for _, c := range strings.Split(cfg.WorkerCapabilities, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			capabilities = append(capabilities, c)
+		}
+	}
+
+	priorityQuotas, err := worker.ParsePriorityQuotas(cfg.WorkerPriorityQuotas)
+	if err != nil {
+		log.Fatalf("Invalid QUORRA_WORKER_PRIORITY_QUOTAS: %v", err)
+	}
+
+	var minPriority *int
+	if floor, ok, _ := cfg.WorkerPriorityFloor(); ok { // already checked by config.Load
+		minPriority = &floor
+	}
+
+	labelFilter, err := worker.ParseLabelFilter(cfg.WorkerLabelFilter)
+	if err != nil {
+		log.Fatalf("Invalid QUORRA_WORKER_LABEL_FILTER: %v", err)
+	}
+
+	queueWeights, err := worker.ParseQueueWeights(cfg.WorkerQueueWeights)
+	if err != nil {
+		log.Fatalf("Invalid QUORRA_WORKER_QUEUE_WEIGHTS: %v", err)
+	}
+
 	// Parse server address
 	serverAddr := cfg.GRPCAddr
 	if strings.HasPrefix(serverAddr, ":") {
@@ -35,10 +68,59 @@ func main() {
 		Queues:     queues,
 		MaxJobs:    cfg.WorkerMaxJobs,
 		LeaseTTL:   cfg.WorkerLeaseTTL,
+
+		PollInterval:      cfg.WorkerPollInterval,
+		QueueWeights:      queueWeights,
+		QueueSelection:    cfg.WorkerQueueSelection,
+		TraceSampleRate:   cfg.TraceSampleRate,
+		VisibilityTimeout: cfg.WorkerVisibilityTimeout,
+		PayloadMode:       cfg.WorkerPayloadMode,
+		Capabilities:      capabilities,
+		LabelFilter:       labelFilter,
+		Weight:            cfg.WorkerWeight,
+		Compression:       cfg.GRPCCompression,
+		MaxMsgBytes:       cfg.GRPCMaxMsgBytes,
+		ConnectTimeout:    cfg.WorkerConnectTimeout,
+		PriorityQuotas:    priorityQuotas,
+		MinPriority:       minPriority,
+		StartImmediately:  cfg.WorkerStartImmediately,
+
+		Simulator: &worker.SimulatorConfig{
+			Seed:        int64(cfg.WorkerSimSeed),
+			FailureRate: cfg.WorkerSimFailureRate,
+			MinDuration: cfg.WorkerSimMinDuration,
+			MaxDuration: cfg.WorkerSimMaxDuration,
+		},
+
+		AckBatchSize:     cfg.WorkerAckBatchSize,
+		AckFlushInterval: cfg.WorkerAckFlushInterval,
+
+		KeepAliveInterval: cfg.WorkerKeepAliveInterval,
+		MaxLeaseDuration:  cfg.WorkerMaxLeaseDuration,
+		MaxLifetimeJobs:   cfg.WorkerMaxLifetimeJobs,
+	}
+
+	if cfg.WorkerMetricsAddr != "" {
+		workerCfg.Metrics = metrics.NewWorkerCollector()
 	}
 
 	w := worker.New(workerCfg, logger)
 
+	// The metrics address also serves the buffer debug endpoints
+	var metricsServer *http.Server
+	if cfg.WorkerMetricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		w.RegisterBufferHandlers(mux)
+		metricsServer = &http.Server{Addr: cfg.WorkerMetricsAddr, Handler: mux}
+		go func() {
+			logger.Printf("Serving worker metrics on %s", cfg.WorkerMetricsAddr)
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Fatalf("Metrics server error: %v", err)
+			}
+		}()
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -56,5 +138,9 @@ func main() {
 		logger.Fatalf("Worker error: %v", err)
 	}
 
+	if metricsServer != nil {
+		metricsServer.Close()
+	}
+
 	logger.Println("Worker stopped")
 }
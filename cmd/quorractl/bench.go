@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newBenchCmd() *cobra.Command {
+	benchCmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Run a synthetic enqueue load test",
+		Long:  "Spin up concurrent producers that create jobs at a target rate and report throughput, latency percentiles, and error rate",
+		Run:   runBench,
+	}
+	benchCmd.Flags().Int("rate", 100, "Target jobs per second across all producers (0 = unthrottled)")
+	benchCmd.Flags().Duration("duration", 10*time.Second, "How long to generate load")
+	benchCmd.Flags().Int("concurrency", 10, "Number of concurrent producers")
+	benchCmd.Flags().Int("payload-size", 64, "Approximate payload size in bytes")
+	benchCmd.Flags().String("queue", "bench", "Queue to enqueue into")
+	benchCmd.Flags().String("type", "bench", "Job type to enqueue")
+
+	return benchCmd
+}
+
+// benchResult records the outcome of a single enqueue request
+type benchResult struct {
+	latency time.Duration
+	err     bool
+}
+
+// maxBenchRate is the highest --rate that is paced by a ticker
+const maxBenchRate = 1000000
+
+func runBench(cmd *cobra.Command, args []string) {
+	rate, _ := cmd.Flags().GetInt("rate")
+	duration, _ := cmd.Flags().GetDuration("duration")
+	concurrency, _ := cmd.Flags().GetInt("concurrency")
+	payloadSize, _ := cmd.Flags().GetInt("payload-size")
+	queue, _ := cmd.Flags().GetString("queue")
+	jobType, _ := cmd.Flags().GetString("type")
+
+	if concurrency <= 0 {
+		fmt.Fprintln(os.Stderr, "Error: --concurrency must be positive")
+		os.Exit(1)
+	}
+	// The ticker interval is a second divided by the rate, which must stay
+	// above zero; beyond this use --rate 0
+	if rate < 0 || rate > maxBenchRate {
+		fmt.Fprintf(os.Stderr, "Error: --rate must be between 0 (unthrottled) and %d\n", maxBenchRate)
+		os.Exit(1)
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"type":    jobType,
+		"queue":   queue,
+		"payload": map[string]interface{}{"data": strings.Repeat("x", payloadSize)},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to marshal request: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Benchmarking %s for %v (rate=%d/s, concurrency=%d, payload=%dB)\n",
+		serverURL, duration, rate, concurrency, payloadSize)
+
+	// Tokens are handed out at the target rate; producers block until one is available
+	tokens := make(chan struct{}, concurrency)
+	deadline := time.Now().Add(duration)
+	go func() {
+		defer close(tokens)
+		if rate <= 0 {
+			for time.Now().Before(deadline) {
+				tokens <- struct{}{}
+			}
+			return
+		}
+		ticker := time.NewTicker(time.Second / time.Duration(rate))
+		defer ticker.Stop()
+		for now := range ticker.C {
+			if !now.Before(deadline) {
+				return
+			}
+			select {
+			case tokens <- struct{}{}:
+			default:
+				// Producers are saturated; drop the tick rather than bursting later
+			}
+		}
+	}()
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	var mu sync.Mutex
+	var results []benchResult
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range tokens {
+				result := benchEnqueue(client, body)
+				mu.Lock()
+				results = append(results, result)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	printBenchReport(results, elapsed)
+}
+
+// benchEnqueue sends a single job creation request and times it
+func benchEnqueue(client *http.Client, body []byte) benchResult {
+	req, err := http.NewRequest("POST", serverURL+"/v1/jobs", bytes.NewReader(body))
+	if err != nil {
+		return benchResult{err: true}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", apiKey)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	latency := time.Since(start)
+	if err != nil {
+		return benchResult{latency: latency, err: true}
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	return benchResult{latency: latency, err: resp.StatusCode != http.StatusCreated}
+}
+
+func printBenchReport(results []benchResult, elapsed time.Duration) {
+	total := len(results)
+	if total == 0 {
+		fmt.Println("No requests were sent")
+		return
+	}
+
+	var errorCount int
+	latencies := make([]time.Duration, 0, total)
+	for _, r := range results {
+		if r.err {
+			errorCount++
+			continue
+		}
+		latencies = append(latencies, r.latency)
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	succeeded := total - errorCount
+
+	fmt.Println("\nBenchmark Results:")
+	fmt.Println("─────────────────────────────────────────")
+	fmt.Printf("  %-12s: %d\n", "requests", total)
+	fmt.Printf("  %-12s: %d\n", "succeeded", succeeded)
+	fmt.Printf("  %-12s: %.2f%%\n", "error rate", float64(errorCount)/float64(total)*100)
+	fmt.Printf("  %-12s: %.1f jobs/s\n", "throughput", float64(succeeded)/elapsed.Seconds())
+	fmt.Printf("  %-12s: %v\n", "p50", percentile(latencies, 50))
+	fmt.Printf("  %-12s: %v\n", "p95", percentile(latencies, 95))
+	fmt.Printf("  %-12s: %v\n", "p99", percentile(latencies, 99))
+}
+
+// percentile returns the p-th percentile of sorted latencies using nearest-rank
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1].Round(time.Microsecond)
+}
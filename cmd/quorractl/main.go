@@ -7,6 +7,8 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"sort"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -34,11 +36,21 @@ func main() {
 		Args:  cobra.ExactArgs(1),
 		Run:   createJob,
 	}
+	createCmd.Flags().String("id", "", "Job ID to use instead of a generated one (UUID or ULID)")
 	createCmd.Flags().String("payload", "{}", "Job payload as JSON string")
 	createCmd.Flags().String("queue", "default", "Queue name")
 	createCmd.Flags().Int("priority", 0, "Job priority")
 	createCmd.Flags().Int("delay", 0, "Delay in seconds before job is ready")
-	createCmd.Flags().Int("retries", 3, "Maximum number of retries")
+	createCmd.Flags().Int("retries", 0, "Maximum number of retries (default: the queue's policy, or 3)")
+	createCmd.Flags().StringToString("label", nil, "Job label as key=value (repeatable)")
+	createCmd.Flags().String("trace-id", "", "Trace ID to propagate to workers")
+	createCmd.Flags().String("partition-key", "", "Partition key for ordered processing in FIFO queues")
+	createCmd.Flags().String("idempotency-key", "", "Key that collapses repeated enqueues into one job")
+	createCmd.Flags().Bool("if-absent", false, "Only enqueue if no job with the same type and queue (or --singleton-key) is active")
+	createCmd.Flags().String("singleton-key", "", "Key checked by --if-absent instead of the type and queue")
+	createCmd.Flags().Bool("dead-retry", false, "Automatically retry the job from the dead-letter queue on the server's dead retry schedule")
+	createCmd.Flags().Duration("deadline", 0, "Expire the job if it hasn't run within this duration (e.g. 10m)")
+	createCmd.Flags().StringSlice("requires", nil, "Worker capabilities the job requires (comma-separated)")
 
 	// Get job command
 	getCmd := &cobra.Command{
@@ -62,7 +74,7 @@ func main() {
 		Run:   listQueues,
 	}
 
-	rootCmd.AddCommand(createCmd, getCmd, queuesCmd, statsCmd)
+	rootCmd.AddCommand(createCmd, getCmd, queuesCmd, statsCmd, newQueueCmd(), newBenchCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -72,11 +84,21 @@ func main() {
 
 func createJob(cmd *cobra.Command, args []string) {
 	jobType := args[0]
+	jobID, _ := cmd.Flags().GetString("id")
 	payloadStr, _ := cmd.Flags().GetString("payload")
 	queue, _ := cmd.Flags().GetString("queue")
 	priority, _ := cmd.Flags().GetInt("priority")
 	delay, _ := cmd.Flags().GetInt("delay")
 	retries, _ := cmd.Flags().GetInt("retries")
+	labels, _ := cmd.Flags().GetStringToString("label")
+	traceID, _ := cmd.Flags().GetString("trace-id")
+	partitionKey, _ := cmd.Flags().GetString("partition-key")
+	idempotencyKey, _ := cmd.Flags().GetString("idempotency-key")
+	ifAbsent, _ := cmd.Flags().GetBool("if-absent")
+	singletonKey, _ := cmd.Flags().GetString("singleton-key")
+	deadRetry, _ := cmd.Flags().GetBool("dead-retry")
+	requires, _ := cmd.Flags().GetStringSlice("requires")
+	deadline, _ := cmd.Flags().GetDuration("deadline")
 
 	// Parse payload
 	var payload map[string]interface{}
@@ -92,7 +114,39 @@ func createJob(cmd *cobra.Command, args []string) {
 		"queue":         queue,
 		"priority":      priority,
 		"delay_seconds": delay,
-		"max_retries":   retries,
+	}
+	if jobID != "" {
+		reqBody["id"] = jobID
+	}
+	if retries > 0 {
+		reqBody["max_retries"] = retries
+	}
+	if len(labels) > 0 {
+		reqBody["labels"] = labels
+	}
+	if traceID != "" {
+		reqBody["trace_id"] = traceID
+	}
+	if partitionKey != "" {
+		reqBody["partition_key"] = partitionKey
+	}
+	if idempotencyKey != "" {
+		reqBody["idempotency_key"] = idempotencyKey
+	}
+	if ifAbsent {
+		reqBody["enqueue_if_absent"] = true
+	}
+	if singletonKey != "" {
+		reqBody["singleton_key"] = singletonKey
+	}
+	if len(requires) > 0 {
+		reqBody["requires"] = requires
+	}
+	if deadline > 0 {
+		reqBody["deadline"] = time.Now().Add(deadline).UTC().Format(time.RFC3339)
+	}
+	if deadRetry {
+		reqBody["dead_retry"] = true
 	}
 
 	jsonData, err := json.Marshal(reqBody)
@@ -136,7 +190,11 @@ func createJob(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	fmt.Printf("Job created successfully!\n")
+	if dedup, _ := result["deduplicated"].(bool); dedup {
+		fmt.Printf("Job already exists; no new job was created\n")
+	} else {
+		fmt.Printf("Job created successfully!\n")
+	}
 	fmt.Printf("ID:     %s\n", result["id"])
 	fmt.Printf("Status: %s\n", result["status"])
 	fmt.Printf("Run at: %s\n", result["run_at"])
@@ -224,21 +282,58 @@ func listQueues(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	// Group by queue
+	// Group by queue, summing duplicate queue/status rows rather than overwriting
 	queueStats := make(map[string]map[string]int)
 	for _, stat := range result.Queues {
 		if _, exists := queueStats[stat.Queue]; !exists {
 			queueStats[stat.Queue] = make(map[string]int)
 		}
-		queueStats[stat.Queue][stat.Status] = stat.Count
+		queueStats[stat.Queue][stat.Status] += stat.Count
+	}
+
+	queues := make([]string, 0, len(queueStats))
+	for queue := range queueStats {
+		queues = append(queues, queue)
 	}
+	sort.Strings(queues)
 
 	fmt.Println("Queue Statistics:")
 	fmt.Println("─────────────────────────────────────────")
-	for queue, stats := range queueStats {
+	for _, queue := range queues {
+		stats := queueStats[queue]
+		total := 0
 		fmt.Printf("\n%s:\n", queue)
-		for status, count := range stats {
-			fmt.Printf("  %-12s: %d\n", status, count)
+		for _, status := range sortedStatuses(stats) {
+			fmt.Printf("  %-12s %8d\n", status, stats[status])
+			total += stats[status]
 		}
+		fmt.Printf("  %-12s %8s\n", "", "--------")
+		fmt.Printf("  %-12s %8d\n", "total", total)
 	}
 }
+
+// statusOrder lists job statuses in lifecycle order for display
+var statusOrder = []string{"pending", "leased", "processing", "succeeded", "failed", "dead"}
+
+// sortedStatuses returns the statuses present in stats in lifecycle order,
+// followed by any unrecognized statuses alphabetically
+func sortedStatuses(stats map[string]int) []string {
+	statuses := make([]string, 0, len(stats))
+	known := make(map[string]bool, len(statusOrder))
+	for _, status := range statusOrder {
+		known[status] = true
+		if _, ok := stats[status]; ok {
+			statuses = append(statuses, status)
+		}
+	}
+
+	var other []string
+	for status := range stats {
+		if !known[status] {
+			other = append(other, status)
+		}
+	}
+	sort.Strings(other)
+
+	return append(statuses, other...)
+}
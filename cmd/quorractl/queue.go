@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// queueConfig mirrors the body of /v1/queues/{name}/config
+type queueConfig struct {
+	Queue              string `json:"queue"`
+	MaxRetries         int    `json:"max_retries,omitempty"`
+	BackoffStrategy    string `json:"backoff_strategy,omitempty"`
+	BackoffBaseSeconds int    `json:"backoff_base_seconds,omitempty"`
+	BackoffCapSeconds  int    `json:"backoff_cap_seconds,omitempty"`
+	DeadRetry          bool   `json:"dead_retry,omitempty"`
+	MinWorkers         int    `json:"min_workers,omitempty"`
+	Scheduling         string `json:"scheduling,omitempty"`
+	RetryBudgetPercent int    `json:"retry_budget_percent,omitempty"`
+	UpdatedAt          string `json:"updated_at,omitempty"`
+}
+
+func newQueueCmd() *cobra.Command {
+	queueCmd := &cobra.Command{
+		Use:   "queue",
+		Short: "Manage queue configuration",
+	}
+
+	getCmd := &cobra.Command{
+		Use:   "get NAME",
+		Short: "Show a queue's config",
+		Args:  cobra.ExactArgs(1),
+		Run:   getQueueConfig,
+	}
+
+	setCmd := &cobra.Command{
+		Use:   "set NAME",
+		Short: "Update a queue's config",
+		Long:  "Update a queue's config. Only the given flags change; a value of 0 (or \"\" for --backoff-strategy and --scheduling) unsets a setting so the server-wide default applies. --dead-retry=false turns dead retries off.",
+		Args:  cobra.ExactArgs(1),
+		Run:   setQueueConfig,
+	}
+	setCmd.Flags().Int("max-retries", 0, "Maximum number of retries for jobs that don't set their own")
+	setCmd.Flags().String("backoff-strategy", "", "Retry backoff strategy: exponential, linear or fixed")
+	setCmd.Flags().Int("backoff-base", 0, "Base retry delay in seconds")
+	setCmd.Flags().Int("backoff-cap", 0, "Maximum retry delay in seconds")
+	setCmd.Flags().Int("min-workers", 0, "Healthy workers required before the queue dispatches")
+	setCmd.Flags().String("scheduling", "", "Lease order: priority, or edf for earliest deadline first")
+	setCmd.Flags().Int("retry-budget", 0, "Most recent leases, in percent, that may be retries before failures go straight to dead")
+	setCmd.Flags().Bool("dead-retry", false, "Automatically retry new jobs from the dead-letter queue on the server's dead retry schedule")
+
+	queueCmd.AddCommand(getCmd, setCmd)
+	return queueCmd
+}
+
+func getQueueConfig(cmd *cobra.Command, args []string) {
+	printQueueConfig(fetchQueueConfig(args[0]))
+}
+
+func setQueueConfig(cmd *cobra.Command, args []string) {
+	flags := cmd.Flags()
+	changed := false
+	for _, name := range []string{"max-retries", "backoff-strategy", "backoff-base", "backoff-cap", "dead-retry", "min-workers", "scheduling", "retry-budget"} {
+		if flags.Changed(name) {
+			changed = true
+		}
+	}
+	if !changed {
+		fmt.Fprintln(os.Stderr, "Error: Nothing to set; pass at least one of --max-retries, --backoff-strategy, --backoff-base, --backoff-cap, --dead-retry, --min-workers, --scheduling or --retry-budget")
+		os.Exit(1)
+	}
+
+	// PUT replaces the whole config, so start from the current one
+	cfg := fetchQueueConfig(args[0])
+
+	if flags.Changed("max-retries") {
+		cfg.MaxRetries, _ = flags.GetInt("max-retries")
+	}
+	if flags.Changed("backoff-strategy") {
+		cfg.BackoffStrategy, _ = flags.GetString("backoff-strategy")
+	}
+	if flags.Changed("backoff-base") {
+		cfg.BackoffBaseSeconds, _ = flags.GetInt("backoff-base")
+	}
+	if flags.Changed("backoff-cap") {
+		cfg.BackoffCapSeconds, _ = flags.GetInt("backoff-cap")
+	}
+	if flags.Changed("dead-retry") {
+		cfg.DeadRetry, _ = flags.GetBool("dead-retry")
+	}
+	if flags.Changed("min-workers") {
+		cfg.MinWorkers, _ = flags.GetInt("min-workers")
+	}
+	if flags.Changed("scheduling") {
+		cfg.Scheduling, _ = flags.GetString("scheduling")
+	}
+	if flags.Changed("retry-budget") {
+		cfg.RetryBudgetPercent, _ = flags.GetInt("retry-budget")
+	}
+
+	switch cfg.BackoffStrategy {
+	case "", "exponential", "linear", "fixed":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: Invalid backoff strategy %q (want exponential, linear or fixed)\n", cfg.BackoffStrategy)
+		os.Exit(1)
+	}
+	switch cfg.Scheduling {
+	case "", "priority", "edf":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: Invalid scheduling mode %q (want priority or edf)\n", cfg.Scheduling)
+		os.Exit(1)
+	}
+	if cfg.MaxRetries < 0 || cfg.BackoffBaseSeconds < 0 || cfg.BackoffCapSeconds < 0 || cfg.MinWorkers < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --max-retries, --backoff-base, --backoff-cap and --min-workers must not be negative")
+		os.Exit(1)
+	}
+	if cfg.RetryBudgetPercent < 0 || cfg.RetryBudgetPercent > 100 {
+		fmt.Fprintln(os.Stderr, "Error: --retry-budget must be between 0 and 100")
+		os.Exit(1)
+	}
+
+	jsonData, err := json.Marshal(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to marshal request: %v\n", err)
+		os.Exit(1)
+	}
+
+	body := queueConfigRequest("PUT", args[0], jsonData)
+
+	var updated queueConfig
+	if err := json.Unmarshal(body, &updated); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to parse response: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Queue config updated\n")
+	printQueueConfig(&updated)
+}
+
+// fetchQueueConfig reads a queue's config, exiting on failure
+func fetchQueueConfig(name string) *queueConfig {
+	body := queueConfigRequest("GET", name, nil)
+
+	var cfg queueConfig
+	if err := json.Unmarshal(body, &cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to parse response: %v\n", err)
+		os.Exit(1)
+	}
+	return &cfg
+}
+
+// queueConfigRequest sends a request to a queue's config endpoint and returns
+// the response body, exiting on failure
+func queueConfigRequest(method, name string, data []byte) []byte {
+	req, err := http.NewRequest(method, serverURL+"/v1/queues/"+url.PathEscape(name)+"/config", bytes.NewReader(data))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to create request: %v\n", err)
+		os.Exit(1)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", apiKey)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to send request: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to read response: %v\n", err)
+		os.Exit(1)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "Error: Server returned status %d\n%s\n", resp.StatusCode, string(body))
+		os.Exit(1)
+	}
+	return body
+}
+
+func printQueueConfig(cfg *queueConfig) {
+	orDefault := func(v int) string {
+		if v == 0 {
+			return "(server default)"
+		}
+		return fmt.Sprintf("%d", v)
+	}
+	strategy := cfg.BackoffStrategy
+	if strategy == "" {
+		strategy = "(server default)"
+	}
+
+	fmt.Printf("Queue:            %s\n", cfg.Queue)
+	fmt.Printf("Max retries:      %s\n", orDefault(cfg.MaxRetries))
+	fmt.Printf("Backoff strategy: %s\n", strategy)
+	fmt.Printf("Backoff base (s): %s\n", orDefault(cfg.BackoffBaseSeconds))
+	fmt.Printf("Backoff cap (s):  %s\n", orDefault(cfg.BackoffCapSeconds))
+	fmt.Printf("Dead retry:       %t\n", cfg.DeadRetry)
+	fmt.Printf("Min workers:      %d\n", cfg.MinWorkers)
+	scheduling := cfg.Scheduling
+	if scheduling == "" {
+		scheduling = "priority"
+	}
+	fmt.Printf("Scheduling:       %s\n", scheduling)
+	retryBudget := "off"
+	if cfg.RetryBudgetPercent > 0 {
+		retryBudget = fmt.Sprintf("%d%%", cfg.RetryBudgetPercent)
+	}
+	fmt.Printf("Retry budget:     %s\n", retryBudget)
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/goquorra/goquorra/internal/queue"
+	"github.com/goquorra/goquorra/internal/store"
+)
+
+// maxBatchJobs caps the number of jobs accepted by POST /v1/jobs/batch
+const maxBatchJobs = 1000
+
+// createJobsBatch handles POST /v1/jobs/batch. Every job is validated
+// before any is created; if any fail, the response is a 422 listing each
+// failure by index and nothing is enqueued, so producers can fix and
+// resubmit just the bad items.
+func (h *Handler) createJobsBatch(w http.ResponseWriter, r *http.Request) {
+	if h.maintenance.Load() {
+		h.respondError(w, http.StatusServiceUnavailable, "Server is in maintenance mode and not accepting new jobs")
+		return
+	}
+
+	var req struct {
+		Jobs []store.CreateJobRequest `json:"jobs"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+	if len(req.Jobs) == 0 {
+		h.respondError(w, http.StatusBadRequest, "jobs must not be empty")
+		return
+	}
+	if len(req.Jobs) > maxBatchJobs {
+		h.respondError(w, http.StatusBadRequest, fmt.Sprintf("At most %d jobs can be created per batch, got %d", maxBatchJobs, len(req.Jobs)))
+		return
+	}
+
+	validationErrors := []fieldError{}
+	clamped := make([]bool, len(req.Jobs))
+	for i := range req.Jobs {
+		job := &req.Jobs[i]
+		fe := h.validateCreateJob(job)
+		if fe == nil {
+			clamped[i], fe = h.applyPriorityCeiling(job)
+		}
+		if fe != nil {
+			validationErrors = append(validationErrors, fe.at(i))
+			continue
+		}
+		if job.TraceID == "" {
+			job.TraceID = r.Header.Get("X-Trace-ID")
+		}
+		job.EnqueuedBy = clientIP(r)
+	}
+	if len(validationErrors) > 0 {
+		h.respondJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":  fmt.Sprintf("%d of %d jobs failed validation; none were created", len(validationErrors), len(req.Jobs)),
+			"errors": validationErrors,
+		})
+		return
+	}
+
+	// Validation passed, so remaining failures are per job (an ID that
+	// already exists) or server-side; report them by index as well
+	created := make([]map[string]interface{}, 0, len(req.Jobs))
+	failures := []fieldError{}
+	var retryAfter time.Duration
+	for i := range req.Jobs {
+		job, err := h.queueManager.EnqueueJob(r.Context(), &req.Jobs[i])
+		var rle *queue.QueueRateLimitError
+		switch {
+		case err == nil:
+		case errors.As(err, &rle):
+			fe := newFieldError(http.StatusTooManyRequests, "queue", codeRateLimited, err.Error())
+			failures = append(failures, fe.at(i))
+			retryAfter = max(retryAfter, rle.RetryAfter)
+			continue
+		case errors.Is(err, store.ErrJobExists):
+			fe := newFieldError(http.StatusConflict, "id", codeAlreadyExists, "Job "+req.Jobs[i].ID+" already exists")
+			failures = append(failures, fe.at(i))
+			continue
+		case errors.Is(err, queue.ErrInlineDisabled) || errors.Is(err, queue.ErrNoInlineHandler) || errors.Is(err, queue.ErrInlineScheduled):
+			fe := newFieldError(http.StatusBadRequest, "inline", codeInvalid, err.Error())
+			failures = append(failures, fe.at(i))
+			continue
+		case errors.Is(err, queue.ErrInlinePaused) || errors.Is(err, queue.ErrInlineLeased):
+			fe := newFieldError(http.StatusConflict, "inline", codeInvalid, err.Error())
+			failures = append(failures, fe.at(i))
+			continue
+		case errors.Is(err, store.ErrCalendarNotFound):
+			fe := newFieldError(http.StatusBadRequest, "schedule_calendar", codeInvalid, err.Error())
+			failures = append(failures, fe.at(i))
+			continue
+		case errors.Is(err, store.ErrInvalidUniqueBy):
+			fe := newFieldError(http.StatusBadRequest, "unique_by", codeInvalid, err.Error())
+			failures = append(failures, fe.at(i))
+			continue
+		default:
+			h.logger.Printf("Failed to create job %d of batch: %v", i, err)
+			fe := newFieldError(http.StatusInternalServerError, "", codeInternal, "Failed to create job")
+			failures = append(failures, fe.at(i))
+			continue
+		}
+
+		result := map[string]interface{}{
+			"index":        i,
+			"id":           job.ID,
+			"status":       job.Status,
+			"run_at":       job.RunAt,
+			"priority":     job.Priority,
+			"deduplicated": job.Deduplicated,
+		}
+		if clamped[i] {
+			result["priority_clamped"] = true
+		}
+		if job.Spooled {
+			result["spooled"] = true
+		}
+		created = append(created, result)
+	}
+
+	status := http.StatusCreated
+	if len(created) == 0 {
+		status = batchFailureStatus(failures)
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+	}
+	h.respondJSON(w, status, map[string]interface{}{
+		"jobs":   created,
+		"errors": failures,
+	})
+}
+
+// batchFailureStatus is the status of a batch none of whose jobs were
+// created: 500 if any failed server-side, else 409 if any conflicted with
+// an existing job, else 429 if any hit a rate limit, else 400
+func batchFailureStatus(failures []fieldError) int {
+	status := http.StatusBadRequest
+	for _, fe := range failures {
+		switch fe.status {
+		case http.StatusInternalServerError:
+			return http.StatusInternalServerError
+		case http.StatusConflict:
+			status = http.StatusConflict
+		case http.StatusTooManyRequests:
+			if status != http.StatusConflict {
+				status = http.StatusTooManyRequests
+			}
+		}
+	}
+	return status
+}
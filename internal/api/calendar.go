@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/goquorra/goquorra/internal/store"
+)
+
+// getCalendar handles GET /v1/calendars/{name}
+func (h *Handler) getCalendar(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	cal, err := h.queueManager.GetCalendar(r.Context(), name)
+	if err != nil {
+		h.logger.Printf("Failed to get calendar %s: %v", name, err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to get calendar")
+		return
+	}
+	if cal == nil {
+		h.respondError(w, http.StatusNotFound, "Calendar not found")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, cal)
+}
+
+// putCalendar handles PUT /v1/calendars/{name}. A calendar that doesn't
+// list its weekend gets store.DefaultWeekend.
+func (h *Handler) putCalendar(w http.ResponseWriter, r *http.Request) {
+	cal := store.BusinessCalendar{Weekend: append([]string(nil), store.DefaultWeekend...)}
+	if err := json.NewDecoder(r.Body).Decode(&cal); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	cal.Name = chi.URLParam(r, "name")
+
+	if !queueNamePattern.MatchString(cal.Name) {
+		h.respondError(w, http.StatusBadRequest, "Calendar name must be at most 255 letters, digits, '_', '.', ':' or '-'")
+		return
+	}
+	if err := cal.Validate(); err != nil {
+		h.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.queueManager.PutCalendar(r.Context(), &cal); err != nil {
+		h.logger.Printf("Failed to put calendar %s: %v", cal.Name, err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to put calendar")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, cal)
+}
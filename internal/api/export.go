@@ -0,0 +1,174 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/goquorra/goquorra/internal/store"
+)
+
+// exportPageSize is how many jobs GET /v1/export reads from the store at a time
+const exportPageSize = 500
+
+// maxImportLineBytes bounds a single NDJSON line accepted by POST /v1/import
+const maxImportLineBytes = 16 << 20
+
+// maxImportErrors caps the per-line errors reported by POST /v1/import
+const maxImportErrors = 100
+
+// exportJobs handles GET /v1/export, streaming a queue's jobs (or every job
+// if no queue is given) as newline-delimited JSON
+func (h *Handler) exportJobs(w http.ResponseWriter, r *http.Request) {
+	queueName := r.URL.Query().Get("queue")
+
+	// Read the first page before committing to a 200 so store errors can
+	// still be reported properly
+	jobs, err := h.queueManager.ExportJobs(r.Context(), queueName, "", exportPageSize)
+	if err != nil {
+		h.logger.Printf("Failed to export jobs: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to export jobs")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+
+	exported := 0
+	for len(jobs) > 0 {
+		for _, job := range jobs {
+			if err := encoder.Encode(job); err != nil {
+				h.logger.Printf("Export aborted after %d jobs: %v", exported, err)
+				return
+			}
+			exported++
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if len(jobs) < exportPageSize {
+			break
+		}
+
+		jobs, err = h.queueManager.ExportJobs(r.Context(), queueName, jobs[len(jobs)-1].ID, exportPageSize)
+		if err != nil {
+			// The status is already sent; a truncated stream is all we can signal
+			h.logger.Printf("Export aborted after %d jobs: %v", exported, err)
+			return
+		}
+	}
+
+	h.logger.Printf("Exported %d jobs (queue=%q)", exported, queueName)
+}
+
+// importJobs handles POST /v1/import, re-creating jobs from the
+// newline-delimited JSON produced by GET /v1/export
+func (h *Handler) importJobs(w http.ResponseWriter, r *http.Request) {
+	if h.maintenance.Load() {
+		h.respondError(w, http.StatusServiceUnavailable, "Server is in maintenance mode and not accepting new jobs")
+		return
+	}
+
+	var opts store.ImportOptions
+	for name, dst := range map[string]*bool{
+		"preserve_ids":    &opts.PreserveIDs,
+		"preserve_status": &opts.PreserveStatus,
+	} {
+		if v := r.URL.Query().Get(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				h.respondError(w, http.StatusBadRequest, name+" must be a boolean")
+				return
+			}
+			*dst = b
+		}
+	}
+
+	imported, skipped := 0, 0
+	lineErrors := []string{}
+	failed := 0
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxImportLineBytes)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var job store.Job
+		err := json.Unmarshal(scanner.Bytes(), &job)
+		if err == nil {
+			err = h.validateImportJob(&job, opts)
+		}
+		if err == nil {
+			_, err = h.queueManager.ImportJob(r.Context(), &job, opts)
+		}
+
+		switch {
+		case err == nil:
+			imported++
+		case errors.Is(err, store.ErrJobExists):
+			skipped++
+		default:
+			failed++
+			if len(lineErrors) < maxImportErrors {
+				lineErrors = append(lineErrors, fmt.Sprintf("line %d: %v", line, err))
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		h.respondError(w, http.StatusBadRequest, fmt.Sprintf("Failed to read import after line %d (%d jobs imported): %v", line, imported, err))
+		return
+	}
+
+	h.logger.Printf("Imported %d jobs (%d skipped as existing, %d failed)", imported, skipped, failed)
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"imported": imported,
+		"skipped":  skipped,
+		"failed":   failed,
+		"errors":   lineErrors,
+	})
+}
+
+// validateImportJob applies the checks POST /v1/jobs makes to an imported
+// job, including the API key's priority ceiling
+func (h *Handler) validateImportJob(job *store.Job, opts store.ImportOptions) error {
+	req := store.CreateJobRequest{
+		Type:               job.Type,
+		Payload:            job.Payload,
+		Queue:              job.Queue,
+		Priority:           job.Priority,
+		MaxRetries:         job.MaxRetries,
+		BackoffStrategy:    job.BackoffStrategy,
+		BackoffBaseSeconds: job.BackoffBaseSeconds,
+		BackoffCapSeconds:  job.BackoffCapSeconds,
+		BackoffSchedule:    job.BackoffSchedule,
+	}
+	if opts.PreserveIDs {
+		req.ID = job.ID
+	}
+	// System jobs belong in the reserved queue. Deadlines and run_at are
+	// left out: an exported job may well be past both.
+	if job.Kind == store.KindSystem && job.Queue == store.SystemQueue {
+		req.Queue = ""
+	}
+
+	if fe := h.validateCreateJob(&req); fe != nil {
+		return errors.New(fe.Message)
+	}
+	if _, fe := h.applyPriorityCeiling(&req); fe != nil {
+		return errors.New(fe.Message)
+	}
+
+	job.Payload = req.Payload
+	job.Priority = req.Priority
+	return nil
+}
@@ -2,12 +2,18 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/goquorra/goquorra/internal/config"
 	"github.com/goquorra/goquorra/internal/metrics"
 	"github.com/goquorra/goquorra/internal/queue"
 	"github.com/goquorra/goquorra/internal/store"
@@ -19,18 +25,29 @@ type Handler struct {
 	queueManager *queue.Manager
 	store        store.Store
 	metrics      *metrics.Collector
-	apiKey       string
+	cfg          *config.Config
 	logger       *log.Logger
+
+	// maintenance rejects new jobs while leasing and acking continue.
+	// It is process-local and resets on restart.
+	maintenance atomic.Bool
+
+	// streams is optional; without it gRPC is reported as disabled
+	streams StreamCounter
+
+	// limiter is nil when rate limiting is off
+	limiter *rateLimiter
 }
 
 // NewHandler creates a new API handler
-func NewHandler(store store.Store, queueManager *queue.Manager, metrics *metrics.Collector, apiKey string, logger *log.Logger) *Handler {
+func NewHandler(store store.Store, queueManager *queue.Manager, metrics *metrics.Collector, cfg *config.Config, logger *log.Logger) *Handler {
 	return &Handler{
 		queueManager: queueManager,
 		store:        store,
 		metrics:      metrics,
-		apiKey:       apiKey,
+		cfg:          cfg,
 		logger:       logger,
+		limiter:      newRateLimiter(cfg.RateLimitRPS),
 	}
 }
 
@@ -45,6 +62,9 @@ func (h *Handler) Router() http.Handler {
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Heartbeat("/healthz"))
 
+	r.Get("/readyz", h.readyz)
+	r.Get("/healthz/detail", h.healthDetail)
+
 	// Public routes
 	r.Get("/metrics", promhttp.Handler().ServeHTTP)
 
@@ -55,16 +75,73 @@ func (h *Handler) Router() http.Handler {
 	// API routes with authentication
 	r.Route("/v1", func(r chi.Router) {
 		r.Use(h.authMiddleware)
+		r.Use(h.rateLimitMiddleware)
 
 		// Job endpoints
-		r.Post("/jobs", h.createJob)
+		r.With(h.limitRequestBody).Post("/jobs", h.createJob)
+		r.With(h.limitRequestBody).Post("/jobs/batch", h.createJobsBatch)
+		r.Post("/jobs/get", h.getJobs)
 		r.Get("/jobs/{id}", h.getJob)
+		r.Get("/jobs/{id}/stream", h.streamJob)
+		r.Get("/jobs/{id}/attempts", h.getJobAttempts)
+		r.Post("/jobs/{id}/kill", h.killJob)
+		r.Post("/jobs/{id}/steal", h.stealJob)
+		r.Get("/leases/{leaseID}/jobs", h.getLeaseJobs)
+		r.With(h.limitRequestBody).Post("/workflows", h.createWorkflow)
+		r.Get("/workflows/{id}", h.getWorkflow)
 
 		// Queue endpoints
 		r.Get("/queues", h.getQueues)
+		r.Get("/queues/{name}", h.getQueue)
+		r.Get("/queues/{name}/config", h.getQueueConfig)
+		r.Get("/queues/{name}/history", h.getQueueHistory)
+		r.Get("/stats/sla", h.getSLAStats)
+		r.Get("/workers", h.getWorkers)
+		r.Post("/workers/{id}/drain", h.drainWorker)
+		r.Put("/queues/{name}/config", h.putQueueConfig)
+		r.Post("/queues/{name}/migrate", h.migrateQueue)
+
+		// Routing rules
+		r.Get("/routing", h.getRoutingRules)
+		r.Put("/routing", h.putRoutingRules)
+
+		// Business calendars for schedule_calendar
+		r.Get("/calendars/{name}", h.getCalendar)
+		r.Put("/calendars/{name}", h.putCalendar)
+
+		// Backup and migration
+		r.Get("/export", h.exportJobs)
+		r.Post("/import", h.importJobs)
+
+		// Job type pausing
+		r.Get("/types/paused", h.listPausedJobTypes)
+		r.Post("/types/{type}/pause", h.pauseJobType)
+		r.Post("/types/{type}/resume", h.resumeJobType)
+
+		// Fail-fast job types
+		r.Get("/types/fail-fast", h.listFailFastJobTypes)
+		r.Post("/types/{type}/fail-fast", h.setJobTypeFailFast)
+		r.Delete("/types/{type}/fail-fast", h.clearJobTypeFailFast)
+
+		// Dead-letter queue
+		r.Get("/dead", h.listDeadJobs)
+		r.Post("/dlq/replay", h.startDLQReplay)
+		r.Get("/dlq/replay/{id}", h.getDLQReplay)
 
 		// Recent jobs for dashboard
 		r.Get("/recent", h.getRecentJobs)
+
+		// Admin
+		r.Post("/admin/maintenance", h.setMaintenance)
+		r.Post("/admin/pause-all", h.pauseAll)
+		r.Post("/admin/resume-all", h.resumeAll)
+		r.Get("/admin/config", h.getEffectiveConfig)
+
+		// Test-only debugging aids
+		if h.cfg.DebugEndpoints {
+			r.Get("/debug/metrics", h.getDebugMetrics)
+			r.Post("/debug/metrics/reset", h.resetDebugMetrics)
+		}
 	})
 
 	return r
@@ -78,7 +155,7 @@ func (h *Handler) authMiddleware(next http.Handler) http.Handler {
 			apiKey = r.URL.Query().Get("api_key")
 		}
 
-		if apiKey != h.apiKey {
+		if apiKey != h.cfg.APIKey {
 			h.respondError(w, http.StatusUnauthorized, "Invalid or missing API key")
 			return
 		}
@@ -87,43 +164,91 @@ func (h *Handler) authMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// limitRequestBody caps the request body at QUORRA_MAX_REQUEST_BYTES, so an
+// oversized or endless body fails to decode instead of filling memory
+func (h *Handler) limitRequestBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, h.cfg.MaxRequestBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
 // createJob handles POST /v1/jobs
 func (h *Handler) createJob(w http.ResponseWriter, r *http.Request) {
+	if h.maintenance.Load() {
+		h.respondError(w, http.StatusServiceUnavailable, "Server is in maintenance mode and not accepting new jobs")
+		return
+	}
+
 	var req store.CreateJobRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		h.respondDecodeError(w, err)
 		return
 	}
 
-	// Validation
-	if req.Type == "" {
-		h.respondError(w, http.StatusBadRequest, "Job type is required")
+	if fe := h.validateCreateJob(&req); fe != nil {
+		h.respondFieldError(w, fe)
 		return
 	}
-	if req.Payload == nil {
-		req.Payload = make(map[string]interface{})
+	clamped, fe := h.applyPriorityCeiling(&req)
+	if fe != nil {
+		h.respondFieldError(w, fe)
+		return
 	}
-	if req.Queue == "" {
-		req.Queue = "default"
+	if req.TraceID == "" {
+		req.TraceID = r.Header.Get("X-Trace-ID")
 	}
-	if req.MaxRetries == 0 {
-		req.MaxRetries = 3
+	if req.IdempotencyKey == "" {
+		req.IdempotencyKey = r.Header.Get("Idempotency-Key")
 	}
+	req.EnqueuedBy = clientIP(r)
 
 	job, err := h.queueManager.EnqueueJob(r.Context(), &req)
+	if errors.Is(err, queue.ErrInlineDisabled) || errors.Is(err, queue.ErrNoInlineHandler) || errors.Is(err, queue.ErrInlineScheduled) {
+		h.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, store.ErrJobExists) {
+		h.respondError(w, http.StatusConflict, "Job "+req.ID+" already exists")
+		return
+	}
+	if errors.Is(err, queue.ErrInlinePaused) || errors.Is(err, queue.ErrInlineLeased) {
+		h.respondError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if errors.Is(err, store.ErrCalendarNotFound) || errors.Is(err, store.ErrInvalidUniqueBy) {
+		h.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if h.respondQueueRateLimited(w, err) {
+		return
+	}
 	if err != nil {
 		h.logger.Printf("Failed to create job: %v", err)
 		h.respondError(w, http.StatusInternalServerError, "Failed to create job")
 		return
 	}
 
-	h.metrics.JobsCreated.Inc()
+	resp := map[string]interface{}{
+		"id":           job.ID,
+		"status":       job.Status,
+		"run_at":       job.RunAt,
+		"priority":     job.Priority,
+		"deduplicated": job.Deduplicated,
+	}
+	if clamped {
+		resp["priority_clamped"] = true
+	}
+	if job.Spooled {
+		resp["spooled"] = true
+	}
+	if req.Inline && !job.Deduplicated {
+		// The job already ran; report how it went
+		resp["attempts"] = job.Attempts
+		resp["last_error"] = job.LastError
+	}
 
-	h.respondJSON(w, http.StatusCreated, map[string]interface{}{
-		"id":     job.ID,
-		"status": job.Status,
-		"run_at": job.RunAt,
-	})
+	h.respondJSON(w, http.StatusCreated, resp)
 }
 
 // getJob handles GET /v1/jobs/{id}
@@ -143,6 +268,183 @@ func (h *Handler) getJob(w http.ResponseWriter, r *http.Request) {
 	h.respondJSON(w, http.StatusOK, job)
 }
 
+// getJobAttempts handles GET /v1/jobs/{id}/attempts
+func (h *Handler) getJobAttempts(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if _, err := h.queueManager.GetJob(r.Context(), id); err != nil {
+		h.respondError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+
+	attempts, err := h.queueManager.ListJobAttempts(r.Context(), id)
+	if err != nil {
+		h.logger.Printf("Failed to list attempts for job %s: %v", id, err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to list job attempts")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"job_id":   id,
+		"attempts": attempts,
+	})
+}
+
+// getLeaseJobs handles GET /v1/leases/{leaseID}/jobs
+func (h *Handler) getLeaseJobs(w http.ResponseWriter, r *http.Request) {
+	leaseID := chi.URLParam(r, "leaseID")
+
+	jobs, err := h.queueManager.GetJobsByLeaseID(r.Context(), leaseID)
+	if err != nil {
+		h.logger.Printf("Failed to get jobs for lease %s: %v", leaseID, err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to get jobs")
+		return
+	}
+	if len(jobs) == 0 {
+		h.respondError(w, http.StatusNotFound, "Lease not found")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"lease_id": leaseID,
+		"jobs":     jobs,
+	})
+}
+
+// killJob handles POST /v1/jobs/{id}/kill
+func (h *Handler) killJob(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var req struct {
+		Operator string `json:"operator"`
+		Reason   string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Operator == "" {
+		h.respondError(w, http.StatusBadRequest, "operator is required")
+		return
+	}
+
+	job, err := h.queueManager.KillJob(r.Context(), id, req.Operator, req.Reason)
+	switch {
+	case errors.Is(err, store.ErrJobNotFound):
+		h.respondError(w, http.StatusNotFound, "Job not found")
+		return
+	case errors.Is(err, store.ErrJobFinished):
+		h.respondError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		h.logger.Printf("Failed to kill job %s: %v", id, err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to kill job")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, job)
+}
+
+// stealJob handles POST /v1/jobs/{id}/steal
+func (h *Handler) stealJob(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	job, err := h.queueManager.StealJob(r.Context(), id)
+	switch {
+	case errors.Is(err, store.ErrJobNotFound):
+		h.respondError(w, http.StatusNotFound, "Job not found")
+		return
+	case errors.Is(err, store.ErrJobNotLeased):
+		h.respondError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		h.logger.Printf("Failed to steal job %s: %v", id, err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to steal job")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, job)
+}
+
+// maxBulkGetIDs caps the number of IDs accepted by POST /v1/jobs/get
+const maxBulkGetIDs = 100
+
+// getJobs handles POST /v1/jobs/get
+func (h *Handler) getJobs(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(req.IDs) == 0 {
+		h.respondError(w, http.StatusBadRequest, "ids is required")
+		return
+	}
+	if len(req.IDs) > maxBulkGetIDs {
+		h.respondError(w, http.StatusBadRequest, fmt.Sprintf("At most %d ids may be requested at once", maxBulkGetIDs))
+		return
+	}
+
+	jobs, err := h.queueManager.GetJobs(r.Context(), req.IDs)
+	if err != nil {
+		h.logger.Printf("Failed to get jobs: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to get jobs")
+		return
+	}
+
+	notFound := []string{}
+	seen := make(map[string]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		if _, ok := jobs[id]; !ok && !seen[id] {
+			notFound = append(notFound, id)
+		}
+		seen[id] = true
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"jobs":      jobs,
+		"not_found": notFound,
+	})
+}
+
+// streamJob handles GET /v1/jobs/{id}/stream
+// It long-polls until the job's status changes or the wait times out, and
+// always responds with the job's current state.
+func (h *Handler) streamJob(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		h.respondError(w, http.StatusBadRequest, "Job ID is required")
+		return
+	}
+
+	timeout := h.cfg.LongPollMaxWait
+	if timeoutStr := r.URL.Query().Get("timeout"); timeoutStr != "" {
+		d, err := time.ParseDuration(timeoutStr)
+		if err != nil || d <= 0 {
+			h.respondError(w, http.StatusBadRequest, "Invalid timeout")
+			return
+		}
+		if d < timeout {
+			timeout = d
+		}
+	}
+
+	knownStatus := store.JobStatus(r.URL.Query().Get("status"))
+
+	job, err := h.queueManager.WaitForJobChange(r.Context(), id, knownStatus, timeout)
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+		h.respondError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, job)
+}
+
 // getQueues handles GET /v1/queues
 func (h *Handler) getQueues(w http.ResponseWriter, r *http.Request) {
 	stats, err := h.queueManager.GetQueueStats(r.Context())
@@ -157,6 +459,540 @@ func (h *Handler) getQueues(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// getQueue handles GET /v1/queues/{name}
+func (h *Handler) getQueue(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	stats, err := h.queueManager.GetQueueStats(r.Context())
+	if err != nil {
+		h.logger.Printf("Failed to get queue stats: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to get queue stats")
+		return
+	}
+
+	stuck, err := h.queueManager.CountStuckJobs(r.Context())
+	if err != nil {
+		h.logger.Printf("Failed to count stuck jobs: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to count stuck jobs")
+		return
+	}
+
+	healthyWorkers, err := h.queueManager.CountHealthyWorkers(r.Context(), name)
+	if err != nil {
+		h.logger.Printf("Failed to count healthy workers: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to count healthy workers")
+		return
+	}
+
+	healthyCapacity, err := h.queueManager.HealthyWorkerCapacity(r.Context(), name)
+	if err != nil {
+		h.logger.Printf("Failed to sum healthy worker capacity: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to sum healthy worker capacity")
+		return
+	}
+
+	retryBudget, err := h.queueManager.RetryBudgetStatus(r.Context(), name)
+	if err != nil {
+		h.logger.Printf("Failed to get retry budget: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to get retry budget")
+		return
+	}
+
+	counts := map[string]int{}
+	for _, stat := range stats {
+		if stat.Queue == name {
+			counts[stat.Status] = stat.Count
+		}
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"queue":            name,
+		"counts":           counts,
+		"stuck":            stuck[name],
+		"healthy_workers":  healthyWorkers,
+		"healthy_capacity": healthyCapacity,
+		"retry_budget":     retryBudget,
+	})
+}
+
+// getQueueHistory handles GET /v1/queues/{name}/history
+func (h *Handler) getQueueHistory(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	window := time.Hour
+	if windowStr := r.URL.Query().Get("window"); windowStr != "" {
+		d, err := time.ParseDuration(windowStr)
+		if err != nil || d <= 0 {
+			h.respondError(w, http.StatusBadRequest, "window must be a positive duration, e.g. 1h")
+			return
+		}
+		window = d
+	}
+	if window > h.cfg.StatsRetention {
+		h.respondError(w, http.StatusBadRequest, fmt.Sprintf("window must not exceed the stats retention of %v", h.cfg.StatsRetention))
+		return
+	}
+
+	points, bucket, err := h.queueManager.GetQueueStatsHistory(r.Context(), name, window)
+	if err != nil {
+		h.logger.Printf("Failed to get queue stats history: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to get queue history")
+		return
+	}
+	if points == nil {
+		points = []store.QueueStatsPoint{}
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"queue":          name,
+		"window":         window.String(),
+		"bucket_seconds": int(bucket.Seconds()),
+		"points":         points,
+	})
+}
+
+// migrateQueue handles POST /v1/queues/{name}/migrate
+func (h *Handler) migrateQueue(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	target := r.URL.Query().Get("target")
+	if target == "" || target == name {
+		h.respondError(w, http.StatusBadRequest, "target must name a different queue")
+		return
+	}
+	filter, err := store.ParseMigrateFilter(r.URL.Query().Get("status"))
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	moved, err := h.queueManager.MigrateQueue(r.Context(), name, target, filter)
+	if err != nil {
+		h.logger.Printf("Failed to migrate queue: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to migrate queue")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"queue":  name,
+		"target": target,
+		"moved":  moved,
+	})
+}
+
+// getSLAStats handles GET /v1/stats/sla
+func (h *Handler) getSLAStats(w http.ResponseWriter, r *http.Request) {
+	jobType := r.URL.Query().Get("type")
+
+	window := 24 * time.Hour
+	if windowStr := r.URL.Query().Get("window"); windowStr != "" {
+		d, err := time.ParseDuration(windowStr)
+		if err != nil || d <= 0 {
+			h.respondError(w, http.StatusBadRequest, "window must be a positive duration, e.g. 24h")
+			return
+		}
+		window = d
+	}
+
+	stats, err := h.queueManager.GetSLAStats(r.Context(), jobType, window)
+	if err != nil {
+		h.logger.Printf("Failed to get SLA stats: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to get SLA stats")
+		return
+	}
+
+	// Compliance is null rather than 0 or 100 when there's nothing to measure
+	var compliance *float64
+	if total := stats.Met + stats.Missed; total > 0 {
+		percent := 100 * float64(stats.Met) / float64(total)
+		compliance = &percent
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"type":               jobType,
+		"window":             window.String(),
+		"met":                stats.Met,
+		"missed":             stats.Missed,
+		"total":              stats.Met + stats.Missed,
+		"compliance_percent": compliance,
+	})
+}
+
+// topLeasersLimit is how many of the busiest workers GET /v1/workers lists
+const topLeasersLimit = 10
+
+// getWorkers handles GET /v1/workers
+func (h *Handler) getWorkers(w http.ResponseWriter, r *http.Request) {
+	workers, err := h.queueManager.ListWorkers(r.Context())
+	if err != nil {
+		h.logger.Printf("Failed to list workers: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to list workers")
+		return
+	}
+
+	totalCapacity := 0
+	for _, worker := range workers {
+		totalCapacity += worker.Weight
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"workers":        workers,
+		"total_capacity": totalCapacity,
+		"top_leasers":    h.metrics.TopLeasers(topLeasersLimit),
+	})
+}
+
+// drainWorker handles POST /v1/workers/{id}/drain
+func (h *Handler) drainWorker(w http.ResponseWriter, r *http.Request) {
+	workerID := chi.URLParam(r, "id")
+
+	requestedAt, err := h.queueManager.DrainWorker(r.Context(), workerID)
+	if err != nil {
+		h.logger.Printf("Failed to drain worker %s: %v", workerID, err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to drain worker")
+		return
+	}
+
+	h.respondJSON(w, http.StatusAccepted, map[string]interface{}{
+		"worker_id":    workerID,
+		"requested_at": requestedAt,
+	})
+}
+
+// getQueueConfig handles GET /v1/queues/{name}/config
+func (h *Handler) getQueueConfig(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	cfg, err := h.queueManager.GetQueueConfig(r.Context(), name)
+	if err != nil {
+		h.logger.Printf("Failed to get queue config: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to get queue config")
+		return
+	}
+	if cfg == nil {
+		// Unconfigured queues use the server-wide defaults
+		cfg = &store.QueueConfig{Queue: name}
+	}
+
+	h.respondJSON(w, http.StatusOK, cfg)
+}
+
+// putQueueConfig handles PUT /v1/queues/{name}/config
+func (h *Handler) putQueueConfig(w http.ResponseWriter, r *http.Request) {
+	var cfg store.QueueConfig
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	cfg.Queue = chi.URLParam(r, "name")
+
+	if cfg.MaxRetries < 0 {
+		h.respondError(w, http.StatusBadRequest, "max_retries must not be negative")
+		return
+	}
+	if cfg.MinWorkers < 0 {
+		h.respondError(w, http.StatusBadRequest, "min_workers must not be negative")
+		return
+	}
+	if cfg.RetryBudgetPercent < 0 || cfg.RetryBudgetPercent > 100 {
+		h.respondError(w, http.StatusBadRequest, "retry_budget_percent must be between 0 and 100")
+		return
+	}
+	switch cfg.Scheduling {
+	case "", store.SchedulingPriority, store.SchedulingEDF:
+	default:
+		h.respondError(w, http.StatusBadRequest, "scheduling must be priority or edf")
+		return
+	}
+	if err := validateRetryPolicy(string(cfg.BackoffStrategy), cfg.BackoffBaseSeconds, cfg.BackoffCapSeconds); err != nil {
+		h.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.queueManager.SetQueueConfig(r.Context(), &cfg); err != nil {
+		h.logger.Printf("Failed to set queue config: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to set queue config")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, cfg)
+}
+
+// getRoutingRules handles GET /v1/routing
+func (h *Handler) getRoutingRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.queueManager.ListRoutingRules(r.Context())
+	if err != nil {
+		h.logger.Printf("Failed to list routing rules: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to list routing rules")
+		return
+	}
+	if rules == nil {
+		rules = []*store.RoutingRule{}
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"rules": rules,
+	})
+}
+
+// putRoutingRules handles PUT /v1/routing, replacing all rules
+func (h *Handler) putRoutingRules(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Rules []*store.RoutingRule `json:"rules"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Rules == nil {
+		req.Rules = []*store.RoutingRule{}
+	}
+
+	seen := make(map[string]bool, len(req.Rules))
+	for _, rule := range req.Rules {
+		if rule == nil {
+			h.respondError(w, http.StatusBadRequest, "Routing rules must not be null")
+			return
+		}
+		if err := rule.Validate(); err != nil {
+			h.respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if seen[rule.TypePattern] {
+			h.respondError(w, http.StatusBadRequest, "Duplicate routing rule for type "+rule.TypePattern)
+			return
+		}
+		seen[rule.TypePattern] = true
+	}
+
+	if err := h.queueManager.SetRoutingRules(r.Context(), req.Rules); err != nil {
+		h.logger.Printf("Failed to set routing rules: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to set routing rules")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"rules": req.Rules,
+	})
+}
+
+// listPausedJobTypes handles GET /v1/types/paused
+func (h *Handler) listPausedJobTypes(w http.ResponseWriter, r *http.Request) {
+	types, err := h.queueManager.ListPausedJobTypes(r.Context())
+	if err != nil {
+		h.logger.Printf("Failed to list paused job types: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to list paused job types")
+		return
+	}
+	if types == nil {
+		types = []*store.PausedJobType{}
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"types": types,
+	})
+}
+
+// pauseJobType handles POST /v1/types/{type}/pause
+func (h *Handler) pauseJobType(w http.ResponseWriter, r *http.Request) {
+	jobType := chi.URLParam(r, "type")
+	if jobType == "" {
+		h.respondError(w, http.StatusBadRequest, "Job type is required")
+		return
+	}
+
+	paused, err := h.queueManager.PauseJobType(r.Context(), jobType)
+	if err != nil {
+		h.logger.Printf("Failed to pause job type: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to pause job type")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, paused)
+}
+
+// resumeJobType handles POST /v1/types/{type}/resume
+func (h *Handler) resumeJobType(w http.ResponseWriter, r *http.Request) {
+	jobType := chi.URLParam(r, "type")
+	if jobType == "" {
+		h.respondError(w, http.StatusBadRequest, "Job type is required")
+		return
+	}
+
+	resumed, err := h.queueManager.ResumeJobType(r.Context(), jobType)
+	if err != nil {
+		h.logger.Printf("Failed to resume job type: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to resume job type")
+		return
+	}
+	if !resumed {
+		h.respondError(w, http.StatusNotFound, "Job type "+jobType+" is not paused")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"type":   jobType,
+		"paused": false,
+	})
+}
+
+// listFailFastJobTypes handles GET /v1/types/fail-fast
+func (h *Handler) listFailFastJobTypes(w http.ResponseWriter, r *http.Request) {
+	types, err := h.queueManager.ListFailFastJobTypes(r.Context())
+	if err != nil {
+		h.logger.Printf("Failed to list fail-fast job types: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to list fail-fast job types")
+		return
+	}
+	if types == nil {
+		types = []*store.FailFastJobType{}
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"types": types,
+	})
+}
+
+// setJobTypeFailFast handles POST /v1/types/{type}/fail-fast
+func (h *Handler) setJobTypeFailFast(w http.ResponseWriter, r *http.Request) {
+	jobType := chi.URLParam(r, "type")
+	if jobType == "" {
+		h.respondError(w, http.StatusBadRequest, "Job type is required")
+		return
+	}
+
+	failFast, err := h.queueManager.SetJobTypeFailFast(r.Context(), jobType)
+	if err != nil {
+		h.logger.Printf("Failed to set job type fail-fast: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to set job type fail-fast")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, failFast)
+}
+
+// clearJobTypeFailFast handles DELETE /v1/types/{type}/fail-fast
+func (h *Handler) clearJobTypeFailFast(w http.ResponseWriter, r *http.Request) {
+	jobType := chi.URLParam(r, "type")
+	if jobType == "" {
+		h.respondError(w, http.StatusBadRequest, "Job type is required")
+		return
+	}
+
+	cleared, err := h.queueManager.ClearJobTypeFailFast(r.Context(), jobType)
+	if err != nil {
+		h.logger.Printf("Failed to clear job type fail-fast: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to clear job type fail-fast")
+		return
+	}
+	if !cleared {
+		h.respondError(w, http.StatusNotFound, "Job type "+jobType+" is not fail-fast")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"type":      jobType,
+		"fail_fast": false,
+	})
+}
+
+// validateRetryPolicy checks backoff settings from a queue config
+func validateRetryPolicy(strategy string, baseSeconds, capSeconds int) error {
+	if _, err := store.ParseBackoffStrategy(strategy); err != nil {
+		return err
+	}
+	if baseSeconds < 0 || capSeconds < 0 {
+		return fmt.Errorf("backoff_base_seconds and backoff_cap_seconds must not be negative")
+	}
+	return nil
+}
+
+// listDeadJobs handles GET /v1/dead
+func (h *Handler) listDeadJobs(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 1000 {
+			limit = l
+		}
+	}
+
+	queue := r.URL.Query().Get("queue")
+	reason := store.DeadReason(r.URL.Query().Get("reason"))
+	view, err := h.listPayloadView(r)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	jobs, err := h.queueManager.ListDeadJobs(r.Context(), queue, reason, limit)
+	if err == nil {
+		jobs, err = store.ApplyPayloadView(jobs, view, h.cfg.ListPayloadBytes)
+	}
+	if err != nil {
+		h.logger.Printf("Failed to list dead jobs: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to list dead jobs")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"jobs": jobs,
+	})
+}
+
+// startDLQReplay handles POST /v1/dlq/replay
+func (h *Handler) startDLQReplay(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		store.DeadJobFilter
+		JobsPerSecond int `json:"jobs_per_second"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.JobsPerSecond == 0 {
+		req.JobsPerSecond = 50
+	}
+	if req.JobsPerSecond < 1 || req.JobsPerSecond > 10000 {
+		h.respondError(w, http.StatusBadRequest, "jobs_per_second must be between 1 and 10000")
+		return
+	}
+	if req.DeadAfter != nil && req.DeadBefore != nil && !req.DeadAfter.Before(*req.DeadBefore) {
+		h.respondError(w, http.StatusBadRequest, "dead_after must be before dead_before")
+		return
+	}
+
+	replay, err := h.queueManager.StartReplay(r.Context(), req.DeadJobFilter, req.JobsPerSecond)
+	if err != nil {
+		h.logger.Printf("Failed to start dead-letter replay: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to start replay")
+		return
+	}
+
+	h.respondJSON(w, http.StatusAccepted, replay)
+}
+
+// getDLQReplay handles GET /v1/dlq/replay/{id}
+func (h *Handler) getDLQReplay(w http.ResponseWriter, r *http.Request) {
+	replay := h.queueManager.GetReplay(chi.URLParam(r, "id"))
+	if replay == nil {
+		h.respondError(w, http.StatusNotFound, "Replay not found")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, replay)
+}
+
+// listPayloadView reads a job list request's payload parameter, defaulting
+// to the server's QUORRA_LIST_PAYLOAD
+func (h *Handler) listPayloadView(r *http.Request) (store.PayloadView, error) {
+	view := r.URL.Query().Get("payload")
+	if view == "" {
+		view = h.cfg.ListPayloadView
+	}
+	return store.ParsePayloadView(view)
+}
+
 // getRecentJobs handles GET /v1/recent
 func (h *Handler) getRecentJobs(w http.ResponseWriter, r *http.Request) {
 	limit := 50
@@ -166,7 +1002,31 @@ func (h *Handler) getRecentJobs(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	jobs, err := h.queueManager.GetRecentJobs(r.Context(), limit)
+	kind := store.JobKind(r.URL.Query().Get("kind"))
+	if kind != "" && kind != store.KindUser && kind != store.KindSystem {
+		h.respondError(w, http.StatusBadRequest, "kind must be user or system")
+		return
+	}
+	view, err := h.listPayloadView(r)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Has("created_after") || query.Has("created_before") || query.Has("cursor") {
+		if kind != "" {
+			h.respondError(w, http.StatusBadRequest, "kind can't be combined with created_after, created_before or cursor")
+			return
+		}
+		h.getJobsByTimeRange(w, r, limit, view)
+		return
+	}
+
+	jobs, err := h.queueManager.GetRecentJobs(r.Context(), kind, limit)
+	if err == nil {
+		jobs, err = store.ApplyPayloadView(jobs, view, h.cfg.ListPayloadBytes)
+	}
 	if err != nil {
 		h.logger.Printf("Failed to get recent jobs: %v", err)
 		h.respondError(w, http.StatusInternalServerError, "Failed to get recent jobs")
@@ -178,6 +1038,142 @@ func (h *Handler) getRecentJobs(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// getJobsByTimeRange serves GET /v1/recent with created_after or
+// created_before, paging with an opaque cursor instead of an offset
+func (h *Handler) getJobsByTimeRange(w http.ResponseWriter, r *http.Request, limit int, view store.PayloadView) {
+	var bounds [2]time.Time
+	for i, name := range []string{"created_after", "created_before"} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			h.respondError(w, http.StatusBadRequest, name+" must be an RFC 3339 timestamp")
+			return
+		}
+		bounds[i] = t
+	}
+	from, to := bounds[0], bounds[1]
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		h.respondError(w, http.StatusBadRequest, "created_after must be before created_before")
+		return
+	}
+
+	var after *store.JobCursor
+	if token := r.URL.Query().Get("cursor"); token != "" {
+		cursor, err := store.ParseJobCursor(token)
+		if err != nil {
+			h.respondError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		after = cursor
+	}
+
+	jobs, err := h.queueManager.GetJobsByTimeRange(r.Context(), from, to, after, limit)
+	if err != nil {
+		h.logger.Printf("Failed to get jobs by time range: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to get jobs")
+		return
+	}
+
+	resp := map[string]interface{}{}
+	if len(jobs) == limit {
+		last := jobs[len(jobs)-1]
+		resp["next_cursor"] = store.JobCursor{CreatedAt: last.CreatedAt, ID: last.ID}.String()
+	}
+	if jobs, err = store.ApplyPayloadView(jobs, view, h.cfg.ListPayloadBytes); err != nil {
+		h.logger.Printf("Failed to get jobs by time range: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to get jobs")
+		return
+	}
+	resp["jobs"] = jobs
+	h.respondJSON(w, http.StatusOK, resp)
+}
+
+// setMaintenance handles POST /v1/admin/maintenance
+func (h *Handler) setMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		h.respondError(w, http.StatusBadRequest, "Request body must be {\"enabled\": true|false}")
+		return
+	}
+
+	if h.maintenance.Swap(*req.Enabled) != *req.Enabled {
+		h.logger.Printf("Maintenance mode set to %t", *req.Enabled)
+	}
+	h.metrics.SetMaintenanceMode(*req.Enabled)
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"maintenance": *req.Enabled,
+	})
+}
+
+// pauseAll handles POST /v1/admin/pause-all
+func (h *Handler) pauseAll(w http.ResponseWriter, r *http.Request) {
+	pause, err := h.queueManager.PauseDispatch(r.Context())
+	if err != nil {
+		h.logger.Printf("Failed to pause dispatch: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to pause dispatch")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"paused":    true,
+		"paused_at": pause.PausedAt,
+	})
+}
+
+// resumeAll handles POST /v1/admin/resume-all
+func (h *Handler) resumeAll(w http.ResponseWriter, r *http.Request) {
+	resumed, err := h.queueManager.ResumeDispatch(r.Context())
+	if err != nil {
+		h.logger.Printf("Failed to resume dispatch: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to resume dispatch")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"paused":     false,
+		"was_paused": resumed,
+	})
+}
+
+// getEffectiveConfig handles GET /v1/admin/config
+func (h *Handler) getEffectiveConfig(w http.ResponseWriter, r *http.Request) {
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"settings": h.cfg.EffectiveSettings(),
+	})
+}
+
+// readyz handles GET /readyz. Maintenance mode and the dispatch pause are
+// reported but don't make the server unready: workers must keep leasing to
+// drain the backlog, and a paused server should stay in rotation to resume.
+func (h *Handler) readyz(w http.ResponseWriter, r *http.Request) {
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"status":          "ready",
+		"maintenance":     h.maintenance.Load(),
+		"dispatch_paused": h.queueManager.DispatchPaused(),
+	})
+}
+
+// getDebugMetrics handles GET /v1/debug/metrics
+func (h *Handler) getDebugMetrics(w http.ResponseWriter, r *http.Request) {
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"counters": h.metrics.Snapshot(),
+	})
+}
+
+// resetDebugMetrics handles POST /v1/debug/metrics/reset
+func (h *Handler) resetDebugMetrics(w http.ResponseWriter, r *http.Request) {
+	h.metrics.Reset()
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"reset": true,
+	})
+}
+
 // serveDashboard serves the web dashboard
 func (h *Handler) serveDashboard(w http.ResponseWriter, r *http.Request) {
 	html := `<!DOCTYPE html>
@@ -202,6 +1198,7 @@ func (h *Handler) serveDashboard(w http.ResponseWriter, r *http.Request) {
         .status-succeeded { color: #27ae60; }
         .status-failed { color: #e74c3c; }
         .status-dead { color: #c0392b; }
+        .status-expired { color: #95a5a6; }
         table { width: 100%; background: white; border-radius: 8px; overflow: hidden; box-shadow: 0 1px 3px rgba(0,0,0,0.1); }
         th, td { padding: 1rem; text-align: left; border-bottom: 1px solid #ecf0f1; }
         th { background: #34495e; color: white; font-weight: 600; }
@@ -215,6 +1212,8 @@ func (h *Handler) serveDashboard(w http.ResponseWriter, r *http.Request) {
         .code { font-family: 'Courier New', monospace; background: #ecf0f1; padding: 0.25rem 0.5rem; border-radius: 3px; font-size: 0.85rem; }
         .refresh { float: right; background: #3498db; color: white; border: none; padding: 0.5rem 1rem; border-radius: 4px; cursor: pointer; }
         .refresh:hover { background: #2980b9; }
+        .trend { display: block; width: 100%; height: 40px; margin-top: 0.75rem; }
+        .trend polyline { fill: none; stroke: #f39c12; stroke-width: 2; }
     </style>
 </head>
 <body>
@@ -248,7 +1247,7 @@ func (h *Handler) serveDashboard(w http.ResponseWriter, r *http.Request) {
             try {
                 const [queuesRes, jobsRes] = await Promise.all([
                     fetch('/v1/queues?api_key=dev-api-key-change-in-production'),
-                    fetch('/v1/recent?limit=20&api_key=dev-api-key-change-in-production')
+                    fetch('/v1/recent?limit=20&kind=user&payload=truncated&api_key=dev-api-key-change-in-production')
                 ]);
 
                 const queues = await queuesRes.json();
@@ -278,10 +1277,30 @@ func (h *Handler) serveDashboard(w http.ResponseWriter, r *http.Request) {
                     html += '<span class="status-' + status + '">' + status + '</span>: ' + count;
                     html += '</div>';
                 }
-                html += '</div></div>';
+                html += '</div>';
+                html += '<svg class="trend" viewBox="0 0 100 40" preserveAspectRatio="none" data-queue="' + queue + '"><title>pending, last hour</title></svg>';
+                html += '</div>';
             }
 
             document.getElementById('stats').innerHTML = html || '<div class="card">No queue data available</div>';
+            document.querySelectorAll('.trend').forEach(loadTrend);
+        }
+
+        // loadTrend draws a queue's pending depth over the last hour
+        async function loadTrend(svg) {
+            try {
+                const res = await fetch('/v1/queues/' + encodeURIComponent(svg.dataset.queue) + '/history?window=1h&api_key=dev-api-key-change-in-production');
+                const history = await res.json();
+                const depths = (history.points || []).map(p => p.counts.pending || 0);
+                if (depths.length < 2) return;
+
+                const max = Math.max(...depths, 1);
+                const points = depths.map((d, i) =>
+                    (i * 100 / (depths.length - 1)).toFixed(1) + ',' + (38 - d * 36 / max).toFixed(1)).join(' ');
+                svg.insertAdjacentHTML('beforeend', '<polyline points="' + points + '"/>');
+            } catch (err) {
+                console.error('Failed to load trend:', err);
+            }
         }
 
         function renderJobs(jobs) {
@@ -315,6 +1334,15 @@ func (h *Handler) serveDashboard(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(html))
 }
 
+// clientIP returns the caller's address without its port. RemoteAddr
+// already reflects X-Forwarded-For via the RealIP middleware.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
 // respondJSON sends a JSON response
 func (h *Handler) respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -326,3 +1354,15 @@ func (h *Handler) respondJSON(w http.ResponseWriter, status int, data interface{
 func (h *Handler) respondError(w http.ResponseWriter, status int, message string) {
 	h.respondJSON(w, status, map[string]string{"error": message})
 }
+
+// respondDecodeError rejects a request body that failed to decode: 413 if
+// it was cut off by limitRequestBody, otherwise 400
+func (h *Handler) respondDecodeError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		h.respondError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf(
+			"Request body exceeds %d bytes (QUORRA_MAX_REQUEST_BYTES)", tooLarge.Limit))
+		return
+	}
+	h.respondError(w, http.StatusBadRequest, "Invalid request body")
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/goquorra/goquorra/internal/queue"
+)
+
+// Subsystem health states reported by GET /healthz/detail
+const (
+	healthOK       = "ok"
+	healthDegraded = "degraded"
+	healthDisabled = "disabled"
+)
+
+// healthCheckTimeout bounds each dependency ping
+const healthCheckTimeout = 2 * time.Second
+
+// StreamCounter reports the number of open worker lease streams
+type StreamCounter interface {
+	ActiveStreams() int64
+}
+
+// SetStreamCounter lets the detailed health check report gRPC stream counts
+func (h *Handler) SetStreamCounter(counter StreamCounter) {
+	h.streams = counter
+}
+
+// subsystemHealth is one entry of the detailed health report
+type subsystemHealth struct {
+	Status        string     `json:"status"`
+	Error         string     `json:"error,omitempty"`
+	LatencyMs     *float64   `json:"latency_ms,omitempty"`
+	LastTick      *time.Time `json:"last_tick,omitempty"`
+	ActiveStreams *int64     `json:"active_streams,omitempty"`
+}
+
+// healthDetail handles GET /healthz/detail. It responds 503 if any
+// subsystem is degraded.
+func (h *Handler) healthDetail(w http.ResponseWriter, r *http.Request) {
+	subsystems := map[string]subsystemHealth{
+		"database":  h.checkDatabase(r.Context()),
+		"redis":     h.checkRedis(r.Context()),
+		"scheduler": h.checkScheduler(),
+		"grpc":      h.checkGRPC(),
+	}
+
+	status := healthOK
+	for _, sub := range subsystems {
+		if sub.Status == healthDegraded {
+			status = healthDegraded
+		}
+	}
+
+	code := http.StatusOK
+	if status != healthOK {
+		code = http.StatusServiceUnavailable
+	}
+
+	h.respondJSON(w, code, map[string]interface{}{
+		"status":     status,
+		"subsystems": subsystems,
+	})
+}
+
+func (h *Handler) checkDatabase(ctx context.Context) subsystemHealth {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := h.store.Ping(ctx)
+	latency := float64(time.Since(start).Microseconds()) / 1000
+
+	if err != nil {
+		return subsystemHealth{Status: healthDegraded, Error: err.Error(), LatencyMs: &latency}
+	}
+	return subsystemHealth{Status: healthOK, LatencyMs: &latency}
+}
+
+func (h *Handler) checkRedis(ctx context.Context) subsystemHealth {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	configured, err := h.queueManager.PingRedis(ctx)
+	latency := float64(time.Since(start).Microseconds()) / 1000
+
+	switch {
+	case !configured:
+		return subsystemHealth{Status: healthDisabled}
+	case err != nil:
+		return subsystemHealth{Status: healthDegraded, Error: err.Error(), LatencyMs: &latency}
+	}
+	return subsystemHealth{Status: healthOK, LatencyMs: &latency}
+}
+
+// checkScheduler reports the scheduler degraded once it misses a few ticks
+func (h *Handler) checkScheduler() subsystemHealth {
+	lastTick := h.queueManager.LastSchedulerTick()
+	if lastTick.IsZero() {
+		return subsystemHealth{Status: healthDegraded, Error: "scheduler not running"}
+	}
+
+	result := subsystemHealth{Status: healthOK, LastTick: &lastTick}
+	if time.Since(lastTick) > 3*queue.SchedulerInterval {
+		result.Status = healthDegraded
+		result.Error = "scheduler has not ticked since " + lastTick.UTC().Format(time.RFC3339)
+	}
+	return result
+}
+
+func (h *Handler) checkGRPC() subsystemHealth {
+	if h.streams == nil {
+		return subsystemHealth{Status: healthDisabled}
+	}
+	active := h.streams.ActiveStreams()
+	return subsystemHealth{Status: healthOK, ActiveStreams: &active}
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/goquorra/goquorra/internal/queue"
+)
+
+// rateLimiter holds the server-wide request limit. Queue limits are applied
+// by the queue manager per job, so they cover every way of enqueueing.
+type rateLimiter struct {
+	global *queue.TokenBucket
+	rps    float64
+}
+
+// newRateLimiter returns nil if rps is zero
+func newRateLimiter(rps float64) *rateLimiter {
+	if rps <= 0 {
+		return nil
+	}
+	return &rateLimiter{global: queue.NewTokenBucket(rps), rps: rps}
+}
+
+// rateLimitMiddleware rejects requests over the server-wide limit with 429
+func (h *Handler) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.limiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if ok, wait := h.limiter.global.Take(time.Now(), 1); !ok {
+			h.respondRateLimited(w, "global", h.limiter.rps, wait)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// respondRateLimited sends a 429 naming the limit that was hit
+func (h *Handler) respondRateLimited(w http.ResponseWriter, name string, rps float64, wait time.Duration) {
+	w.Header().Set("Retry-After", retryAfterSeconds(wait))
+	h.respondJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+		"error": fmt.Sprintf("Rate limit exceeded for %s", name),
+		"limit": name,
+		"rps":   rps,
+	})
+}
+
+// respondQueueRateLimited sends a 429 for an enqueue over its queue's limit.
+// It reports false if err isn't a queue rate limit error.
+func (h *Handler) respondQueueRateLimited(w http.ResponseWriter, err error) bool {
+	var rle *queue.QueueRateLimitError
+	if !errors.As(err, &rle) {
+		return false
+	}
+	h.respondRateLimited(w, "queue:"+rle.Queue, rle.RPS, rle.RetryAfter)
+	return true
+}
+
+// retryAfterSeconds formats wait for a Retry-After header, rounding up
+func retryAfterSeconds(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
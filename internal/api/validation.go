@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/goquorra/goquorra/internal/store"
+)
+
+// Validation error codes reported alongside the offending field
+const (
+	codeRequired      = "required"
+	codeInvalid       = "invalid"
+	codeReserved      = "reserved"
+	codeTooLarge      = "too_large"
+	codeTooComplex    = "too_complex"
+	codeForbidden     = "forbidden"
+	codeAlreadyExists = "already_exists"
+	codeRateLimited   = "rate_limited"
+	codeInternal      = "internal"
+)
+
+// queueNamePattern limits queue names to characters that are safe in URLs,
+// metric labels and Redis channel names
+var queueNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,255}$`)
+
+// fieldError is a structured validation error: the request field at fault,
+// a stable machine-readable code and a human-readable message. Batch
+// responses set Index to the position of the offending job.
+type fieldError struct {
+	Index   *int   `json:"index,omitempty"`
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+
+	status int
+}
+
+func newFieldError(status int, field, code, message string) *fieldError {
+	return &fieldError{Field: field, Code: code, Message: message, status: status}
+}
+
+// at returns a copy of e reported against the batch item at index
+func (e *fieldError) at(index int) fieldError {
+	item := *e
+	item.Index = &index
+	return item
+}
+
+// respondFieldError sends a single validation error, keeping the plain
+// "error" message for clients that don't read the structured fields
+func (h *Handler) respondFieldError(w http.ResponseWriter, e *fieldError) {
+	h.respondJSON(w, e.status, map[string]string{
+		"error":   e.Message,
+		"field":   e.Field,
+		"code":    e.Code,
+		"message": e.Message,
+	})
+}
+
+// validateCreateJob checks a create request and fills in its defaults,
+// returning the first problem found
+func (h *Handler) validateCreateJob(req *store.CreateJobRequest) *fieldError {
+	if req.Type == "" {
+		return newFieldError(http.StatusBadRequest, "type", codeRequired, "Job type is required")
+	}
+	if req.Payload == nil {
+		req.Payload = make(map[string]interface{})
+	}
+	if req.Queue == "" {
+		req.Queue = "default"
+	}
+	if req.Queue == store.SystemQueue {
+		return newFieldError(http.StatusBadRequest, "queue", codeReserved, "Queue "+store.SystemQueue+" is reserved for system jobs")
+	}
+	if !queueNamePattern.MatchString(req.Queue) {
+		return newFieldError(http.StatusBadRequest, "queue", codeInvalid, fmt.Sprintf(
+			"Queue name %q must be at most 255 letters, digits, '_', '.', ':' or '-'", req.Queue))
+	}
+	if req.MaxRetries < 0 {
+		return newFieldError(http.StatusBadRequest, "max_retries", codeInvalid, "max_retries must not be negative")
+	}
+	if req.DelayMs < 0 {
+		return newFieldError(http.StatusBadRequest, "delay_ms", codeInvalid, "delay_ms must not be negative")
+	}
+	if req.DelayMs > 0 && req.DelaySeconds > 0 {
+		return newFieldError(http.StatusBadRequest, "delay_ms", codeInvalid, "delay_ms and delay_seconds are mutually exclusive")
+	}
+	if req.RunAt != nil && (req.DelayMs > 0 || req.DelaySeconds > 0) {
+		return newFieldError(http.StatusBadRequest, "run_at", codeInvalid, "run_at can't be combined with delay_seconds or delay_ms")
+	}
+	if req.Deadline != nil && !req.Deadline.After(time.Now()) {
+		return newFieldError(http.StatusBadRequest, "deadline", codeInvalid, "deadline must be in the future")
+	}
+	if req.ID != "" {
+		if err := store.ValidateJobID(req.ID); err != nil {
+			return newFieldError(http.StatusBadRequest, "id", codeInvalid, err.Error())
+		}
+	}
+	if _, err := store.ParseBackoffStrategy(string(req.BackoffStrategy)); err != nil {
+		return newFieldError(http.StatusBadRequest, "backoff_strategy", codeInvalid, err.Error())
+	}
+	if req.BackoffBaseSeconds < 0 {
+		return newFieldError(http.StatusBadRequest, "backoff_base_seconds", codeInvalid, "backoff_base_seconds must not be negative")
+	}
+	if req.BackoffCapSeconds < 0 {
+		return newFieldError(http.StatusBadRequest, "backoff_cap_seconds", codeInvalid, "backoff_cap_seconds must not be negative")
+	}
+	if err := store.ValidateBackoffSchedule(req.BackoffSchedule); err != nil {
+		return newFieldError(http.StatusBadRequest, "backoff_schedule", codeInvalid, err.Error())
+	}
+	if fe := h.validatePayloadShape(req.Payload); fe != nil {
+		return fe
+	}
+	if payloadJSON, err := json.Marshal(req.Payload); err != nil {
+		return newFieldError(http.StatusBadRequest, "payload", codeInvalid, "Invalid payload")
+	} else if len(payloadJSON) > h.cfg.MaxPayloadBytes() {
+		return newFieldError(http.StatusRequestEntityTooLarge, "payload", codeTooLarge, fmt.Sprintf(
+			"Payload is %d bytes; at most %d fit in a gRPC message to workers (QUORRA_GRPC_MAX_MSG_BYTES=%d)",
+			len(payloadJSON), h.cfg.MaxPayloadBytes(), h.cfg.GRPCMaxMsgBytes))
+	}
+	if req.SingletonKey != "" && !req.EnqueueIfAbsent {
+		return newFieldError(http.StatusBadRequest, "singleton_key", codeInvalid, "singleton_key requires enqueue_if_absent")
+	}
+	if err := store.ValidateUniqueBy(req.UniqueBy); err != nil {
+		return newFieldError(http.StatusBadRequest, "unique_by", codeInvalid, err.Error())
+	}
+	return nil
+}
+
+// validatePayloadShape rejects payloads nested deeper or holding more keys
+// than the configured limits
+func (h *Handler) validatePayloadShape(payload map[string]interface{}) *fieldError {
+	shape := store.MeasurePayload(payload)
+	if limit := h.cfg.MaxPayloadDepth; limit > 0 && shape.Depth > limit {
+		return newFieldError(http.StatusBadRequest, "payload", codeTooComplex, fmt.Sprintf(
+			"Payload is nested %d levels deep; at most %d are allowed (QUORRA_MAX_PAYLOAD_DEPTH)", shape.Depth, limit))
+	}
+	if limit := h.cfg.MaxPayloadKeys; limit > 0 && shape.Keys > limit {
+		return newFieldError(http.StatusBadRequest, "payload", codeTooComplex, fmt.Sprintf(
+			"Payload has %d object keys; at most %d are allowed (QUORRA_MAX_PAYLOAD_KEYS)", shape.Keys, limit))
+	}
+	return nil
+}
+
+// applyPriorityCeiling enforces the API key's priority ceiling, clamping
+// the request's priority or rejecting it depending on the ceiling mode
+func (h *Handler) applyPriorityCeiling(req *store.CreateJobRequest) (clamped bool, fe *fieldError) {
+	ceiling, ok, _ := h.cfg.PriorityCeiling()
+	if !ok || req.Priority <= ceiling {
+		return false, nil
+	}
+	if h.cfg.PriorityCeilingMode == "reject" {
+		h.logger.Printf("Rejected %s job with priority %d above the API key's ceiling of %d", req.Type, req.Priority, ceiling)
+		return false, newFieldError(http.StatusForbidden, "priority", codeForbidden,
+			fmt.Sprintf("priority %d exceeds this API key's maximum of %d", req.Priority, ceiling))
+	}
+	h.logger.Printf("Warning: clamping %s job priority %d to the API key's ceiling of %d", req.Type, req.Priority, ceiling)
+	req.Priority = ceiling
+	return true, nil
+}
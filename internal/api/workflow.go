@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/goquorra/goquorra/internal/store"
+)
+
+// createWorkflow handles POST /v1/workflows. Every node's job is validated
+// like a job in POST /v1/jobs/batch, with failures reported by node index,
+// before the workflow's structure is checked and anything is created.
+func (h *Handler) createWorkflow(w http.ResponseWriter, r *http.Request) {
+	if h.maintenance.Load() {
+		h.respondError(w, http.StatusServiceUnavailable, "Server is in maintenance mode and not accepting new jobs")
+		return
+	}
+
+	var req store.CreateWorkflowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	validationErrors := []fieldError{}
+	for i := range req.Nodes {
+		job := &req.Nodes[i].Job
+		fe := h.validateCreateJob(job)
+		if fe == nil {
+			_, fe = h.applyPriorityCeiling(job)
+		}
+		if fe != nil {
+			fe.Field = "job." + fe.Field
+			validationErrors = append(validationErrors, fe.at(i))
+			continue
+		}
+		if job.TraceID == "" {
+			job.TraceID = r.Header.Get("X-Trace-ID")
+		}
+		job.EnqueuedBy = clientIP(r)
+	}
+	if len(validationErrors) > 0 {
+		h.respondJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":  fmt.Sprintf("%d of %d nodes failed validation; the workflow was not created", len(validationErrors), len(req.Nodes)),
+			"errors": validationErrors,
+		})
+		return
+	}
+
+	wf, err := h.queueManager.CreateWorkflow(r.Context(), &req)
+	switch {
+	case errors.Is(err, store.ErrInvalidWorkflow):
+		h.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, store.ErrJobExists):
+		h.respondError(w, http.StatusConflict, err.Error())
+		return
+	case h.respondQueueRateLimited(w, err):
+		return
+	case err != nil:
+		h.logger.Printf("Failed to create workflow: %v", err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to create workflow")
+		return
+	}
+
+	h.respondJSON(w, http.StatusCreated, wf)
+}
+
+// getWorkflow handles GET /v1/workflows/{id}
+func (h *Handler) getWorkflow(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	wf, err := h.queueManager.GetWorkflow(r.Context(), id)
+	switch {
+	case errors.Is(err, store.ErrWorkflowNotFound):
+		h.respondError(w, http.StatusNotFound, "Workflow not found")
+		return
+	case err != nil:
+		h.logger.Printf("Failed to get workflow %s: %v", id, err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to get workflow")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, wf)
+}
@@ -0,0 +1,64 @@
+package config
+
+import "net/url"
+
+// Setting is how Load resolved one environment variable. Value is what took
+// effect; Default is set when the variable was unset or couldn't be parsed,
+// in which case a non-empty Raw is the value that was ignored.
+type Setting struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	Default bool   `json:"default"`
+	Raw     string `json:"raw,omitempty"`
+}
+
+// redactedValue replaces secrets in EffectiveSettings
+const redactedValue = "REDACTED"
+
+// secretSettings are never shown, and urlSettings only without their password
+var (
+	secretSettings = map[string]bool{"QUORRA_API_KEY": true}
+	urlSettings    = map[string]bool{"DATABASE_URL": true, "QUORRA_DATABASE_REPLICA_URL": true, "REDIS_URL": true}
+)
+
+// envReader reads environment variables for Load, recording each one
+type envReader struct {
+	settings []Setting
+}
+
+func (e *envReader) record(key, raw, value string, usedDefault bool) {
+	setting := Setting{Name: key, Value: value, Default: usedDefault}
+	if usedDefault {
+		setting.Raw = raw
+	}
+	e.settings = append(e.settings, setting)
+}
+
+// EffectiveSettings returns every environment variable Load read, in the
+// order it read them, with secrets redacted
+func (c *Config) EffectiveSettings() []Setting {
+	settings := make([]Setting, len(c.settings))
+	for i, setting := range c.settings {
+		setting.Value = redact(setting.Name, setting.Value)
+		setting.Raw = redact(setting.Name, setting.Raw)
+		settings[i] = setting
+	}
+	return settings
+}
+
+func redact(name, value string) string {
+	switch {
+	case value == "":
+		return value
+	case secretSettings[name]:
+		return redactedValue
+	case urlSettings[name]:
+		u, err := url.Parse(value)
+		if err != nil {
+			// An unparseable URL may still hold a password
+			return redactedValue
+		}
+		return u.Redacted()
+	}
+	return value
+}
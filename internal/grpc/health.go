@@ -0,0 +1,116 @@
+package grpc
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// HealthServiceName is the service workers and probes check with the
+// standard grpc.health.v1.Health service. The empty name reports the same.
+const HealthServiceName = "quorra.WorkerService"
+
+// HealthCheckInterval is how often the reported health is refreshed
+const HealthCheckInterval = 5 * time.Second
+
+// healthPingTimeout bounds each database ping
+const healthPingTimeout = 2 * time.Second
+
+// HealthReporter serves the standard gRPC health checking protocol,
+// reporting SERVING while the database is reachable and NOT_SERVING
+// otherwise, and for good once the server starts shutting down
+type HealthReporter struct {
+	server *health.Server
+	ping   func(ctx context.Context) error
+	logger *log.Logger
+
+	mu       sync.Mutex
+	serving  bool
+	shutdown bool
+}
+
+// NewHealthReporter creates a HealthReporter that checks the database with
+// ping. It reports NOT_SERVING until the first check passes.
+func NewHealthReporter(ping func(ctx context.Context) error, logger *log.Logger) *HealthReporter {
+	r := &HealthReporter{server: health.NewServer(), ping: ping, logger: logger}
+	r.setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	return r
+}
+
+// Register adds the health service to a gRPC server
+func (r *HealthReporter) Register(s grpc.ServiceRegistrar) {
+	healthpb.RegisterHealthServer(s, r.server)
+}
+
+// Run checks the database every HealthCheckInterval until ctx is done
+func (r *HealthReporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		r.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check pings the database once and updates the reported status, returning
+// whether the server is serving
+func (r *HealthReporter) Check(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, healthPingTimeout)
+	defer cancel()
+	err := r.ping(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.shutdown {
+		return false
+	}
+
+	serving := err == nil
+	if serving != r.serving {
+		if serving {
+			r.logger.Println("gRPC health: SERVING")
+		} else {
+			r.logger.Printf("gRPC health: NOT_SERVING (database unreachable: %v)", err)
+		}
+	}
+	r.serving = serving
+
+	if serving {
+		r.setStatus(healthpb.HealthCheckResponse_SERVING)
+	} else {
+		r.setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+	return serving
+}
+
+// Serving reports whether the server currently reports SERVING
+func (r *HealthReporter) Serving() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.serving
+}
+
+// Shutdown reports NOT_SERVING from now on, so workers and load balancers
+// stop sending new work while in-flight jobs are still acked
+func (r *HealthReporter) Shutdown() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.shutdown = true
+	r.serving = false
+	r.server.Shutdown()
+}
+
+func (r *HealthReporter) setStatus(status healthpb.HealthCheckResponse_ServingStatus) {
+	r.server.SetServingStatus("", status)
+	r.server.SetServingStatus(HealthServiceName, status)
+}
@@ -8,35 +8,134 @@ import (
 )
 
 type Job struct {
-	Id         string                 `json:"id"`
-	Type       string                 `json:"type"`
-	Payload    []byte                 `json:"payload"`
-	Priority   int32                  `json:"priority"`
-	Attempts   int32                  `json:"attempts"`
-	MaxRetries int32                  `json:"max_retries"`
-	RunAt      *timestamppb.Timestamp `json:"run_at"`
-	LeasedAt   *timestamppb.Timestamp `json:"leased_at"`
-	CreatedAt  *timestamppb.Timestamp `json:"created_at"`
-	Queue      string                 `json:"queue"`
-	LeaseId    string                 `json:"lease_id"`
+	Id             string                 `json:"id"`
+	Type           string                 `json:"type"`
+	Payload        []byte                 `json:"payload"`
+	Priority       int32                  `json:"priority"`
+	Attempts       int32                  `json:"attempts"`
+	MaxRetries     int32                  `json:"max_retries"`
+	RunAt          *timestamppb.Timestamp `json:"run_at"`
+	LeasedAt       *timestamppb.Timestamp `json:"leased_at"`
+	CreatedAt      *timestamppb.Timestamp `json:"created_at"`
+	Queue          string                 `json:"queue"`
+	LeaseId        string                 `json:"lease_id"`
+	Metadata       map[string]string      `json:"metadata"`
+	PayloadOmitted bool                   `json:"payload_omitted"`
+	Deadline       *timestamppb.Timestamp `json:"deadline"`
+	LeaseEpoch     int64                  `json:"lease_epoch"`
+	State          []byte                 `json:"state"`
 }
 
 type LeaseRequest struct {
-	WorkerId        string `json:"worker_id"`
-	Queue           string `json:"queue"`
-	MaxJobs         int32  `json:"max_jobs"`
-	LeaseTtlSeconds int32  `json:"lease_ttl_seconds"`
+	WorkerId                 string            `json:"worker_id"`
+	Queue                    string            `json:"queue"`
+	MaxJobs                  int32             `json:"max_jobs"`
+	LeaseTtlSeconds          int32             `json:"lease_ttl_seconds"`
+	VisibilityTimeoutSeconds int32             `json:"visibility_timeout_seconds"`
+	PayloadMode              string            `json:"payload_mode"`
+	Capabilities             []string          `json:"capabilities"`
+	PriorityQuotas           []*PriorityQuota  `json:"priority_quotas"`
+	LabelFilter              map[string]string `json:"label_filter"`
+	Weight                   int32             `json:"weight"`
+	MinPriority              *int32            `json:"min_priority,omitempty"`
+	StartImmediately         bool              `json:"start_immediately"`
+}
+
+type PriorityQuota struct {
+	MinPriority int32 `json:"min_priority"`
+	Reserved    int32 `json:"reserved"`
 }
 
 type JobAck struct {
-	JobId        string `json:"job_id"`
-	WorkerId     string `json:"worker_id"`
-	LeaseId      string `json:"lease_id"`
-	Success      bool   `json:"success"`
-	ErrorMessage string `json:"error_message"`
+	JobId             string `json:"job_id"`
+	WorkerId          string `json:"worker_id"`
+	LeaseId           string `json:"lease_id"`
+	Success           bool   `json:"success"`
+	ErrorMessage      string `json:"error_message"`
+	DeadReason        string `json:"dead_reason"`
+	RequeueFront      bool   `json:"requeue_front"`
+	RetryAfterSeconds int32  `json:"retry_after_seconds"`
+	LeaseEpoch        int64  `json:"lease_epoch"`
+	Retryable         *bool  `json:"retryable,omitempty"`
+	RetryDelaySeconds int32  `json:"retry_delay_seconds"`
+	Redelivery        bool   `json:"redelivery"`
+	Release           bool   `json:"release"`
 }
 
 type JobAckResponse struct {
 	Acknowledged bool   `json:"acknowledged"`
 	Message      string `json:"message"`
 }
+
+type BatchAck struct {
+	Acks []*JobAck `json:"acks"`
+}
+
+type BatchNack struct {
+	Nacks []*JobAck `json:"nacks"`
+}
+
+type JobAckResult struct {
+	JobId        string `json:"job_id"`
+	Acknowledged bool   `json:"acknowledged"`
+	Message      string `json:"message"`
+}
+
+type BatchAckResponse struct {
+	Results []*JobAckResult `json:"results"`
+}
+
+type FetchPayloadRequest struct {
+	JobId    string `json:"job_id"`
+	WorkerId string `json:"worker_id"`
+	LeaseId  string `json:"lease_id"`
+}
+
+type FetchPayloadResponse struct {
+	Payload []byte `json:"payload"`
+}
+
+type RenewLeaseRequest struct {
+	JobId           string `json:"job_id"`
+	WorkerId        string `json:"worker_id"`
+	LeaseId         string `json:"lease_id"`
+	LeaseEpoch      int64  `json:"lease_epoch"`
+	LeaseTtlSeconds int32  `json:"lease_ttl_seconds"`
+}
+
+type RenewLeaseResponse struct {
+	LeaseExpiresAt *timestamppb.Timestamp `json:"lease_expires_at"`
+}
+
+type SaveStateRequest struct {
+	JobId      string `json:"job_id"`
+	WorkerId   string `json:"worker_id"`
+	LeaseId    string `json:"lease_id"`
+	LeaseEpoch int64  `json:"lease_epoch"`
+	State      []byte `json:"state"`
+}
+
+type SaveStateResponse struct {
+}
+
+type HeartbeatRequest struct {
+	WorkerId  string                 `json:"worker_id"`
+	StartedAt *timestamppb.Timestamp `json:"started_at"`
+}
+
+type HeartbeatResponse struct {
+	Draining bool `json:"draining"`
+}
+
+type WatchJobsRequest struct {
+	Queue  string   `json:"queue"`
+	Type   string   `json:"type"`
+	Events []string `json:"events"`
+}
+
+type JobEvent struct {
+	Event     string `json:"event"`
+	Job       *Job   `json:"job"`
+	Status    string `json:"status"`
+	LastError string `json:"last_error"`
+}
@@ -14,6 +14,13 @@ type WorkerServiceClient interface {
 	LeaseJobs(ctx context.Context, in *LeaseRequest, opts ...grpc.CallOption) (WorkerService_LeaseJobsClient, error)
 	AckJob(ctx context.Context, in *JobAck, opts ...grpc.CallOption) (*JobAckResponse, error)
 	NackJob(ctx context.Context, in *JobAck, opts ...grpc.CallOption) (*JobAckResponse, error)
+	AckJobs(ctx context.Context, in *BatchAck, opts ...grpc.CallOption) (*BatchAckResponse, error)
+	NackJobs(ctx context.Context, in *BatchNack, opts ...grpc.CallOption) (*BatchAckResponse, error)
+	FetchPayload(ctx context.Context, in *FetchPayloadRequest, opts ...grpc.CallOption) (*FetchPayloadResponse, error)
+	RenewLease(ctx context.Context, in *RenewLeaseRequest, opts ...grpc.CallOption) (*RenewLeaseResponse, error)
+	SaveState(ctx context.Context, in *SaveStateRequest, opts ...grpc.CallOption) (*SaveStateResponse, error)
+	Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error)
+	WatchJobs(ctx context.Context, in *WatchJobsRequest, opts ...grpc.CallOption) (WorkerService_WatchJobsClient, error)
 }
 
 type workerServiceClient struct {
@@ -74,11 +81,104 @@ func (c *workerServiceClient) NackJob(ctx context.Context, in *JobAck, opts ...g
 	return out, nil
 }
 
+func (c *workerServiceClient) AckJobs(ctx context.Context, in *BatchAck, opts ...grpc.CallOption) (*BatchAckResponse, error) {
+	out := new(BatchAckResponse)
+	err := c.cc.Invoke(ctx, "/quorra.WorkerService/AckJobs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *workerServiceClient) NackJobs(ctx context.Context, in *BatchNack, opts ...grpc.CallOption) (*BatchAckResponse, error) {
+	out := new(BatchAckResponse)
+	err := c.cc.Invoke(ctx, "/quorra.WorkerService/NackJobs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *workerServiceClient) FetchPayload(ctx context.Context, in *FetchPayloadRequest, opts ...grpc.CallOption) (*FetchPayloadResponse, error) {
+	out := new(FetchPayloadResponse)
+	err := c.cc.Invoke(ctx, "/quorra.WorkerService/FetchPayload", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *workerServiceClient) RenewLease(ctx context.Context, in *RenewLeaseRequest, opts ...grpc.CallOption) (*RenewLeaseResponse, error) {
+	out := new(RenewLeaseResponse)
+	err := c.cc.Invoke(ctx, "/quorra.WorkerService/RenewLease", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *workerServiceClient) SaveState(ctx context.Context, in *SaveStateRequest, opts ...grpc.CallOption) (*SaveStateResponse, error) {
+	out := new(SaveStateResponse)
+	err := c.cc.Invoke(ctx, "/quorra.WorkerService/SaveState", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *workerServiceClient) Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error) {
+	out := new(HeartbeatResponse)
+	err := c.cc.Invoke(ctx, "/quorra.WorkerService/Heartbeat", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *workerServiceClient) WatchJobs(ctx context.Context, in *WatchJobsRequest, opts ...grpc.CallOption) (WorkerService_WatchJobsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &WorkerService_ServiceDesc.Streams[1], "/quorra.WorkerService/WatchJobs", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &workerServiceWatchJobsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type WorkerService_WatchJobsClient interface {
+	Recv() (*JobEvent, error)
+	grpc.ClientStream
+}
+
+type workerServiceWatchJobsClient struct {
+	grpc.ClientStream
+}
+
+func (x *workerServiceWatchJobsClient) Recv() (*JobEvent, error) {
+	m := new(JobEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // WorkerServiceServer is the server API for WorkerService
 type WorkerServiceServer interface {
 	LeaseJobs(*LeaseRequest, WorkerService_LeaseJobsServer) error
 	AckJob(context.Context, *JobAck) (*JobAckResponse, error)
 	NackJob(context.Context, *JobAck) (*JobAckResponse, error)
+	AckJobs(context.Context, *BatchAck) (*BatchAckResponse, error)
+	NackJobs(context.Context, *BatchNack) (*BatchAckResponse, error)
+	FetchPayload(context.Context, *FetchPayloadRequest) (*FetchPayloadResponse, error)
+	RenewLease(context.Context, *RenewLeaseRequest) (*RenewLeaseResponse, error)
+	SaveState(context.Context, *SaveStateRequest) (*SaveStateResponse, error)
+	Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error)
+	WatchJobs(*WatchJobsRequest, WorkerService_WatchJobsServer) error
 }
 
 type UnimplementedWorkerServiceServer struct {
@@ -96,6 +196,34 @@ func (UnimplementedWorkerServiceServer) NackJob(context.Context, *JobAck) (*JobA
 	return nil, nil
 }
 
+func (UnimplementedWorkerServiceServer) AckJobs(context.Context, *BatchAck) (*BatchAckResponse, error) {
+	return nil, nil
+}
+
+func (UnimplementedWorkerServiceServer) NackJobs(context.Context, *BatchNack) (*BatchAckResponse, error) {
+	return nil, nil
+}
+
+func (UnimplementedWorkerServiceServer) FetchPayload(context.Context, *FetchPayloadRequest) (*FetchPayloadResponse, error) {
+	return nil, nil
+}
+
+func (UnimplementedWorkerServiceServer) RenewLease(context.Context, *RenewLeaseRequest) (*RenewLeaseResponse, error) {
+	return nil, nil
+}
+
+func (UnimplementedWorkerServiceServer) SaveState(context.Context, *SaveStateRequest) (*SaveStateResponse, error) {
+	return nil, nil
+}
+
+func (UnimplementedWorkerServiceServer) Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error) {
+	return nil, nil
+}
+
+func (UnimplementedWorkerServiceServer) WatchJobs(*WatchJobsRequest, WorkerService_WatchJobsServer) error {
+	return nil
+}
+
 func RegisterWorkerServiceServer(s grpc.ServiceRegistrar, srv WorkerServiceServer) {
 	s.RegisterService(&WorkerService_ServiceDesc, srv)
 }
@@ -121,6 +249,27 @@ func (x *workerServiceLeaseJobsServer) Send(m *Job) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _WorkerService_WatchJobs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchJobsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(WorkerServiceServer).WatchJobs(m, &workerServiceWatchJobsServer{stream})
+}
+
+type WorkerService_WatchJobsServer interface {
+	Send(*JobEvent) error
+	grpc.ServerStream
+}
+
+type workerServiceWatchJobsServer struct {
+	grpc.ServerStream
+}
+
+func (x *workerServiceWatchJobsServer) Send(m *JobEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 func _WorkerService_AckJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(JobAck)
 	if err := dec(in); err != nil {
@@ -157,6 +306,114 @@ func _WorkerService_NackJob_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _WorkerService_AckJobs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchAck)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WorkerServiceServer).AckJobs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/quorra.WorkerService/AckJobs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WorkerServiceServer).AckJobs(ctx, req.(*BatchAck))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WorkerService_NackJobs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchNack)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WorkerServiceServer).NackJobs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/quorra.WorkerService/NackJobs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WorkerServiceServer).NackJobs(ctx, req.(*BatchNack))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WorkerService_FetchPayload_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FetchPayloadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WorkerServiceServer).FetchPayload(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/quorra.WorkerService/FetchPayload",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WorkerServiceServer).FetchPayload(ctx, req.(*FetchPayloadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WorkerService_RenewLease_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RenewLeaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WorkerServiceServer).RenewLease(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/quorra.WorkerService/RenewLease",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WorkerServiceServer).RenewLease(ctx, req.(*RenewLeaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WorkerService_SaveState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SaveStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WorkerServiceServer).SaveState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/quorra.WorkerService/SaveState",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WorkerServiceServer).SaveState(ctx, req.(*SaveStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WorkerService_Heartbeat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HeartbeatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WorkerServiceServer).Heartbeat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/quorra.WorkerService/Heartbeat",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WorkerServiceServer).Heartbeat(ctx, req.(*HeartbeatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var WorkerService_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "quorra.WorkerService",
 	HandlerType: (*WorkerServiceServer)(nil),
@@ -169,6 +426,30 @@ var WorkerService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "NackJob",
 			Handler:    _WorkerService_NackJob_Handler,
 		},
+		{
+			MethodName: "AckJobs",
+			Handler:    _WorkerService_AckJobs_Handler,
+		},
+		{
+			MethodName: "NackJobs",
+			Handler:    _WorkerService_NackJobs_Handler,
+		},
+		{
+			MethodName: "FetchPayload",
+			Handler:    _WorkerService_FetchPayload_Handler,
+		},
+		{
+			MethodName: "RenewLease",
+			Handler:    _WorkerService_RenewLease_Handler,
+		},
+		{
+			MethodName: "SaveState",
+			Handler:    _WorkerService_SaveState_Handler,
+		},
+		{
+			MethodName: "Heartbeat",
+			Handler:    _WorkerService_Heartbeat_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -176,6 +457,11 @@ var WorkerService_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _WorkerService_LeaseJobs_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "WatchJobs",
+			Handler:       _WorkerService_WatchJobs_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "proto/quorra.proto",
 }
@@ -3,39 +3,162 @@ package grpc
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
+	"sync/atomic"
 	"time"
 
 	"github.com/goquorra/goquorra/internal/metrics"
 	"github.com/goquorra/goquorra/internal/queue"
 	"github.com/goquorra/goquorra/internal/store"
+	"google.golang.org/grpc"
+	// Registers the gzip compressor so workers can request it
+	_ "google.golang.org/grpc/encoding/gzip"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-// WorkerServiceServer implements the gRPC WorkerService
-type WorkerServiceServer struct {
+// Payload modes accepted in LeaseRequest.PayloadMode
+const (
+	PayloadModeFull         = "full"
+	PayloadModeMetadataOnly = "metadata_only"
+)
+
+// WorkerService implements the gRPC WorkerService
+type WorkerService struct {
 	UnimplementedWorkerServiceServer
 	queueManager *queue.Manager
 	metrics      *metrics.Collector
 	logger       *log.Logger
+
+	activeStreams atomic.Int64
+
+	// compressor, when set, compresses lease streams even for workers that
+	// didn't compress their request
+	compressor string
+
+	// maxPayloadBytes, when positive, is the largest payload that fits in a
+	// lease stream message
+	maxPayloadBytes int
+
+	// traceSampleRate is the fraction of jobs whose every lease and ack is
+	// logged; the rest only log terminal outcomes
+	traceSampleRate float64
+
+	// maxLeaseBatch, when positive, caps the jobs one lease request gets
+	maxLeaseBatch int
 }
 
 // NewWorkerService creates a new WorkerService
-func NewWorkerService(queueManager *queue.Manager, metrics *metrics.Collector, logger *log.Logger) *WorkerServiceServer {
-	return &WorkerServiceServer{
-		queueManager: queueManager,
-		metrics:      metrics,
-		logger:       logger,
+func NewWorkerService(queueManager *queue.Manager, metrics *metrics.Collector, logger *log.Logger) *WorkerService {
+	return &WorkerService{
+		queueManager:    queueManager,
+		metrics:         metrics,
+		logger:          logger,
+		traceSampleRate: 1,
+		maxLeaseBatch:   DefaultMaxLeaseBatch,
 	}
 }
 
+// DefaultMaxLeaseBatch is how many jobs one lease request gets at most by default
+const DefaultMaxLeaseBatch = 100
+
+// SetCompression makes LeaseJobs send its stream compressed with the named
+// compressor ("gzip"); empty or "none" leaves it to the worker's choice
+func (s *WorkerService) SetCompression(name string) {
+	if name == "none" {
+		name = ""
+	}
+	s.compressor = name
+}
+
+// SetMaxPayloadBytes sets the largest payload LeaseJobs sends. Larger jobs,
+// e.g. ones enqueued before the gRPC message limit was lowered, can never be
+// delivered, so they are dead-lettered instead.
+func (s *WorkerService) SetMaxPayloadBytes(max int) {
+	s.maxPayloadBytes = max
+}
+
+// SetMaxLeaseBatch caps the jobs one lease request gets, so a worker asking
+// for a huge batch can't take a whole queue from the others; zero removes
+// the cap
+func (s *WorkerService) SetMaxLeaseBatch(max int) {
+	s.maxLeaseBatch = max
+}
+
+// SetTraceSampleRate sets the fraction of jobs, from 0 to 1, that get
+// verbose lifecycle logging; see TraceSampled
+func (s *WorkerService) SetTraceSampleRate(rate float64) {
+	s.traceSampleRate = rate
+}
+
+func (s *WorkerService) traced(jobID string) bool {
+	return TraceSampled(jobID, s.traceSampleRate)
+}
+
+// logAckOutcome logs a job's state after a batch ack, where the manager only
+// logs a summary: always for traced jobs, and only once it's terminal for
+// the rest. Single acks are logged by the manager itself.
+func (s *WorkerService) logAckOutcome(result *store.AckResult) {
+	switch {
+	case s.traced(result.JobID):
+		s.logger.Printf("Job %s is now %s", result.JobID, result.Status)
+	case result.Status == store.StatusSucceeded:
+		s.logger.Printf("Job %s succeeded", result.JobID)
+	case result.Status == store.StatusDead:
+		s.logger.Printf("Job %s dead-lettered (%s)", result.JobID, result.DeadReason)
+	}
+}
+
+// ActiveStreams returns the number of LeaseJobs streams currently open
+func (s *WorkerService) ActiveStreams() int64 {
+	return s.activeStreams.Load()
+}
+
 // LeaseJobs streams jobs to workers
-func (s *WorkerServiceServer) LeaseJobs(req *LeaseRequest, stream WorkerService_LeaseJobsServer) error {
+func (s *WorkerService) LeaseJobs(req *LeaseRequest, stream WorkerService_LeaseJobsServer) error {
+	s.activeStreams.Add(1)
+	defer s.activeStreams.Add(-1)
+
 	ctx := stream.Context()
+	if s.compressor != "" {
+		if err := grpc.SetSendCompressor(ctx, s.compressor); err != nil {
+			// The worker didn't advertise support; stream uncompressed
+			s.logger.Printf("Failed to compress lease stream for worker %s: %v", req.WorkerId, err)
+		}
+	}
 	workerID := req.WorkerId
 	queue := req.Queue
 	maxJobs := int(req.MaxJobs)
 	leaseTTL := time.Duration(req.LeaseTtlSeconds) * time.Second
+	opts := store.LeaseOptions{
+		VisibilityTimeout: time.Duration(req.VisibilityTimeoutSeconds) * time.Second,
+		Capabilities:      req.Capabilities,
+		LabelFilter:       req.LabelFilter,
+		Weight:            int(req.Weight),
+		StartImmediately:  req.StartImmediately,
+	}
+	if req.MinPriority != nil {
+		minPriority := int(*req.MinPriority)
+		opts.MinPriority = &minPriority
+	}
+
+	switch req.PayloadMode {
+	case "", PayloadModeFull:
+	case PayloadModeMetadataOnly:
+		opts.OmitPayload = true
+	default:
+		return fmt.Errorf("invalid payload_mode %q", req.PayloadMode)
+	}
+
+	for _, quota := range req.PriorityQuotas {
+		if quota.Reserved < 0 {
+			return fmt.Errorf("invalid priority quota for priority %d: reserved must be non-negative", quota.MinPriority)
+		}
+		opts.PriorityQuotas = append(opts.PriorityQuotas, store.PriorityQuota{
+			MinPriority: int(quota.MinPriority),
+			Reserved:    int(quota.Reserved),
+		})
+	}
 
 	if queue == "" {
 		queue = "default"
@@ -43,6 +166,13 @@ func (s *WorkerServiceServer) LeaseJobs(req *LeaseRequest, stream WorkerService_
 	if maxJobs <= 0 {
 		maxJobs = 1
 	}
+	if s.maxLeaseBatch > 0 && maxJobs > s.maxLeaseBatch {
+		s.logger.Printf("Worker %s requested %d jobs from queue %s; clamping to QUORRA_MAX_LEASE_BATCH=%d", workerID, maxJobs, queue, s.maxLeaseBatch)
+		maxJobs = s.maxLeaseBatch
+	}
+	if req.Weight < 0 {
+		return fmt.Errorf("invalid weight %d: must be non-negative", req.Weight)
+	}
 	if leaseTTL <= 0 {
 		leaseTTL = 30 * time.Second
 	}
@@ -50,32 +180,65 @@ func (s *WorkerServiceServer) LeaseJobs(req *LeaseRequest, stream WorkerService_
 	s.logger.Printf("Worker %s requesting lease from queue %s (max_jobs=%d, ttl=%v)", workerID, queue, maxJobs, leaseTTL)
 
 	// Lease jobs from the queue
-	jobs, err := s.queueManager.LeaseJobs(ctx, queue, workerID, maxJobs, leaseTTL)
+	jobs, err := s.queueManager.LeaseJobs(ctx, queue, workerID, maxJobs, leaseTTL, opts)
 	if err != nil {
 		s.logger.Printf("Failed to lease jobs: %v", err)
 		return err
 	}
 
 	s.metrics.RecordJobLeased(len(jobs))
+	s.metrics.RecordWorkerLeased(workerID, len(jobs))
 
 	// Stream jobs to worker
 	for _, job := range jobs {
 		protoJob := s.convertToProtoJob(job)
+		if job.LeasedAt != nil {
+			s.metrics.RecordQueueWait(job.Queue, job.LeasedAt.Sub(job.RunAt))
+		}
+		if s.maxPayloadBytes > 0 && len(protoJob.Payload) > s.maxPayloadBytes {
+			s.rejectOversizedJob(ctx, job, len(protoJob.Payload))
+			continue
+		}
 		if err := stream.Send(protoJob); err != nil {
 			s.logger.Printf("Failed to send job to worker: %v", err)
 			return err
 		}
-		s.logger.Printf("Sent job %s to worker %s", job.ID, workerID)
+		if s.traced(job.ID) {
+			s.logger.Printf("Sent job %s to worker %s", job.ID, workerID)
+		}
 	}
 
 	return nil
 }
 
+// rejectOversizedJob dead-letters a leased job whose payload exceeds the gRPC message limit
+func (s *WorkerService) rejectOversizedJob(ctx context.Context, job *store.Job, size int) {
+	msg := fmt.Sprintf("payload of %d bytes exceeds the %d bytes allowed by QUORRA_GRPC_MAX_MSG_BYTES", size, s.maxPayloadBytes)
+	s.logger.Printf("Cannot deliver job %s: %s", job.ID, msg)
+
+	_, err := s.queueManager.AckJob(ctx, store.AckRequest{
+		JobID:        job.ID,
+		LeaseID:      job.LeaseID,
+		ErrorMessage: msg,
+		DeadReason:   store.DeadReasonPermanent,
+	})
+	if err != nil {
+		s.logger.Printf("Failed to dead-letter oversized job %s: %v", job.ID, err)
+	}
+}
+
 // AckJob acknowledges successful job completion
-func (s *WorkerServiceServer) AckJob(ctx context.Context, ack *JobAck) (*JobAckResponse, error) {
-	s.logger.Printf("Worker %s acknowledging job %s (success=%v)", ack.WorkerId, ack.JobId, ack.Success)
+func (s *WorkerService) AckJob(ctx context.Context, ack *JobAck) (*JobAckResponse, error) {
+	if s.traced(ack.JobId) {
+		s.logger.Printf("Worker %s acknowledging job %s (success=%v)", ack.WorkerId, ack.JobId, ack.Success)
+	}
 
-	err := s.queueManager.AckJob(ctx, ack.JobId, ack.LeaseId, true, "")
+	result, err := s.queueManager.AckJob(ctx, store.AckRequest{
+		JobID:      ack.JobId,
+		LeaseID:    ack.LeaseId,
+		LeaseEpoch: ack.LeaseEpoch,
+		Success:    true,
+	})
 	if err != nil {
 		s.logger.Printf("Failed to ack job: %v", err)
 		return &JobAckResponse{
@@ -85,6 +248,7 @@ func (s *WorkerServiceServer) AckJob(ctx context.Context, ack *JobAck) (*JobAckR
 	}
 
 	s.metrics.RecordJobProcessed()
+	s.metrics.RecordJobE2ELatency(result.Queue, time.Since(result.CreatedAt))
 
 	return &JobAckResponse{
 		Acknowledged: true,
@@ -93,10 +257,36 @@ func (s *WorkerServiceServer) AckJob(ctx context.Context, ack *JobAck) (*JobAckR
 }
 
 // NackJob handles job failure
-func (s *WorkerServiceServer) NackJob(ctx context.Context, ack *JobAck) (*JobAckResponse, error) {
-	s.logger.Printf("Worker %s nacking job %s: %s", ack.WorkerId, ack.JobId, ack.ErrorMessage)
+func (s *WorkerService) NackJob(ctx context.Context, ack *JobAck) (*JobAckResponse, error) {
+	if s.traced(ack.JobId) {
+		s.logger.Printf("Worker %s nacking job %s: %s", ack.WorkerId, ack.JobId, ack.ErrorMessage)
+	}
 
-	err := s.queueManager.AckJob(ctx, ack.JobId, ack.LeaseId, false, ack.ErrorMessage)
+	if ack.Release {
+		if err := s.queueManager.ReleaseJob(ctx, ack.JobId, ack.LeaseId, ack.LeaseEpoch); err != nil {
+			s.logger.Printf("Failed to release job: %v", err)
+			return &JobAckResponse{Acknowledged: false, Message: err.Error()}, err
+		}
+		return &JobAckResponse{Acknowledged: true, Message: "Job released"}, nil
+	}
+
+	deadReason, err := parseDeadReason(ack.DeadReason)
+	if err != nil {
+		return &JobAckResponse{Acknowledged: false, Message: err.Error()}, err
+	}
+
+	_, err = s.queueManager.AckJob(ctx, store.AckRequest{
+		JobID:        ack.JobId,
+		LeaseID:      ack.LeaseId,
+		ErrorMessage: ack.ErrorMessage,
+		DeadReason:   deadReason,
+		RequeueFront: ack.RequeueFront,
+		RetryAfter:   time.Duration(ack.RetryAfterSeconds) * time.Second,
+		LeaseEpoch:   ack.LeaseEpoch,
+		Retryable:    ack.Retryable,
+		RetryDelay:   time.Duration(ack.RetryDelaySeconds) * time.Second,
+		Redelivery:   ack.Redelivery,
+	})
 	if err != nil {
 		s.logger.Printf("Failed to nack job: %v", err)
 		return &JobAckResponse{
@@ -113,11 +303,218 @@ func (s *WorkerServiceServer) NackJob(ctx context.Context, ack *JobAck) (*JobAck
 	}, nil
 }
 
+// FetchPayload returns the payload of a job leased in metadata_only mode
+func (s *WorkerService) FetchPayload(ctx context.Context, req *FetchPayloadRequest) (*FetchPayloadResponse, error) {
+	payload, err := s.queueManager.FetchPayload(ctx, req.JobId, req.LeaseId)
+	if err != nil {
+		s.logger.Printf("Failed to fetch payload for job %s: %v", req.JobId, err)
+		return nil, err
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	return &FetchPayloadResponse{Payload: payloadBytes}, nil
+}
+
+// RenewLease extends the lease of a job the worker is still processing
+func (s *WorkerService) RenewLease(ctx context.Context, req *RenewLeaseRequest) (*RenewLeaseResponse, error) {
+	if req.LeaseTtlSeconds <= 0 {
+		return nil, fmt.Errorf("lease_ttl_seconds must be positive")
+	}
+
+	expiresAt, err := s.queueManager.RenewLease(ctx, req.JobId, req.LeaseId, req.LeaseEpoch,
+		time.Duration(req.LeaseTtlSeconds)*time.Second)
+	if err != nil {
+		s.logger.Printf("Failed to renew lease of job %s for worker %s: %v", req.JobId, req.WorkerId, err)
+		return nil, err
+	}
+
+	return &RenewLeaseResponse{LeaseExpiresAt: timestamppb.New(expiresAt)}, nil
+}
+
+// SaveState checkpoints the progress of a job the worker still holds
+func (s *WorkerService) SaveState(ctx context.Context, req *SaveStateRequest) (*SaveStateResponse, error) {
+	if !json.Valid(req.State) {
+		return nil, fmt.Errorf("state must be valid JSON")
+	}
+
+	if err := s.queueManager.SaveState(ctx, req.JobId, req.LeaseId, req.LeaseEpoch, req.State); err != nil {
+		s.logger.Printf("Failed to save state of job %s for worker %s: %v", req.JobId, req.WorkerId, err)
+		return nil, err
+	}
+
+	return &SaveStateResponse{}, nil
+}
+
+// Heartbeat tells a worker whether it has been asked to drain
+func (s *WorkerService) Heartbeat(ctx context.Context, req *HeartbeatRequest) (*HeartbeatResponse, error) {
+	if req.WorkerId == "" {
+		return nil, fmt.Errorf("worker_id is required")
+	}
+	if req.StartedAt == nil {
+		return nil, fmt.Errorf("started_at is required")
+	}
+
+	draining, err := s.queueManager.WorkerDraining(ctx, req.WorkerId, req.StartedAt.AsTime())
+	if err != nil {
+		s.logger.Printf("Failed to check drain state of worker %s: %v", req.WorkerId, err)
+		return nil, err
+	}
+	return &HeartbeatResponse{Draining: draining}, nil
+}
+
+// AckJobs acknowledges a batch of completed jobs
+func (s *WorkerService) AckJobs(ctx context.Context, batch *BatchAck) (*BatchAckResponse, error) {
+	s.logger.Printf("Acknowledging batch of %d jobs", len(batch.Acks))
+
+	resp, err := s.ackBatch(ctx, batch.Acks, true)
+	if err != nil {
+		s.logger.Printf("Failed to ack batch: %v", err)
+		return nil, err
+	}
+
+	for _, result := range resp.Results {
+		if result.Acknowledged {
+			s.metrics.RecordJobProcessed()
+		}
+	}
+
+	return resp, nil
+}
+
+// NackJobs records failure for a batch of jobs
+func (s *WorkerService) NackJobs(ctx context.Context, batch *BatchNack) (*BatchAckResponse, error) {
+	s.logger.Printf("Nacking batch of %d jobs", len(batch.Nacks))
+
+	resp, err := s.ackBatch(ctx, batch.Nacks, false)
+	if err != nil {
+		s.logger.Printf("Failed to nack batch: %v", err)
+		return nil, err
+	}
+
+	for _, result := range resp.Results {
+		if result.Acknowledged {
+			s.metrics.RecordJobFailed()
+		}
+	}
+
+	return resp, nil
+}
+
+// ackBatch converts protobuf acks to store requests and applies them in one transaction
+func (s *WorkerService) ackBatch(ctx context.Context, acks []*JobAck, success bool) (*BatchAckResponse, error) {
+	requests := make([]store.AckRequest, 0, len(acks))
+	for _, ack := range acks {
+		req := store.AckRequest{
+			JobID:      ack.JobId,
+			LeaseID:    ack.LeaseId,
+			LeaseEpoch: ack.LeaseEpoch,
+			Success:    success,
+		}
+		if !success {
+			if ack.Release {
+				return nil, fmt.Errorf("job %s: release is only supported by NackJob", ack.JobId)
+			}
+			deadReason, err := parseDeadReason(ack.DeadReason)
+			if err != nil {
+				return nil, err
+			}
+			req.ErrorMessage = ack.ErrorMessage
+			req.DeadReason = deadReason
+			req.RequeueFront = ack.RequeueFront
+			req.RetryAfter = time.Duration(ack.RetryAfterSeconds) * time.Second
+			req.Retryable = ack.Retryable
+			req.RetryDelay = time.Duration(ack.RetryDelaySeconds) * time.Second
+			req.Redelivery = ack.Redelivery
+		}
+		requests = append(requests, req)
+	}
+
+	results, err := s.queueManager.AckJobsBatch(ctx, requests)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &BatchAckResponse{Results: make([]*JobAckResult, 0, len(results))}
+	for i := range results {
+		result := &results[i]
+		message := result.Error
+		if result.Acknowledged {
+			message = "ok"
+			if success {
+				s.metrics.RecordJobE2ELatency(result.Queue, time.Since(result.CreatedAt))
+			}
+			s.logAckOutcome(result)
+		}
+		resp.Results = append(resp.Results, &JobAckResult{
+			JobId:        result.JobID,
+			Acknowledged: result.Acknowledged,
+			Message:      message,
+		})
+	}
+
+	return resp, nil
+}
+
+// parseDeadReason validates a worker-supplied dead reason on a nack.
+// Workers may only request immediate dead-lettering as permanent or poison.
+func parseDeadReason(reason string) (store.DeadReason, error) {
+	switch store.DeadReason(reason) {
+	case "", store.DeadReasonPermanent, store.DeadReasonPoison:
+		return store.DeadReason(reason), nil
+	default:
+		return "", fmt.Errorf("invalid dead_reason %q", reason)
+	}
+}
+
+// WatchJobs streams lifecycle events of jobs matching the request's filter
+// until the client disconnects
+func (s *WorkerService) WatchJobs(req *WatchJobsRequest, stream WorkerService_WatchJobsServer) error {
+	filter := queue.JobEventFilter{Queue: req.Queue, Type: req.Type}
+	for _, name := range req.Events {
+		switch t := queue.JobEventType(name); t {
+		case queue.EventCreated, queue.EventLeased, queue.EventSucceeded,
+			queue.EventFailed, queue.EventDead, queue.EventExpired:
+			filter.Events = append(filter.Events, t)
+		default:
+			return fmt.Errorf("invalid event type %q", name)
+		}
+	}
+
+	events, unsubscribe := s.queueManager.SubscribeJobEvents(filter)
+	defer unsubscribe()
+
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(&JobEvent{
+				Event:     string(event.Type),
+				Job:       s.convertToProtoJob(event.Job),
+				Status:    string(event.Job.Status),
+				LastError: event.Job.LastError,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
 // convertToProtoJob converts a store.Job to a protobuf Job
-func (s *WorkerServiceServer) convertToProtoJob(job *store.Job) *Job {
+func (s *WorkerService) convertToProtoJob(job *store.Job) *Job {
 	// Marshal payload to JSON bytes
 	payloadBytes := []byte("{}")
-	if job.Payload != nil {
+	if job.PayloadOmitted {
+		payloadBytes = nil
+	} else if job.Payload != nil {
 		if data, err := json.Marshal(job.Payload); err == nil {
 			payloadBytes = data
 		}
@@ -134,11 +531,38 @@ func (s *WorkerServiceServer) convertToProtoJob(job *store.Job) *Job {
 		CreatedAt:  timestamppb.New(job.CreatedAt),
 		Queue:      job.Queue,
 		LeaseId:    job.LeaseID,
+		LeaseEpoch: job.LeaseEpoch,
+		State:      job.State,
+
+		PayloadOmitted: job.PayloadOmitted,
 	}
 
 	if job.LeasedAt != nil {
 		protoJob.LeasedAt = timestamppb.New(*job.LeasedAt)
 	}
+	if job.Deadline != nil {
+		protoJob.Deadline = timestamppb.New(*job.Deadline)
+	}
+
+	protoJob.Metadata = jobMetadata(job)
 
 	return protoJob
 }
+
+// jobMetadata builds the metadata map sent alongside a leased job
+func jobMetadata(job *store.Job) map[string]string {
+	metadata := make(map[string]string, len(job.Labels)+2)
+	for k, v := range job.Labels {
+		metadata["label."+k] = v
+	}
+	if job.TraceID != "" {
+		metadata["trace_id"] = job.TraceID
+	}
+	if job.PartitionKey != "" {
+		metadata["partition_key"] = job.PartitionKey
+	}
+	if job.LeaseExpiresAt != nil {
+		metadata["deadline"] = job.LeaseExpiresAt.UTC().Format(time.RFC3339)
+	}
+	return metadata
+}
@@ -0,0 +1,10 @@
+package grpc
+
+import "github.com/goquorra/goquorra/internal/queue"
+
+// TraceSampled reports whether a job is in the sampled fraction rate of jobs
+// that get verbose lifecycle logging; it's queue.TraceSampled, exported here
+// for workers
+func TraceSampled(jobID string, rate float64) bool {
+	return queue.TraceSampled(jobID, rate)
+}
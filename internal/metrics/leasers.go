@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// OtherWorkers is the worker_id that jobs leased by workers past the
+// tracking limit are counted under
+const OtherWorkers = "other"
+
+// RecentLeaseWindow is how far back TopLeasers counts leases
+const RecentLeaseWindow = 5 * time.Minute
+
+// leaseBucketWidth is the granularity of the recent lease counts
+const leaseBucketWidth = 10 * time.Second
+
+// WorkerLeaseCount is how many jobs a worker leased within RecentLeaseWindow
+type WorkerLeaseCount struct {
+	WorkerID string `json:"worker_id"`
+	Leased   int    `json:"leased"`
+}
+
+// leaseBucket counts the jobs leased in one leaseBucketWidth interval
+type leaseBucket struct {
+	start time.Time
+	count int
+}
+
+// workerLeases tracks jobs leased per worker for the worker_id metric and
+// TopLeasers. Every worker ID is a metric series, so at most limit workers
+// have one; leases by any others go to OtherWorkers. A worker keeps its
+// series until a new worker needs its place and it hasn't leased within
+// RecentLeaseWindow.
+type workerLeases struct {
+	mu    sync.Mutex
+	limit int
+
+	// buckets holds the recent lease counts of workers that leased within
+	// RecentLeaseWindow
+	buckets map[string][]leaseBucket
+
+	// lastLeased is when each worker with a series last leased
+	lastLeased map[string]time.Time
+}
+
+// SetWorkerLeaseLimit enables per-worker lease counting for up to limit
+// distinct workers at a time; 0 disables it
+func (c *Collector) SetWorkerLeaseLimit(limit int) {
+	c.leasers.mu.Lock()
+	defer c.leasers.mu.Unlock()
+	c.leasers.limit = limit
+	if c.leasers.buckets == nil {
+		c.leasers.buckets = make(map[string][]leaseBucket)
+		c.leasers.lastLeased = make(map[string]time.Time)
+	}
+}
+
+// RecordWorkerLeased counts count jobs leased by workerID, if per-worker
+// counting is enabled
+func (c *Collector) RecordWorkerLeased(workerID string, count int) {
+	if count <= 0 {
+		return
+	}
+
+	l := &c.leasers
+	l.mu.Lock()
+	if l.limit <= 0 {
+		l.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	c.pruneLeasers(now)
+	if _, ok := l.lastLeased[workerID]; !ok && workerID != OtherWorkers && l.tracked() >= l.limit && !c.evictIdleLeaser() {
+		workerID = OtherWorkers
+	}
+	l.lastLeased[workerID] = now
+
+	start := now.Truncate(leaseBucketWidth)
+	buckets := l.buckets[workerID]
+	if n := len(buckets); n > 0 && buckets[n-1].start.Equal(start) {
+		buckets[n-1].count += count
+	} else {
+		buckets = append(buckets, leaseBucket{start: start, count: count})
+	}
+	l.buckets[workerID] = buckets
+	l.mu.Unlock()
+
+	c.WorkerJobsLeased.WithLabelValues(workerID).Add(float64(count))
+	c.count("quorra_worker_jobs_leased_total", "worker_id", workerID, float64(count))
+}
+
+// TopLeasers returns up to n workers by jobs leased within
+// RecentLeaseWindow, busiest first. Leases counted under OtherWorkers aren't
+// one worker's, so they're left out. It's empty while per-worker counting is
+// disabled.
+func (c *Collector) TopLeasers(n int) []WorkerLeaseCount {
+	l := &c.leasers
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c.pruneLeasers(time.Now())
+
+	leasers := make([]WorkerLeaseCount, 0, len(l.buckets))
+	for workerID, buckets := range l.buckets {
+		if workerID == OtherWorkers {
+			continue
+		}
+		leased := 0
+		for _, bucket := range buckets {
+			leased += bucket.count
+		}
+		leasers = append(leasers, WorkerLeaseCount{WorkerID: workerID, Leased: leased})
+	}
+	sort.Slice(leasers, func(i, j int) bool {
+		if leasers[i].Leased != leasers[j].Leased {
+			return leasers[i].Leased > leasers[j].Leased
+		}
+		return leasers[i].WorkerID < leasers[j].WorkerID
+	})
+	if len(leasers) > n {
+		leasers = leasers[:n]
+	}
+	return leasers
+}
+
+// tracked returns how many workers count toward the limit
+func (l *workerLeases) tracked() int {
+	n := len(l.lastLeased)
+	if _, ok := l.lastLeased[OtherWorkers]; ok {
+		n--
+	}
+	return n
+}
+
+// evictIdleLeaser drops the series of the worker that leased least recently,
+// if it hasn't leased within RecentLeaseWindow, reporting whether one was
+// dropped. The caller must hold the lock.
+func (c *Collector) evictIdleLeaser() bool {
+	l := &c.leasers
+	idle, idleSince := "", time.Time{}
+	for workerID, last := range l.lastLeased {
+		if _, recent := l.buckets[workerID]; recent || workerID == OtherWorkers {
+			continue
+		}
+		if idle == "" || last.Before(idleSince) {
+			idle, idleSince = workerID, last
+		}
+	}
+	if idle == "" {
+		return false
+	}
+
+	delete(l.lastLeased, idle)
+	c.WorkerJobsLeased.DeleteLabelValues(idle)
+	c.forget("quorra_worker_jobs_leased_total", "worker_id", idle)
+	return true
+}
+
+// pruneLeasers drops lease buckets older than RecentLeaseWindow. The caller
+// must hold the lock.
+func (c *Collector) pruneLeasers(now time.Time) {
+	cutoff := now.Add(-RecentLeaseWindow)
+	for workerID, buckets := range c.leasers.buckets {
+		keep := 0
+		for keep < len(buckets) && !buckets[keep].start.After(cutoff) {
+			keep++
+		}
+		if keep == len(buckets) {
+			delete(c.leasers.buckets, workerID)
+			continue
+		}
+		c.leasers.buckets[workerID] = buckets[keep:]
+	}
+}
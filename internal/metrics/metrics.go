@@ -1,71 +1,340 @@
 package metrics
 
 import (
+	"fmt"
+	"sync"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 // Collector holds all Prometheus metrics
 type Collector struct {
-	JobsCreated   prometheus.Counter
-	JobsProcessed prometheus.Counter
-	JobsFailed    prometheus.Counter
-	JobsDead      prometheus.Counter
-	JobsLeased    prometheus.Counter
-	QueueLength   *prometheus.GaugeVec
+	JobsCreated      *prometheus.CounterVec
+	JobsDeduplicated *prometheus.CounterVec
+	JobsProcessed    prometheus.Counter
+	JobsFailed       prometheus.Counter
+	JobsDead         *prometheus.CounterVec
+	JobsLeased       prometheus.Counter
+	JobsExpired      prometheus.Counter
+	JobsAged         prometheus.Counter
+	JobsDeadRetried  prometheus.Counter
+	QueueLength      *prometheus.GaugeVec
+	MaintenanceMode  prometheus.Gauge
+	StuckJobs        *prometheus.GaugeVec
+	JobE2ELatency    *prometheus.HistogramVec
+
+	// BackoffMultiplier is each job type's adaptive backoff factor
+	BackoffMultiplier *prometheus.GaugeVec
+
+	// CorruptRows counts job rows skipped because they couldn't be decoded
+	CorruptRows *prometheus.CounterVec
+
+	// DBQueryDuration is how long each store operation takes
+	DBQueryDuration *prometheus.HistogramVec
+
+	// QueueWait is how long jobs wait between becoming due and being leased
+	QueueWait *prometheus.HistogramVec
+
+	// DispatchPaused is 1 while the global pause stops all leasing
+	DispatchPaused prometheus.Gauge
+
+	// SLAMet and SLAMissed count finished jobs with a deadline by whether
+	// they succeeded by it
+	SLAMet    *prometheus.CounterVec
+	SLAMissed *prometheus.CounterVec
+
+	// RecentJobsCache counts recent-jobs requests served from the cache
+	// (hit) or the store (miss)
+	RecentJobsCache *prometheus.CounterVec
+
+	// WorkerJobsLeased counts leased jobs per worker. It's off until
+	// SetWorkerLeaseLimit is called; see leasers.go.
+	WorkerJobsLeased *prometheus.CounterVec
+	leasers          workerLeases
+
+	// counts mirrors the counters above for Snapshot. Prometheus counters
+	// can't be reset, so resets only affect this copy.
+	mu     sync.Mutex
+	counts map[string]float64
 }
 
-// NewCollector creates a new metrics collector
+// NewCollector creates a new metrics collector registered with the default
+// Prometheus registry
 func NewCollector() *Collector {
+	return NewCollectorWith(prometheus.DefaultRegisterer)
+}
+
+// NewCollectorWith creates a new metrics collector registered with reg, so
+// tests can have a collector of their own
+func NewCollectorWith(reg prometheus.Registerer) *Collector {
+	factory := promauto.With(reg)
 	return &Collector{
-		JobsCreated: promauto.NewCounter(prometheus.CounterOpts{
+		JobsCreated: factory.NewCounterVec(prometheus.CounterOpts{
 			Name: "quorra_jobs_created_total",
-			Help: "Total number of jobs created",
-		}),
-		JobsProcessed: promauto.NewCounter(prometheus.CounterOpts{
+			Help: "Total number of jobs created by kind (user or system)",
+		}, []string{"kind"}),
+		JobsDeduplicated: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "quorra_jobs_deduplicated_total",
+			Help: "Total number of enqueues that returned an existing job by idempotency key",
+		}, []string{"queue"}),
+		JobsProcessed: factory.NewCounter(prometheus.CounterOpts{
 			Name: "quorra_jobs_processed_total",
 			Help: "Total number of jobs processed successfully",
 		}),
-		JobsFailed: promauto.NewCounter(prometheus.CounterOpts{
+		JobsFailed: factory.NewCounter(prometheus.CounterOpts{
 			Name: "quorra_jobs_failed_total",
 			Help: "Total number of jobs that failed",
 		}),
-		JobsDead: promauto.NewCounter(prometheus.CounterOpts{
+		JobsDead: factory.NewCounterVec(prometheus.CounterOpts{
 			Name: "quorra_jobs_dead_total",
-			Help: "Total number of jobs moved to dead letter queue",
-		}),
-		JobsLeased: promauto.NewCounter(prometheus.CounterOpts{
+			Help: "Total number of jobs moved to dead letter queue by reason",
+		}, []string{"reason"}),
+		JobsLeased: factory.NewCounter(prometheus.CounterOpts{
 			Name: "quorra_jobs_leased_total",
 			Help: "Total number of jobs leased to workers",
 		}),
-		QueueLength: promauto.NewGaugeVec(prometheus.GaugeOpts{
+		JobsExpired: factory.NewCounter(prometheus.CounterOpts{
+			Name: "quorra_jobs_expired_total",
+			Help: "Total number of jobs expired because their deadline passed before they were leased",
+		}),
+		JobsAged: factory.NewCounter(prometheus.CounterOpts{
+			Name: "quorra_jobs_aged_total",
+			Help: "Total number of priority bumps given to long-waiting pending jobs",
+		}),
+		JobsDeadRetried: factory.NewCounter(prometheus.CounterOpts{
+			Name: "quorra_jobs_dead_retried_total",
+			Help: "Total number of dead jobs automatically returned to pending by the dead retry policy",
+		}),
+		QueueLength: factory.NewGaugeVec(prometheus.GaugeOpts{
 			Name: "quorra_job_queue_length",
 			Help: "Current length of job queues by queue and status",
 		}, []string{"queue", "status"}),
+		MaintenanceMode: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "quorra_maintenance_mode",
+			Help: "1 while the server rejects new jobs for maintenance, 0 otherwise",
+		}),
+		StuckJobs: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "quorra_stuck_jobs",
+			Help: "Jobs leased for longer than the stuck threshold, by queue",
+		}, []string{"queue"}),
+		JobE2ELatency: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "quorra_job_e2e_latency_seconds",
+			Help: "Time from job creation to successful completion, including queue wait, by queue",
+			// 100ms up to about 7 hours
+			Buckets: prometheus.ExponentialBuckets(0.1, 4, 10),
+		}, []string{"queue"}),
+		BackoffMultiplier: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "quorra_backoff_multiplier",
+			Help: "Factor the retry backoff of each job type is multiplied by under adaptive backoff; 1 when healthy",
+		}, []string{"type"}),
+		CorruptRows: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "quorra_corrupt_rows_total",
+			Help: "Total number of job rows skipped by list and lease queries because they couldn't be decoded",
+		}, []string{"query"}),
+		DBQueryDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "quorra_db_query_duration_seconds",
+			Help: "Time taken by store operations against the database, including their transactions, by operation",
+			// 1ms up to about 16 seconds
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+		}, []string{"operation"}),
+		SLAMet: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "quorra_sla_met_total",
+			Help: "Total number of jobs with a deadline that succeeded by it, by type",
+		}, []string{"type"}),
+		SLAMissed: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "quorra_sla_missed_total",
+			Help: "Total number of jobs with a deadline that succeeded after it or were dead-lettered, by type",
+		}, []string{"type"}),
+		QueueWait: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "quorra_queue_wait_seconds",
+			Help: "Time jobs waited from their run_at until they were leased, by queue",
+			// 10ms up to about 3 hours
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+		}, []string{"queue"}),
+		DispatchPaused: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "quorra_dispatch_paused",
+			Help: "1 while dispatch is paused on every queue, 0 otherwise",
+		}),
+		RecentJobsCache: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "quorra_recent_jobs_cache_total",
+			Help: "Recent-jobs requests by whether the cached result was reused",
+		}, []string{"result"}),
+		WorkerJobsLeased: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "quorra_worker_jobs_leased_total",
+			Help: "Jobs leased by each worker, with workers past the tracking limit counted as other",
+		}, []string{"worker_id"}),
+		counts: make(map[string]float64),
+	}
+}
+
+// Snapshot returns the counter values recorded since creation or the last
+// Reset, keyed by series name, e.g. quorra_jobs_created_total{kind="user"}
+func (c *Collector) Snapshot() map[string]float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snapshot := make(map[string]float64, len(c.counts))
+	for series, value := range c.counts {
+		snapshot[series] = value
+	}
+	return snapshot
+}
+
+// Reset zeroes the values returned by Snapshot. The exported Prometheus
+// counters are left untouched.
+func (c *Collector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts = make(map[string]float64)
+}
+
+// count adds delta to the snapshot value of a series with at most one label
+func (c *Collector) count(name, label, value string, delta float64) {
+	series := name
+	if label != "" {
+		series = fmt.Sprintf("%s{%s=%q}", name, label, value)
 	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[series] += delta
+}
+
+// forget drops a series counted with count, once its metric is deleted
+func (c *Collector) forget(name, label, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.counts, fmt.Sprintf("%s{%s=%q}", name, label, value))
+}
+
+// RecordJobCreated increments the created counter for the given job kind
+func (c *Collector) RecordJobCreated(kind string) {
+	c.JobsCreated.WithLabelValues(kind).Inc()
+	c.count("quorra_jobs_created_total", "kind", kind, 1)
+}
+
+// RecordJobDeduplicated increments the deduplicated counter for the given queue
+func (c *Collector) RecordJobDeduplicated(queue string) {
+	c.JobsDeduplicated.WithLabelValues(queue).Inc()
+	c.count("quorra_jobs_deduplicated_total", "queue", queue, 1)
 }
 
 // RecordJobProcessed increments the processed counter
 func (c *Collector) RecordJobProcessed() {
 	c.JobsProcessed.Inc()
+	c.count("quorra_jobs_processed_total", "", "", 1)
 }
 
 // RecordJobFailed increments the failed counter
 func (c *Collector) RecordJobFailed() {
 	c.JobsFailed.Inc()
+	c.count("quorra_jobs_failed_total", "", "", 1)
 }
 
-// RecordJobDead increments the dead counter
-func (c *Collector) RecordJobDead() {
-	c.JobsDead.Inc()
+// RecordJobDead increments the dead counter for the given reason
+func (c *Collector) RecordJobDead(reason string) {
+	c.JobsDead.WithLabelValues(reason).Inc()
+	c.count("quorra_jobs_dead_total", "reason", reason, 1)
 }
 
 // RecordJobLeased increments the leased counter
 func (c *Collector) RecordJobLeased(count int) {
 	c.JobsLeased.Add(float64(count))
+	c.count("quorra_jobs_leased_total", "", "", float64(count))
+}
+
+// RecordJobsExpired increments the expired counter
+func (c *Collector) RecordJobsExpired(count int) {
+	c.JobsExpired.Add(float64(count))
+	c.count("quorra_jobs_expired_total", "", "", float64(count))
+}
+
+// RecordJobsAged increments the aged counter
+func (c *Collector) RecordJobsAged(count int64) {
+	c.JobsAged.Add(float64(count))
+	c.count("quorra_jobs_aged_total", "", "", float64(count))
+}
+
+// RecordJobsDeadRetried increments the dead retry counter
+func (c *Collector) RecordJobsDeadRetried(count int) {
+	c.JobsDeadRetried.Add(float64(count))
+	c.count("quorra_jobs_dead_retried_total", "", "", float64(count))
+}
+
+// RecordJobE2ELatency observes the time a job took from creation to completion
+func (c *Collector) RecordJobE2ELatency(queue string, latency time.Duration) {
+	c.JobE2ELatency.WithLabelValues(queue).Observe(latency.Seconds())
+}
+
+// RecordQueueWait observes how long a job waited to be leased once due. Jobs
+// leased early, e.g. by clock skew, count as not having waited.
+func (c *Collector) RecordQueueWait(queue string, wait time.Duration) {
+	c.QueueWait.WithLabelValues(queue).Observe(max(wait, 0).Seconds())
+}
+
+// RecordSLA counts a finished job with a deadline as having met or missed it
+func (c *Collector) RecordSLA(jobType string, met bool) {
+	if met {
+		c.SLAMet.WithLabelValues(jobType).Inc()
+		c.count("quorra_sla_met_total", "type", jobType, 1)
+	} else {
+		c.SLAMissed.WithLabelValues(jobType).Inc()
+		c.count("quorra_sla_missed_total", "type", jobType, 1)
+	}
+}
+
+// RecordRecentJobsCache counts a recent-jobs request as a cache hit or miss
+func (c *Collector) RecordRecentJobsCache(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	c.RecentJobsCache.WithLabelValues(result).Inc()
+	c.count("quorra_recent_jobs_cache_total", "result", result, 1)
+}
+
+// RecordDBQueryDuration records how long a store operation took
+func (c *Collector) RecordDBQueryDuration(operation string, duration time.Duration) {
+	c.DBQueryDuration.WithLabelValues(operation).Observe(duration.Seconds())
 }
 
 // UpdateQueueLength updates the queue length gauge
 func (c *Collector) UpdateQueueLength(queue, status string, length float64) {
 	c.QueueLength.WithLabelValues(queue, status).Set(length)
 }
+
+// UpdateStuckJobs sets the stuck job gauge for a queue
+func (c *Collector) UpdateStuckJobs(queue string, count int) {
+	c.StuckJobs.WithLabelValues(queue).Set(float64(count))
+}
+
+// UpdateBackoffMultiplier sets the adaptive backoff gauge for a job type
+func (c *Collector) UpdateBackoffMultiplier(jobType string, multiplier float64) {
+	c.BackoffMultiplier.WithLabelValues(jobType).Set(multiplier)
+}
+
+// RecordCorruptRow increments the corrupt row counter for the given query
+func (c *Collector) RecordCorruptRow(query string) {
+	c.CorruptRows.WithLabelValues(query).Inc()
+	c.count("quorra_corrupt_rows_total", "query", query, 1)
+}
+
+// SetDispatchPaused sets the dispatch pause gauge to 1 or 0
+func (c *Collector) SetDispatchPaused(paused bool) {
+	if paused {
+		c.DispatchPaused.Set(1)
+	} else {
+		c.DispatchPaused.Set(0)
+	}
+}
+
+// SetMaintenanceMode sets the maintenance gauge to 1 or 0
+func (c *Collector) SetMaintenanceMode(enabled bool) {
+	if enabled {
+		c.MaintenanceMode.Set(1)
+	} else {
+		c.MaintenanceMode.Set(0)
+	}
+}
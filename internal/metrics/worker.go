@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// WorkerCollector holds the Prometheus metrics exported by a worker process.
+// Server-side metrics aggregate every worker; these give per-pod visibility.
+type WorkerCollector struct {
+	JobsProcessed prometheus.Counter
+	JobsFailed    prometheus.Counter
+	Inflight      prometheus.Gauge
+	Leases        *prometheus.CounterVec
+	LeaseErrors   *prometheus.CounterVec
+	Reconnects    *prometheus.CounterVec
+}
+
+// NewWorkerCollector creates a worker metrics collector
+func NewWorkerCollector() *WorkerCollector {
+	return &WorkerCollector{
+		JobsProcessed: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "quorra_worker_jobs_processed_total",
+			Help: "Total number of jobs this worker completed successfully",
+		}),
+		JobsFailed: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "quorra_worker_jobs_failed_total",
+			Help: "Total number of jobs this worker failed or abandoned",
+		}),
+		Inflight: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "quorra_worker_inflight",
+			Help: "Jobs currently being processed by this worker",
+		}),
+		Leases: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "quorra_worker_leases_total",
+			Help: "Total number of lease requests by queue",
+		}, []string{"queue"}),
+		LeaseErrors: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "quorra_worker_lease_errors_total",
+			Help: "Total number of lease streams that failed to open or broke, by queue",
+		}, []string{"queue"}),
+		Reconnects: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "quorra_worker_reconnects_total",
+			Help: "Total number of lease streams re-established after a failure, by queue",
+		}, []string{"queue"}),
+	}
+}
+
+// RecordJobProcessed increments the processed counter
+func (c *WorkerCollector) RecordJobProcessed() {
+	c.JobsProcessed.Inc()
+}
+
+// RecordJobFailed increments the failed counter
+func (c *WorkerCollector) RecordJobFailed() {
+	c.JobsFailed.Inc()
+}
+
+// JobStarted increments the in-flight gauge
+func (c *WorkerCollector) JobStarted() {
+	c.Inflight.Inc()
+}
+
+// JobFinished decrements the in-flight gauge
+func (c *WorkerCollector) JobFinished() {
+	c.Inflight.Dec()
+}
+
+// RecordLease increments the lease counter for a queue
+func (c *WorkerCollector) RecordLease(queue string) {
+	c.Leases.WithLabelValues(queue).Inc()
+}
+
+// RecordLeaseError increments the lease error counter for a queue
+func (c *WorkerCollector) RecordLeaseError(queue string) {
+	c.LeaseErrors.WithLabelValues(queue).Inc()
+}
+
+// RecordReconnect increments the reconnect counter for a queue
+func (c *WorkerCollector) RecordReconnect(queue string) {
+	c.Reconnects.WithLabelValues(queue).Inc()
+}
@@ -0,0 +1,104 @@
+package queue
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// DefaultAdaptiveBackoffWindow is how far back a job type's failure density is measured by default
+const DefaultAdaptiveBackoffWindow = time.Minute
+
+// adaptiveBackoffThreshold is the share of a type's recent acks that must
+// be failures before its backoff is inflated
+const adaptiveBackoffThreshold = 0.5
+
+// minAdaptiveBackoffAcks is how many acks the window must hold before a
+// type's backoff is inflated, so a handful of failures can't trip it
+const minAdaptiveBackoffAcks = 20
+
+// AdaptiveBackoff inflates the retry backoff of every job of a type while
+// most of that type's recent acks are failures, as when its jobs share a
+// failing downstream. Past adaptiveBackoffThreshold the multiplier grows
+// exponentially with the failure ratio, reaching MaxMultiplier when every
+// ack fails, and falls back as successes return or the failures age out of
+// Window. A MaxMultiplier of 1 or less disables it.
+type AdaptiveBackoff struct {
+	MaxMultiplier float64
+	Window        time.Duration
+}
+
+// adaptiveBackoffs counts, per job type, recent successful and failed acks
+type adaptiveBackoffs struct {
+	mu     sync.Mutex
+	policy AdaptiveBackoff
+	types  map[string]*slidingWindow
+}
+
+// SetAdaptiveBackoff enables adaptive per-type backoff
+func (m *Manager) SetAdaptiveBackoff(policy AdaptiveBackoff) {
+	m.adaptiveBackoffs.mu.Lock()
+	defer m.adaptiveBackoffs.mu.Unlock()
+	m.adaptiveBackoffs.policy = policy
+}
+
+// BackoffMultiplier returns the factor the next retry delay of a jobType
+// job is multiplied by; 1 unless the type is failing. The store consults it
+// from the ack path.
+func (m *Manager) BackoffMultiplier(jobType string) float64 {
+	return m.adaptiveBackoffs.multiplier(jobType, time.Now())
+}
+
+// recordAck counts an ack of a jobType job toward the type's failure
+// density and updates its multiplier gauge
+func (m *Manager) recordAck(jobType string, success bool) {
+	now := time.Now()
+	if !m.adaptiveBackoffs.record(jobType, success, now) {
+		return
+	}
+	if m.metrics != nil {
+		m.metrics.UpdateBackoffMultiplier(jobType, m.adaptiveBackoffs.multiplier(jobType, now))
+	}
+}
+
+// record counts an ack, reporting false if adaptive backoff is disabled
+func (b *adaptiveBackoffs) record(jobType string, success bool, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.policy.MaxMultiplier <= 1 || jobType == "" {
+		return false
+	}
+	w, ok := b.types[jobType]
+	if !ok {
+		w = &slidingWindow{}
+		b.types[jobType] = w
+	}
+	if success {
+		w.add(b.policy.Window, now, 1, 0)
+	} else {
+		w.add(b.policy.Window, now, 0, 1)
+	}
+	return true
+}
+
+func (b *adaptiveBackoffs) multiplier(jobType string, now time.Time) float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	w, ok := b.types[jobType]
+	if !ok || b.policy.MaxMultiplier <= 1 {
+		return 1
+	}
+	successes, failures := w.sum(b.policy.Window, now)
+	total := successes + failures
+	if total < minAdaptiveBackoffAcks {
+		return 1
+	}
+	ratio := float64(failures) / float64(total)
+	if ratio <= adaptiveBackoffThreshold {
+		return 1
+	}
+	excess := (ratio - adaptiveBackoffThreshold) / (1 - adaptiveBackoffThreshold)
+	return math.Pow(b.policy.MaxMultiplier, excess)
+}
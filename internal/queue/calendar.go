@@ -0,0 +1,52 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/goquorra/goquorra/internal/store"
+)
+
+// applyCalendar moves the request's run_at forward to the next business time
+// of its schedule calendar
+func (m *Manager) applyCalendar(ctx context.Context, req *store.CreateJobRequest) error {
+	cal, err := m.store.GetCalendar(ctx, req.ScheduleCalendar)
+	if err != nil {
+		return err
+	}
+	if cal == nil {
+		return fmt.Errorf("%w: %s", store.ErrCalendarNotFound, req.ScheduleCalendar)
+	}
+
+	now := time.Now()
+	runAt := req.RunAtFrom(now)
+	next, err := cal.NextBusinessTime(runAt)
+	if err != nil {
+		return err
+	}
+	if next.Equal(runAt) {
+		return nil
+	}
+
+	// run_at has no time zone, so store it in the server's zone like every
+	// other time it writes, not the client's
+	next = next.In(now.Location())
+	req.RunAt = &next
+	req.DelayMs, req.DelaySeconds = 0, 0
+	return nil
+}
+
+// GetCalendar returns the named business calendar, or nil if it isn't defined
+func (m *Manager) GetCalendar(ctx context.Context, name string) (*store.BusinessCalendar, error) {
+	return m.store.GetCalendar(ctx, name)
+}
+
+// PutCalendar creates or replaces a business calendar
+func (m *Manager) PutCalendar(ctx context.Context, cal *store.BusinessCalendar) error {
+	if err := m.store.PutCalendar(ctx, cal); err != nil {
+		return err
+	}
+	m.logger.Printf("Calendar %s updated (timezone=%q, weekend=%v, holidays=%d)", cal.Name, cal.Timezone, cal.Weekend, len(cal.Holidays))
+	return nil
+}
@@ -0,0 +1,115 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/goquorra/goquorra/internal/store"
+)
+
+// createBatchTimeout bounds each batched insert, independently of the
+// callers, which may give up while their creates are in flight
+const createBatchTimeout = 30 * time.Second
+
+// pendingCreate is a create waiting in the batcher for its result
+type pendingCreate struct {
+	req    *store.CreateJobRequest
+	result chan store.CreateJobResult
+}
+
+// createBatcher buffers job creates for up to window and inserts them with
+// CreateJobsBatch, trading a little latency for far fewer transactions
+type createBatcher struct {
+	store   store.Store
+	window  time.Duration
+	maxSize int
+	queue   chan pendingCreate
+}
+
+// EnableCreateBatching makes EnqueueJob buffer creates for up to window and
+// insert them in batches of at most maxSize in one transaction. Inline
+// creates are never batched. It must be called before the manager starts
+// serving requests.
+func (m *Manager) EnableCreateBatching(window time.Duration, maxSize int) {
+	m.createBatcher = &createBatcher{
+		store:   m.store,
+		window:  window,
+		maxSize: maxSize,
+		queue:   make(chan pendingCreate, maxSize),
+	}
+	go m.createBatcher.run()
+}
+
+// createJob creates req through the batcher when batching is on
+func (m *Manager) createJob(ctx context.Context, req *store.CreateJobRequest) (*store.Job, error) {
+	if m.createBatcher == nil || req.Inline {
+		return m.store.CreateJob(ctx, req)
+	}
+	return m.createBatcher.create(ctx, req)
+}
+
+// create queues req for the next batch and waits for its result. If ctx is
+// done first the job may still be created.
+func (b *createBatcher) create(ctx context.Context, req *store.CreateJobRequest) (*store.Job, error) {
+	pending := pendingCreate{req: req, result: make(chan store.CreateJobResult, 1)}
+
+	select {
+	case b.queue <- pending:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case result := <-pending.result:
+		return result.Job, result.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// run collects a batch starting with the first queued create, until the
+// window elapses or the batch is full, then flushes it
+func (b *createBatcher) run() {
+	for first := range b.queue {
+		batch := []pendingCreate{first}
+		timer := time.NewTimer(b.window)
+
+	collect:
+		for len(batch) < b.maxSize {
+			select {
+			case pending := <-b.queue:
+				batch = append(batch, pending)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		b.flush(batch)
+	}
+}
+
+// flush inserts a batch, falling back to one create per request if the batch
+// fails so a single bad request can't fail the others
+func (b *createBatcher) flush(batch []pendingCreate) {
+	ctx, cancel := context.WithTimeout(context.Background(), createBatchTimeout)
+	defer cancel()
+
+	reqs := make([]*store.CreateJobRequest, len(batch))
+	for i, pending := range batch {
+		reqs[i] = pending.req
+	}
+
+	results, err := b.store.CreateJobsBatch(ctx, reqs)
+	if err != nil {
+		for _, pending := range batch {
+			job, err := b.store.CreateJob(ctx, pending.req)
+			pending.result <- store.CreateJobResult{Job: job, Err: err}
+		}
+		return
+	}
+
+	for i, pending := range batch {
+		pending.result <- results[i]
+	}
+}
@@ -0,0 +1,44 @@
+package queue
+
+import (
+	"github.com/goquorra/goquorra/internal/store"
+)
+
+// EnqueuedByLabel is the label recording where a job was enqueued from
+const EnqueuedByLabel = "enqueued_by"
+
+// Enrichment is metadata the server stamps on every user job at enqueue, so
+// producers don't each have to add it
+type Enrichment struct {
+	// Labels are added to every job; labels the producer set take precedence
+	Labels map[string]string
+
+	// StampEnqueuedBy records the request's origin in the enqueued_by label,
+	// replacing any value the producer sent
+	StampEnqueuedBy bool
+}
+
+// SetEnrichment sets the metadata added to user jobs by EnqueueJob
+func (m *Manager) SetEnrichment(enrichment Enrichment) {
+	m.enrichment = enrichment
+}
+
+// enrich applies the configured enrichment to a user job's request
+func (m *Manager) enrich(req *store.CreateJobRequest) {
+	stamp := m.enrichment.StampEnqueuedBy && req.EnqueuedBy != ""
+	if len(m.enrichment.Labels) == 0 && !stamp {
+		return
+	}
+
+	labels := make(map[string]string, len(m.enrichment.Labels)+len(req.Labels)+1)
+	for k, v := range m.enrichment.Labels {
+		labels[k] = v
+	}
+	for k, v := range req.Labels {
+		labels[k] = v
+	}
+	if stamp {
+		labels[EnqueuedByLabel] = req.EnqueuedBy
+	}
+	req.Labels = labels
+}
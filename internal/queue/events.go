@@ -0,0 +1,158 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/goquorra/goquorra/internal/store"
+)
+
+// JobEventType names a step in a job's lifecycle
+type JobEventType string
+
+const (
+	EventCreated   JobEventType = "created"
+	EventLeased    JobEventType = "leased"
+	EventSucceeded JobEventType = "succeeded"
+	EventFailed    JobEventType = "failed"
+	EventDead      JobEventType = "dead"
+	EventExpired   JobEventType = "expired"
+	EventCancelled JobEventType = "cancelled"
+)
+
+// JobEvent is a job lifecycle change with a snapshot of the job taken when
+// the event was dispatched
+type JobEvent struct {
+	Type JobEventType
+	Job  *store.Job
+}
+
+// JobEventFilter selects the events a subscriber receives. Empty fields match everything.
+type JobEventFilter struct {
+	Queue  string
+	Type   string
+	Events []JobEventType
+}
+
+// Matches reports whether the event passes the filter
+func (f JobEventFilter) Matches(event JobEvent) bool {
+	if f.Queue != "" && event.Job.Queue != f.Queue {
+		return false
+	}
+	if f.Type != "" && event.Job.Type != f.Type {
+		return false
+	}
+	if len(f.Events) == 0 {
+		return true
+	}
+	for _, t := range f.Events {
+		if t == event.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// jobEventQueueSize bounds the job changes waiting to be dispatched to
+// subscribers; changes beyond it are dropped
+const jobEventQueueSize = 1024
+
+// jobEventBuffer is how many events a subscriber may fall behind by before
+// further events to it are dropped
+const jobEventBuffer = 64
+
+// jobChange is a job change waiting to be dispatched to subscribers
+type jobChange struct {
+	jobID string
+	event JobEventType
+}
+
+type jobEventSub struct {
+	filter JobEventFilter
+	ch     chan JobEvent
+}
+
+// SubscribeJobEvents streams lifecycle events of jobs matching filter. Events
+// come from the same change notifications that wake WaitForJobChange, so
+// only changes made through this server are seen. The returned function must
+// be called to unsubscribe; it closes the channel.
+func (m *Manager) SubscribeJobEvents(filter JobEventFilter) (<-chan JobEvent, func()) {
+	m.eventOnce.Do(func() {
+		m.eventQueue = make(chan jobChange, jobEventQueueSize)
+		go m.dispatchJobEvents()
+	})
+
+	sub := &jobEventSub{filter: filter, ch: make(chan JobEvent, jobEventBuffer)}
+	m.eventMu.Lock()
+	m.eventSubs[sub] = struct{}{}
+	m.eventMu.Unlock()
+
+	return sub.ch, func() {
+		m.eventMu.Lock()
+		defer m.eventMu.Unlock()
+		if _, ok := m.eventSubs[sub]; ok {
+			delete(m.eventSubs, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// queueJobEvent hands a changed job to the event dispatcher if anyone is subscribed
+func (m *Manager) queueJobEvent(jobID string, event JobEventType) {
+	m.eventMu.Lock()
+	subscribed := len(m.eventSubs) > 0
+	m.eventMu.Unlock()
+	if !subscribed {
+		return
+	}
+
+	select {
+	case m.eventQueue <- jobChange{jobID: jobID, event: event}:
+	default:
+		m.logger.Printf("Job event queue full; dropping event for job %s", jobID)
+	}
+}
+
+// dispatchJobEvents snapshots each changed job and fans the event out to
+// matching subscribers, in the order the changes were made. The event type
+// comes from the change itself, since the job may have moved on by the time
+// it is read.
+func (m *Manager) dispatchJobEvents() {
+	for change := range m.eventQueue {
+		// The change was just written to the primary; a replica may lag it
+		ctx, cancel := context.WithTimeout(store.WithPrimaryReads(context.Background()), 5*time.Second)
+		job, err := m.store.GetJob(ctx, change.jobID)
+		cancel()
+		if err != nil {
+			m.logger.Printf("Failed to read job %s for its event: %v", change.jobID, err)
+			continue
+		}
+
+		event := JobEvent{Type: change.event, Job: job}
+
+		m.eventMu.Lock()
+		for sub := range m.eventSubs {
+			if !sub.filter.Matches(event) {
+				continue
+			}
+			select {
+			case sub.ch <- event:
+			default:
+				// A slow subscriber must not hold up the others
+			}
+		}
+		m.eventMu.Unlock()
+	}
+}
+
+// ackEventType is the lifecycle step an ack moved a job to. A nack that
+// leaves the job pending for a retry is a failure too.
+func ackEventType(success bool, result *store.AckResult) JobEventType {
+	switch {
+	case result.Status == store.StatusDead:
+		return EventDead
+	case success:
+		return EventSucceeded
+	}
+	return EventFailed
+}
@@ -0,0 +1,121 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/goquorra/goquorra/internal/store"
+)
+
+// InlineHandler processes a job synchronously. Returning an error nacks the job.
+type InlineHandler func(ctx context.Context, job *store.Job) error
+
+// inlineWorkerID is recorded as leased_by for jobs run inline
+const inlineWorkerID = "inline"
+
+// inlineLeaseTTL bounds how long an inline handler may hold its job
+const inlineLeaseTTL = 30 * time.Second
+
+var (
+	// ErrInlineDisabled is returned when a job requests inline execution but
+	// the manager hasn't enabled it
+	ErrInlineDisabled = errors.New("inline execution is disabled")
+	// ErrNoInlineHandler is returned when no inline handler is registered for the job type
+	ErrNoInlineHandler = errors.New("no inline handler registered for job type")
+	// ErrInlineScheduled is returned when a job requests inline execution
+	// but is delayed or has a schedule calendar, so it may not be due yet
+	ErrInlineScheduled = errors.New("scheduled jobs can't be executed inline")
+	// ErrInlinePaused is returned when a job requests inline execution
+	// while dispatch or its type is paused, since it couldn't be leased
+	ErrInlinePaused = errors.New("dispatch is paused; jobs can't be executed inline")
+	// ErrInlineLeased is returned when a worker polling the job's queue
+	// leases an inline job before it can run. The job was created and
+	// runs on that worker instead.
+	ErrInlineLeased = errors.New("job was leased by a worker before it could run inline")
+)
+
+// EnableInlineExecution lets EnqueueJob run jobs that request it synchronously
+// with a registered InlineHandler. It is meant for tests and local development,
+// where it exercises the enqueue-lease-ack path without a worker; it must be
+// called before the manager is used.
+func (m *Manager) EnableInlineExecution() {
+	m.inlineEnabled = true
+	if m.inlineHandlers == nil {
+		m.inlineHandlers = make(map[string]InlineHandler)
+	}
+}
+
+// RegisterInlineHandler sets the handler run for inline jobs of jobType
+func (m *Manager) RegisterInlineHandler(jobType string, handler InlineHandler) {
+	if m.inlineHandlers == nil {
+		m.inlineHandlers = make(map[string]InlineHandler)
+	}
+	m.inlineHandlers[jobType] = handler
+}
+
+// checkInline validates an inline request before the job is created
+func (m *Manager) checkInline(ctx context.Context, req *store.CreateJobRequest) error {
+	if !m.inlineEnabled {
+		return ErrInlineDisabled
+	}
+	if _, ok := m.inlineHandlers[req.Type]; !ok {
+		return fmt.Errorf("%w: %s", ErrNoInlineHandler, req.Type)
+	}
+	if req.Delayed() {
+		return fmt.Errorf("%w: the job is delayed", ErrInlineScheduled)
+	}
+	// A schedule calendar may push run_at past business hours, which would
+	// leave the job created but not leasable
+	if req.ScheduleCalendar != "" {
+		return fmt.Errorf("%w: the job has a schedule calendar", ErrInlineScheduled)
+	}
+
+	pause, err := m.store.GetDispatchPause(ctx)
+	if err != nil {
+		return err
+	}
+	if pause != nil {
+		return ErrInlinePaused
+	}
+	pausedTypes, err := m.store.ListPausedJobTypes(ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range pausedTypes {
+		if p.Type == req.Type {
+			return fmt.Errorf("%w: job type %s is paused", ErrInlinePaused, req.Type)
+		}
+	}
+	return nil
+}
+
+// runInline leases the newly created job, runs its handler and acks the
+// outcome, returning the job's state afterwards. The job is pending between
+// its insert and the lease, so a worker may take it first; runInline then
+// returns ErrInlineLeased.
+func (m *Manager) runInline(ctx context.Context, job *store.Job) (*store.Job, error) {
+	leased, err := m.store.LeaseJob(ctx, job.ID, inlineWorkerID, inlineLeaseTTL)
+	if errors.Is(err, store.ErrJobNotLeasable) {
+		return nil, fmt.Errorf("%w: job %s", ErrInlineLeased, job.ID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lease inline job: %w", err)
+	}
+	m.localLeases.add([]*store.Job{leased})
+	m.notifyJobChanged(job.ID, EventLeased)
+
+	ack := store.AckRequest{JobID: leased.ID, LeaseID: leased.LeaseID, Success: true}
+	if err := m.inlineHandlers[leased.Type](ctx, leased); err != nil {
+		ack.Success = false
+		ack.ErrorMessage = err.Error()
+	}
+
+	if _, err := m.AckJob(ctx, ack); err != nil {
+		return nil, fmt.Errorf("failed to ack inline job: %w", err)
+	}
+
+	// The ack was just written, so a replica may not have it yet
+	return m.store.GetJob(store.WithPrimaryReads(ctx), job.ID)
+}
@@ -2,9 +2,14 @@ package queue
 
 import (
 	"context"
+	"encoding/json"
 	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/goquorra/goquorra/internal/metrics"
 	"github.com/goquorra/goquorra/internal/store"
 	"github.com/redis/go-redis/v9"
 )
@@ -13,26 +18,217 @@ import (
 type Manager struct {
 	store       store.Store
 	redisClient *redis.Client
+	metrics     *metrics.Collector
 	logger      *log.Logger
+	fifoQueues  map[string]bool
+
+	// serialQueues allow only one job in flight across all workers
+	serialQueues map[string]bool
+
+	inlineEnabled  bool
+	inlineHandlers map[string]InlineHandler
+
+	// lastTick is the UnixNano time of the scheduler's latest tick
+	lastTick atomic.Int64
+
+	// stuckTTLMultiple is the fraction of its lease TTL a job may be held
+	// before it counts as stuck. stuckQueues remembers which queues last had
+	// stuck jobs so their gauges can be reset; only the scheduler touches it.
+	stuckTTLMultiple float64
+	stuckQueues      map[string]bool
+
+	// traceSampleRate is the fraction of jobs whose non-terminal acks are logged
+	traceSampleRate float64
+
+	aging AgingPolicy
+
+	enrichment Enrichment
+
+	statsSampling StatsSampling
+
+	// createBatcher batches EnqueueJob's inserts when create batching is on
+	createBatcher *createBatcher
+
+	// leasingStopped makes LeaseJobs hand out nothing while the server drains
+	leasingStopped atomic.Bool
+
+	// dispatchPaused caches whether the global pause is set
+	dispatchPaused atomic.Bool
+
+	watchMu  sync.Mutex
+	watchers map[string][]chan struct{}
+
+	// Job event subscribers, and the changed job IDs awaiting dispatch to
+	// them. The dispatcher starts with the first subscription.
+	eventMu    sync.Mutex
+	eventSubs  map[*jobEventSub]struct{}
+	eventQueue chan jobChange
+	eventOnce  sync.Once
+
+	// replays tracks dead-letter replays started on this server
+	replays replayRegistry
+
+	// heartbeats is when each worker/queue pair was last written to the
+	// heartbeat registry
+	heartbeatMu sync.Mutex
+	heartbeats  map[string]time.Time
+
+	retryBudgets retryBudgets
+
+	adaptiveBackoffs adaptiveBackoffs
+
+	recentJobs recentJobsCache
+
+	// queueLimits caps enqueues per second on particular queues
+	queueLimits map[string]*queueRateLimit
+
+	// localLeases are the leases granted by this server, for draining
+	localLeases localLeases
 }
 
-// NewManager creates a new queue manager
-func NewManager(store store.Store, redisClient *redis.Client, logger *log.Logger) *Manager {
+// NewManager creates a new queue manager. metrics may be nil.
+func NewManager(store store.Store, redisClient *redis.Client, metrics *metrics.Collector, logger *log.Logger) *Manager {
 	return &Manager{
 		store:       store,
 		redisClient: redisClient,
+		metrics:     metrics,
 		logger:      logger,
+		watchers:    make(map[string][]chan struct{}),
+		eventSubs:   make(map[*jobEventSub]struct{}),
+		replays:     replayRegistry{replays: make(map[string]*Replay)},
+		heartbeats:  make(map[string]time.Time),
+
+		retryBudgets: retryBudgets{window: DefaultRetryBudgetWindow, queues: make(map[string]*queueRetryBudget)},
+		adaptiveBackoffs: adaptiveBackoffs{
+			policy: AdaptiveBackoff{Window: DefaultAdaptiveBackoffWindow},
+			types:  make(map[string]*slidingWindow),
+		},
+
+		recentJobs: recentJobsCache{ttl: DefaultRecentJobsCacheTTL},
+
+		stuckTTLMultiple: DefaultStuckTTLMultiple,
+		traceSampleRate:  1,
 	}
 }
 
-// EnqueueJob creates a new job
+// AgingPolicy raises the priority of pending jobs that keep waiting, so a
+// steady stream of high-priority work can't starve them. Every Interval, jobs
+// that have waited at least that long since they were due or last aged gain
+// Increment priority, up to MaxPriority. A zero Increment disables aging.
+type AgingPolicy struct {
+	Interval    time.Duration
+	Increment   int
+	MaxPriority int
+}
+
+// SetAgingPolicy enables priority aging; it must be called before StartScheduler
+func (m *Manager) SetAgingPolicy(policy AgingPolicy) {
+	m.aging = policy
+}
+
+// DefaultStuckTTLMultiple flags jobs that have used 80% of their lease TTL
+const DefaultStuckTTLMultiple = 0.8
+
+// SetStuckTTLMultiple sets how many lease TTLs a job may be held before it is
+// reported as stuck. Values below 1 warn before the lease is reclaimed.
+func (m *Manager) SetStuckTTLMultiple(multiple float64) {
+	m.stuckTTLMultiple = multiple
+}
+
+// SetFIFOQueues puts the named queues in FIFO mode, where jobs sharing a
+// partition key are leased one at a time in enqueue order. It must be called
+// before the manager starts serving leases.
+func (m *Manager) SetFIFOQueues(queues []string) {
+	m.fifoQueues = make(map[string]bool)
+	for _, q := range queues {
+		if q = strings.TrimSpace(q); q != "" {
+			m.fifoQueues[q] = true
+		}
+	}
+}
+
+// SetSerialQueues puts the named queues in serial mode, where at most one of
+// their jobs is leased at a time across all workers. It must be called before
+// the manager starts serving leases.
+func (m *Manager) SetSerialQueues(queues []string) {
+	m.serialQueues = make(map[string]bool)
+	for _, q := range queues {
+		if q = strings.TrimSpace(q); q != "" {
+			m.serialQueues[q] = true
+		}
+	}
+}
+
+// EnqueueJob creates a new job. User jobs get the configured enrichment labels
+// (see SetEnrichment), those matching a routing rule are moved to
+// the rule's queue, and retry settings the request leaves unset are taken from
+// the queue's config. Jobs with a schedule calendar are pushed forward to its
+// next business time. Enqueues over the target queue's rate limit fail with
+// a *QueueRateLimitError; see SetQueueRateLimits. If the request asks for
+// inline execution, the job is also run and acked before returning; see
+// EnableInlineExecution.
 func (m *Manager) EnqueueJob(ctx context.Context, req *store.CreateJobRequest) (*store.Job, error) {
-	job, err := m.store.CreateJob(ctx, req)
+	if req.Inline {
+		if err := m.checkInline(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.Kind == "" {
+		req.Kind = store.KindUser
+	}
+	if req.Queue == "" {
+		req.Queue = store.DefaultQueue(req.Kind)
+	}
+
+	if req.Kind == store.KindUser {
+		m.enrich(req)
+		if err := m.applyRouting(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+
+	queueCfg, err := m.store.GetQueueConfig(ctx, req.Queue)
+	if err != nil {
+		return nil, err
+	}
+	if queueCfg != nil {
+		queueCfg.ApplyDefaults(req)
+	}
+
+	if req.ScheduleCalendar != "" {
+		if err := m.applyCalendar(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := m.takeQueueTokens(req.Queue, 1); err != nil {
+		return nil, err
+	}
+
+	job, err := m.createJob(ctx, req)
 	if err != nil {
 		return nil, err
 	}
 
+	if job.Deduplicated {
+		m.logger.Printf("Deduplicated enqueue of job %s (queue=%s, idempotency_key=%s, if_absent=%t, unique_by=%v)",
+			job.ID, job.Queue, req.IdempotencyKey, req.EnqueueIfAbsent, req.UniqueBy)
+		if m.metrics != nil {
+			m.metrics.RecordJobDeduplicated(job.Queue)
+		}
+		return job, nil
+	}
+
 	m.logger.Printf("Enqueued job %s (type=%s, queue=%s, priority=%d)", job.ID, job.Type, job.Queue, job.Priority)
+	if m.metrics != nil {
+		m.metrics.RecordJobCreated(string(job.Kind))
+	}
+	m.notifyJobChanged(job.ID, EventCreated)
+
+	if req.Inline {
+		return m.runInline(ctx, job)
+	}
 
 	// If Redis is available, publish notification
 	if m.redisClient != nil {
@@ -51,34 +247,212 @@ func (m *Manager) GetJob(ctx context.Context, id string) (*store.Job, error) {
 	return m.store.GetJob(ctx, id)
 }
 
-// LeaseJobs leases jobs for a worker
-func (m *Manager) LeaseJobs(ctx context.Context, queue string, workerID string, maxJobs int, leaseTTL time.Duration) ([]*store.Job, error) {
-	jobs, err := m.store.LeaseJobs(ctx, queue, workerID, maxJobs, leaseTTL)
+// GetJobs retrieves several jobs by ID in one round-trip
+func (m *Manager) GetJobs(ctx context.Context, ids []string) (map[string]*store.Job, error) {
+	return m.store.GetJobs(ctx, ids)
+}
+
+// KillJob dead-letters a job an operator knows will never succeed
+func (m *Manager) KillJob(ctx context.Context, id, operator, reason string) (*store.Job, error) {
+	job, err := m.store.KillJob(ctx, id, operator, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	m.logger.Printf("Job %s killed by operator %s (reason=%q)", id, operator, reason)
+	if m.metrics != nil {
+		m.metrics.RecordJobDead(string(store.DeadReasonKilled))
+	}
+	m.notifyJobChanged(id, EventDead)
+	return job, nil
+}
+
+// StealJob revokes a job's lease so the next lease request picks it up; the
+// previous holder's ack or nack is rejected as stale
+func (m *Manager) StealJob(ctx context.Context, id string) (*store.Job, error) {
+	job, err := m.store.StealJob(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
+	m.logger.Printf("Job %s lease revoked, returned to queue %s", id, job.Queue)
+	m.notifyJobChanged(id, "")
+	return job, nil
+}
+
+// ReleaseJob returns a leased job its worker hasn't started to the queue
+// without counting it as an attempt
+func (m *Manager) ReleaseJob(ctx context.Context, jobID, leaseID string, epoch int64) error {
+	if err := m.store.ReleaseJob(ctx, jobID, leaseID, epoch); err != nil {
+		return err
+	}
+	m.notifyJobChanged(jobID, "")
+	return nil
+}
+
+// GetJobsByLeaseID returns the batch of jobs handed out under a lease ID
+func (m *Manager) GetJobsByLeaseID(ctx context.Context, leaseID string) ([]*store.Job, error) {
+	return m.store.GetJobsByLeaseID(ctx, leaseID)
+}
+
+// ListJobAttempts returns a job's attempt history, oldest first
+func (m *Manager) ListJobAttempts(ctx context.Context, jobID string) ([]*store.JobAttempt, error) {
+	return m.store.ListJobAttempts(ctx, jobID)
+}
+
+// LeaseJobs leases jobs for a worker
+func (m *Manager) LeaseJobs(ctx context.Context, queue string, workerID string, maxJobs int, leaseTTL time.Duration, opts store.LeaseOptions) ([]*store.Job, error) {
+	if m.leasingStopped.Load() {
+		return nil, nil
+	}
+	m.recordHeartbeat(ctx, workerID, queue, opts.Weight)
+	queueCfg, err := m.store.GetQueueConfig(ctx, queue)
+	if err != nil {
+		// Fail open, leasing as if the queue had no config
+		m.logger.Printf("Failed to read config for queue %s: %v", queue, err)
+	}
+	if !m.hasMinWorkers(ctx, queue, queueCfg) {
+		return nil, nil
+	}
+	if m.fifoQueues[queue] {
+		opts.FIFO = true
+	}
+	if m.serialQueues[queue] {
+		opts.Serial = true
+	}
+
+	m.expireJobs(ctx, queue)
+
+	var jobs []*store.Job
+	if len(opts.PriorityQuotas) > 0 {
+		jobs, err = m.leaseByPriority(ctx, queue, workerID, maxJobs, leaseTTL, opts)
+	} else {
+		jobs, err = m.store.LeaseJobs(ctx, queue, workerID, maxJobs, leaseTTL, opts)
+	}
+	if err != nil {
+		if len(jobs) == 0 {
+			return nil, err
+		}
+		// Hand out the tiers already leased rather than strand them until their leases expire
+		m.logger.Printf("Partial lease for worker %s from queue %s: %v", workerID, queue, err)
+	}
+
 	if len(jobs) > 0 {
 		m.logger.Printf("Leased %d jobs to worker %s from queue %s", len(jobs), workerID, queue)
 	}
+	m.recordLeases(queue, queueCfg, jobs)
+	m.localLeases.add(jobs)
+
+	for _, job := range jobs {
+		m.notifyJobChanged(job.ID, EventLeased)
+	}
 
 	return jobs, nil
 }
 
+// expireJobs marks the queue's pending jobs that are past their deadline as
+// expired. Failures are only logged: the lease query skips such jobs anyway.
+func (m *Manager) expireJobs(ctx context.Context, queue string) {
+	ids, err := m.store.ExpireJobs(ctx, queue)
+	if err != nil {
+		m.logger.Printf("Error expiring jobs in queue %s: %v", queue, err)
+		return
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	m.logger.Printf("Expired %d jobs past their deadline in queue %s", len(ids), queue)
+	for _, id := range ids {
+		m.notifyJobChanged(id, EventExpired)
+	}
+	if m.metrics != nil {
+		m.metrics.RecordJobsExpired(len(ids))
+	}
+}
+
+// FetchPayload returns the payload of a job leased without one
+func (m *Manager) FetchPayload(ctx context.Context, jobID, leaseID string) (map[string]interface{}, error) {
+	return m.store.FetchPayload(ctx, jobID, leaseID)
+}
+
+// RenewLease extends a held lease to leaseTTL from now, returning the new expiry
+func (m *Manager) RenewLease(ctx context.Context, jobID, leaseID string, epoch int64, leaseTTL time.Duration) (time.Time, error) {
+	return m.store.RenewLease(ctx, jobID, leaseID, epoch, leaseTTL)
+}
+
+// SaveState replaces the checkpoint state of a job held under leaseID
+func (m *Manager) SaveState(ctx context.Context, jobID, leaseID string, epoch int64, state json.RawMessage) error {
+	return m.store.SaveState(ctx, jobID, leaseID, epoch, state)
+}
+
 // AckJob acknowledges job completion
-func (m *Manager) AckJob(ctx context.Context, jobID, leaseID string, success bool, errorMsg string) error {
-	err := m.store.AckJob(ctx, jobID, leaseID, success, errorMsg)
+func (m *Manager) AckJob(ctx context.Context, req store.AckRequest) (*store.AckResult, error) {
+	result, err := m.store.AckJob(ctx, req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if success {
-		m.logger.Printf("Job %s completed successfully", jobID)
-	} else {
-		m.logger.Printf("Job %s failed: %s", jobID, errorMsg)
+	m.notifyJobChanged(req.JobID, ackEventType(req.Success, result))
+	m.recordDead(result)
+	m.recordSLA(result)
+	m.recordAck(result.Type, req.Success)
+
+	if req.Success {
+		m.logger.Printf("Job %s completed successfully", req.JobID)
+	} else if result.DeadReason == store.DeadReasonRetryBudget {
+		m.logger.Printf("Job %s dead: queue %s is over its retry budget: %s", req.JobID, result.Queue, req.ErrorMessage)
+	} else if result.DeadReason == store.DeadReasonFailFast {
+		m.logger.Printf("Job %s dead: type %s is set to fail fast: %s", req.JobID, result.Type, req.ErrorMessage)
+	} else if result.Status == store.StatusDead {
+		m.logger.Printf("Job %s dead (%s): %s", req.JobID, result.DeadReason, req.ErrorMessage)
+	} else if TraceSampled(req.JobID, m.traceSampleRate) {
+		// A failure that will be retried isn't an outcome yet, so only traced jobs log it
+		if result.FrontRequeued {
+			m.logger.Printf("Job %s failed, requeued to front: %s", req.JobID, req.ErrorMessage)
+		} else {
+			m.logger.Printf("Job %s failed: %s", req.JobID, req.ErrorMessage)
+		}
 	}
 
-	return nil
+	return result, nil
+}
+
+// recordDead counts a dead-lettered job by reason
+func (m *Manager) recordDead(result *store.AckResult) {
+	if m.metrics != nil && result.Status == store.StatusDead {
+		m.metrics.RecordJobDead(string(result.DeadReason))
+	}
+}
+
+// recordSLA counts whether a finished job with a deadline met it
+func (m *Manager) recordSLA(result *store.AckResult) {
+	if m.metrics != nil && result.SLAMet != nil {
+		m.metrics.RecordSLA(result.Type, *result.SLAMet)
+	}
+}
+
+// AckJobsBatch acknowledges multiple jobs in a single transaction
+func (m *Manager) AckJobsBatch(ctx context.Context, acks []store.AckRequest) ([]store.AckResult, error) {
+	results, err := m.store.AckJobsBatch(ctx, acks)
+	if err != nil {
+		return nil, err
+	}
+
+	acknowledged := 0
+	for i := range results {
+		if results[i].Acknowledged {
+			acknowledged++
+			m.notifyJobChanged(results[i].JobID, ackEventType(acks[i].Success, &results[i]))
+			m.recordDead(&results[i])
+			m.recordSLA(&results[i])
+			m.recordAck(results[i].Type, acks[i].Success)
+		}
+	}
+
+	m.logger.Printf("Batch acknowledged %d/%d jobs", acknowledged, len(acks))
+
+	return results, nil
 }
 
 // GetQueueStats returns statistics for all queues
@@ -86,41 +460,331 @@ func (m *Manager) GetQueueStats(ctx context.Context) ([]store.QueueStats, error)
 	return m.store.GetQueueStats(ctx)
 }
 
-// GetRecentJobs returns recent jobs
-func (m *Manager) GetRecentJobs(ctx context.Context, limit int) ([]*store.Job, error) {
-	return m.store.GetRecentJobs(ctx, limit)
+// GetSLAStats counts the jobs of jobType, or of every type if empty, that
+// met or missed their deadline within the last window
+func (m *Manager) GetSLAStats(ctx context.Context, jobType string, window time.Duration) (*store.SLAStats, error) {
+	return m.store.GetSLAStats(ctx, jobType, time.Now().Add(-window))
+}
+
+// GetJobsByTimeRange returns a page of jobs created between from and to, newest first
+func (m *Manager) GetJobsByTimeRange(ctx context.Context, from, to time.Time, after *store.JobCursor, limit int) ([]*store.Job, error) {
+	return m.store.GetJobsByTimeRange(ctx, from, to, after, limit)
+}
+
+// ListDeadJobs returns dead-lettered jobs filtered by queue and reason
+func (m *Manager) ListDeadJobs(ctx context.Context, queue string, reason store.DeadReason, limit int) ([]*store.Job, error) {
+	return m.store.ListDeadJobs(ctx, queue, reason, limit)
+}
+
+// GetQueueConfig returns a queue's config, or nil if none has been set
+func (m *Manager) GetQueueConfig(ctx context.Context, queue string) (*store.QueueConfig, error) {
+	return m.store.GetQueueConfig(ctx, queue)
+}
+
+// ListQueueConfigs returns all queue configs
+func (m *Manager) ListQueueConfigs(ctx context.Context) ([]*store.QueueConfig, error) {
+	return m.store.ListQueueConfigs(ctx)
+}
+
+// SetQueueConfig creates or replaces a queue's config
+func (m *Manager) SetQueueConfig(ctx context.Context, cfg *store.QueueConfig) error {
+	if err := m.store.SetQueueConfig(ctx, cfg); err != nil {
+		return err
+	}
+	m.logger.Printf("Updated config for queue %s", cfg.Queue)
+	return nil
+}
+
+// MigrateQueue moves the pending jobs of queue from into queue to, e.g. when
+// consolidating queues, returning how many moved
+func (m *Manager) MigrateQueue(ctx context.Context, from, to string, filter store.MigrateFilter) (int64, error) {
+	moved, err := m.store.MigrateQueue(ctx, from, to, filter)
+	if err != nil {
+		return 0, err
+	}
+	m.logger.Printf("Migrated %d jobs from queue %s to %s", moved, from, to)
+	return moved, nil
+}
+
+// ListRoutingRules returns all routing rules
+func (m *Manager) ListRoutingRules(ctx context.Context) ([]*store.RoutingRule, error) {
+	return m.store.ListRoutingRules(ctx)
+}
+
+// SetRoutingRules replaces all routing rules
+func (m *Manager) SetRoutingRules(ctx context.Context, rules []*store.RoutingRule) error {
+	if err := m.store.SetRoutingRules(ctx, rules); err != nil {
+		return err
+	}
+	m.logger.Printf("Updated routing rules (%d rules)", len(rules))
+	return nil
+}
+
+// ExportJobs returns a page of a queue's jobs ordered by ID; see store.ExportJobs
+func (m *Manager) ExportJobs(ctx context.Context, queue, afterID string, limit int) ([]*store.Job, error) {
+	return m.store.ExportJobs(ctx, queue, afterID, limit)
+}
+
+// ImportJob re-creates an exported job, returning its ID. Imports count
+// against the job's queue rate limit like any other enqueue.
+func (m *Manager) ImportJob(ctx context.Context, job *store.Job, opts store.ImportOptions) (string, error) {
+	if err := m.takeQueueTokens(job.Queue, 1); err != nil {
+		return "", err
+	}
+	id, err := m.store.ImportJob(ctx, job, opts)
+	if err != nil {
+		return "", err
+	}
+	m.notifyJobChanged(id, EventCreated)
+	return id, nil
+}
+
+// ListPausedJobTypes returns the job types excluded from leasing
+func (m *Manager) ListPausedJobTypes(ctx context.Context) ([]*store.PausedJobType, error) {
+	return m.store.ListPausedJobTypes(ctx)
+}
+
+// PauseJobType stops jobs of jobType from being leased on every queue
+func (m *Manager) PauseJobType(ctx context.Context, jobType string) (*store.PausedJobType, error) {
+	paused, err := m.store.PauseJobType(ctx, jobType)
+	if err != nil {
+		return nil, err
+	}
+	m.logger.Printf("Paused job type %s", jobType)
+	return paused, nil
+}
+
+// ResumeJobType lets jobs of jobType be leased again, reporting whether it was paused
+func (m *Manager) ResumeJobType(ctx context.Context, jobType string) (bool, error) {
+	resumed, err := m.store.ResumeJobType(ctx, jobType)
+	if err != nil {
+		return false, err
+	}
+	if resumed {
+		m.logger.Printf("Resumed job type %s", jobType)
+	}
+	return resumed, nil
+}
+
+// ListFailFastJobTypes returns the job types whose failures skip retries
+func (m *Manager) ListFailFastJobTypes(ctx context.Context) ([]*store.FailFastJobType, error) {
+	return m.store.ListFailFastJobTypes(ctx)
+}
+
+// SetJobTypeFailFast makes failures of jobType go straight to the
+// dead-letter queue until cleared
+func (m *Manager) SetJobTypeFailFast(ctx context.Context, jobType string) (*store.FailFastJobType, error) {
+	failFast, err := m.store.SetJobTypeFailFast(ctx, jobType)
+	if err != nil {
+		return nil, err
+	}
+	m.logger.Printf("Job type %s set to fail fast", jobType)
+	return failFast, nil
+}
+
+// ClearJobTypeFailFast lets failures of jobType be retried again, reporting
+// whether it was fail-fast
+func (m *Manager) ClearJobTypeFailFast(ctx context.Context, jobType string) (bool, error) {
+	cleared, err := m.store.ClearJobTypeFailFast(ctx, jobType)
+	if err != nil {
+		return false, err
+	}
+	if cleared {
+		m.logger.Printf("Cleared fail fast for job type %s", jobType)
+	}
+	return cleared, nil
+}
+
+// applyRouting moves the request to the queue of the routing rule matching its type
+func (m *Manager) applyRouting(ctx context.Context, req *store.CreateJobRequest) error {
+	rules, err := m.store.ListRoutingRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	rule := store.MatchRoutingRule(rules, req.Type)
+	if rule == nil || rule.Queue == req.Queue {
+		return nil
+	}
+
+	m.logger.Printf("Rerouting job type %s from queue %s to %s (rule %s)", req.Type, req.Queue, rule.Queue, rule.TypePattern)
+	req.Queue = rule.Queue
+	return nil
+}
+
+// CountStuckJobs returns the number of stuck jobs per queue
+func (m *Manager) CountStuckJobs(ctx context.Context) (map[string]int, error) {
+	return m.store.CountStuckJobs(ctx, m.stuckTTLMultiple)
+}
+
+// SchedulerInterval is how often the scheduler reclaims leases, retries dead
+// jobs and checks for stuck jobs
+const SchedulerInterval = 5 * time.Second
+
+// LastSchedulerTick returns when the scheduler last completed a tick, or the
+// zero time if it hasn't started
+func (m *Manager) LastSchedulerTick() time.Time {
+	nanos := m.lastTick.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// PingRedis checks the Redis connection. It reports false if Redis isn't configured.
+func (m *Manager) PingRedis(ctx context.Context) (bool, error) {
+	if m.redisClient == nil {
+		return false, nil
+	}
+	return true, m.redisClient.Ping(ctx).Err()
 }
 
-// StartScheduler runs a background scheduler that moves delayed jobs to ready state
+// StartScheduler runs the background maintenance tasks: lease reclaim, dead
+// retries, stuck job detection and, when configured, aging and stats
+// sampling. Delayed jobs need no promotion; they are pending all along and
+// the lease query skips them until their run_at passes.
 func (m *Manager) StartScheduler(ctx context.Context) {
-	ticker := time.NewTicker(5 * time.Second)
+	ticker := time.NewTicker(SchedulerInterval)
 	defer ticker.Stop()
 
+	// Aging runs on its own period; a nil channel never fires
+	var agingTick <-chan time.Time
+	if m.aging.Increment > 0 && m.aging.Interval > 0 {
+		agingTicker := time.NewTicker(m.aging.Interval)
+		defer agingTicker.Stop()
+		agingTick = agingTicker.C
+	}
+
+	pruneTicker := time.NewTicker(localLeasePruneInterval)
+	defer pruneTicker.Stop()
+
+	var statsTick <-chan time.Time
+	if m.statsSampling.Interval > 0 {
+		statsTicker := time.NewTicker(m.statsSampling.Interval)
+		defer statsTicker.Stop()
+		statsTick = statsTicker.C
+	}
+
 	m.logger.Println("Scheduler started")
+	m.refreshDispatchPause(ctx)
+	m.lastTick.Store(time.Now().UnixNano())
 
 	for {
 		select {
 		case <-ctx.Done():
 			m.logger.Println("Scheduler stopped")
 			return
+		case <-agingTick:
+			m.ageJobs(ctx)
+		case <-statsTick:
+			m.sampleQueueStats(ctx)
+		case <-pruneTicker.C:
+			m.pruneLocalLeases(ctx)
 		case <-ticker.C:
-			m.processDelayedJobs(ctx)
+			m.reclaimExpiredLeases(ctx)
+			m.retryDeadJobs(ctx)
+			m.pruneHeartbeats(ctx)
+			m.detectStuckJobs(ctx)
+			m.refreshDispatchPause(ctx)
+			m.lastTick.Store(time.Now().UnixNano())
 		}
 	}
 }
 
-func (m *Manager) processDelayedJobs(ctx context.Context) {
-	jobs, err := m.store.GetPendingDelayedJobs(ctx, 100)
+// ageJobs applies one round of the aging policy
+func (m *Manager) ageJobs(ctx context.Context) {
+	aged, err := m.store.AgeJobs(ctx, m.aging.Increment, m.aging.MaxPriority, time.Now().Add(-m.aging.Interval))
 	if err != nil {
-		m.logger.Printf("Error fetching delayed jobs: %v", err)
+		m.logger.Printf("Error aging jobs: %v", err)
+		return
+	}
+	if aged == 0 {
 		return
 	}
 
-	if len(jobs) > 0 {
-		m.logger.Printf("Processing %d delayed jobs", len(jobs))
-		for _, job := range jobs {
-			// Jobs are already pending and past their run_at time, so they're ready to be leased
-			// No action needed here - the query already filters for ready jobs
+	m.logger.Printf("Raised the priority of %d waiting jobs", aged)
+	if m.metrics != nil {
+		m.metrics.RecordJobsAged(aged)
+	}
+}
+
+// reclaimExpiredLeases returns jobs with expired leases or visibility timeouts to the queue
+func (m *Manager) reclaimExpiredLeases(ctx context.Context) {
+	ids, dead, err := m.store.ReclaimExpiredLeases(ctx)
+	if err != nil {
+		m.logger.Printf("Error reclaiming expired leases: %v", err)
+		return
+	}
+
+	if len(ids) > 0 {
+		m.logger.Printf("Reclaimed %d jobs with expired leases (%d dead)", len(ids), len(dead))
+		deadIDs := make(map[string]bool, len(dead))
+		for _, id := range dead {
+			deadIDs[id] = true
+		}
+		// A lapsed lease counts as a failed attempt
+		for _, id := range ids {
+			if deadIDs[id] {
+				m.notifyJobChanged(id, EventDead)
+			} else {
+				m.notifyJobChanged(id, EventFailed)
+			}
+		}
+	}
+
+	if m.metrics != nil {
+		for range dead {
+			m.metrics.RecordJobDead(string(store.DeadReasonExpired))
+		}
+	}
+}
+
+// retryDeadJobs returns dead jobs that opted into dead retries to the queue
+// once their next retry is due
+func (m *Manager) retryDeadJobs(ctx context.Context) {
+	ids, err := m.store.RetryDeadJobs(ctx)
+	if err != nil {
+		m.logger.Printf("Error retrying dead jobs: %v", err)
+		return
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	m.logger.Printf("Returned %d dead jobs to pending for another try", len(ids))
+	for _, id := range ids {
+		m.notifyJobChanged(id, "")
+	}
+	if m.metrics != nil {
+		m.metrics.RecordJobsDeadRetried(len(ids))
+	}
+}
+
+// detectStuckJobs refreshes the stuck job gauges and logs queues with stuck jobs
+func (m *Manager) detectStuckJobs(ctx context.Context) {
+	counts, err := m.CountStuckJobs(ctx)
+	if err != nil {
+		m.logger.Printf("Error counting stuck jobs: %v", err)
+		return
+	}
+
+	for queue, count := range counts {
+		m.logger.Printf("Queue %s has %d stuck jobs", queue, count)
+	}
+
+	if m.metrics != nil {
+		for queue := range m.stuckQueues {
+			if _, ok := counts[queue]; !ok {
+				m.metrics.UpdateStuckJobs(queue, 0)
+			}
+		}
+		for queue, count := range counts {
+			m.metrics.UpdateStuckJobs(queue, count)
 		}
 	}
+
+	m.stuckQueues = make(map[string]bool, len(counts))
+	for queue := range counts {
+		m.stuckQueues[queue] = true
+	}
 }
@@ -0,0 +1,59 @@
+package queue
+
+import (
+	"context"
+
+	"github.com/goquorra/goquorra/internal/store"
+)
+
+// PauseDispatch stops every queue handing out jobs, on every server, until
+// ResumeDispatch. Job type pauses are left as they are.
+func (m *Manager) PauseDispatch(ctx context.Context) (*store.DispatchPause, error) {
+	pause, err := m.store.PauseDispatch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !m.dispatchPaused.Swap(true) {
+		m.logger.Printf("Paused dispatch on every queue")
+	}
+	m.setDispatchPausedMetric(true)
+	return pause, nil
+}
+
+// ResumeDispatch lets jobs be leased again, reporting whether dispatch was paused
+func (m *Manager) ResumeDispatch(ctx context.Context) (bool, error) {
+	resumed, err := m.store.ResumeDispatch(ctx)
+	if err != nil {
+		return false, err
+	}
+	if resumed {
+		m.logger.Printf("Resumed dispatch")
+	}
+	m.dispatchPaused.Store(false)
+	m.setDispatchPausedMetric(false)
+	return resumed, nil
+}
+
+// DispatchPaused reports whether dispatch was paused as of this server's
+// last scheduler tick, or its own latest pause or resume. It doesn't hit
+// the store; leasing always checks the stored pause.
+func (m *Manager) DispatchPaused() bool {
+	return m.dispatchPaused.Load()
+}
+
+// refreshDispatchPause picks up pauses and resumes made through other servers
+func (m *Manager) refreshDispatchPause(ctx context.Context) {
+	pause, err := m.store.GetDispatchPause(ctx)
+	if err != nil {
+		m.logger.Printf("Error reading dispatch pause: %v", err)
+		return
+	}
+	m.dispatchPaused.Store(pause != nil)
+	m.setDispatchPausedMetric(pause != nil)
+}
+
+func (m *Manager) setDispatchPausedMetric(paused bool) {
+	if m.metrics != nil {
+		m.metrics.SetDispatchPaused(paused)
+	}
+}
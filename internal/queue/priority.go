@@ -0,0 +1,58 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/goquorra/goquorra/internal/store"
+)
+
+// leaseByPriority fills a lease batch tier by tier, highest priority first.
+// Slots reserved for a tier that it couldn't fill are held back from every
+// lower tier, so a flood of low-priority jobs never takes the whole batch.
+func (m *Manager) leaseByPriority(ctx context.Context, queue, workerID string, maxJobs int, leaseTTL time.Duration, opts store.LeaseOptions) ([]*store.Job, error) {
+	tiers := append([]store.PriorityQuota(nil), opts.PriorityQuotas...)
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].MinPriority > tiers[j].MinPriority })
+
+	var (
+		leased   []*store.Job
+		held     int
+		upper    *int
+		tierOpts = opts
+	)
+	tierOpts.PriorityQuotas = nil
+
+	lease := func(atLeast *int, limit int) (int, error) {
+		if limit <= 0 {
+			return 0, nil
+		}
+		tierOpts.PriorityAtLeast = atLeast
+		tierOpts.PriorityBelow = upper
+		jobs, err := m.store.LeaseJobs(ctx, queue, workerID, limit, leaseTTL, tierOpts)
+		if err != nil {
+			return 0, err
+		}
+		leased = append(leased, jobs...)
+		return len(jobs), nil
+	}
+
+	for i := range tiers {
+		minPriority := tiers[i].MinPriority
+		n, err := lease(&minPriority, maxJobs-len(leased)-held)
+		if err != nil {
+			return leased, err
+		}
+		if unfilled := tiers[i].Reserved - n; unfilled > 0 {
+			held += unfilled
+		}
+		upper = &minPriority
+	}
+
+	// Everything below the lowest tier shares what's left
+	if _, err := lease(nil, maxJobs-len(leased)-held); err != nil {
+		return leased, err
+	}
+
+	return leased, nil
+}
@@ -0,0 +1,128 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/goquorra/goquorra/internal/store"
+)
+
+// ErrQueueRateLimited is returned, wrapped in a *QueueRateLimitError, when an
+// enqueue would exceed its queue's rate limit; see SetQueueRateLimits
+var ErrQueueRateLimited = errors.New("queue rate limit exceeded")
+
+// QueueRateLimitError reports which queue's limit an enqueue hit and how
+// long until it would be accepted
+type QueueRateLimitError struct {
+	Queue      string
+	RPS        float64
+	RetryAfter time.Duration
+}
+
+func (e *QueueRateLimitError) Error() string {
+	return fmt.Sprintf("%v for queue %s (%v jobs per second)", ErrQueueRateLimited, e.Queue, e.RPS)
+}
+
+func (e *QueueRateLimitError) Unwrap() error {
+	return ErrQueueRateLimited
+}
+
+// TokenBucket allows rate events per second on average, with bursts of up
+// to a second's worth
+type TokenBucket struct {
+	rate float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a full bucket allowing rate events per second
+func NewTokenBucket(rate float64) *TokenBucket {
+	return &TokenBucket{rate: rate, tokens: burst(rate), last: time.Now()}
+}
+
+// burst is how many events a bucket holds when full
+func burst(rate float64) float64 {
+	return math.Max(rate, 1)
+}
+
+// Take consumes n tokens if at least one is available, letting the bucket
+// go into debt so that a group larger than the burst still gets through and
+// holds back what follows. Otherwise it reports how long until a token is.
+func (b *TokenBucket) Take(now time.Time, n int) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = math.Min(burst(b.rate), b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens -= float64(n)
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// refund returns n tokens taken for events that didn't happen after all
+func (b *TokenBucket) refund(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(burst(b.rate), b.tokens+float64(n))
+}
+
+// queueRateLimit is a queue's bucket and the limit it was built with
+type queueRateLimit struct {
+	bucket *TokenBucket
+	rps    float64
+}
+
+// SetQueueRateLimits caps how many jobs per second each listed queue
+// accepts, whichever way they are enqueued: single creates, batches,
+// workflow nodes and imports all count, against the queue they land in
+// after routing. Enqueues over the limit fail with a *QueueRateLimitError.
+// It must be called before the manager is used.
+func (m *Manager) SetQueueRateLimits(rps map[string]float64) {
+	m.queueLimits = make(map[string]*queueRateLimit, len(rps))
+	for queue, r := range rps {
+		m.queueLimits[queue] = &queueRateLimit{bucket: NewTokenBucket(r), rps: r}
+	}
+}
+
+// takeQueueTokens charges n jobs to queue's rate limit, if it has one
+func (m *Manager) takeQueueTokens(queue string, n int) error {
+	limit, ok := m.queueLimits[queue]
+	if !ok {
+		return nil
+	}
+	if ok, wait := limit.bucket.Take(time.Now(), n); !ok {
+		return &QueueRateLimitError{Queue: queue, RPS: limit.rps, RetryAfter: wait}
+	}
+	return nil
+}
+
+// takeWorkflowTokens charges a workflow's nodes to their queues' limits. If
+// one queue is over its limit the others are refunded, so a rejected
+// workflow doesn't use up their tokens.
+func (m *Manager) takeWorkflowTokens(nodes []store.WorkflowNodeRequest) error {
+	counts := make(map[string]int)
+	for i := range nodes {
+		if _, ok := m.queueLimits[nodes[i].Job.Queue]; ok {
+			counts[nodes[i].Job.Queue]++
+		}
+	}
+	charged := make(map[string]int, len(counts))
+	for queue, n := range counts {
+		if err := m.takeQueueTokens(queue, n); err != nil {
+			for queue, n := range charged {
+				m.queueLimits[queue].bucket.refund(n)
+			}
+			return err
+		}
+		charged[queue] = n
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/goquorra/goquorra/internal/store"
+)
+
+// DefaultRecentJobsCacheTTL is how long a recent-jobs result is reused by default
+const DefaultRecentJobsCacheTTL = 500 * time.Millisecond
+
+// recentJobsCache holds the latest recent-jobs result so dashboards polling
+// at once share one query. Only one kind and limit is cached at a time.
+type recentJobsCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	kind      store.JobKind
+	limit     int
+	jobs      []*store.Job
+	fetchedAt time.Time
+}
+
+// SetRecentJobsCacheTTL sets how long GetRecentJobs reuses a result; zero
+// disables the cache
+func (m *Manager) SetRecentJobsCacheTTL(ttl time.Duration) {
+	m.recentJobs.mu.Lock()
+	defer m.recentJobs.mu.Unlock()
+	m.recentJobs.ttl = ttl
+	m.recentJobs.fetchedAt = time.Time{}
+}
+
+// GetRecentJobs returns recent jobs, optionally only those of one kind. A
+// result less than the cache TTL old for the same kind and limit is reused,
+// so callers must not modify the returned jobs.
+func (m *Manager) GetRecentJobs(ctx context.Context, kind store.JobKind, limit int) ([]*store.Job, error) {
+	c := &m.recentJobs
+	c.mu.Lock()
+	if c.ttl <= 0 {
+		c.mu.Unlock()
+		return m.store.GetRecentJobs(ctx, kind, limit)
+	}
+	// The lock is held across the query so concurrent callers wait for it
+	// and reuse its result rather than each running their own
+	defer c.mu.Unlock()
+
+	if !c.fetchedAt.IsZero() && c.kind == kind && c.limit == limit && time.Since(c.fetchedAt) < c.ttl {
+		m.recordRecentJobsCache(true)
+		return c.jobs, nil
+	}
+	m.recordRecentJobsCache(false)
+
+	jobs, err := m.store.GetRecentJobs(ctx, kind, limit)
+	if err != nil {
+		return nil, err
+	}
+	c.kind, c.limit, c.jobs, c.fetchedAt = kind, limit, jobs, time.Now()
+	return jobs, nil
+}
+
+func (m *Manager) recordRecentJobsCache(hit bool) {
+	if m.metrics != nil {
+		m.metrics.RecordRecentJobsCache(hit)
+	}
+}
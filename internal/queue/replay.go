@@ -0,0 +1,141 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/goquorra/goquorra/internal/store"
+)
+
+// ReplayStatus is the state of a dead-letter replay
+type ReplayStatus string
+
+const (
+	ReplayRunning   ReplayStatus = "running"
+	ReplayCompleted ReplayStatus = "completed"
+	ReplayFailed    ReplayStatus = "failed"
+)
+
+// replayRetention is how long finished replays stay queryable
+const replayRetention = 24 * time.Hour
+
+// replayQueryTimeout bounds each batch a replay requeues
+const replayQueryTimeout = 30 * time.Second
+
+// Replay is a background task requeueing dead jobs at a bounded rate
+type Replay struct {
+	ID            string              `json:"id"`
+	Filter        store.DeadJobFilter `json:"filter"`
+	JobsPerSecond int                 `json:"jobs_per_second"`
+	Status        ReplayStatus        `json:"status"`
+	Total         int                 `json:"total"`
+	Replayed      int                 `json:"replayed"`
+	Error         string              `json:"error,omitempty"`
+	StartedAt     time.Time           `json:"started_at"`
+	FinishedAt    *time.Time          `json:"finished_at,omitempty"`
+}
+
+// replayRegistry tracks the replays started on this server
+type replayRegistry struct {
+	mu      sync.Mutex
+	replays map[string]*Replay
+}
+
+// StartReplay starts requeueing the dead jobs matching filter in the
+// background, at most jobsPerSecond per second, and returns the replay for
+// progress tracking. Jobs that die after the replay starts are left alone
+// unless the filter's time range says otherwise.
+func (m *Manager) StartReplay(ctx context.Context, filter store.DeadJobFilter, jobsPerSecond int) (*Replay, error) {
+	if filter.DeadBefore == nil {
+		// Don't chase jobs that die again during the replay
+		now := time.Now()
+		filter.DeadBefore = &now
+	}
+
+	total, err := m.store.CountDeadJobs(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	replay := &Replay{
+		ID:            uuid.New().String(),
+		Filter:        filter,
+		JobsPerSecond: jobsPerSecond,
+		Status:        ReplayRunning,
+		Total:         total,
+		StartedAt:     time.Now(),
+	}
+
+	m.replays.mu.Lock()
+	for id, r := range m.replays.replays {
+		if r.FinishedAt != nil && time.Since(*r.FinishedAt) > replayRetention {
+			delete(m.replays.replays, id)
+		}
+	}
+	m.replays.replays[replay.ID] = replay
+	snapshot := *replay
+	m.replays.mu.Unlock()
+
+	m.logger.Printf("Started dead-letter replay %s of %d jobs at %d/s", replay.ID, total, jobsPerSecond)
+	go m.runReplay(replay)
+	return &snapshot, nil
+}
+
+// GetReplay returns a snapshot of a replay's progress, or nil if this server
+// doesn't know the ID
+func (m *Manager) GetReplay(id string) *Replay {
+	m.replays.mu.Lock()
+	defer m.replays.mu.Unlock()
+
+	replay, ok := m.replays.replays[id]
+	if !ok {
+		return nil
+	}
+	snapshot := *replay
+	return &snapshot
+}
+
+// runReplay requeues one batch of jobsPerSecond jobs every second until no
+// matching dead jobs are left
+func (m *Manager) runReplay(replay *Replay) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), replayQueryTimeout)
+		ids, err := m.store.ReplayDeadJobs(ctx, replay.Filter, replay.JobsPerSecond)
+		cancel()
+
+		for _, id := range ids {
+			m.notifyJobChanged(id, "")
+		}
+
+		m.replays.mu.Lock()
+		replay.Replayed += len(ids)
+		done := err != nil || len(ids) < replay.JobsPerSecond
+		if done {
+			now := time.Now()
+			replay.FinishedAt = &now
+			replay.Status = ReplayCompleted
+			if err != nil {
+				replay.Status = ReplayFailed
+				replay.Error = err.Error()
+			}
+		}
+		replayed := replay.Replayed
+		m.replays.mu.Unlock()
+
+		if done {
+			if err != nil {
+				m.logger.Printf("Dead-letter replay %s failed after %d jobs: %v", replay.ID, replayed, err)
+			} else {
+				m.logger.Printf("Dead-letter replay %s finished: %d jobs requeued", replay.ID, replayed)
+			}
+			return
+		}
+
+		<-ticker.C
+	}
+}
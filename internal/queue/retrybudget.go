@@ -0,0 +1,133 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/goquorra/goquorra/internal/store"
+)
+
+// DefaultRetryBudgetWindow is how far back a queue's retry share is measured by default
+const DefaultRetryBudgetWindow = time.Minute
+
+// minRetryBudgetLeases is how many leases the window must hold before a
+// budget is enforced, so a quiet queue isn't cut off by its first retry
+const minRetryBudgetLeases = 20
+
+// RetryBudgetStatus reports a queue's retry budget over the current window.
+// Leases are counted on this server only.
+type RetryBudgetStatus struct {
+	Percent       int     `json:"percent"`
+	WindowSeconds float64 `json:"window_seconds"`
+	FreshLeases   int     `json:"fresh_leases"`
+	RetryLeases   int     `json:"retry_leases"`
+	RetryRatio    float64 `json:"retry_ratio"`
+	Exhausted     bool    `json:"exhausted"`
+}
+
+// queueRetryBudget counts a queue's fresh leases and retry leases
+type queueRetryBudget struct {
+	percent int
+	leases  slidingWindow
+}
+
+// retryBudgets tracks, per queue, how many recent leases were of jobs that
+// had already failed
+type retryBudgets struct {
+	mu     sync.Mutex
+	window time.Duration
+	queues map[string]*queueRetryBudget
+}
+
+// SetRetryBudgetWindow sets how far back retry budgets look
+func (m *Manager) SetRetryBudgetWindow(window time.Duration) {
+	m.retryBudgets.mu.Lock()
+	defer m.retryBudgets.mu.Unlock()
+	m.retryBudgets.window = window
+}
+
+// RetryBudgetExhausted reports whether queue's retries have used up its
+// budget, meaning failures should be dead-lettered rather than retried. The
+// store consults it from the ack path.
+func (m *Manager) RetryBudgetExhausted(queue string) bool {
+	return m.retryBudgets.status(queue, time.Now()).Exhausted
+}
+
+// RetryBudgetStatus returns queue's retry budget and recent lease mix
+func (m *Manager) RetryBudgetStatus(ctx context.Context, queue string) (RetryBudgetStatus, error) {
+	cfg, err := m.store.GetQueueConfig(ctx, queue)
+	if err != nil {
+		return RetryBudgetStatus{}, err
+	}
+	percent := 0
+	if cfg != nil {
+		percent = cfg.RetryBudgetPercent
+	}
+	m.retryBudgets.setPercent(queue, percent)
+	return m.retryBudgets.status(queue, time.Now()), nil
+}
+
+// recordLeases counts leased jobs toward queue's retry budget; jobs with
+// attempts behind them are retries
+func (m *Manager) recordLeases(queue string, cfg *store.QueueConfig, jobs []*store.Job) {
+	percent := 0
+	if cfg != nil {
+		percent = cfg.RetryBudgetPercent
+	}
+	retries := 0
+	for _, job := range jobs {
+		if job.Attempts > 0 {
+			retries++
+		}
+	}
+	m.retryBudgets.record(queue, percent, len(jobs)-retries, retries, time.Now())
+}
+
+func (b *retryBudgets) queue(name string) *queueRetryBudget {
+	q, ok := b.queues[name]
+	if !ok {
+		q = &queueRetryBudget{}
+		b.queues[name] = q
+	}
+	return q
+}
+
+func (b *retryBudgets) setPercent(queue string, percent int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.queue(queue).percent = percent
+}
+
+func (b *retryBudgets) record(queue string, percent, fresh, retries int, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q := b.queue(queue)
+	q.percent = percent
+	if fresh == 0 && retries == 0 {
+		return
+	}
+	q.leases.add(b.window, now, fresh, retries)
+}
+
+func (b *retryBudgets) status(queue string, now time.Time) RetryBudgetStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := RetryBudgetStatus{WindowSeconds: b.window.Seconds()}
+	q, ok := b.queues[queue]
+	if !ok {
+		return status
+	}
+	status.Percent = q.percent
+	status.FreshLeases, status.RetryLeases = q.leases.sum(b.window, now)
+
+	total := status.FreshLeases + status.RetryLeases
+	if total > 0 {
+		status.RetryRatio = float64(status.RetryLeases) / float64(total)
+	}
+	status.Exhausted = q.percent > 0 && total >= minRetryBudgetLeases &&
+		status.RetryLeases*100 > q.percent*total
+	return status
+}
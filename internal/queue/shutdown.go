@@ -0,0 +1,123 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/goquorra/goquorra/internal/store"
+)
+
+// drainPollInterval is how often WaitForInFlight re-counts leased jobs, and
+// drainCountTimeout bounds each count
+const (
+	drainPollInterval = 500 * time.Millisecond
+	drainCountTimeout = 2 * time.Second
+)
+
+// localLeasePruneInterval is how often the scheduler forgets this server's
+// leases that no longer hold any job
+const localLeasePruneInterval = time.Minute
+
+// localLeases remembers the lease IDs this server has granted, so that a
+// draining server waits for its own workers' jobs and not the whole
+// cluster's. LeaseJobs uses one lease ID per batch, so there are far fewer
+// IDs than jobs.
+type localLeases struct {
+	mu  sync.Mutex
+	ids map[string]struct{}
+}
+
+func (l *localLeases) add(jobs []*store.Job) {
+	if len(jobs) == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ids == nil {
+		l.ids = make(map[string]struct{})
+	}
+	for _, job := range jobs {
+		l.ids[job.LeaseID] = struct{}{}
+	}
+}
+
+func (l *localLeases) list() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ids := make([]string, 0, len(l.ids))
+	for id := range l.ids {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// keep forgets the listed leases that aren't in held. Leases granted since
+// the list was taken weren't counted, so they are kept.
+func (l *localLeases) keep(listed []string, held map[string]int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, id := range listed {
+		if held[id] == 0 {
+			delete(l.ids, id)
+		}
+	}
+}
+
+// StopLeasing makes LeaseJobs return no jobs from now on, so that the jobs
+// already leased can drain during shutdown. Acks are still accepted.
+func (m *Manager) StopLeasing() {
+	m.leasingStopped.Store(true)
+}
+
+// CountInFlightJobs returns the number of jobs this server leased that are
+// still leased or processing. Jobs other servers leased aren't counted.
+func (m *Manager) CountInFlightJobs(ctx context.Context) (int, error) {
+	listed := m.localLeases.list()
+	if len(listed) == 0 {
+		return 0, nil
+	}
+	held, err := m.store.CountInFlightByLease(ctx, listed)
+	if err != nil {
+		return 0, err
+	}
+	m.localLeases.keep(listed, held)
+
+	count := 0
+	for _, n := range held {
+		count += n
+	}
+	return count, nil
+}
+
+// pruneLocalLeases forgets this server's leases whose jobs have all been
+// acked, released, stolen or reclaimed
+func (m *Manager) pruneLocalLeases(ctx context.Context) {
+	if _, err := m.CountInFlightJobs(ctx); err != nil {
+		m.logger.Printf("Error pruning local leases: %v", err)
+	}
+}
+
+// WaitForInFlight polls until none of the jobs this server leased are in
+// flight or ctx is done, and returns the number still in flight when it
+// stopped waiting
+func (m *Manager) WaitForInFlight(ctx context.Context) (int, error) {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Count with a fresh context so the final count survives ctx expiring
+		countCtx, cancel := context.WithTimeout(context.Background(), drainCountTimeout)
+		inFlight, err := m.CountInFlightJobs(countCtx)
+		cancel()
+		if err != nil || inFlight == 0 {
+			return inFlight, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return inFlight, nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/goquorra/goquorra/internal/store"
+)
+
+// StatsSampling snapshots every queue's job counts by status each Interval
+// into the stats history, keeping samples for Retention. A zero Interval
+// disables sampling.
+type StatsSampling struct {
+	Interval  time.Duration
+	Retention time.Duration
+}
+
+// statsHistoryPoints is roughly how many points GetQueueStatsHistory returns
+// for any window
+const statsHistoryPoints = 60
+
+// SetStatsSampling enables queue stats sampling; it must be called before StartScheduler
+func (m *Manager) SetStatsSampling(sampling StatsSampling) {
+	m.statsSampling = sampling
+}
+
+// GetQueueStatsHistory returns a queue's job counts by status over the last
+// window, downsampled to about statsHistoryPoints points, along with the
+// bucket size used
+func (m *Manager) GetQueueStatsHistory(ctx context.Context, queue string, window time.Duration) ([]store.QueueStatsPoint, time.Duration, error) {
+	bucket := window / statsHistoryPoints
+	if bucket < m.statsSampling.Interval {
+		bucket = m.statsSampling.Interval
+	}
+	bucket = bucket.Truncate(time.Second)
+	if bucket < time.Second {
+		bucket = time.Second
+	}
+
+	points, err := m.store.GetQueueStatsHistory(ctx, queue, time.Now().Add(-window), bucket)
+	return points, bucket, err
+}
+
+// sampleQueueStats records one stats sample and drops samples past retention
+func (m *Manager) sampleQueueStats(ctx context.Context) {
+	now := time.Now()
+	if _, err := m.store.RecordQueueStatsSample(ctx, now); err != nil {
+		m.logger.Printf("Error sampling queue stats: %v", err)
+		return
+	}
+
+	pruned, err := m.store.PruneQueueStatsHistory(ctx, now.Add(-m.statsSampling.Retention))
+	if err != nil {
+		m.logger.Printf("Error pruning queue stats history: %v", err)
+		return
+	}
+	if pruned > 0 {
+		m.logger.Printf("Pruned %d queue stats samples older than %v", pruned, m.statsSampling.Retention)
+	}
+}
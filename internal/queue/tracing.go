@@ -0,0 +1,34 @@
+package queue
+
+import "hash/fnv"
+
+// TraceSampled reports whether a job is in the sampled fraction rate of jobs
+// that get verbose lifecycle logging. It hashes the job ID rather than
+// rolling a die, so the server and its workers agree on which jobs are
+// traced without coordinating.
+func TraceSampled(jobID string, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+	h := fnv.New64a()
+	h.Write([]byte(jobID))
+	// FNV's high bits barely change between IDs that differ only at the
+	// end, so mix them (murmur3's finalizer) before mapping onto [0, 1)
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return float64(x>>11)/(1<<53) < rate
+}
+
+// SetTraceSampleRate sets the fraction of jobs, from 0 to 1, whose
+// non-terminal acks (retried nacks and front requeues) are logged; see
+// TraceSampled. The default of 1 logs every ack.
+func (m *Manager) SetTraceSampleRate(rate float64) {
+	m.traceSampleRate = rate
+}
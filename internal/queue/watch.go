@@ -0,0 +1,100 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/goquorra/goquorra/internal/store"
+)
+
+// WaitForJobChange blocks until the job's status differs from knownStatus or
+// the timeout elapses, then returns the job's current state. If knownStatus is
+// empty, the status at the time of the call is used as the baseline.
+func (m *Manager) WaitForJobChange(ctx context.Context, jobID string, knownStatus store.JobStatus, timeout time.Duration) (*store.Job, error) {
+	// Subscribe before reading so a change between the read and the wait is not missed
+	ch, unwatch := m.watchJob(jobID)
+	defer unwatch()
+
+	// Notifications follow writes to the primary, which a replica may not
+	// have caught up with
+	ctx = store.WithPrimaryReads(ctx)
+
+	job, err := m.store.GetJob(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	if knownStatus == "" {
+		knownStatus = job.Status
+	}
+	if job.Status != knownStatus {
+		return job, nil
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+			return m.store.GetJob(ctx, jobID)
+		case <-ch:
+			job, err := m.store.GetJob(ctx, jobID)
+			if err != nil {
+				return nil, err
+			}
+			if job.Status != knownStatus {
+				return job, nil
+			}
+		}
+	}
+}
+
+// watchJob registers interest in changes to a job. The returned function must
+// be called to release the subscription.
+func (m *Manager) watchJob(jobID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	m.watchMu.Lock()
+	m.watchers[jobID] = append(m.watchers[jobID], ch)
+	m.watchMu.Unlock()
+
+	return ch, func() {
+		m.watchMu.Lock()
+		defer m.watchMu.Unlock()
+
+		watchers := m.watchers[jobID]
+		for i, w := range watchers {
+			if w == ch {
+				watchers = append(watchers[:i], watchers[i+1:]...)
+				break
+			}
+		}
+		if len(watchers) == 0 {
+			delete(m.watchers, jobID)
+		} else {
+			m.watchers[jobID] = watchers
+		}
+	}
+}
+
+// notifyJobChanged wakes any goroutines waiting on the given job and
+// publishes the change to job event subscribers as event. Changes that
+// aren't a lifecycle step, such as a revoked lease, pass an empty event and
+// only wake waiters.
+func (m *Manager) notifyJobChanged(jobID string, event JobEventType) {
+	m.watchMu.Lock()
+	for _, ch := range m.watchers[jobID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	m.watchMu.Unlock()
+
+	if event != "" {
+		m.queueJobEvent(jobID, event)
+	}
+}
@@ -0,0 +1,42 @@
+package queue
+
+import "time"
+
+// windowBuckets is how many slices a sliding window is split into; the
+// oldest slice drops off as time moves on
+const windowBuckets = 10
+
+type windowBucket struct {
+	start time.Time
+	a, b  int
+}
+
+// slidingWindow keeps two event counts over the last window of time, in
+// windowBuckets slices
+type slidingWindow struct {
+	buckets [windowBuckets]windowBucket
+}
+
+// add counts a and b events at now
+func (w *slidingWindow) add(window time.Duration, now time.Time, a, b int) {
+	slot := window / windowBuckets
+	start := now.Truncate(slot)
+	bucket := &w.buckets[(start.UnixNano()/int64(slot))%windowBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = windowBucket{start: start}
+	}
+	bucket.a += a
+	bucket.b += b
+}
+
+// sum returns the a and b events counted within window of now
+func (w *slidingWindow) sum(window time.Duration, now time.Time) (a, b int) {
+	cutoff := now.Add(-window)
+	for _, bucket := range w.buckets {
+		if bucket.start.After(cutoff) {
+			a += bucket.a
+			b += bucket.b
+		}
+	}
+	return a, b
+}
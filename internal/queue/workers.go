@@ -0,0 +1,115 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/goquorra/goquorra/internal/store"
+)
+
+// WorkerHealthyWindow is how recently a worker must have leased from a queue
+// to count as one of its healthy workers
+const WorkerHealthyWindow = time.Minute
+
+// heartbeatInterval throttles how often a worker's polls are written to the
+// heartbeat registry; workers poll far more often than this
+const heartbeatInterval = 10 * time.Second
+
+// heartbeatRetention is how long workers that stopped polling stay in the
+// registry before the scheduler prunes them
+const heartbeatRetention = 24 * time.Hour
+
+// recordHeartbeat registers workerID as alive on queue with the given
+// capacity weight, at most once per heartbeatInterval
+func (m *Manager) recordHeartbeat(ctx context.Context, workerID, queue string, weight int) {
+	key := workerID + "\x00" + queue
+	now := time.Now()
+
+	m.heartbeatMu.Lock()
+	last := m.heartbeats[key]
+	due := now.Sub(last) >= heartbeatInterval
+	if due {
+		m.heartbeats[key] = now
+	}
+	m.heartbeatMu.Unlock()
+	if !due {
+		return
+	}
+
+	if err := m.store.RecordWorkerHeartbeat(ctx, workerID, queue, weight); err != nil {
+		m.logger.Printf("Failed to record heartbeat for worker %s: %v", workerID, err)
+		// Retry on the next poll
+		m.heartbeatMu.Lock()
+		m.heartbeats[key] = last
+		m.heartbeatMu.Unlock()
+	}
+}
+
+// CountHealthyWorkers returns how many workers have leased from queue within WorkerHealthyWindow
+func (m *Manager) CountHealthyWorkers(ctx context.Context, queue string) (int, error) {
+	return m.store.CountHealthyWorkers(ctx, queue, time.Now().Add(-WorkerHealthyWindow))
+}
+
+// HealthyWorkerCapacity returns the summed weight of the workers that have
+// leased from queue within WorkerHealthyWindow
+func (m *Manager) HealthyWorkerCapacity(ctx context.Context, queue string) (int, error) {
+	return m.store.HealthyWorkerCapacity(ctx, queue, time.Now().Add(-WorkerHealthyWindow))
+}
+
+// ListWorkers returns the workers that have leased from any queue within WorkerHealthyWindow
+func (m *Manager) ListWorkers(ctx context.Context) ([]*store.WorkerInfo, error) {
+	return m.store.ListWorkers(ctx, time.Now().Add(-WorkerHealthyWindow))
+}
+
+// DrainWorker asks workerID to stop leasing and exit once its in-flight jobs
+// finish. The worker picks the request up on its next heartbeat.
+func (m *Manager) DrainWorker(ctx context.Context, workerID string) (time.Time, error) {
+	requestedAt, err := m.store.RequestWorkerDrain(ctx, workerID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	m.logger.Printf("Requested drain of worker %s", workerID)
+	return requestedAt, nil
+}
+
+// WorkerDraining reports whether the worker process with workerID that
+// started at startedAt has been asked to drain
+func (m *Manager) WorkerDraining(ctx context.Context, workerID string, startedAt time.Time) (bool, error) {
+	return m.store.WorkerDrainRequested(ctx, workerID, startedAt)
+}
+
+// hasMinWorkers reports whether queue's healthy workers add up to the
+// weighted capacity its config cfg requires. Errors fail open, so a registry
+// outage doesn't stop dispatch.
+func (m *Manager) hasMinWorkers(ctx context.Context, queue string, cfg *store.QueueConfig) bool {
+	if cfg == nil || cfg.MinWorkers <= 0 {
+		return true
+	}
+
+	capacity, err := m.HealthyWorkerCapacity(ctx, queue)
+	if err != nil {
+		m.logger.Printf("Failed to sum healthy worker capacity for queue %s: %v", queue, err)
+		return true
+	}
+	return capacity >= cfg.MinWorkers
+}
+
+// pruneHeartbeats drops workers that stopped polling long ago
+func (m *Manager) pruneHeartbeats(ctx context.Context) {
+	pruned, err := m.store.PruneWorkerHeartbeats(ctx, time.Now().Add(-heartbeatRetention))
+	if err != nil {
+		m.logger.Printf("Error pruning worker heartbeats: %v", err)
+		return
+	}
+	if pruned > 0 {
+		m.logger.Printf("Pruned %d stale worker heartbeats", pruned)
+	}
+
+	m.heartbeatMu.Lock()
+	for key, last := range m.heartbeats {
+		if time.Since(last) > heartbeatRetention {
+			delete(m.heartbeats, key)
+		}
+	}
+	m.heartbeatMu.Unlock()
+}
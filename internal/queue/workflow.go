@@ -0,0 +1,57 @@
+package queue
+
+import (
+	"context"
+
+	"github.com/goquorra/goquorra/internal/store"
+)
+
+// CreateWorkflow enqueues a DAG of jobs. Each node's job gets the same
+// enrichment, routing, queue defaults and queue rate limits as a job
+// enqueued on its own.
+func (m *Manager) CreateWorkflow(ctx context.Context, req *store.CreateWorkflowRequest) (*store.Workflow, error) {
+	if err := store.ValidateWorkflow(req); err != nil {
+		return nil, err
+	}
+
+	for i := range req.Nodes {
+		job := &req.Nodes[i].Job
+		job.Kind = store.KindUser
+		if job.Queue == "" {
+			job.Queue = store.DefaultQueue(job.Kind)
+		}
+		m.enrich(job)
+		if err := m.applyRouting(ctx, job); err != nil {
+			return nil, err
+		}
+		queueCfg, err := m.store.GetQueueConfig(ctx, job.Queue)
+		if err != nil {
+			return nil, err
+		}
+		if queueCfg != nil {
+			queueCfg.ApplyDefaults(job)
+		}
+	}
+	if err := m.takeWorkflowTokens(req.Nodes); err != nil {
+		return nil, err
+	}
+
+	wf, err := m.store.CreateWorkflow(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	m.logger.Printf("Created workflow %s with %d nodes (failure_policy=%s)", wf.ID, len(wf.Nodes), wf.FailurePolicy)
+	for _, node := range wf.Nodes {
+		if m.metrics != nil {
+			m.metrics.RecordJobCreated(string(store.KindUser))
+		}
+		m.notifyJobChanged(node.JobID, EventCreated)
+	}
+	return wf, nil
+}
+
+// GetWorkflow returns a workflow and the status of each of its nodes
+func (m *Manager) GetWorkflow(ctx context.Context, id string) (*store.Workflow, error) {
+	return m.store.GetWorkflow(ctx, id)
+}
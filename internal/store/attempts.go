@@ -0,0 +1,79 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Attempt outcomes recorded in job_attempts
+const (
+	AttemptSucceeded = "succeeded"
+	AttemptFailed    = "failed"
+	AttemptExpired   = "expired"
+)
+
+// JobAttempt is one lease of a job, from the lease until it was acked, nacked
+// or its lease expired. Attempts still running have no FinishedAt.
+type JobAttempt struct {
+	Attempt    int        `json:"attempt"`
+	WorkerID   string     `json:"worker_id"`
+	LeaseID    string     `json:"lease_id"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	DurationMs *int64     `json:"duration_ms,omitempty"`
+	Outcome    string     `json:"outcome,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// ListJobAttempts returns a job's attempts, oldest first
+func (s *PostgresStore) ListJobAttempts(ctx context.Context, jobID string) ([]*JobAttempt, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT attempt, worker_id, lease_id, started_at, finished_at, outcome, error
+		FROM job_attempts
+		WHERE job_id = $1
+		ORDER BY id
+	`, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query job attempts: %w", err)
+	}
+	defer rows.Close()
+
+	attempts := []*JobAttempt{}
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var a JobAttempt
+		var finishedAt sql.NullTime
+		var outcome, errMsg sql.NullString
+		if err := rows.Scan(&a.Attempt, &a.WorkerID, &a.LeaseID, &a.StartedAt, &finishedAt, &outcome, &errMsg); err != nil {
+			return nil, fmt.Errorf("failed to scan job attempt: %w", err)
+		}
+		if finishedAt.Valid {
+			a.FinishedAt = &finishedAt.Time
+			duration := finishedAt.Time.Sub(a.StartedAt).Milliseconds()
+			a.DurationMs = &duration
+		}
+		a.Outcome = outcome.String
+		a.Error = errMsg.String
+		attempts = append(attempts, &a)
+	}
+
+	return attempts, rows.Err()
+}
+
+// finishAttemptTx closes the attempt started by a lease
+func finishAttemptTx(ctx context.Context, tx *sql.Tx, jobID, leaseID, outcome, errMsg string) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE job_attempts
+		SET finished_at = $1, outcome = $2, error = $3
+		WHERE job_id = $4 AND lease_id = $5 AND finished_at IS NULL
+	`, time.Now(), outcome, sql.NullString{String: errMsg, Valid: errMsg != ""}, jobID, leaseID)
+	if err != nil {
+		return fmt.Errorf("failed to record job attempt: %w", err)
+	}
+	return nil
+}
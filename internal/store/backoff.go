@@ -0,0 +1,122 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// BackoffStrategy selects how the retry delay grows with each failed attempt
+type BackoffStrategy string
+
+const (
+	// BackoffExponential waits base * 2^attempts
+	BackoffExponential BackoffStrategy = "exponential"
+	// BackoffLinear waits base * attempts
+	BackoffLinear BackoffStrategy = "linear"
+	// BackoffFixed always waits base
+	BackoffFixed BackoffStrategy = "fixed"
+)
+
+// ParseBackoffStrategy validates a strategy name; empty means the default
+func ParseBackoffStrategy(s string) (BackoffStrategy, error) {
+	switch BackoffStrategy(s) {
+	case "", BackoffExponential, BackoffLinear, BackoffFixed:
+		return BackoffStrategy(s), nil
+	}
+	return "", fmt.Errorf("invalid backoff strategy %q", s)
+}
+
+// BackoffPolicy computes the retry delay of failed jobs
+type BackoffPolicy struct {
+	Strategy BackoffStrategy // defaults to exponential
+	Base     time.Duration   // defaults to one second
+	Min      time.Duration
+	Max      time.Duration
+}
+
+// DefaultBackoffPolicy retries immediately-ish and caps delays at one hour
+func DefaultBackoffPolicy() BackoffPolicy {
+	return BackoffPolicy{Strategy: BackoffExponential, Base: time.Second, Min: 0, Max: time.Hour}
+}
+
+// WithJobOverrides returns the policy with a job's own strategy, base and cap
+// applied over it. Zero values keep the policy's settings; the floor always
+// comes from the policy.
+func (p BackoffPolicy) WithJobOverrides(strategy BackoffStrategy, baseSeconds, capSeconds int) BackoffPolicy {
+	if strategy != "" {
+		p.Strategy = strategy
+	}
+	if baseSeconds > 0 {
+		p.Base = time.Duration(baseSeconds) * time.Second
+	}
+	if capSeconds > 0 {
+		p.Max = time.Duration(capSeconds) * time.Second
+	}
+	return p
+}
+
+// Delay returns the backoff before the next attempt of a job that has failed
+// attempts times, clamped to [Min, Max]
+func (p BackoffPolicy) Delay(attempts int) time.Duration {
+	base := p.Base
+	if base <= 0 {
+		base = time.Second
+	}
+
+	delay := p.Max
+	switch p.Strategy {
+	case BackoffFixed:
+		if base < delay {
+			delay = base
+		}
+	case BackoffLinear:
+		if attempts <= 0 {
+			delay = 0
+		} else if base <= delay/time.Duration(attempts) {
+			delay = base * time.Duration(attempts)
+		}
+	default:
+		// Stop doubling before time.Duration overflows; by then the cap applies anyway
+		if attempts < 63 && base <= delay>>uint(attempts) {
+			delay = base << uint(attempts)
+		}
+	}
+
+	if delay < p.Min {
+		delay = p.Min
+	}
+	return delay
+}
+
+// MaxBackoffScheduleLen caps the entries of a job's custom backoff schedule
+const MaxBackoffScheduleLen = 100
+
+// ScheduleDelay returns the delay a custom backoff schedule, in seconds,
+// gives a job that has failed attempts times: the entry at attempts-1, or
+// the last entry once the schedule is exhausted
+func ScheduleDelay(schedule []int, attempts int) time.Duration {
+	if len(schedule) == 0 {
+		return 0
+	}
+	i := attempts - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(schedule) {
+		i = len(schedule) - 1
+	}
+	return time.Duration(schedule[i]) * time.Second
+}
+
+// ValidateBackoffSchedule checks a custom backoff schedule from a client
+func ValidateBackoffSchedule(schedule []int) error {
+	if len(schedule) > MaxBackoffScheduleLen {
+		return fmt.Errorf("backoff_schedule must have at most %d entries, got %d", MaxBackoffScheduleLen, len(schedule))
+	}
+	for _, seconds := range schedule {
+		if seconds <= 0 {
+			return fmt.Errorf("backoff_schedule entries must be positive, got %d", seconds)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrCalendarNotFound is returned when a job names a calendar that isn't defined
+var ErrCalendarNotFound = errors.New("calendar not found")
+
+// maxCalendarSearchDays bounds how far ahead NextBusinessTime looks
+const maxCalendarSearchDays = 3660
+
+// BusinessCalendar describes when scheduled work may run: every day except
+// the weekend days and holidays, between Open and Close in Timezone. Jobs
+// enqueued with a schedule_calendar have their run_at moved forward to the
+// calendar's next business time.
+type BusinessCalendar struct {
+	Name string `json:"name"`
+
+	// Timezone is an IANA zone name; empty means UTC
+	Timezone string `json:"timezone,omitempty"`
+
+	// Weekend holds lowercase weekday names, such as "saturday"
+	Weekend []string `json:"weekend"`
+
+	// Holidays are dates in YYYY-MM-DD form, in the calendar's timezone
+	Holidays []string `json:"holidays,omitempty"`
+
+	// Open and Close bound the business hours of each business day as
+	// HH:MM; empty means the start and end of the day
+	Open  string `json:"open,omitempty"`
+	Close string `json:"close,omitempty"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DefaultWeekend is the weekend of calendars that don't set one
+var DefaultWeekend = []string{"saturday", "sunday"}
+
+// calendarRules is a BusinessCalendar parsed for lookups
+type calendarRules struct {
+	loc      *time.Location
+	weekend  map[time.Weekday]bool
+	holidays map[string]bool
+	open     int // minutes after midnight
+	close    int
+}
+
+// Validate checks that the calendar is well formed and has business time
+func (c *BusinessCalendar) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("calendar name is required")
+	}
+	_, err := c.rules()
+	return err
+}
+
+func (c *BusinessCalendar) rules() (*calendarRules, error) {
+	r := &calendarRules{
+		loc:      time.UTC,
+		weekend:  make(map[time.Weekday]bool),
+		holidays: make(map[string]bool),
+		close:    24 * 60,
+	}
+
+	if c.Timezone != "" {
+		loc, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", c.Timezone, err)
+		}
+		r.loc = loc
+	}
+
+	for _, name := range c.Weekend {
+		day, ok := parseWeekday(name)
+		if !ok {
+			return nil, fmt.Errorf("invalid weekend day %q", name)
+		}
+		r.weekend[day] = true
+	}
+	if len(r.weekend) == 7 {
+		return nil, fmt.Errorf("calendar has no business days")
+	}
+
+	for _, date := range c.Holidays {
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			return nil, fmt.Errorf("invalid holiday %q: must be YYYY-MM-DD", date)
+		}
+		r.holidays[date] = true
+	}
+
+	for _, bound := range []struct {
+		name  string
+		value string
+		dst   *int
+	}{{"open", c.Open, &r.open}, {"close", c.Close, &r.close}} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := time.Parse("15:04", bound.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s time %q: must be HH:MM", bound.name, bound.value)
+		}
+		*bound.dst = t.Hour()*60 + t.Minute()
+	}
+	if r.open >= r.close {
+		return nil, fmt.Errorf("open (%s) must be before close (%s)", c.Open, c.Close)
+	}
+
+	return r, nil
+}
+
+// parseWeekday parses a weekday's full English name, ignoring case
+func parseWeekday(name string) (time.Weekday, bool) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(name, day.String()) {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// NextBusinessTime returns t if it falls in business hours on a business
+// day, otherwise the start of the next business hours after it
+func (c *BusinessCalendar) NextBusinessTime(t time.Time) (time.Time, error) {
+	r, err := c.rules()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	local := t.In(r.loc)
+	for i := 0; i < maxCalendarSearchDays; i++ {
+		year, month, day := local.Date()
+		date := time.Date(year, month, day, 0, 0, 0, 0, r.loc)
+		if !r.weekend[date.Weekday()] && !r.holidays[date.Format(time.DateOnly)] {
+			openAt := time.Date(year, month, day, r.open/60, r.open%60, 0, 0, r.loc)
+			closeAt := time.Date(year, month, day, r.close/60, r.close%60, 0, 0, r.loc)
+			if local.Before(openAt) {
+				return openAt.In(t.Location()), nil
+			}
+			if local.Before(closeAt) {
+				return local.In(t.Location()), nil
+			}
+		}
+		local = time.Date(year, month, day+1, 0, 0, 0, 0, r.loc)
+	}
+	return time.Time{}, fmt.Errorf("calendar %s has no business time within %d days of %s", c.Name, maxCalendarSearchDays, t.Format(time.RFC3339))
+}
+
+// GetCalendar returns the named calendar, or nil if it isn't defined
+func (s *PostgresStore) GetCalendar(ctx context.Context, name string) (*BusinessCalendar, error) {
+	var cal BusinessCalendar
+	var open, closeTime sql.NullString
+	err := s.db.QueryRowContext(ctx, `
+		SELECT name, timezone, weekend, holidays, open_time, close_time, updated_at
+		FROM business_calendars
+		WHERE name = $1
+	`, name).Scan(&cal.Name, &cal.Timezone, pq.Array(&cal.Weekend), pq.Array(&cal.Holidays), &open, &closeTime, &cal.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get calendar: %w", err)
+	}
+	cal.Open, cal.Close = open.String, closeTime.String
+	return &cal, nil
+}
+
+// PutCalendar creates or replaces a calendar, setting its UpdatedAt
+func (s *PostgresStore) PutCalendar(ctx context.Context, cal *BusinessCalendar) error {
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO business_calendars (name, timezone, weekend, holidays, open_time, close_time, updated_at)
+		VALUES ($1, $2, COALESCE($3::TEXT[], '{}'), COALESCE($4::TEXT[], '{}'), NULLIF($5, ''), NULLIF($6, ''), NOW())
+		ON CONFLICT (name) DO UPDATE SET
+			timezone = EXCLUDED.timezone,
+			weekend = EXCLUDED.weekend,
+			holidays = EXCLUDED.holidays,
+			open_time = EXCLUDED.open_time,
+			close_time = EXCLUDED.close_time,
+			updated_at = EXCLUDED.updated_at
+		RETURNING updated_at
+	`, cal.Name, cal.Timezone, pq.Array(cal.Weekend), pq.Array(cal.Holidays), cal.Open, cal.Close).Scan(&cal.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to put calendar: %w", err)
+	}
+	return nil
+}
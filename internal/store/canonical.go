@@ -0,0 +1,124 @@
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// CanonicalizePayload serializes a payload so that semantically equal
+// payloads produce identical bytes: object keys are sorted at every level,
+// insignificant whitespace is dropped and numbers are normalized, so 1, 1.0
+// and 1e0 all become 1. Integers beyond int64 are normalized as float64 and
+// may lose precision.
+func CanonicalizePayload(payload map[string]interface{}) ([]byte, error) {
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+
+	// Round-trip through encoding/json so structs, json.RawMessage and the
+	// like are reduced to plain maps, slices and numbers first
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, fmt.Errorf("failed to decode payload: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// PayloadHash returns the hex-encoded SHA-256 of a payload's canonical form
+func PayloadHash(payload map[string]interface{}) (string, error) {
+	canonical, err := CanonicalizePayload(payload)
+	if err != nil {
+		return "", err
+	}
+	return hashCanonical(canonical), nil
+}
+
+// hashCanonical hashes an already canonicalized payload
+func hashCanonical(canonical []byte) string {
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeCanonical writes a value decoded with UseNumber in canonical form
+func writeCanonical(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, key); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, v[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, elem := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, elem); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case json.Number:
+		n, err := canonicalNumber(v)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(n)
+	default:
+		// Strings, booleans and null already have a single encoding
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to marshal payload value: %w", err)
+		}
+		buf.Write(encoded)
+	}
+	return nil
+}
+
+// canonicalNumber formats a JSON number as an integer when it is one and
+// otherwise in Go's shortest float64 representation
+func canonicalNumber(n json.Number) (string, error) {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		return strconv.FormatInt(i, 10), nil
+	}
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid number %q in payload: %w", n, err)
+	}
+	if f >= -(1<<63) && f < 1<<63 && f == float64(int64(f)) {
+		return strconv.FormatInt(int64(f), 10), nil
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64), nil
+}
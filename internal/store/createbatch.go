@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CreateJobResult is the outcome of one request in CreateJobsBatch
+type CreateJobResult struct {
+	Job *Job
+	Err error
+}
+
+// CreateJobsBatch creates jobs in a single transaction, returning one result
+// per request in order. Problems with individual requests, such as an
+// invalid or taken ID, are reported in that request's result without
+// affecting the others. Any other error, including a payload that can't be
+// encoded, fails the whole batch and nothing is created.
+func (s *PostgresStore) CreateJobsBatch(ctx context.Context, reqs []*CreateJobRequest) ([]CreateJobResult, error) {
+	defer s.observe("create_batch", time.Now())
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	results := make([]CreateJobResult, len(reqs))
+	for i, req := range reqs {
+		job, err := s.createJobTx(ctx, tx, req)
+		if err != nil && !isRequestError(err) {
+			return nil, err
+		}
+		results[i] = CreateJobResult{Job: job, Err: err}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit batch create: %w", err)
+	}
+	return results, nil
+}
+
+// isRequestError reports whether a createJobTx error is down to the request
+// and left the transaction usable
+func isRequestError(err error) bool {
+	return errors.Is(err, ErrJobExists) || errors.Is(err, ErrInvalidJobID) || errors.Is(err, ErrInvalidUniqueBy)
+}
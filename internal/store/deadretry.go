@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DefaultDeadRetrySchedule is how long a dead job that opted into dead retries
+// waits before each automatic retry; it gives up after the last one
+var DefaultDeadRetrySchedule = []time.Duration{time.Hour, 6 * time.Hour, 24 * time.Hour}
+
+// deadRetryBatchSize bounds how many dead jobs one RetryDeadJobs call revives
+const deadRetryBatchSize = 100
+
+// deadRetryReasons are the dead reasons a later retry might get past. Jobs the
+// worker marked permanent or poison are never retried automatically.
+var deadRetryReasons = []string{string(DeadReasonMaxRetries), string(DeadReasonExpired), string(DeadReasonRetryBudget)}
+
+// SetDeadRetrySchedule replaces the delays between automatic retries of dead
+// jobs. The nth retry happens schedule[n-1] after the job last died, and a
+// job stays dead once it has had len(schedule) retries.
+func (s *PostgresStore) SetDeadRetrySchedule(schedule []time.Duration) {
+	s.deadRetrySchedule = schedule
+}
+
+// RetryDeadJobs returns dead jobs that opted into dead retries to pending once
+// their next delay on the schedule has passed, and returns their IDs. Attempts
+// are left as they were, so each dead retry gets a single attempt before the
+// job is dead-lettered again.
+func (s *PostgresStore) RetryDeadJobs(ctx context.Context) ([]string, error) {
+	defer s.observe("dead_retry", time.Now())
+	if len(s.deadRetrySchedule) == 0 {
+		return nil, nil
+	}
+
+	delays := make([]int64, len(s.deadRetrySchedule))
+	for i, d := range s.deadRetrySchedule {
+		delays[i] = int64(d.Seconds())
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE jobs
+		SET status = $1, dead_reason = NULL, dead_at = NULL,
+		    dead_retry_count = dead_retry_count + 1,
+		    run_at = $2, updated_at = $2
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE status = $3
+			  AND dead_retry
+			  AND dead_reason = ANY($4)
+			  AND dead_retry_count < $5
+			  AND COALESCE(dead_at, updated_at) <= $2 - ($6::bigint[])[dead_retry_count + 1] * INTERVAL '1 second'
+			LIMIT $7
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id
+	`, StatusPending, time.Now(), StatusDead, pq.Array(deadRetryReasons), len(delays), pq.Array(delays), deadRetryBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retry dead jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan retried job: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
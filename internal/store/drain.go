@@ -0,0 +1,40 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// RequestWorkerDrain asks workerID to stop leasing and drain, returning when
+// the request was made. Worker processes started after that aren't affected,
+// so a drained worker that restarts under the same ID leases normally.
+func (s *PostgresStore) RequestWorkerDrain(ctx context.Context, workerID string) (time.Time, error) {
+	now := time.Now()
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO worker_drains (worker_id, requested_at)
+		VALUES ($1, $2)
+		ON CONFLICT (worker_id) DO UPDATE SET requested_at = EXCLUDED.requested_at
+	`, workerID, now)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to request worker drain: %w", err)
+	}
+	return now, nil
+}
+
+// WorkerDrainRequested reports whether a drain was requested for workerID
+// after startedAt, the start of the worker process asking
+func (s *PostgresStore) WorkerDrainRequested(ctx context.Context, workerID string, startedAt time.Time) (bool, error) {
+	var requestedAt time.Time
+	err := s.db.QueryRowContext(ctx, `
+		SELECT requested_at FROM worker_drains WHERE worker_id = $1
+	`, workerID).Scan(&requestedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check worker drain: %w", err)
+	}
+	return requestedAt.After(startedAt), nil
+}
@@ -0,0 +1,193 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ExportJobs returns up to limit jobs of queue (or of every queue if queue is
+// empty) with IDs greater than afterID, ordered by ID. Callers page through
+// all jobs by passing the last ID of each page as the next afterID.
+func (s *PostgresStore) ExportJobs(ctx context.Context, queue, afterID string, limit int) ([]*Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs
+		WHERE ($1 = '' OR queue = $1) AND id > $2
+		ORDER BY id
+		LIMIT $3`
+
+	rows, err := s.db.QueryContext(ctx, query, queue, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// ImportOptions controls how ImportJob re-creates an exported job
+type ImportOptions struct {
+	// PreserveIDs keeps the exported job ID; otherwise a new one is generated
+	PreserveIDs bool
+
+	// PreserveStatus keeps the exported status and its history: attempts,
+	// last error, redeliveries and, for dead jobs, the dead-letter details.
+	// Otherwise the job starts over as pending. Leases never carry over, so
+	// leased jobs are always imported as pending.
+	PreserveStatus bool
+}
+
+// ImportJob inserts an exported job, returning its ID. It returns
+// ErrJobExists if a job with the preserved ID already exists, or if the job
+// would be active alongside another active job with its unique key.
+func (s *PostgresStore) ImportJob(ctx context.Context, job *Job, opts ImportOptions) (string, error) {
+	id := job.ID
+	if !opts.PreserveIDs || id == "" {
+		id = s.idGenerator.NewID()
+	} else if err := ValidateJobID(id); err != nil {
+		return "", err
+	}
+
+	status := StatusPending
+	attempts, redeliveries := 0, 0
+	lastError := ""
+	if opts.PreserveStatus {
+		status = job.Status
+		attempts = job.Attempts
+		redeliveries = job.Redeliveries
+		lastError = job.LastError
+	}
+	if status == StatusLeased || status == StatusProcessing || status == "" {
+		status = StatusPending
+	}
+
+	// Dead-letter details only describe a job that is still dead
+	deadReason := DeadReason("")
+	deadRetryCount := 0
+	var deadAt *time.Time
+	killedBy := ""
+	if status == StatusDead {
+		deadReason = job.DeadReason
+		deadRetryCount = job.DeadRetryCount
+		deadAt = job.DeadAt
+		killedBy = job.KilledBy
+	}
+
+	kind := job.Kind
+	if kind == "" {
+		kind = KindUser
+	}
+	queue := job.Queue
+	if queue == "" {
+		queue = DefaultQueue(kind)
+	}
+	maxRetries := job.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = 3
+	}
+	now := time.Now()
+	runAt, createdAt := job.RunAt, job.CreatedAt
+	if runAt.IsZero() {
+		runAt = now
+	}
+	if createdAt.IsZero() {
+		createdAt = now
+	}
+
+	payloadJSON, err := CanonicalizePayload(job.Payload)
+	if err != nil {
+		return "", err
+	}
+	labels := job.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labelsJSON, err := json.Marshal(labels)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal labels: %w", err)
+	}
+	requiresJSON, err := marshalStrings(job.Requires)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal requires: %w", err)
+	}
+	scheduleJSON, err := marshalSchedule(job.BackoffSchedule)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The unique key only constrains active jobs, as on create
+	if job.UniqueKey != "" && isActiveStatus(status) {
+		existingID, err := s.findUniqueTx(ctx, tx, job.UniqueKey)
+		if err != nil {
+			return "", err
+		}
+		if existingID != "" {
+			return "", fmt.Errorf("%w: active job %s has the same unique key", ErrJobExists, existingID)
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO jobs (id, type, payload, queue, priority, status, kind, attempts, max_retries, last_error,
+		                  run_at, created_at, updated_at, labels, trace_id, partition_key, idempotency_key, requires,
+		                  dead_reason, backoff_strategy, backoff_base_seconds, backoff_cap_seconds, deadline, dead_retry, payload_hash, backoff_schedule,
+		                  unique_key, workflow_id, state, dead_retry_count, dead_at, killed_by, redeliveries)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26,
+		        $27, $28, $29, $30, $31, $32, $33)
+		ON CONFLICT (id) DO NOTHING
+	`,
+		id, job.Type, payloadJSON, queue, job.Priority, status, kind, attempts, maxRetries,
+		sql.NullString{String: lastError, Valid: lastError != ""},
+		runAt, createdAt, now, labelsJSON,
+		sql.NullString{String: job.TraceID, Valid: job.TraceID != ""},
+		sql.NullString{String: job.PartitionKey, Valid: job.PartitionKey != ""},
+		sql.NullString{String: job.IdempotencyKey, Valid: job.IdempotencyKey != ""},
+		requiresJSON,
+		sql.NullString{String: string(deadReason), Valid: deadReason != ""},
+		sql.NullString{String: string(job.BackoffStrategy), Valid: job.BackoffStrategy != ""},
+		sql.NullInt64{Int64: int64(job.BackoffBaseSeconds), Valid: job.BackoffBaseSeconds > 0},
+		sql.NullInt64{Int64: int64(job.BackoffCapSeconds), Valid: job.BackoffCapSeconds > 0},
+		nullTime(job.Deadline), job.DeadRetry, hashCanonical(payloadJSON), scheduleJSON,
+		sql.NullString{String: job.UniqueKey, Valid: job.UniqueKey != ""},
+		sql.NullString{String: job.WorkflowID, Valid: job.WorkflowID != ""},
+		sql.NullString{String: string(job.State), Valid: len(job.State) > 0},
+		deadRetryCount, nullTime(deadAt),
+		sql.NullString{String: killedBy, Valid: killedBy != ""},
+		redeliveries,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to import job: %w", err)
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if inserted == 0 {
+		return "", fmt.Errorf("%w: %s", ErrJobExists, id)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,74 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// FailFastJobType is a job type whose failures skip their remaining retries
+// and go straight to the dead-letter queue with DeadReasonFailFast, so a
+// broken type stops consuming capacity until it is fixed and replayed
+type FailFastJobType struct {
+	Type      string    `json:"type"`
+	EnabledAt time.Time `json:"enabled_at"`
+}
+
+// SetJobTypeFailFast makes failures of jobType dead-letter immediately.
+// Setting a type that is already fail-fast keeps its original EnabledAt.
+func (s *PostgresStore) SetJobTypeFailFast(ctx context.Context, jobType string) (*FailFastJobType, error) {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO fail_fast_types (type, enabled_at)
+		VALUES ($1, NOW())
+		ON CONFLICT (type) DO NOTHING
+	`, jobType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set job type fail-fast: %w", err)
+	}
+
+	failFast := FailFastJobType{Type: jobType}
+	err = s.db.QueryRowContext(ctx, `SELECT enabled_at FROM fail_fast_types WHERE type = $1`, jobType).Scan(&failFast.EnabledAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fail-fast job type: %w", err)
+	}
+	return &failFast, nil
+}
+
+// ClearJobTypeFailFast lets failures of jobType be retried again. It
+// reports whether the type was fail-fast.
+func (s *PostgresStore) ClearJobTypeFailFast(ctx context.Context, jobType string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM fail_fast_types WHERE type = $1`, jobType)
+	if err != nil {
+		return false, fmt.Errorf("failed to clear job type fail-fast: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// ListFailFastJobTypes returns all fail-fast job types ordered by type
+func (s *PostgresStore) ListFailFastJobTypes(ctx context.Context) ([]*FailFastJobType, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT type, enabled_at FROM fail_fast_types ORDER BY type`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query fail-fast job types: %w", err)
+	}
+	defer rows.Close()
+
+	var types []*FailFastJobType
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var failFast FailFastJobType
+		if err := rows.Scan(&failFast.Type, &failFast.EnabledAt); err != nil {
+			return nil, fmt.Errorf("failed to scan fail-fast job type: %w", err)
+		}
+		types = append(types, &failFast)
+	}
+
+	return types, rows.Err()
+}
@@ -0,0 +1,311 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// JobSpool holds create requests while the primary store is unavailable
+type JobSpool interface {
+	Add(ctx context.Context, req *CreateJobRequest, spooledAt time.Time) error
+	List(ctx context.Context, limit int) ([]*SpooledJob, error)
+	Remove(ctx context.Context, id string) error
+
+	// Quarantine moves a request the primary refused out of the replay
+	// queue, keeping it with reason for an operator to inspect
+	Quarantine(ctx context.Context, id string, reason string) error
+}
+
+// replayBatchSize bounds how many spooled jobs one reconciler pass replays
+const replayBatchSize = 100
+
+// FailoverStore wraps a primary Store so enqueues survive brief outages. When
+// the primary fails to create a job, the request is written to a local spool
+// instead and replayed by StartReconciler once the primary recovers. Every
+// other call, including reads, goes to the primary; jobs aren't visible
+// there until replayed.
+//
+// Queue configs, routing rules and business calendars are read on enqueue,
+// so the last values read from the primary are kept and served while it is
+// down.
+type FailoverStore struct {
+	Store
+	spool       JobSpool
+	logger      *log.Logger
+	idGenerator IDGenerator
+
+	mu           sync.Mutex
+	queueConfigs map[string]*QueueConfig
+	routingRules []*RoutingRule
+	rulesLoaded  bool
+	calendars    map[string]*BusinessCalendar
+}
+
+// NewFailoverStore wraps primary, spooling failed creates to spool
+func NewFailoverStore(primary Store, spool JobSpool, logger *log.Logger) *FailoverStore {
+	return &FailoverStore{
+		Store:        primary,
+		spool:        spool,
+		logger:       logger,
+		idGenerator:  UUIDGenerator{},
+		queueConfigs: make(map[string]*QueueConfig),
+		calendars:    make(map[string]*BusinessCalendar),
+	}
+}
+
+// SetIDGenerator replaces how IDs are made for jobs spooled without one,
+// and for the primary's jobs if it supports SetIDGenerator too. Spooled
+// IDs are replayed as client-supplied IDs, so they must be UUIDs or ULIDs.
+// Nil restores the UUID default.
+func (f *FailoverStore) SetIDGenerator(gen IDGenerator) {
+	if gen == nil {
+		gen = UUIDGenerator{}
+	}
+	f.idGenerator = gen
+	if primary, ok := f.Store.(interface{ SetIDGenerator(IDGenerator) }); ok {
+		primary.SetIDGenerator(gen)
+	}
+}
+
+// CreateJob creates the job in the primary store, or spools it if the
+// primary is unavailable. Spooled jobs are returned with Spooled set.
+func (f *FailoverStore) CreateJob(ctx context.Context, req *CreateJobRequest) (*Job, error) {
+	job, err := f.Store.CreateJob(ctx, req)
+	if err == nil || !shouldSpool(ctx, err) {
+		return job, err
+	}
+
+	// The primary never saw the request, so reject what it would refuse on replay
+	if err := validateSpooled(req); err != nil {
+		return nil, err
+	}
+
+	// A fixed ID makes the replay idempotent and lets the client look the job up later
+	if req.ID == "" {
+		id := f.idGenerator.NewID()
+		if err := ValidateJobID(id); err != nil {
+			return nil, fmt.Errorf("generated ID can't be replayed: %w", err)
+		}
+		req.ID = id
+	}
+	if req.Kind == "" {
+		req.Kind = KindUser
+	}
+	if req.Queue == "" {
+		req.Queue = DefaultQueue(req.Kind)
+	}
+
+	now := time.Now()
+	if spoolErr := f.spool.Add(ctx, req, now); spoolErr != nil {
+		return nil, fmt.Errorf("failed to spool job after primary error (%v): %w", err, spoolErr)
+	}
+	f.logger.Printf("Primary store unavailable, spooled job %s: %v", req.ID, err)
+
+	runAt := req.RunAtFrom(now)
+	return &Job{
+		ID:         req.ID,
+		Type:       req.Type,
+		Payload:    req.Payload,
+		Queue:      req.Queue,
+		Priority:   req.Priority,
+		Status:     StatusPending,
+		Kind:       req.Kind,
+		MaxRetries: req.MaxRetries,
+		RunAt:      runAt,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		Labels:     req.Labels,
+		TraceID:    req.TraceID,
+		Spooled:    true,
+
+		PartitionKey:   req.PartitionKey,
+		Requires:       req.Requires,
+		IdempotencyKey: req.IdempotencyKey,
+		Deadline:       req.Deadline,
+	}, nil
+}
+
+// CreateJobsBatch creates the jobs in the primary store. If the primary is
+// unavailable, each job is created or spooled on its own by CreateJob.
+func (f *FailoverStore) CreateJobsBatch(ctx context.Context, reqs []*CreateJobRequest) ([]CreateJobResult, error) {
+	results, err := f.Store.CreateJobsBatch(ctx, reqs)
+	if err == nil || !shouldSpool(ctx, err) {
+		return results, err
+	}
+
+	results = make([]CreateJobResult, len(reqs))
+	for i, req := range reqs {
+		job, err := f.CreateJob(ctx, req)
+		results[i] = CreateJobResult{Job: job, Err: err}
+	}
+	return results, nil
+}
+
+// shouldSpool reports whether a create failure looks like an outage rather
+// than a problem with the request or a cancelled caller
+func shouldSpool(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && isOutage(err)
+}
+
+// isOutage reports whether err means the primary couldn't be reached or
+// dropped the connection. Anything else, such as a constraint violation,
+// would fail again on replay, so it isn't spooled.
+func isOutage(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	// Connection exceptions, and a server shutting down or starting up
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		code := string(pqErr.Code)
+		return strings.HasPrefix(code, "08") || code == "57P01" || code == "57P02" || code == "57P03"
+	}
+	return false
+}
+
+// validateSpooled checks a request for the errors createJobTx would report
+// for it, so that a spooled job can't fail every replay
+func validateSpooled(req *CreateJobRequest) error {
+	if req.ID != "" {
+		if err := ValidateJobID(req.ID); err != nil {
+			return err
+		}
+	}
+	payloadJSON, err := CanonicalizePayload(req.Payload)
+	if err != nil {
+		return err
+	}
+	_, err = uniqueKey(req, payloadJSON)
+	return err
+}
+
+// GetQueueConfig reads from the primary, falling back to the last value read
+func (f *FailoverStore) GetQueueConfig(ctx context.Context, queue string) (*QueueConfig, error) {
+	cfg, err := f.Store.GetQueueConfig(ctx, queue)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err != nil {
+		if cached, ok := f.queueConfigs[queue]; ok {
+			return cached, nil
+		}
+		return nil, err
+	}
+	f.queueConfigs[queue] = cfg
+	return cfg, nil
+}
+
+// ListRoutingRules reads from the primary, falling back to the last rules read
+func (f *FailoverStore) ListRoutingRules(ctx context.Context) ([]*RoutingRule, error) {
+	rules, err := f.Store.ListRoutingRules(ctx)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err != nil {
+		if f.rulesLoaded {
+			return f.routingRules, nil
+		}
+		return nil, err
+	}
+	f.routingRules = rules
+	f.rulesLoaded = true
+	return rules, nil
+}
+
+// GetCalendar reads from the primary, falling back to the last value read
+func (f *FailoverStore) GetCalendar(ctx context.Context, name string) (*BusinessCalendar, error) {
+	cal, err := f.Store.GetCalendar(ctx, name)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err != nil {
+		if cached, ok := f.calendars[name]; ok {
+			return cached, nil
+		}
+		return nil, err
+	}
+	f.calendars[name] = cal
+	return cal, nil
+}
+
+// ReplaySpool writes spooled jobs to the primary store, oldest first, and
+// returns how many were replayed. It stops at the first outage, leaving the
+// rest spooled for the next attempt. A job the primary refuses for any other
+// reason is quarantined in the spool so it can't hold up the jobs behind it.
+func (f *FailoverStore) ReplaySpool(ctx context.Context) (int, error) {
+	spooled, err := f.spool.List(ctx, replayBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	for _, job := range spooled {
+		req := job.Request
+		if req.Delayed() {
+			// Keep the original run_at rather than restarting the delay
+			runAt := req.RunAtFrom(job.SpooledAt)
+			req.RunAt = &runAt
+			req.DelaySeconds, req.DelayMs = 0, 0
+		}
+
+		// ErrJobExists means an earlier replay got as far as the primary
+		_, err := f.Store.CreateJob(ctx, &req)
+		if err != nil && !errors.Is(err, ErrJobExists) {
+			if ctx.Err() != nil || isOutage(err) {
+				return replayed, fmt.Errorf("failed to replay spooled job %s: %w", req.ID, err)
+			}
+			if err := f.spool.Quarantine(ctx, req.ID, err.Error()); err != nil {
+				return replayed, err
+			}
+			f.logger.Printf("Quarantined spooled job %s refused by the primary store: %v", req.ID, err)
+			continue
+		}
+		if err := f.spool.Remove(ctx, req.ID); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+// StartReconciler replays the spool every interval until ctx is cancelled
+func (f *FailoverStore) StartReconciler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			replayed, err := f.ReplaySpool(ctx)
+			if replayed > 0 {
+				f.logger.Printf("Replayed %d spooled jobs to the primary store", replayed)
+			}
+			if err != nil {
+				f.logger.Printf("Spool replay incomplete: %v", err)
+			}
+		}
+	}
+}
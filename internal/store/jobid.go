@@ -0,0 +1,62 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidJobID is returned when a client-supplied job ID is neither a UUID nor a ULID
+	ErrInvalidJobID = errors.New("job ID must be a UUID or ULID")
+	// ErrJobExists is returned when a client-supplied job ID is already taken
+	ErrJobExists = errors.New("job already exists")
+)
+
+// IDGenerator makes the IDs of jobs created without a client-supplied one.
+// IDs must be unique and at most 36 characters.
+type IDGenerator interface {
+	NewID() string
+}
+
+// UUIDGenerator generates random (version 4) UUIDs; it's the default
+type UUIDGenerator struct{}
+
+// NewID returns a new random UUID
+func (UUIDGenerator) NewID() string {
+	return uuid.New().String()
+}
+
+// crockfordBase32 is the ULID alphabet; I, L, O and U are excluded
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ValidateJobID checks that a client-supplied job ID is a UUID in canonical
+// 36-character form or a 26-character ULID
+func ValidateJobID(id string) error {
+	switch len(id) {
+	case 36:
+		if _, err := uuid.Parse(id); err == nil {
+			return nil
+		}
+	case 26:
+		if isULID(id) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrInvalidJobID, id)
+}
+
+func isULID(id string) bool {
+	// The first character encodes the top bits of a 48-bit timestamp, so it can't exceed 7
+	if id[0] > '7' {
+		return false
+	}
+	for _, c := range strings.ToUpper(id) {
+		if !strings.ContainsRune(crockfordBase32, c) {
+			return false
+		}
+	}
+	return true
+}
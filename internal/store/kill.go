@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AttemptKilled is the outcome of an attempt whose job was killed while leased
+const AttemptKilled = "killed"
+
+var (
+	// ErrJobNotFound is returned by KillJob for an unknown job ID
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobFinished is returned by KillJob for a job already in a terminal state
+	ErrJobFinished = errors.New("job is already finished")
+)
+
+// killableStatuses are the states a job can be killed from
+var killableStatuses = map[JobStatus]bool{
+	StatusPending:    true,
+	StatusLeased:     true,
+	StatusProcessing: true,
+	StatusFailed:     true,
+	StatusBlocked:    true,
+}
+
+// KillJob moves a non-terminal job straight to the dead-letter queue with
+// DeadReasonKilled, recording who killed it and why. A leased job's lease is
+// revoked, so its worker's eventual ack is rejected.
+func (s *PostgresStore) KillJob(ctx context.Context, id, operator, reason string) (*Job, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var status JobStatus
+	var leaseID, workflowID sql.NullString
+	err = tx.QueryRowContext(ctx, `SELECT status, lease_id, workflow_id FROM jobs WHERE id = $1 FOR UPDATE`, id).Scan(&status, &leaseID, &workflowID)
+	if err == sql.ErrNoRows {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	if !killableStatuses[status] {
+		return nil, fmt.Errorf("%w: status is %s", ErrJobFinished, status)
+	}
+
+	lastError := "killed by " + operator
+	if reason != "" {
+		lastError += ": " + reason
+	}
+
+	now := time.Now()
+	_, err = tx.ExecContext(ctx, `
+		UPDATE jobs
+		SET status = $1, dead_reason = $2, dead_at = $3, killed_by = $4, last_error = $5,
+		    lease_id = NULL, leased_at = NULL, leased_by = NULL,
+		    lease_expires_at = NULL, visible_until = NULL, updated_at = $3
+		WHERE id = $6
+	`, StatusDead, DeadReasonKilled, now, operator, lastError, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to kill job: %w", err)
+	}
+
+	if leaseID.Valid {
+		if err := finishAttemptTx(ctx, tx, id, leaseID.String, AttemptKilled, lastError); err != nil {
+			return nil, err
+		}
+	}
+
+	if workflowID.Valid {
+		if err := advanceWorkflowTx(ctx, tx, workflowID.String); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return s.GetJob(ctx, id)
+}
@@ -0,0 +1,2080 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// InMemoryStore implements Store in process memory, for unit tests of the
+// queue manager, API and gRPC service that shouldn't need PostgreSQL. It
+// follows PostgresStore's semantics for leasing, acks, backoff, the
+// dead-letter queue and workflows. A single mutex serializes every call, so
+// concurrent leases never hand out the same job twice. Nothing is persisted.
+type InMemoryStore struct {
+	mu  sync.Mutex
+	seq int64
+
+	jobs         map[string]*memJob
+	workflows    map[string]*memWorkflow
+	queueConfigs map[string]*QueueConfig
+	routingRules []*RoutingRule
+	pausedTypes  map[string]time.Time
+	failFast     map[string]time.Time
+	heartbeats   map[memHeartbeatKey]*memHeartbeat
+	drains       map[string]time.Time
+	statsHistory []memStatsSample
+
+	// dispatchPause, when set, stops all leasing
+	dispatchPause *DispatchPause
+
+	// calendars holds business calendars by name
+	calendars map[string]*BusinessCalendar
+
+	backoff              BackoffPolicy
+	dedupWindow          time.Duration
+	maxFrontRequeues     int
+	maxRetryAfter        time.Duration
+	maxDeferrals         int
+	deadRetrySchedule    []time.Duration
+	requireEpoch         bool
+	graceRedeliveries    int
+	retryBudgetExhausted func(queue string) bool
+	backoffMultiplier    func(jobType string) float64
+	idGenerator          IDGenerator
+}
+
+// memJob is a stored job plus the bookkeeping columns Job doesn't expose
+type memJob struct {
+	job     Job
+	payload []byte
+	seq     int64
+
+	singletonKey       string
+	visibleUntil       *time.Time
+	visibilityRequeued bool
+	priorityBoost      int
+	frontRequeues      int
+	deferrals          int
+	attempts           []*JobAttempt
+
+	// slaMet is the job's SLA outcome, once it has a deadline and finished
+	slaMet *bool
+}
+
+type memWorkflow struct {
+	workflow Workflow
+	nodes    []memWorkflowNode
+}
+
+type memWorkflowNode struct {
+	name      string
+	dependsOn []string
+	jobID     string
+}
+
+type memHeartbeatKey struct {
+	workerID string
+	queue    string
+}
+
+type memHeartbeat struct {
+	lastSeen time.Time
+	weight   int
+}
+
+type memStatsSample struct {
+	sampledAt time.Time
+	queue     string
+	status    string
+	count     int
+}
+
+var _ Store = (*InMemoryStore)(nil)
+
+// NewInMemoryStore creates an empty InMemoryStore with the same defaults as NewPostgresStore
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		jobs:              make(map[string]*memJob),
+		workflows:         make(map[string]*memWorkflow),
+		queueConfigs:      make(map[string]*QueueConfig),
+		pausedTypes:       make(map[string]time.Time),
+		failFast:          make(map[string]time.Time),
+		heartbeats:        make(map[memHeartbeatKey]*memHeartbeat),
+		drains:            make(map[string]time.Time),
+		calendars:         make(map[string]*BusinessCalendar),
+		backoff:           DefaultBackoffPolicy(),
+		dedupWindow:       DefaultDedupWindow,
+		maxFrontRequeues:  DefaultMaxFrontRequeues,
+		maxRetryAfter:     DefaultMaxRetryAfter,
+		maxDeferrals:      DefaultMaxDeferrals,
+		deadRetrySchedule: DefaultDeadRetrySchedule,
+		idGenerator:       UUIDGenerator{},
+	}
+}
+
+// SetBackoffPolicy replaces the retry backoff bounds applied to failed jobs
+func (s *InMemoryStore) SetBackoffPolicy(policy BackoffPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.backoff = policy
+}
+
+// SetDedupWindow sets how long after creation a job's idempotency key still
+// collapses new enqueues into it
+func (s *InMemoryStore) SetDedupWindow(window time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dedupWindow = window
+}
+
+// SetMaxFrontRequeues caps how many RequeueFront nacks each job may use
+func (s *InMemoryStore) SetMaxFrontRequeues(max int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxFrontRequeues = max
+}
+
+// SetGraceRedeliveries sets how many lease expiries and redelivery nacks
+// each job gets before they count against its attempts
+func (s *InMemoryStore) SetGraceRedeliveries(grace int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.graceRedeliveries = grace
+}
+
+// SetMaxRetryAfter caps the delay a RetryAfter nack may request
+func (s *InMemoryStore) SetMaxRetryAfter(max time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxRetryAfter = max
+}
+
+// SetMaxDeferrals caps how many RetryAfter nacks each job may use without
+// counting an attempt
+func (s *InMemoryStore) SetMaxDeferrals(max int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxDeferrals = max
+}
+
+// SetIDGenerator replaces how IDs are made for jobs created or imported
+// without one; see PostgresStore.SetIDGenerator
+func (s *InMemoryStore) SetIDGenerator(gen IDGenerator) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if gen == nil {
+		gen = UUIDGenerator{}
+	}
+	s.idGenerator = gen
+}
+
+// SetRequireLeaseEpoch makes acks that don't carry a lease epoch fail
+func (s *InMemoryStore) SetRequireLeaseEpoch(require bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requireEpoch = require
+}
+
+// SetRetryBudget makes AckJob dead-letter failures it would otherwise retry
+// while exhausted reports the job's queue over its retry budget
+func (s *InMemoryStore) SetRetryBudget(exhausted func(queue string) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retryBudgetExhausted = exhausted
+}
+
+// SetBackoffMultiplier makes AckJob multiply the computed backoff of a
+// failed job by multiplier(job type)
+func (s *InMemoryStore) SetBackoffMultiplier(multiplier func(jobType string) float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.backoffMultiplier = multiplier
+}
+
+// SetDeadRetrySchedule replaces the delays between automatic retries of dead jobs
+func (s *InMemoryStore) SetDeadRetrySchedule(schedule []time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deadRetrySchedule = schedule
+}
+
+// Ping always succeeds
+func (s *InMemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// copyJob returns a copy of a stored job that callers can't use to change
+// it, with the payload decoded unless withPayload is false. A front-requeue
+// boost only orders leasing, so the copy carries the job's own priority.
+func (m *memJob) copyJob(withPayload bool) (*Job, error) {
+	job := m.job
+	job.Priority -= m.priorityBoost
+	if withPayload {
+		if err := json.Unmarshal(m.payload, &job.Payload); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
+		}
+	} else {
+		job.PayloadOmitted = true
+	}
+	if m.job.Labels != nil {
+		job.Labels = make(map[string]string, len(m.job.Labels))
+		for k, v := range m.job.Labels {
+			job.Labels[k] = v
+		}
+	}
+	job.Requires = append([]string(nil), m.job.Requires...)
+	job.BackoffSchedule = append([]int(nil), m.job.BackoffSchedule...)
+	job.State = append(json.RawMessage(nil), m.job.State...)
+	return &job, nil
+}
+
+// clearLease drops a job's lease, as every transition out of leased does
+func (m *memJob) clearLease() {
+	m.job.LeaseID = ""
+	m.job.LeasedAt = nil
+	m.job.LeasedBy = ""
+	m.job.LeaseExpiresAt = nil
+	m.visibleUntil = nil
+}
+
+// finishAttempt closes the attempt started by a lease
+func (m *memJob) finishAttempt(leaseID, outcome, errMsg string, now time.Time) {
+	for _, a := range m.attempts {
+		if a.LeaseID == leaseID && a.FinishedAt == nil {
+			finishedAt := now
+			a.FinishedAt = &finishedAt
+			a.Outcome = outcome
+			a.Error = errMsg
+		}
+	}
+}
+
+// lease hands the job to workerID, starting an attempt
+func (m *memJob) lease(leaseID, workerID string, now time.Time, leaseTTL time.Duration) {
+	leasedAt, expiresAt := now, now.Add(leaseTTL)
+	m.job.Status = StatusLeased
+	m.job.LeaseID = leaseID
+	m.job.LeasedAt = &leasedAt
+	m.job.LeasedBy = workerID
+	m.job.LeaseExpiresAt = &expiresAt
+	m.job.LeaseEpoch++
+	m.job.Priority -= m.priorityBoost
+	m.priorityBoost = 0
+	m.job.UpdatedAt = now
+	m.attempts = append(m.attempts, &JobAttempt{
+		Attempt:   m.job.Attempts + 1,
+		WorkerID:  workerID,
+		LeaseID:   leaseID,
+		StartedAt: now,
+	})
+}
+
+// retryDelay is how long a job waits before its next attempt after its
+// attempts-th failure
+func (s *InMemoryStore) retryDelay(m *memJob, attempts int) time.Duration {
+	if len(m.job.BackoffSchedule) > 0 {
+		return ScheduleDelay(m.job.BackoffSchedule, attempts)
+	}
+	policy := s.backoff.WithJobOverrides(m.job.BackoffStrategy, m.job.BackoffBaseSeconds, m.job.BackoffCapSeconds)
+	return policy.Delay(attempts)
+}
+
+// CreateJob creates a new job
+func (s *InMemoryStore) CreateJob(ctx context.Context, req *CreateJobRequest) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.createJobLocked(req)
+}
+
+// CreateJobsBatch creates jobs atomically, returning one result per request
+// in order; see PostgresStore.CreateJobsBatch
+func (s *InMemoryStore) CreateJobsBatch(ctx context.Context, reqs []*CreateJobRequest) ([]CreateJobResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]CreateJobResult, len(reqs))
+	var created []string
+	for i, req := range reqs {
+		job, err := s.createJobLocked(req)
+		if err != nil && !isRequestError(err) {
+			s.deleteJobsLocked(created)
+			return nil, err
+		}
+		if err == nil && !job.Deduplicated {
+			created = append(created, job.ID)
+		}
+		results[i] = CreateJobResult{Job: job, Err: err}
+	}
+	return results, nil
+}
+
+func (s *InMemoryStore) deleteJobsLocked(ids []string) {
+	for _, id := range ids {
+		delete(s.jobs, id)
+	}
+}
+
+func (s *InMemoryStore) createJobLocked(req *CreateJobRequest) (*Job, error) {
+	id := req.ID
+	if id == "" {
+		id = s.idGenerator.NewID()
+	} else if err := ValidateJobID(id); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	runAt := req.RunAtFrom(now)
+
+	if req.Kind == "" {
+		req.Kind = KindUser
+	}
+	if req.Queue == "" {
+		req.Queue = DefaultQueue(req.Kind)
+	}
+	if req.MaxRetries == 0 {
+		req.MaxRetries = 3
+	}
+
+	payloadJSON, err := CanonicalizePayload(req.Payload)
+	if err != nil {
+		return nil, err
+	}
+	unique, err := uniqueKey(req, payloadJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.IdempotencyKey != "" || req.EnqueueIfAbsent || unique != "" {
+		var existing *memJob
+		if req.IdempotencyKey != "" {
+			existing = s.findDuplicateLocked(req.Queue, req.IdempotencyKey, now)
+		}
+		if existing == nil && req.EnqueueIfAbsent {
+			existing = s.findActiveLocked(req)
+		}
+		if existing == nil && unique != "" {
+			existing = s.findUniqueLocked(unique)
+		}
+		if existing != nil {
+			job, err := existing.copyJob(true)
+			if err != nil {
+				return nil, err
+			}
+			job.Deduplicated = true
+			return job, nil
+		}
+	}
+
+	if _, ok := s.jobs[id]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrJobExists, id)
+	}
+
+	s.seq++
+	m := &memJob{
+		job: Job{
+			ID:                 id,
+			Type:               req.Type,
+			Queue:              req.Queue,
+			Priority:           req.Priority,
+			Status:             StatusPending,
+			Kind:               req.Kind,
+			MaxRetries:         req.MaxRetries,
+			RunAt:              runAt,
+			CreatedAt:          now,
+			UpdatedAt:          now,
+			TraceID:            req.TraceID,
+			PartitionKey:       req.PartitionKey,
+			IdempotencyKey:     req.IdempotencyKey,
+			Deadline:           req.Deadline,
+			BackoffStrategy:    req.BackoffStrategy,
+			BackoffBaseSeconds: req.BackoffBaseSeconds,
+			BackoffCapSeconds:  req.BackoffCapSeconds,
+			DeadRetry:          req.DeadRetry,
+			PayloadHash:        hashCanonical(payloadJSON),
+			UniqueKey:          unique,
+		},
+		payload:      payloadJSON,
+		seq:          s.seq,
+		singletonKey: req.SingletonKey,
+	}
+	if len(req.Labels) > 0 {
+		m.job.Labels = make(map[string]string, len(req.Labels))
+		for k, v := range req.Labels {
+			m.job.Labels[k] = v
+		}
+	}
+	if len(req.Requires) > 0 {
+		m.job.Requires = append([]string(nil), req.Requires...)
+	}
+	if len(req.BackoffSchedule) > 0 {
+		m.job.BackoffSchedule = append([]int(nil), req.BackoffSchedule...)
+	}
+	s.jobs[id] = m
+
+	return m.copyJob(true)
+}
+
+// findDuplicateLocked returns the queue's newest job created with the same
+// idempotency key within the dedup window, or nil
+func (s *InMemoryStore) findDuplicateLocked(queue, key string, now time.Time) *memJob {
+	var found *memJob
+	cutoff := now.Add(-s.dedupWindow)
+	for _, m := range s.jobs {
+		if m.job.Queue != queue || m.job.IdempotencyKey != key || !m.job.CreatedAt.After(cutoff) {
+			continue
+		}
+		if found == nil || m.seq > found.seq {
+			found = m
+		}
+	}
+	return found
+}
+
+// findActiveLocked returns the oldest active job with the request's
+// singleton key, or nil
+func (s *InMemoryStore) findActiveLocked(req *CreateJobRequest) *memJob {
+	var found *memJob
+	for _, m := range s.jobs {
+		if !isActiveStatus(m.job.Status) {
+			continue
+		}
+		if req.SingletonKey != "" {
+			if m.singletonKey != req.SingletonKey {
+				continue
+			}
+		} else if m.job.Queue != req.Queue || m.job.Type != req.Type {
+			continue
+		}
+		if found == nil || m.seq < found.seq {
+			found = m
+		}
+	}
+	return found
+}
+
+func isActiveStatus(status JobStatus) bool {
+	for _, active := range activeStatuses {
+		if string(status) == active {
+			return true
+		}
+	}
+	return false
+}
+
+// GetJob retrieves a job by ID
+func (s *InMemoryStore) GetJob(ctx context.Context, id string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("job not found")
+	}
+	return m.copyJob(true)
+}
+
+// GetJobs retrieves the jobs with the given IDs, keyed by ID; unknown IDs are left out
+func (s *InMemoryStore) GetJobs(ctx context.Context, ids []string) (map[string]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make(map[string]*Job, len(ids))
+	for _, id := range ids {
+		m, ok := s.jobs[id]
+		if !ok {
+			continue
+		}
+		job, err := m.copyJob(true)
+		if err != nil {
+			return nil, err
+		}
+		jobs[id] = job
+	}
+	return jobs, nil
+}
+
+// GetJobsByLeaseID returns the jobs handed out under leaseID, whether they
+// still hold it or have since been acked
+func (s *InMemoryStore) GetJobsByLeaseID(ctx context.Context, leaseID string) ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matched []*memJob
+	for _, m := range s.jobs {
+		if m.job.LeaseID == leaseID {
+			matched = append(matched, m)
+			continue
+		}
+		for _, a := range m.attempts {
+			if a.LeaseID == leaseID {
+				matched = append(matched, m)
+				break
+			}
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		a, b := matched[i].job, matched[j].job
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	})
+	return copyJobs(matched)
+}
+
+func copyJobs(matched []*memJob) ([]*Job, error) {
+	jobs := make([]*Job, 0, len(matched))
+	for _, m := range matched {
+		job, err := m.copyJob(true)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// RenewLease extends a held lease to leaseTTL from now; see PostgresStore.RenewLease
+func (s *InMemoryStore) RenewLease(ctx context.Context, jobID, leaseID string, epoch int64, leaseTTL time.Duration) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.jobs[jobID]
+	if !ok || m.job.LeaseID == "" || m.job.LeaseID != leaseID ||
+		(m.job.Status != StatusLeased && m.job.Status != StatusProcessing) ||
+		(epoch != 0 && m.job.LeaseEpoch != epoch) {
+		return time.Time{}, errInvalidLease
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(leaseTTL)
+	m.job.LeaseExpiresAt = &expiresAt
+	if m.visibleUntil != nil {
+		visibleUntil := expiresAt
+		m.visibleUntil = &visibleUntil
+	}
+	m.job.UpdatedAt = now
+	return expiresAt, nil
+}
+
+// SaveState replaces a held job's checkpoint state; see PostgresStore.SaveState
+func (s *InMemoryStore) SaveState(ctx context.Context, jobID, leaseID string, epoch int64, state json.RawMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.jobs[jobID]
+	if !ok || m.job.LeaseID == "" || m.job.LeaseID != leaseID ||
+		(m.job.Status != StatusLeased && m.job.Status != StatusProcessing) ||
+		(epoch != 0 && m.job.LeaseEpoch != epoch) {
+		return errInvalidLease
+	}
+
+	m.job.State = append(json.RawMessage(nil), state...)
+	m.job.UpdatedAt = time.Now()
+	return nil
+}
+
+// UpdateJobStatus updates a job's status and last error
+func (s *InMemoryStore) UpdateJobStatus(ctx context.Context, id string, status JobStatus, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if m, ok := s.jobs[id]; ok {
+		m.job.Status = status
+		m.job.LastError = lastError
+		m.job.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+// LeaseJobs atomically leases up to maxJobs of queue's eligible jobs to
+// workerID, with the same eligibility and ordering as PostgresStore.LeaseJobs
+func (s *InMemoryStore) LeaseJobs(ctx context.Context, queue string, workerID string, maxJobs int, leaseTTL time.Duration, opts LeaseOptions) ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dispatchPause != nil {
+		return nil, nil
+	}
+
+	now := time.Now()
+	if opts.Serial {
+		maxJobs = 1
+		for _, m := range s.jobs {
+			if m.job.Queue == queue && (m.job.Status == StatusLeased || m.job.Status == StatusProcessing) {
+				return nil, nil
+			}
+		}
+	}
+
+	capabilities := make(map[string]bool, len(opts.Capabilities))
+	for _, c := range opts.Capabilities {
+		capabilities[c] = true
+	}
+
+	// With FIFO, only the earliest pending, leased or processing job of each partition
+	// key can be leased, and only if it's still pending
+	var firstInPartition map[string]int64
+	if opts.FIFO {
+		firstInPartition = make(map[string]int64)
+		for _, m := range s.jobs {
+			if m.job.Queue != queue || m.job.PartitionKey == "" ||
+				(m.job.Status != StatusPending && m.job.Status != StatusLeased && m.job.Status != StatusProcessing) {
+				continue
+			}
+			if seq, ok := firstInPartition[m.job.PartitionKey]; !ok || m.seq < seq {
+				firstInPartition[m.job.PartitionKey] = m.seq
+			}
+		}
+	}
+
+	var candidates []*memJob
+	for _, m := range s.jobs {
+		job := &m.job
+		if job.Queue != queue || job.Status != StatusPending || job.RunAt.After(now) {
+			continue
+		}
+		if job.Deadline != nil && !job.Deadline.After(now) {
+			continue
+		}
+		if _, paused := s.pausedTypes[job.Type]; paused {
+			continue
+		}
+		if !requirementsMet(job.Requires, capabilities) || !labelsMatch(job.Labels, opts.LabelFilter) {
+			continue
+		}
+		// Filters apply to the job's own priority, not a front requeue's boost
+		priority := job.Priority - m.priorityBoost
+		if (opts.PriorityAtLeast != nil && priority < *opts.PriorityAtLeast) ||
+			(opts.PriorityBelow != nil && priority >= *opts.PriorityBelow) ||
+			(opts.MinPriority != nil && priority < *opts.MinPriority) {
+			continue
+		}
+		if opts.FIFO && job.PartitionKey != "" && firstInPartition[job.PartitionKey] != m.seq {
+			continue
+		}
+		candidates = append(candidates, m)
+	}
+
+	edf := false
+	if cfg, ok := s.queueConfigs[queue]; ok {
+		edf = cfg.Scheduling == SchedulingEDF
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := &candidates[i].job, &candidates[j].job
+		if edf && (a.Deadline != nil || b.Deadline != nil) {
+			switch {
+			case b.Deadline == nil:
+				return true
+			case a.Deadline == nil:
+				return false
+			case !a.Deadline.Equal(*b.Deadline):
+				return a.Deadline.Before(*b.Deadline)
+			}
+		}
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if !a.RunAt.Equal(b.RunAt) {
+			return a.RunAt.Before(b.RunAt)
+		}
+		return candidates[i].seq < candidates[j].seq
+	})
+	if maxJobs < 0 {
+		maxJobs = 0
+	}
+	if len(candidates) > maxJobs {
+		candidates = candidates[:maxJobs]
+	}
+
+	leaseID := uuid.New().String()
+	jobs := make([]*Job, 0, len(candidates))
+	for _, m := range candidates {
+		m.lease(leaseID, workerID, now, leaseTTL)
+		m.job.StartedAt = nil
+		if opts.StartImmediately {
+			startedAt := now
+			m.job.Status = StatusProcessing
+			m.job.StartedAt = &startedAt
+		}
+		if opts.VisibilityTimeout > 0 {
+			visibleUntil := now.Add(opts.VisibilityTimeout)
+			m.visibleUntil = &visibleUntil
+		}
+		job, err := m.copyJob(!opts.OmitPayload)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// requirementsMet reports whether every required capability is offered
+func requirementsMet(requires []string, capabilities map[string]bool) bool {
+	for _, r := range requires {
+		if !capabilities[r] {
+			return false
+		}
+	}
+	return true
+}
+
+// labelsMatch reports whether labels include every pair in filter
+func labelsMatch(labels, filter map[string]string) bool {
+	for k, v := range filter {
+		if got, ok := labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// LeaseJob leases one specific pending job to workerID
+func (s *InMemoryStore) LeaseJob(ctx context.Context, jobID, workerID string, leaseTTL time.Duration) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	m, ok := s.jobs[jobID]
+	if !ok || m.job.Status != StatusPending || m.job.RunAt.After(now) ||
+		(m.job.Deadline != nil && !m.job.Deadline.After(now)) || s.dispatchPause != nil {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotLeasable, jobID)
+	}
+	if _, paused := s.pausedTypes[m.job.Type]; paused {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotLeasable, jobID)
+	}
+
+	m.lease(uuid.New().String(), workerID, now, leaseTTL)
+	return m.copyJob(true)
+}
+
+// ReclaimExpiredLeases returns jobs whose lease or visibility timeout has
+// passed to pending, or to dead once their retries are used up; see
+// PostgresStore.ReclaimExpiredLeases
+func (s *InMemoryStore) ReclaimExpiredLeases(ctx context.Context) ([]string, []string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var reclaimed, dead, expired []string
+	for _, m := range s.jobs {
+		if m.job.Status != StatusLeased && m.job.Status != StatusProcessing {
+			continue
+		}
+		leaseExpired := m.job.LeaseExpiresAt != nil && !m.job.LeaseExpiresAt.After(now)
+		invisible := m.visibleUntil != nil && !m.visibleUntil.After(now)
+		if !leaseExpired && !invisible {
+			continue
+		}
+		m.finishAttempt(m.job.LeaseID, AttemptExpired, "lease expired", now)
+
+		// First visibility expiry: re-queue without touching attempts
+		if invisible && !m.visibilityRequeued {
+			m.job.Status = StatusPending
+			m.job.RunAt = now
+			m.visibilityRequeued = true
+			m.clearLease()
+			m.job.UpdatedAt = now
+			reclaimed = append(reclaimed, m.job.ID)
+			continue
+		}
+
+		// Expiries within the grace limit: redeliver right away without touching attempts
+		if m.job.Redeliveries < s.graceRedeliveries {
+			m.job.Status = StatusPending
+			m.job.RunAt = now
+			m.job.Redeliveries++
+			m.job.LastError = "lease expired"
+			m.clearLease()
+			m.job.UpdatedAt = now
+			reclaimed = append(reclaimed, m.job.ID)
+			continue
+		}
+		expired = append(expired, m.job.ID)
+	}
+
+	// Remaining expiries count as failed attempts
+	var workflows []string
+	for _, id := range expired {
+		m := s.jobs[id]
+		m.job.Attempts++
+		if m.job.Attempts >= m.job.MaxRetries {
+			deadAt := now
+			m.job.Status = StatusDead
+			m.job.DeadReason = DeadReasonExpired
+			m.job.DeadAt = &deadAt
+			m.job.RunAt = now
+			m.slaMet = slaOutcome(m.job.Deadline, StatusDead, now)
+			dead = append(dead, id)
+			if m.job.WorkflowID != "" {
+				workflows = append(workflows, m.job.WorkflowID)
+			}
+		} else {
+			m.job.Status = StatusPending
+			m.job.DeadReason = ""
+			m.job.DeadAt = nil
+			m.job.RunAt = now.Add(s.retryDelay(m, m.job.Attempts))
+		}
+		m.job.LastError = "lease expired"
+		m.clearLease()
+		m.job.UpdatedAt = now
+		reclaimed = append(reclaimed, id)
+	}
+
+	for _, workflowID := range workflows {
+		s.advanceWorkflowLocked(workflowID)
+	}
+	return reclaimed, dead, nil
+}
+
+// FetchPayload returns a leased job's payload, failing with
+// errInvalidLease unless the job is still held under leaseID
+func (s *InMemoryStore) FetchPayload(ctx context.Context, jobID, leaseID string) (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.jobs[jobID]
+	if !ok || m.job.LeaseID == "" || m.job.LeaseID != leaseID {
+		return nil, errInvalidLease
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(m.payload, &payload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+	return payload, nil
+}
+
+// AckJob acknowledges a leased job; see PostgresStore.AckJob
+func (s *InMemoryStore) AckJob(ctx context.Context, req AckRequest) (*AckResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ackJobLocked(req)
+}
+
+// AckJobsBatch acknowledges several jobs at once. Acks with a stale lease
+// or unknown job are reported in their result rather than failing the batch.
+func (s *InMemoryStore) AckJobsBatch(ctx context.Context, acks []AckRequest) ([]AckResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]AckResult, 0, len(acks))
+	for _, ack := range acks {
+		result, err := s.ackJobLocked(ack)
+		if err != nil {
+			result = &AckResult{JobID: ack.JobID, Error: err.Error()}
+		}
+		results = append(results, *result)
+	}
+	return results, nil
+}
+
+func (s *InMemoryStore) ackJobLocked(req AckRequest) (*AckResult, error) {
+	m, ok := s.jobs[req.JobID]
+	if !ok {
+		return nil, fmt.Errorf("failed to get job: %w", sql.ErrNoRows)
+	}
+
+	if m.job.LeaseID == "" || m.job.LeaseID != req.LeaseID {
+		return nil, errInvalidLease
+	}
+	if req.LeaseEpoch == 0 && s.requireEpoch {
+		return nil, fmt.Errorf("%w: lease epoch required", errInvalidLease)
+	}
+	if req.LeaseEpoch != 0 && req.LeaseEpoch != m.job.LeaseEpoch {
+		return nil, fmt.Errorf("%w: stale lease epoch %d (current %d)", errInvalidLease, req.LeaseEpoch, m.job.LeaseEpoch)
+	}
+
+	result := &AckResult{JobID: req.JobID, Acknowledged: true, Queue: m.job.Queue, Type: m.job.Type, CreatedAt: m.job.CreatedAt}
+
+	now := time.Now()
+	outcome := AttemptFailed
+	if req.Success {
+		outcome = AttemptSucceeded
+	}
+	m.finishAttempt(req.LeaseID, outcome, req.ErrorMessage, now)
+
+	if req.Success {
+		result.Status = StatusSucceeded
+	} else {
+		// Increment attempts and decide retry or DLQ
+		permanentReason := req.permanentDeadReason()
+		permanent := permanentReason != ""
+		_, failFastType := s.failFast[m.job.Type]
+		failFast := failFastType && !permanent
+		deferred := req.RetryAfter > 0 && !permanent && !failFast && m.deferrals < s.maxDeferrals
+		grace := req.Redelivery && !permanent && !deferred && m.job.Redeliveries < s.graceRedeliveries
+		if !deferred && !grace {
+			m.job.Attempts++
+		}
+		runAt := now
+		boost := 0
+
+		switch {
+		case permanent:
+			result.Status = StatusDead
+			result.DeadReason = permanentReason
+		case deferred:
+			result.Status = StatusPending
+			m.deferrals++
+			delay := req.RetryAfter
+			if delay > s.maxRetryAfter {
+				delay = s.maxRetryAfter
+			}
+			runAt = now.Add(delay)
+		case grace:
+			result.Status = StatusPending
+			m.job.Redeliveries++
+		case m.job.Attempts >= m.job.MaxRetries:
+			result.Status = StatusDead
+			result.DeadReason = DeadReasonMaxRetries
+		case failFast:
+			result.Status = StatusDead
+			result.DeadReason = DeadReasonFailFast
+		case s.retryBudgetExhausted != nil && s.retryBudgetExhausted(m.job.Queue):
+			result.Status = StatusDead
+			result.DeadReason = DeadReasonRetryBudget
+		case req.RequeueFront && m.frontRequeues < s.maxFrontRequeues:
+			result.Status = StatusPending
+			result.FrontRequeued = true
+			m.frontRequeues++
+			boost = frontRequeueBoost
+		default:
+			result.Status = StatusPending
+			if delay, ok := req.retryDelay(s.maxRetryAfter); ok {
+				runAt = now.Add(delay)
+				break
+			}
+			delay := s.retryDelay(m, m.job.Attempts)
+			if s.backoffMultiplier != nil {
+				delay = time.Duration(float64(delay) * s.backoffMultiplier(m.job.Type))
+			}
+			runAt = now.Add(delay)
+		}
+
+		m.job.LastError = req.ErrorMessage
+		m.job.RunAt = runAt
+		m.job.DeadReason = result.DeadReason
+		m.job.DeadAt = nil
+		if result.Status == StatusDead {
+			deadAt := runAt
+			m.job.DeadAt = &deadAt
+		}
+		m.job.Priority += boost
+		m.priorityBoost += boost
+	}
+	result.SLAMet = slaOutcome(m.job.Deadline, result.Status, now)
+	m.slaMet = result.SLAMet
+	m.job.Status = result.Status
+	m.clearLease()
+	m.job.UpdatedAt = now
+
+	// A finished workflow node may unblock its downstream nodes or fail the workflow
+	if m.job.WorkflowID != "" && (result.Status == StatusSucceeded || result.Status == StatusDead) {
+		s.advanceWorkflowLocked(m.job.WorkflowID)
+	}
+	return result, nil
+}
+
+func limitJobs(jobs []*memJob, limit int) []*memJob {
+	if limit < 0 {
+		limit = 0
+	}
+	if len(jobs) > limit {
+		return jobs[:limit]
+	}
+	return jobs
+}
+
+// GetQueueStats returns job counts by queue and status
+func (s *InMemoryStore) GetQueueStats(ctx context.Context) ([]QueueStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queueStatsLocked(), nil
+}
+
+func (s *InMemoryStore) queueStatsLocked() []QueueStats {
+	counts := make(map[QueueStats]int)
+	for _, m := range s.jobs {
+		counts[QueueStats{Queue: m.job.Queue, Status: string(m.job.Status)}]++
+	}
+
+	var stats []QueueStats
+	for stat, count := range counts {
+		stat.Count = count
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Queue != stats[j].Queue {
+			return stats[i].Queue < stats[j].Queue
+		}
+		return stats[i].Status < stats[j].Status
+	})
+	return stats
+}
+
+// RecordQueueStatsSample snapshots the current job counts of every queue at
+// the given time, returning the samples written
+func (s *InMemoryStore) RecordQueueStatsSample(ctx context.Context, at time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := s.queueStatsLocked()
+	for _, stat := range stats {
+		s.statsHistory = append(s.statsHistory, memStatsSample{sampledAt: at, queue: stat.Queue, status: stat.Status, count: stat.Count})
+	}
+	return int64(len(stats)), nil
+}
+
+// PruneQueueStatsHistory deletes samples taken before the cutoff
+func (s *InMemoryStore) PruneQueueStatsHistory(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.statsHistory[:0]
+	for _, sample := range s.statsHistory {
+		if !sample.sampledAt.Before(before) {
+			kept = append(kept, sample)
+		}
+	}
+	pruned := int64(len(s.statsHistory) - len(kept))
+	s.statsHistory = kept
+	return pruned, nil
+}
+
+// GetQueueStatsHistory returns a queue's samples since the given time, oldest
+// first, downsampled to the last sample in each bucket-sized interval
+func (s *InMemoryStore) GetQueueStatsHistory(ctx context.Context, queue string, since time.Time, bucket time.Duration) ([]QueueStatsPoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucketSeconds := bucket.Seconds()
+	if bucketSeconds < 1 {
+		bucketSeconds = 1
+	}
+	bucketOf := func(t time.Time) float64 {
+		return math.Floor(float64(t.UnixNano()) / 1e9 / bucketSeconds)
+	}
+
+	latest := make(map[float64]time.Time)
+	for _, sample := range s.statsHistory {
+		if sample.queue != queue || sample.sampledAt.Before(since) {
+			continue
+		}
+		b := bucketOf(sample.sampledAt)
+		if t, ok := latest[b]; !ok || sample.sampledAt.After(t) {
+			latest[b] = sample.sampledAt
+		}
+	}
+
+	var points []QueueStatsPoint
+	for _, t := range latest {
+		points = append(points, QueueStatsPoint{SampledAt: t, Counts: make(map[string]int)})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].SampledAt.Before(points[j].SampledAt) })
+	for _, sample := range s.statsHistory {
+		if sample.queue != queue {
+			continue
+		}
+		for i := range points {
+			if points[i].SampledAt.Equal(sample.sampledAt) {
+				points[i].Counts[sample.status] = sample.count
+			}
+		}
+	}
+	return points, nil
+}
+
+// CountStuckJobs returns, per queue, how many leased jobs have been held
+// longer than ttlMultiple times their lease TTL
+func (s *InMemoryStore) CountStuckJobs(ctx context.Context, ttlMultiple float64) (map[string]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	counts := make(map[string]int)
+	for _, m := range s.jobs {
+		job := m.job
+		if (job.Status != StatusLeased && job.Status != StatusProcessing) || job.LeasedAt == nil || job.LeaseExpiresAt == nil {
+			continue
+		}
+		ttl := job.LeaseExpiresAt.Sub(*job.LeasedAt)
+		if float64(now.Sub(*job.LeasedAt)) > float64(ttl)*ttlMultiple {
+			counts[job.Queue]++
+		}
+	}
+	return counts, nil
+}
+
+// CountInFlightByLease counts the jobs still leased or processing under each
+// of leaseIDs
+func (s *InMemoryStore) CountInFlightByLease(ctx context.Context, leaseIDs []string) (map[string]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[string]bool, len(leaseIDs))
+	for _, id := range leaseIDs {
+		wanted[id] = true
+	}
+	counts := make(map[string]int)
+	for _, m := range s.jobs {
+		if (m.job.Status == StatusLeased || m.job.Status == StatusProcessing) && wanted[m.job.LeaseID] {
+			counts[m.job.LeaseID]++
+		}
+	}
+	return counts, nil
+}
+
+// ExpireJobs marks queue's pending jobs whose deadline has passed as expired
+func (s *InMemoryStore) ExpireJobs(ctx context.Context, queue string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var ids []string
+	for _, m := range s.jobs {
+		if m.job.Queue == queue && m.job.Status == StatusPending && m.job.Deadline != nil && !m.job.Deadline.After(now) {
+			m.job.Status = StatusExpired
+			m.slaMet = slaOutcome(m.job.Deadline, StatusExpired, now)
+			m.job.UpdatedAt = now
+			ids = append(ids, m.job.ID)
+		}
+	}
+	return ids, nil
+}
+
+// AgeJobs raises the priority of jobs that have been runnable but untouched
+// since waitingSince by increment, up to maxPriority
+func (s *InMemoryStore) AgeJobs(ctx context.Context, increment, maxPriority int, waitingSince time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var aged int64
+	for _, m := range s.jobs {
+		job := &m.job
+		if job.Status != StatusPending || job.Priority >= maxPriority ||
+			job.RunAt.After(waitingSince) || job.UpdatedAt.After(waitingSince) {
+			continue
+		}
+		job.Priority += increment
+		if job.Priority > maxPriority {
+			job.Priority = maxPriority
+		}
+		job.UpdatedAt = now
+		aged++
+	}
+	return aged, nil
+}
+
+// MigrateQueue moves the pending jobs of queue from into queue to, returning
+// how many moved
+func (s *InMemoryStore) MigrateQueue(ctx context.Context, from, to string, filter MigrateFilter) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var moved int64
+	for _, m := range s.jobs {
+		job := &m.job
+		if job.Queue != from || job.Status != StatusPending || !filter.matches(job.RunAt, now) {
+			continue
+		}
+		job.Queue = to
+		job.UpdatedAt = now
+		moved++
+	}
+	return moved, nil
+}
+
+// GetRecentJobs returns the newest jobs, optionally of one kind
+func (s *InMemoryStore) GetRecentJobs(ctx context.Context, kind JobKind, limit int) ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matched []*memJob
+	for _, m := range s.jobs {
+		if kind == "" || m.job.Kind == kind {
+			matched = append(matched, m)
+		}
+	}
+	sortNewestFirst(matched)
+	return copyJobs(limitJobs(matched, limit))
+}
+
+// sortNewestFirst orders jobs by creation time then ID, descending
+func sortNewestFirst(jobs []*memJob) {
+	sort.Slice(jobs, func(i, j int) bool {
+		a, b := jobs[i].job, jobs[j].job
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	})
+}
+
+// GetJobsByTimeRange returns up to limit jobs created in [from, to), newest
+// first, continuing after the given cursor; see PostgresStore.GetJobsByTimeRange
+func (s *InMemoryStore) GetJobsByTimeRange(ctx context.Context, from, to time.Time, after *JobCursor, limit int) ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if to.IsZero() {
+		to = maxCreatedAt
+	}
+	var matched []*memJob
+	for _, m := range s.jobs {
+		createdAt := m.job.CreatedAt
+		if createdAt.Before(from) || !createdAt.Before(to) {
+			continue
+		}
+		if after != nil && !(createdAt.Before(after.CreatedAt) || (createdAt.Equal(after.CreatedAt) && m.job.ID < after.ID)) {
+			continue
+		}
+		matched = append(matched, m)
+	}
+	sortNewestFirst(matched)
+	return copyJobs(limitJobs(matched, limit))
+}
+
+// ListDeadJobs returns dead jobs, most recently dead first, optionally
+// filtered by queue and dead reason
+func (s *InMemoryStore) ListDeadJobs(ctx context.Context, queue string, reason DeadReason, limit int) ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matched []*memJob
+	for _, m := range s.jobs {
+		if m.job.Status == StatusDead && (queue == "" || m.job.Queue == queue) && (reason == "" || m.job.DeadReason == reason) {
+			matched = append(matched, m)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].job.UpdatedAt.After(matched[j].job.UpdatedAt) })
+	return copyJobs(limitJobs(matched, limit))
+}
+
+// deadSince is when a dead job died, falling back to its last update
+func (m *memJob) deadSince() time.Time {
+	if m.job.DeadAt != nil {
+		return *m.job.DeadAt
+	}
+	return m.job.UpdatedAt
+}
+
+// matches reports whether a dead job is selected by the filter
+func (f DeadJobFilter) matches(m *memJob) bool {
+	job := m.job
+	switch {
+	case job.Status != StatusDead:
+		return false
+	case f.Queue != "" && job.Queue != f.Queue:
+		return false
+	case f.Type != "" && job.Type != f.Type:
+		return false
+	case f.Reason != "" && job.DeadReason != f.Reason:
+		return false
+	case f.DeadAfter != nil && m.deadSince().Before(*f.DeadAfter):
+		return false
+	case f.DeadBefore != nil && !m.deadSince().Before(*f.DeadBefore):
+		return false
+	}
+	return true
+}
+
+// RetryDeadJobs returns dead jobs that opted into dead retries to pending
+// once their next delay on the schedule has passed; see
+// PostgresStore.RetryDeadJobs
+func (s *InMemoryStore) RetryDeadJobs(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.deadRetrySchedule) == 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	var ids []string
+	for _, m := range s.jobs {
+		if len(ids) >= deadRetryBatchSize {
+			break
+		}
+		job := &m.job
+		if job.Status != StatusDead || !job.DeadRetry || job.DeadRetryCount >= len(s.deadRetrySchedule) {
+			continue
+		}
+		retryable := false
+		for _, reason := range deadRetryReasons {
+			if string(job.DeadReason) == reason {
+				retryable = true
+			}
+		}
+		if !retryable || m.deadSince().After(now.Add(-s.deadRetrySchedule[job.DeadRetryCount])) {
+			continue
+		}
+
+		job.Status = StatusPending
+		job.DeadReason = ""
+		job.DeadAt = nil
+		job.DeadRetryCount++
+		job.RunAt = now
+		job.UpdatedAt = now
+		ids = append(ids, job.ID)
+	}
+	return ids, nil
+}
+
+// CountDeadJobs returns how many dead jobs match the filter
+func (s *InMemoryStore) CountDeadJobs(ctx context.Context, filter DeadJobFilter) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, m := range s.jobs {
+		if filter.matches(m) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ReplayDeadJobs returns up to limit dead jobs matching the filter to
+// pending, oldest death first, with a full set of attempts
+func (s *InMemoryStore) ReplayDeadJobs(ctx context.Context, filter DeadJobFilter, limit int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matched []*memJob
+	for _, m := range s.jobs {
+		if filter.matches(m) {
+			matched = append(matched, m)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		a, b := matched[i].deadSince(), matched[j].deadSince()
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return matched[i].job.ID < matched[j].job.ID
+	})
+
+	now := time.Now()
+	var ids []string
+	for _, m := range limitJobs(matched, limit) {
+		m.job.Status = StatusPending
+		m.job.Attempts = 0
+		m.job.Redeliveries = 0
+		m.job.DeadReason = ""
+		m.job.DeadAt = nil
+		m.job.KilledBy = ""
+		m.frontRequeues = 0
+		m.deferrals = 0
+		m.job.RunAt = now
+		m.job.UpdatedAt = now
+		ids = append(ids, m.job.ID)
+	}
+	return ids, nil
+}
+
+// KillJob moves a non-terminal job straight to the dead-letter queue; see
+// PostgresStore.KillJob
+func (s *InMemoryStore) KillJob(ctx context.Context, id, operator, reason string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	if !killableStatuses[m.job.Status] {
+		return nil, fmt.Errorf("%w: status is %s", ErrJobFinished, m.job.Status)
+	}
+
+	lastError := "killed by " + operator
+	if reason != "" {
+		lastError += ": " + reason
+	}
+
+	now := time.Now()
+	if m.job.LeaseID != "" {
+		m.finishAttempt(m.job.LeaseID, AttemptKilled, lastError, now)
+	}
+	m.job.Status = StatusDead
+	m.job.DeadReason = DeadReasonKilled
+	m.job.DeadAt = &now
+	m.job.KilledBy = operator
+	m.job.LastError = lastError
+	m.clearLease()
+	m.job.UpdatedAt = now
+
+	if m.job.WorkflowID != "" {
+		s.advanceWorkflowLocked(m.job.WorkflowID)
+	}
+	return m.copyJob(true)
+}
+
+// StealJob revokes a job's lease and makes it pending again; see
+// PostgresStore.StealJob
+func (s *InMemoryStore) StealJob(ctx context.Context, id string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	if (m.job.Status != StatusLeased && m.job.Status != StatusProcessing) || m.job.LeaseID == "" {
+		return nil, fmt.Errorf("%w: status is %s", ErrJobNotLeased, m.job.Status)
+	}
+
+	now := time.Now()
+	m.finishAttempt(m.job.LeaseID, AttemptStolen, "lease revoked", now)
+	m.job.Status = StatusPending
+	m.job.RunAt = now
+	m.job.LeaseEpoch++
+	m.job.StartedAt = nil
+	m.clearLease()
+	m.job.UpdatedAt = now
+	return m.copyJob(true)
+}
+
+// ReleaseJob returns a leased job its worker hasn't started to pending
+// without counting it; see PostgresStore.ReleaseJob
+func (s *InMemoryStore) ReleaseJob(ctx context.Context, jobID, leaseID string, epoch int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.jobs[jobID]
+	if !ok {
+		return fmt.Errorf("failed to get job: %w", sql.ErrNoRows)
+	}
+	if err := checkLease(m.job.LeaseID, m.job.LeaseEpoch, leaseID, epoch, s.requireEpoch); err != nil {
+		return err
+	}
+
+	attempts := m.attempts[:0]
+	for _, a := range m.attempts {
+		if a.LeaseID != leaseID || a.FinishedAt != nil {
+			attempts = append(attempts, a)
+		}
+	}
+	m.attempts = attempts
+	m.job.Status = StatusPending
+	m.job.StartedAt = nil
+	m.clearLease()
+	m.job.UpdatedAt = time.Now()
+	return nil
+}
+
+// CreateWorkflow validates the workflow and creates a job for every node
+// atomically; see PostgresStore.CreateWorkflow
+func (s *InMemoryStore) CreateWorkflow(ctx context.Context, req *CreateWorkflowRequest) (*Workflow, error) {
+	if err := ValidateWorkflow(req); err != nil {
+		return nil, err
+	}
+	policy := req.FailurePolicy
+	if policy == "" {
+		policy = WorkflowFailFast
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	mw := &memWorkflow{workflow: Workflow{
+		ID:            uuid.New().String(),
+		Status:        WorkflowRunning,
+		FailurePolicy: policy,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}}
+	wf := mw.workflow
+	wf.Nodes = make([]*WorkflowNode, 0, len(req.Nodes))
+
+	var created []string
+	for i := range req.Nodes {
+		node := &req.Nodes[i]
+		job, err := s.createJobLocked(&node.Job)
+		if err != nil {
+			s.deleteJobsLocked(created)
+			return nil, fmt.Errorf("node %q: %w", node.Name, err)
+		}
+		created = append(created, job.ID)
+
+		status := StatusPending
+		if len(node.DependsOn) > 0 {
+			status = StatusBlocked
+		}
+		m := s.jobs[job.ID]
+		m.job.WorkflowID = mw.workflow.ID
+		m.job.Status = status
+
+		dependsOn := node.DependsOn
+		if dependsOn == nil {
+			dependsOn = []string{}
+		}
+		mw.nodes = append(mw.nodes, memWorkflowNode{name: node.Name, dependsOn: dependsOn, jobID: job.ID})
+		wf.Nodes = append(wf.Nodes, &WorkflowNode{
+			Name:      node.Name,
+			DependsOn: dependsOn,
+			JobID:     job.ID,
+			Status:    status,
+		})
+	}
+
+	s.workflows[mw.workflow.ID] = mw
+	return &wf, nil
+}
+
+// GetWorkflow returns a workflow with the current status of each node
+func (s *InMemoryStore) GetWorkflow(ctx context.Context, id string) (*Workflow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mw, ok := s.workflows[id]
+	if !ok {
+		return nil, ErrWorkflowNotFound
+	}
+
+	wf := mw.workflow
+	for _, node := range mw.nodes {
+		job := s.jobs[node.jobID].job
+		wf.Nodes = append(wf.Nodes, &WorkflowNode{
+			Name:      node.name,
+			DependsOn: append([]string{}, node.dependsOn...),
+			JobID:     node.jobID,
+			Status:    job.Status,
+			Attempts:  job.Attempts,
+			LastError: job.LastError,
+		})
+	}
+	sort.SliceStable(wf.Nodes, func(i, j int) bool {
+		a, b := s.jobs[wf.Nodes[i].JobID].job, s.jobs[wf.Nodes[j].JobID].job
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return wf.Nodes[i].Name < wf.Nodes[j].Name
+	})
+	return &wf, nil
+}
+
+// advanceWorkflowLocked is advanceWorkflowTx for the in-memory store
+func (s *InMemoryStore) advanceWorkflowLocked(workflowID string) {
+	mw, ok := s.workflows[workflowID]
+	if !ok || mw.workflow.Status != WorkflowRunning {
+		return
+	}
+
+	nodes := make(map[string]*workflowNodeState, len(mw.nodes))
+	for _, node := range mw.nodes {
+		nodes[node.name] = &workflowNodeState{
+			jobID:     node.jobID,
+			dependsOn: node.dependsOn,
+			status:    s.jobs[node.jobID].job.Status,
+		}
+	}
+	plan := planWorkflowAdvance(mw.workflow.FailurePolicy, nodes)
+
+	now := time.Now()
+	for _, jobID := range plan.unblock {
+		// Delays count from the moment a node is released, not from when
+		// the workflow was created
+		if m := s.jobs[jobID]; m.job.Status == StatusBlocked {
+			m.job.Status = StatusPending
+			m.job.RunAt = now.Add(m.job.RunAt.Sub(m.job.CreatedAt))
+			m.job.UpdatedAt = now
+		}
+	}
+	for jobID, reason := range plan.cancelled {
+		if m := s.jobs[jobID]; m.job.Status == StatusBlocked {
+			m.job.Status = StatusCancelled
+			m.job.LastError = reason
+			m.job.UpdatedAt = now
+		}
+	}
+
+	mw.workflow.UpdatedAt = now
+	if plan.status != WorkflowRunning {
+		finishedAt := now
+		mw.workflow.Status = plan.status
+		mw.workflow.FinishedAt = &finishedAt
+	}
+}
+
+// RecordWorkerHeartbeat notes that workerID, with the given capacity weight,
+// just polled queue. Weights below 1 are recorded as 1.
+func (s *InMemoryStore) RecordWorkerHeartbeat(ctx context.Context, workerID, queue string, weight int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if weight < 1 {
+		weight = 1
+	}
+	s.heartbeats[memHeartbeatKey{workerID: workerID, queue: queue}] = &memHeartbeat{lastSeen: time.Now(), weight: weight}
+	return nil
+}
+
+// CountHealthyWorkers returns how many workers have polled queue since the given time
+func (s *InMemoryStore) CountHealthyWorkers(ctx context.Context, queue string, since time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for key, hb := range s.heartbeats {
+		if key.queue == queue && !hb.lastSeen.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// HealthyWorkerCapacity returns the summed weight of the workers that have
+// polled queue since the given time
+func (s *InMemoryStore) HealthyWorkerCapacity(ctx context.Context, queue string, since time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	capacity := 0
+	for key, hb := range s.heartbeats {
+		if key.queue == queue && !hb.lastSeen.Before(since) {
+			capacity += hb.weight
+		}
+	}
+	return capacity, nil
+}
+
+// ListWorkers returns the workers that have polled any queue since the given
+// time, with their most recently reported weight
+func (s *InMemoryStore) ListWorkers(ctx context.Context, since time.Time) ([]*WorkerInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byID := make(map[string]*WorkerInfo)
+	for key, hb := range s.heartbeats {
+		if hb.lastSeen.Before(since) {
+			continue
+		}
+		w, ok := byID[key.workerID]
+		if !ok {
+			w = &WorkerInfo{WorkerID: key.workerID}
+			byID[key.workerID] = w
+		}
+		w.Queues = append(w.Queues, key.queue)
+		if hb.lastSeen.After(w.LastSeen) {
+			w.LastSeen = hb.lastSeen
+			w.Weight = hb.weight
+		}
+	}
+
+	workers := make([]*WorkerInfo, 0, len(byID))
+	for _, w := range byID {
+		sort.Strings(w.Queues)
+		workers = append(workers, w)
+	}
+	sort.Slice(workers, func(i, j int) bool { return workers[i].WorkerID < workers[j].WorkerID })
+	return workers, nil
+}
+
+// PruneWorkerHeartbeats forgets workers that haven't polled since before and
+// returns how many were removed
+func (s *InMemoryStore) PruneWorkerHeartbeats(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var pruned int64
+	for key, hb := range s.heartbeats {
+		if hb.lastSeen.Before(before) {
+			delete(s.heartbeats, key)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+// RequestWorkerDrain asks workerID to stop leasing and drain, returning when
+// the request was made
+func (s *InMemoryStore) RequestWorkerDrain(ctx context.Context, workerID string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.drains[workerID] = now
+	return now, nil
+}
+
+// WorkerDrainRequested reports whether a drain was requested for workerID
+// after startedAt
+func (s *InMemoryStore) WorkerDrainRequested(ctx context.Context, workerID string, startedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requestedAt, ok := s.drains[workerID]
+	return ok && requestedAt.After(startedAt), nil
+}
+
+// GetQueueConfig returns queue's config, or nil if it has none
+func (s *InMemoryStore) GetQueueConfig(ctx context.Context, queue string) (*QueueConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cfg, ok := s.queueConfigs[queue]
+	if !ok {
+		return nil, nil
+	}
+	copied := *cfg
+	return &copied, nil
+}
+
+// ListQueueConfigs returns every queue config ordered by queue
+func (s *InMemoryStore) ListQueueConfigs(ctx context.Context) ([]*QueueConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var configs []*QueueConfig
+	for _, cfg := range s.queueConfigs {
+		copied := *cfg
+		configs = append(configs, &copied)
+	}
+	sort.Slice(configs, func(i, j int) bool { return configs[i].Queue < configs[j].Queue })
+	return configs, nil
+}
+
+// SetQueueConfig creates or replaces a queue's config, setting its UpdatedAt
+func (s *InMemoryStore) SetQueueConfig(ctx context.Context, cfg *QueueConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cfg.UpdatedAt = time.Now()
+	copied := *cfg
+	s.queueConfigs[cfg.Queue] = &copied
+	return nil
+}
+
+// ListRoutingRules returns all routing rules ordered by pattern
+func (s *InMemoryStore) ListRoutingRules(ctx context.Context) ([]*RoutingRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rules []*RoutingRule
+	for _, rule := range s.routingRules {
+		copied := *rule
+		rules = append(rules, &copied)
+	}
+	return rules, nil
+}
+
+// SetRoutingRules replaces all routing rules, setting each rule's UpdatedAt
+func (s *InMemoryStore) SetRoutingRules(ctx context.Context, rules []*RoutingRule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.routingRules = make([]*RoutingRule, 0, len(rules))
+	for _, rule := range rules {
+		rule.UpdatedAt = now
+		copied := *rule
+		s.routingRules = append(s.routingRules, &copied)
+	}
+	sort.Slice(s.routingRules, func(i, j int) bool {
+		return s.routingRules[i].TypePattern < s.routingRules[j].TypePattern
+	})
+	return nil
+}
+
+// GetCalendar returns the named calendar, or nil if it isn't defined
+func (s *InMemoryStore) GetCalendar(ctx context.Context, name string) (*BusinessCalendar, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cal, ok := s.calendars[name]
+	if !ok {
+		return nil, nil
+	}
+	copied := *cal
+	return &copied, nil
+}
+
+// PutCalendar creates or replaces a calendar, setting its UpdatedAt
+func (s *InMemoryStore) PutCalendar(ctx context.Context, cal *BusinessCalendar) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cal.UpdatedAt = time.Now()
+	copied := *cal
+	copied.Weekend = append([]string{}, cal.Weekend...)
+	copied.Holidays = append([]string{}, cal.Holidays...)
+	s.calendars[cal.Name] = &copied
+	return nil
+}
+
+// PauseJobType stops jobs of jobType from being leased. Pausing a type that is
+// already paused keeps its original PausedAt.
+func (s *InMemoryStore) PauseJobType(ctx context.Context, jobType string) (*PausedJobType, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pausedAt, ok := s.pausedTypes[jobType]
+	if !ok {
+		pausedAt = time.Now()
+		s.pausedTypes[jobType] = pausedAt
+	}
+	return &PausedJobType{Type: jobType, PausedAt: pausedAt}, nil
+}
+
+// ResumeJobType lets jobs of jobType be leased again. It reports whether the
+// type was paused.
+func (s *InMemoryStore) ResumeJobType(ctx context.Context, jobType string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.pausedTypes[jobType]
+	delete(s.pausedTypes, jobType)
+	return ok, nil
+}
+
+// ListPausedJobTypes returns all paused job types ordered by type
+func (s *InMemoryStore) ListPausedJobTypes(ctx context.Context) ([]*PausedJobType, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var types []*PausedJobType
+	for jobType, pausedAt := range s.pausedTypes {
+		types = append(types, &PausedJobType{Type: jobType, PausedAt: pausedAt})
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Type < types[j].Type })
+	return types, nil
+}
+
+// PauseDispatch stops all leasing. Pausing while already paused keeps the
+// original PausedAt.
+func (s *InMemoryStore) PauseDispatch(ctx context.Context) (*DispatchPause, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dispatchPause == nil {
+		s.dispatchPause = &DispatchPause{PausedAt: time.Now()}
+	}
+	pause := *s.dispatchPause
+	return &pause, nil
+}
+
+// ResumeDispatch lets jobs be leased again. It reports whether dispatch was
+// paused.
+func (s *InMemoryStore) ResumeDispatch(ctx context.Context) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	paused := s.dispatchPause != nil
+	s.dispatchPause = nil
+	return paused, nil
+}
+
+// GetDispatchPause returns the global pause, or nil if dispatch isn't paused
+func (s *InMemoryStore) GetDispatchPause(ctx context.Context) (*DispatchPause, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dispatchPause == nil {
+		return nil, nil
+	}
+	pause := *s.dispatchPause
+	return &pause, nil
+}
+
+// SetJobTypeFailFast makes failures of jobType dead-letter immediately.
+// Setting a type that is already fail-fast keeps its original EnabledAt.
+func (s *InMemoryStore) SetJobTypeFailFast(ctx context.Context, jobType string) (*FailFastJobType, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enabledAt, ok := s.failFast[jobType]
+	if !ok {
+		enabledAt = time.Now()
+		s.failFast[jobType] = enabledAt
+	}
+	return &FailFastJobType{Type: jobType, EnabledAt: enabledAt}, nil
+}
+
+// ClearJobTypeFailFast lets failures of jobType be retried again. It
+// reports whether the type was fail-fast.
+func (s *InMemoryStore) ClearJobTypeFailFast(ctx context.Context, jobType string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.failFast[jobType]
+	delete(s.failFast, jobType)
+	return ok, nil
+}
+
+// ListFailFastJobTypes returns all fail-fast job types ordered by type
+func (s *InMemoryStore) ListFailFastJobTypes(ctx context.Context) ([]*FailFastJobType, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var types []*FailFastJobType
+	for jobType, enabledAt := range s.failFast {
+		types = append(types, &FailFastJobType{Type: jobType, EnabledAt: enabledAt})
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Type < types[j].Type })
+	return types, nil
+}
+
+// ExportJobs returns up to limit jobs of queue (or of every queue if queue is
+// empty) with IDs greater than afterID, ordered by ID
+func (s *InMemoryStore) ExportJobs(ctx context.Context, queue, afterID string, limit int) ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matched []*memJob
+	for _, m := range s.jobs {
+		if (queue == "" || m.job.Queue == queue) && m.job.ID > afterID {
+			matched = append(matched, m)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].job.ID < matched[j].job.ID })
+	return copyJobs(limitJobs(matched, limit))
+}
+
+// ImportJob inserts an exported job, returning its ID; see PostgresStore.ImportJob
+func (s *InMemoryStore) ImportJob(ctx context.Context, job *Job, opts ImportOptions) (string, error) {
+	id := job.ID
+	if !opts.PreserveIDs || id == "" {
+		s.mu.Lock()
+		id = s.idGenerator.NewID()
+		s.mu.Unlock()
+	} else if err := ValidateJobID(id); err != nil {
+		return "", err
+	}
+
+	payloadJSON, err := CanonicalizePayload(job.Payload)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[id]; ok {
+		return "", fmt.Errorf("%w: %s", ErrJobExists, id)
+	}
+
+	imported := Job{
+		ID:                 id,
+		Type:               job.Type,
+		Queue:              job.Queue,
+		Priority:           job.Priority,
+		Status:             StatusPending,
+		Kind:               job.Kind,
+		MaxRetries:         job.MaxRetries,
+		RunAt:              job.RunAt,
+		CreatedAt:          job.CreatedAt,
+		UpdatedAt:          time.Now(),
+		TraceID:            job.TraceID,
+		PartitionKey:       job.PartitionKey,
+		Requires:           append([]string(nil), job.Requires...),
+		IdempotencyKey:     job.IdempotencyKey,
+		Deadline:           job.Deadline,
+		BackoffStrategy:    job.BackoffStrategy,
+		BackoffBaseSeconds: job.BackoffBaseSeconds,
+		BackoffCapSeconds:  job.BackoffCapSeconds,
+		BackoffSchedule:    append([]int(nil), job.BackoffSchedule...),
+		DeadRetry:          job.DeadRetry,
+		PayloadHash:        hashCanonical(payloadJSON),
+		UniqueKey:          job.UniqueKey,
+		WorkflowID:         job.WorkflowID,
+		State:              append(json.RawMessage(nil), job.State...),
+	}
+	if opts.PreserveStatus {
+		imported.Status = job.Status
+		imported.Attempts = job.Attempts
+		imported.Redeliveries = job.Redeliveries
+		imported.LastError = job.LastError
+		if job.Status == StatusDead {
+			imported.DeadReason = job.DeadReason
+			imported.DeadRetryCount = job.DeadRetryCount
+			imported.DeadAt = job.DeadAt
+			imported.KilledBy = job.KilledBy
+		}
+	}
+	if imported.Status == StatusLeased || imported.Status == StatusProcessing || imported.Status == "" {
+		imported.Status = StatusPending
+	}
+	if imported.Kind == "" {
+		imported.Kind = KindUser
+	}
+	if imported.Queue == "" {
+		imported.Queue = DefaultQueue(imported.Kind)
+	}
+	if imported.MaxRetries == 0 {
+		imported.MaxRetries = 3
+	}
+	if imported.RunAt.IsZero() {
+		imported.RunAt = imported.UpdatedAt
+	}
+	if imported.CreatedAt.IsZero() {
+		imported.CreatedAt = imported.UpdatedAt
+	}
+	if len(job.Labels) > 0 {
+		imported.Labels = make(map[string]string, len(job.Labels))
+		for k, v := range job.Labels {
+			imported.Labels[k] = v
+		}
+	}
+	if imported.UniqueKey != "" && isActiveStatus(imported.Status) {
+		if existing := s.findUniqueLocked(imported.UniqueKey); existing != nil {
+			return "", fmt.Errorf("%w: active job %s has the same unique key", ErrJobExists, existing.job.ID)
+		}
+	}
+
+	s.seq++
+	s.jobs[id] = &memJob{job: imported, payload: payloadJSON, seq: s.seq}
+	return id, nil
+}
+
+// ListJobAttempts returns a job's attempts, oldest first
+func (s *InMemoryStore) ListJobAttempts(ctx context.Context, jobID string) ([]*JobAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts := []*JobAttempt{}
+	m, ok := s.jobs[jobID]
+	if !ok {
+		return attempts, nil
+	}
+	for _, a := range m.attempts {
+		copied := *a
+		if a.FinishedAt != nil {
+			duration := a.FinishedAt.Sub(a.StartedAt).Milliseconds()
+			copied.DurationMs = &duration
+		}
+		attempts = append(attempts, &copied)
+	}
+	return attempts, nil
+}
+
+// GetSLAStats counts the jobs of jobType, or of every type if empty, whose
+// SLA outcome was recorded since the given time
+func (s *InMemoryStore) GetSLAStats(ctx context.Context, jobType string, since time.Time) (*SLAStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stats SLAStats
+	for _, m := range s.jobs {
+		if m.slaMet == nil || (jobType != "" && m.job.Type != jobType) || m.job.UpdatedAt.Before(since) {
+			continue
+		}
+		if *m.slaMet {
+			stats.Met++
+		} else {
+			stats.Missed++
+		}
+	}
+	return &stats, nil
+}
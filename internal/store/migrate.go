@@ -0,0 +1,65 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// MigrateFilter narrows which waiting jobs MigrateQueue moves
+type MigrateFilter string
+
+const (
+	// MigrateWaiting moves every pending job, due or not
+	MigrateWaiting MigrateFilter = ""
+	// MigrateDue moves only pending jobs that are due to run
+	MigrateDue MigrateFilter = "pending"
+	// MigrateScheduled moves only pending jobs whose run_at is in the future
+	MigrateScheduled MigrateFilter = "scheduled"
+)
+
+// ParseMigrateFilter parses "", "pending" or "scheduled"
+func ParseMigrateFilter(s string) (MigrateFilter, error) {
+	switch f := MigrateFilter(s); f {
+	case MigrateWaiting, MigrateDue, MigrateScheduled:
+		return f, nil
+	}
+	return "", fmt.Errorf("status must be pending or scheduled, got %q", s)
+}
+
+// matches reports whether a pending job due at runAt passes the filter at now
+func (f MigrateFilter) matches(runAt, now time.Time) bool {
+	switch f {
+	case MigrateDue:
+		return !runAt.After(now)
+	case MigrateScheduled:
+		return runAt.After(now)
+	}
+	return true
+}
+
+// MigrateQueue moves the pending jobs of queue from into queue to, returning
+// how many moved. Leased and processing jobs stay behind so their acks and
+// retries aren't disturbed; migrating again once they finish picks up any
+// that were retried.
+func (s *PostgresStore) MigrateQueue(ctx context.Context, from, to string, filter MigrateFilter) (int64, error) {
+	defer s.observe("migrate", time.Now())
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE jobs
+		SET queue = $2, updated_at = $3
+		WHERE queue = $1
+		  AND status = $4
+		  AND ($5 = $6
+		       OR ($5 = $7 AND run_at <= $3)
+		       OR ($5 = $8 AND run_at > $3))
+	`, from, to, time.Now(), StatusPending, filter, MigrateWaiting, MigrateDue, MigrateScheduled)
+	if err != nil {
+		return 0, fmt.Errorf("failed to migrate queue: %w", err)
+	}
+
+	moved, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to migrate queue: %w", err)
+	}
+	return moved, nil
+}
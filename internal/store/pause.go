@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// PausedJobType is a job type excluded from leasing on every queue. Its jobs
+// keep accumulating and become leasable again once the type is resumed.
+type PausedJobType struct {
+	Type     string    `json:"type"`
+	PausedAt time.Time `json:"paused_at"`
+}
+
+// PauseJobType stops jobs of jobType from being leased. Pausing a type that is
+// already paused keeps its original PausedAt.
+func (s *PostgresStore) PauseJobType(ctx context.Context, jobType string) (*PausedJobType, error) {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO paused_types (type, paused_at)
+		VALUES ($1, NOW())
+		ON CONFLICT (type) DO NOTHING
+	`, jobType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pause job type: %w", err)
+	}
+
+	paused := PausedJobType{Type: jobType}
+	err = s.db.QueryRowContext(ctx, `SELECT paused_at FROM paused_types WHERE type = $1`, jobType).Scan(&paused.PausedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read paused job type: %w", err)
+	}
+	return &paused, nil
+}
+
+// ResumeJobType lets jobs of jobType be leased again. It reports whether the
+// type was paused.
+func (s *PostgresStore) ResumeJobType(ctx context.Context, jobType string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM paused_types WHERE type = $1`, jobType)
+	if err != nil {
+		return false, fmt.Errorf("failed to resume job type: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// ListPausedJobTypes returns all paused job types ordered by type
+func (s *PostgresStore) ListPausedJobTypes(ctx context.Context) ([]*PausedJobType, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT type, paused_at FROM paused_types ORDER BY type`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query paused job types: %w", err)
+	}
+	defer rows.Close()
+
+	var types []*PausedJobType
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var paused PausedJobType
+		if err := rows.Scan(&paused.Type, &paused.PausedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan paused job type: %w", err)
+		}
+		types = append(types, &paused)
+	}
+
+	return types, rows.Err()
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DispatchPause is the global kill switch: while set, no job on any queue is
+// leased. Job type pauses are kept underneath and apply again on resume.
+type DispatchPause struct {
+	PausedAt time.Time `json:"paused_at"`
+}
+
+// PauseDispatch stops all leasing. Pausing while already paused keeps the
+// original PausedAt.
+func (s *PostgresStore) PauseDispatch(ctx context.Context) (*DispatchPause, error) {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO dispatch_pause (singleton, paused_at)
+		VALUES (TRUE, NOW())
+		ON CONFLICT (singleton) DO NOTHING
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pause dispatch: %w", err)
+	}
+
+	pause, err := s.GetDispatchPause(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if pause == nil {
+		return nil, fmt.Errorf("failed to pause dispatch: resumed concurrently")
+	}
+	return pause, nil
+}
+
+// ResumeDispatch lets jobs be leased again. It reports whether dispatch was
+// paused.
+func (s *PostgresStore) ResumeDispatch(ctx context.Context) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM dispatch_pause`)
+	if err != nil {
+		return false, fmt.Errorf("failed to resume dispatch: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// GetDispatchPause returns the global pause, or nil if dispatch isn't paused
+func (s *PostgresStore) GetDispatchPause(ctx context.Context) (*DispatchPause, error) {
+	var pause DispatchPause
+	err := s.db.QueryRowContext(ctx, `SELECT paused_at FROM dispatch_pause`).Scan(&pause.PausedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dispatch pause: %w", err)
+	}
+	return &pause, nil
+}
@@ -0,0 +1,32 @@
+package store
+
+// PayloadShape describes how complex a decoded payload is: Depth is how
+// deeply objects and arrays nest, counting the payload itself as 1, and Keys
+// is how many object keys it holds at every level
+type PayloadShape struct {
+	Depth int
+	Keys  int
+}
+
+// MeasurePayload walks a payload decoded from JSON to find its shape
+func MeasurePayload(payload map[string]interface{}) PayloadShape {
+	var shape PayloadShape
+	measureValue(payload, 1, &shape)
+	return shape
+}
+
+func measureValue(value interface{}, depth int, shape *PayloadShape) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		shape.Depth = max(shape.Depth, depth)
+		shape.Keys += len(v)
+		for _, child := range v {
+			measureValue(child, depth+1, shape)
+		}
+	case []interface{}:
+		shape.Depth = max(shape.Depth, depth)
+		for _, child := range v {
+			measureValue(child, depth+1, shape)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+)
+
+// PayloadView controls how much of each job's payload a list response shows
+type PayloadView string
+
+const (
+	// PayloadViewFull returns payloads unchanged
+	PayloadViewFull PayloadView = "full"
+	// PayloadViewTruncated replaces payloads longer than the byte limit with
+	// a preview of their first bytes
+	PayloadViewTruncated PayloadView = "truncated"
+	// PayloadViewNone omits payloads, leaving only the payload hash
+	PayloadViewNone PayloadView = "none"
+)
+
+// ParsePayloadView parses "none", "truncated" or "full"
+func ParsePayloadView(s string) (PayloadView, error) {
+	switch v := PayloadView(s); v {
+	case PayloadViewFull, PayloadViewTruncated, PayloadViewNone:
+		return v, nil
+	}
+	return "", fmt.Errorf("payload must be none, truncated or full, got %q", s)
+}
+
+// ApplyPayloadView returns the jobs with their payloads trimmed to view.
+// Trimmed jobs are copies with PayloadOmitted set, so jobs shared with a
+// cache aren't modified; under PayloadViewTruncated a payload whose JSON
+// fits in maxBytes is kept whole.
+func ApplyPayloadView(jobs []*Job, view PayloadView, maxBytes int) ([]*Job, error) {
+	if view == PayloadViewFull {
+		return jobs, nil
+	}
+
+	trimmed := make([]*Job, len(jobs))
+	for i, job := range jobs {
+		if job.PayloadOmitted {
+			trimmed[i] = job
+			continue
+		}
+
+		var preview string
+		if view == PayloadViewTruncated {
+			raw, err := json.Marshal(job.Payload)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal payload: %w", err)
+			}
+			if len(raw) <= maxBytes {
+				trimmed[i] = job
+				continue
+			}
+			// Cut on a rune boundary so the preview stays valid UTF-8
+			n := maxBytes
+			for n > 0 && !utf8.RuneStart(raw[n]) {
+				n--
+			}
+			preview = string(raw[:n])
+		}
+
+		c := *job
+		c.Payload = nil
+		c.PayloadOmitted = true
+		c.PayloadPreview = preview
+		trimmed[i] = &c
+	}
+	return trimmed, nil
+}
@@ -0,0 +1,18 @@
+package store
+
+import "time"
+
+// SetQueryObserver sets a function called with the duration of each timed
+// store operation, e.g. "lease", "create" or "stats". An operation covers
+// all of its queries, including the transaction around them.
+func (s *PostgresStore) SetQueryObserver(observe func(operation string, duration time.Duration)) {
+	s.queryObserver = observe
+}
+
+// observe reports how long an operation started at start took; call it
+// deferred at the top of the operation
+func (s *PostgresStore) observe(operation string, start time.Time) {
+	if s.queryObserver != nil {
+		s.queryObserver(operation, time.Since(start))
+	}
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ReleaseJob hands a leased job its worker hasn't started back to pending,
+// as if it had never been leased. Unlike a nack it leaves attempts,
+// deferrals and redeliveries alone, and the lease's attempt, which never
+// ran, is dropped rather than recorded as failed. It fails with
+// errInvalidLease unless the job is still held under leaseID and, when
+// non-zero, epoch.
+func (s *PostgresStore) ReleaseJob(ctx context.Context, jobID, leaseID string, epoch int64) error {
+	defer s.observe("release", time.Now())
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var currentLeaseID sql.NullString
+	var leaseEpoch int64
+	err = tx.QueryRowContext(ctx, `SELECT lease_id, lease_epoch FROM jobs WHERE id = $1 FOR UPDATE`, jobID).Scan(&currentLeaseID, &leaseEpoch)
+	if err != nil {
+		return fmt.Errorf("failed to get job: %w", err)
+	}
+	if err := checkLease(currentLeaseID.String, leaseEpoch, leaseID, epoch, s.requireEpoch); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE jobs
+		SET status = $1, lease_id = NULL, leased_at = NULL, leased_by = NULL,
+		    lease_expires_at = NULL, visible_until = NULL, started_at = NULL, updated_at = $2
+		WHERE id = $3
+	`, StatusPending, time.Now(), jobID)
+	if err != nil {
+		return fmt.Errorf("failed to release job: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM job_attempts WHERE job_id = $1 AND lease_id = $2 AND finished_at IS NULL
+	`, jobID, leaseID)
+	if err != nil {
+		return fmt.Errorf("failed to drop released attempt: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// checkLease applies an ack's lease checks: errInvalidLease unless the job,
+// held under current at currentEpoch, matches leaseID and epoch
+func checkLease(current string, currentEpoch int64, leaseID string, epoch int64, requireEpoch bool) error {
+	if current == "" || current != leaseID {
+		return errInvalidLease
+	}
+	if epoch == 0 && requireEpoch {
+		return fmt.Errorf("%w: lease epoch required", errInvalidLease)
+	}
+	if epoch != 0 && epoch != currentEpoch {
+		return fmt.Errorf("%w: stale lease epoch %d (current %d)", errInvalidLease, epoch, currentEpoch)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// RenewLease extends a held lease to leaseTTL from now, returning the new
+// expiry. A visibility timeout on the lease is pushed back to the same time.
+// It fails with errInvalidLease unless the job is still leased under leaseID
+// and, when epoch is set, on that lease epoch.
+func (s *PostgresStore) RenewLease(ctx context.Context, jobID, leaseID string, epoch int64, leaseTTL time.Duration) (time.Time, error) {
+	defer s.observe("renew", time.Now())
+	now := time.Now()
+	var expiresAt time.Time
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE jobs
+		SET lease_expires_at = $1,
+		    visible_until = CASE WHEN visible_until IS NULL THEN NULL ELSE $1 END,
+		    updated_at = $2
+		WHERE id = $3 AND lease_id = $4 AND status IN ($5, $6)
+		  AND ($7 = 0 OR lease_epoch = $7)
+		RETURNING lease_expires_at
+	`, now.Add(leaseTTL), now, jobID, leaseID, StatusLeased, StatusProcessing, epoch).Scan(&expiresAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, errInvalidLease
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to renew lease: %w", err)
+	}
+	return expiresAt, nil
+}
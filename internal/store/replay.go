@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DeadJobFilter selects dead-lettered jobs for a bulk replay. Empty fields
+// match every dead job; the time range applies to when the job died.
+type DeadJobFilter struct {
+	Queue      string     `json:"queue,omitempty"`
+	Type       string     `json:"type,omitempty"`
+	Reason     DeadReason `json:"dead_reason,omitempty"`
+	DeadAfter  *time.Time `json:"dead_after,omitempty"`
+	DeadBefore *time.Time `json:"dead_before,omitempty"`
+}
+
+// deadJobFilterSQL is the WHERE clause shared by CountDeadJobs and
+// ReplayDeadJobs; its parameters start at $1 with the dead status
+const deadJobFilterSQL = `status = $1
+	  AND ($2 = '' OR queue = $2)
+	  AND ($3 = '' OR type = $3)
+	  AND ($4 = '' OR dead_reason = $4)
+	  AND ($5::timestamp IS NULL OR COALESCE(dead_at, updated_at) >= $5)
+	  AND ($6::timestamp IS NULL OR COALESCE(dead_at, updated_at) < $6)`
+
+// args binds the time range in the server's zone, which dead_at and
+// updated_at are written in, rather than at the offset the client sent
+func (f DeadJobFilter) args() []interface{} {
+	return []interface{}{StatusDead, f.Queue, f.Type, string(f.Reason), nullTime(localTime(f.DeadAfter)), nullTime(localTime(f.DeadBefore))}
+}
+
+// localTime converts an optional time to the server's zone
+func localTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	local := t.In(time.Local)
+	return &local
+}
+
+// CountDeadJobs returns how many dead jobs match the filter
+func (s *PostgresStore) CountDeadJobs(ctx context.Context, filter DeadJobFilter) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM jobs WHERE `+deadJobFilterSQL, filter.args()...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count dead jobs: %w", err)
+	}
+	return count, nil
+}
+
+// ReplayDeadJobs returns up to limit dead jobs matching the filter to
+// pending, oldest death first, and returns their IDs. Replayed jobs start
+// over with a full set of attempts, as if newly enqueued.
+func (s *PostgresStore) ReplayDeadJobs(ctx context.Context, filter DeadJobFilter, limit int) ([]string, error) {
+	args := append(filter.args(), StatusPending, time.Now(), limit)
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE jobs
+		SET status = $7, attempts = 0, dead_reason = NULL, dead_at = NULL, killed_by = NULL,
+		    front_requeues = 0, deferrals = 0, redeliveries = 0, run_at = $8, updated_at = $8
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE `+deadJobFilterSQL+`
+			ORDER BY COALESCE(dead_at, updated_at), id
+			LIMIT $9
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay dead jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan replayed job: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
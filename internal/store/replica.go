@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// ReplicaStore wraps a primary Store and sends read-heavy queries (job
+// lookups, recent jobs and queue stats) to a read replica, keeping writes
+// and leases on the primary. Replica reads can lag the primary, so a job
+// created moments ago may not be visible there yet; with read-your-writes
+// enabled, GetJob and GetJobs retry jobs the replica didn't return on the
+// primary. Reads made with a WithPrimaryReads context skip the replica.
+type ReplicaStore struct {
+	Store
+	replica        Store
+	readYourWrites bool
+}
+
+// NewReplicaStore routes reads to replica and everything else to primary
+func NewReplicaStore(primary, replica Store, readYourWrites bool) *ReplicaStore {
+	return &ReplicaStore{Store: primary, replica: replica, readYourWrites: readYourWrites}
+}
+
+type primaryReadsKey struct{}
+
+// WithPrimaryReads returns a context whose reads a ReplicaStore serves from
+// the primary, for callers that must see the latest state of a job, such as
+// one they just wrote, rather than whatever the replica has caught up to
+func WithPrimaryReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryReadsKey{}, true)
+}
+
+// primaryReads reports whether ctx was made by WithPrimaryReads
+func primaryReads(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryReadsKey{}).(bool)
+	return primary
+}
+
+// reader returns the store that serves reads made with ctx
+func (r *ReplicaStore) reader(ctx context.Context) Store {
+	if primaryReads(ctx) {
+		return r.Store
+	}
+	return r.replica
+}
+
+// GetJob reads the job from the replica, falling back to the primary when
+// the replica can't return it and read-your-writes is enabled
+func (r *ReplicaStore) GetJob(ctx context.Context, id string) (*Job, error) {
+	if primaryReads(ctx) {
+		return r.Store.GetJob(ctx, id)
+	}
+	job, err := r.replica.GetJob(ctx, id)
+	if err != nil && r.readYourWrites {
+		return r.Store.GetJob(ctx, id)
+	}
+	return job, err
+}
+
+// GetJobs reads the jobs from the replica. With read-your-writes enabled,
+// IDs the replica doesn't have yet are looked up on the primary.
+func (r *ReplicaStore) GetJobs(ctx context.Context, ids []string) (map[string]*Job, error) {
+	if primaryReads(ctx) {
+		return r.Store.GetJobs(ctx, ids)
+	}
+	jobs, err := r.replica.GetJobs(ctx, ids)
+	if !r.readYourWrites {
+		return jobs, err
+	}
+	if err != nil {
+		return r.Store.GetJobs(ctx, ids)
+	}
+
+	var missing []string
+	for _, id := range ids {
+		if _, ok := jobs[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return jobs, nil
+	}
+	fresh, err := r.Store.GetJobs(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	for id, job := range fresh {
+		jobs[id] = job
+	}
+	return jobs, nil
+}
+
+// GetRecentJobs reads recent jobs from the replica
+func (r *ReplicaStore) GetRecentJobs(ctx context.Context, kind JobKind, limit int) ([]*Job, error) {
+	return r.reader(ctx).GetRecentJobs(ctx, kind, limit)
+}
+
+// GetJobsByTimeRange reads jobs created in a time range from the replica
+func (r *ReplicaStore) GetJobsByTimeRange(ctx context.Context, from, to time.Time, after *JobCursor, limit int) ([]*Job, error) {
+	return r.reader(ctx).GetJobsByTimeRange(ctx, from, to, after, limit)
+}
+
+// GetQueueStats reads queue stats from the replica
+func (r *ReplicaStore) GetQueueStats(ctx context.Context) ([]QueueStats, error) {
+	return r.reader(ctx).GetQueueStats(ctx)
+}
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+)
+
+// RoutingRule sends jobs whose type matches TypePattern to Queue, overriding
+// the queue the producer asked for. Patterns use path.Match syntax, so
+// "email.*" matches "email.welcome".
+type RoutingRule struct {
+	TypePattern string    `json:"type"`
+	Queue       string    `json:"queue"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Validate checks that the rule has a well-formed pattern and a target queue
+func (r *RoutingRule) Validate() error {
+	if r.TypePattern == "" {
+		return fmt.Errorf("routing rule type is required")
+	}
+	if _, err := path.Match(r.TypePattern, ""); err != nil {
+		return fmt.Errorf("invalid routing rule type pattern %q: %w", r.TypePattern, err)
+	}
+	if r.Queue == "" {
+		return fmt.Errorf("routing rule for %q has no queue", r.TypePattern)
+	}
+	if r.Queue == SystemQueue {
+		return fmt.Errorf("queue %s is reserved for system jobs", SystemQueue)
+	}
+	return nil
+}
+
+// MatchRoutingRule returns the rule that applies to jobType, or nil. An exact
+// type wins over wildcards; among wildcards the longest pattern wins.
+func MatchRoutingRule(rules []*RoutingRule, jobType string) *RoutingRule {
+	var best *RoutingRule
+	for _, rule := range rules {
+		if rule.TypePattern == jobType {
+			return rule
+		}
+		if ok, _ := path.Match(rule.TypePattern, jobType); ok {
+			if best == nil || len(rule.TypePattern) > len(best.TypePattern) {
+				best = rule
+			}
+		}
+	}
+	return best
+}
+
+// ListRoutingRules returns all routing rules ordered by pattern
+func (s *PostgresStore) ListRoutingRules(ctx context.Context) ([]*RoutingRule, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT type_pattern, queue, updated_at
+		FROM routing_rules
+		ORDER BY type_pattern
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query routing rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []*RoutingRule
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var rule RoutingRule
+		if err := rows.Scan(&rule.TypePattern, &rule.Queue, &rule.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan routing rule: %w", err)
+		}
+		rules = append(rules, &rule)
+	}
+
+	return rules, rows.Err()
+}
+
+// SetRoutingRules atomically replaces all routing rules, setting each rule's UpdatedAt
+func (s *PostgresStore) SetRoutingRules(ctx context.Context, rules []*RoutingRule) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM routing_rules`); err != nil {
+		return fmt.Errorf("failed to clear routing rules: %w", err)
+	}
+
+	for _, rule := range rules {
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO routing_rules (type_pattern, queue, updated_at)
+			VALUES ($1, $2, NOW())
+			RETURNING updated_at
+		`, rule.TypePattern, rule.Queue).Scan(&rule.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to insert routing rule %q: %w", rule.TypePattern, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SLAStats counts the jobs with a deadline that finished within a window:
+// Met succeeded by their deadline, Missed succeeded after it or were
+// dead-lettered
+type SLAStats struct {
+	Met    int `json:"met"`
+	Missed int `json:"missed"`
+}
+
+// slaOutcome reports whether a job with deadline that ended up in status at
+// now met its SLA. It returns nil for jobs without a deadline and for
+// changes that leave the job to be retried.
+func slaOutcome(deadline *time.Time, status JobStatus, now time.Time) *bool {
+	if deadline == nil || (status != StatusSucceeded && status != StatusDead && status != StatusExpired) {
+		return nil
+	}
+	met := status == StatusSucceeded && !now.After(*deadline)
+	return &met
+}
+
+// GetSLAStats counts the jobs of jobType, or of every type if empty, whose
+// SLA outcome was recorded since the given time
+func (s *PostgresStore) GetSLAStats(ctx context.Context, jobType string, since time.Time) (*SLAStats, error) {
+	defer s.observe("sla_stats", time.Now())
+	var stats SLAStats
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FILTER (WHERE sla_met), COUNT(*) FILTER (WHERE NOT sla_met)
+		FROM jobs
+		WHERE sla_met IS NOT NULL AND ($1 = '' OR type = $1) AND updated_at >= $2
+	`, jobType, since).Scan(&stats.Met, &stats.Missed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SLA stats: %w", err)
+	}
+	return &stats, nil
+}
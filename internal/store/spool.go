@@ -0,0 +1,136 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SpooledJob is a create request held in the spool until it can be replayed
+type SpooledJob struct {
+	Request   CreateJobRequest
+	SpooledAt time.Time
+}
+
+// SQLiteSpool keeps create requests in a local SQLite database while the
+// primary store is unavailable. The caller opens the database and registers
+// the driver.
+type SQLiteSpool struct {
+	db *sql.DB
+}
+
+// NewSQLiteSpool creates the spool tables if needed
+func NewSQLiteSpool(ctx context.Context, db *sql.DB) (*SQLiteSpool, error) {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS spooled_jobs (
+			id TEXT PRIMARY KEY,
+			kind TEXT NOT NULL,
+			request TEXT NOT NULL,
+			spooled_at INTEGER NOT NULL
+		)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool table: %w", err)
+	}
+
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS quarantined_jobs (
+			id TEXT PRIMARY KEY,
+			kind TEXT NOT NULL,
+			request TEXT NOT NULL,
+			spooled_at INTEGER NOT NULL,
+			quarantined_at INTEGER NOT NULL,
+			reason TEXT NOT NULL
+		)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create quarantine table: %w", err)
+	}
+	return &SQLiteSpool{db: db}, nil
+}
+
+// Add spools a request, which must already have its ID set
+func (s *SQLiteSpool) Add(ctx context.Context, req *CreateJobRequest, spooledAt time.Time) error {
+	// Kind is excluded from the request's JSON, so it gets its own column
+	requestJSON, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal spooled request: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO spooled_jobs (id, kind, request, spooled_at) VALUES (?, ?, ?, ?)
+	`, req.ID, string(req.Kind), string(requestJSON), spooledAt.UnixNano())
+	if err != nil {
+		return fmt.Errorf("failed to spool job: %w", err)
+	}
+	return nil
+}
+
+// List returns up to limit spooled requests, oldest first
+func (s *SQLiteSpool) List(ctx context.Context, limit int) ([]*SpooledJob, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT kind, request, spooled_at FROM spooled_jobs ORDER BY spooled_at LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query spooled jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*SpooledJob
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var kind, requestStr string
+		var spooledAt int64
+		if err := rows.Scan(&kind, &requestStr, &spooledAt); err != nil {
+			return nil, fmt.Errorf("failed to scan spooled job: %w", err)
+		}
+
+		job := &SpooledJob{SpooledAt: time.Unix(0, spooledAt)}
+		if err := json.Unmarshal([]byte(requestStr), &job.Request); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal spooled request: %w", err)
+		}
+		job.Request.Kind = JobKind(kind)
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// Remove deletes a replayed request from the spool
+func (s *SQLiteSpool) Remove(ctx context.Context, id string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM spooled_jobs WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to remove spooled job: %w", err)
+	}
+	return nil
+}
+
+// Quarantine moves a spooled request to the quarantined_jobs table, where
+// it is no longer replayed
+func (s *SQLiteSpool) Quarantine(ctx context.Context, id string, reason string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT OR REPLACE INTO quarantined_jobs (id, kind, request, spooled_at, quarantined_at, reason)
+		SELECT id, kind, request, spooled_at, ?, ? FROM spooled_jobs WHERE id = ?
+	`, time.Now().UnixNano(), reason, id)
+	if err != nil {
+		return fmt.Errorf("failed to quarantine spooled job: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM spooled_jobs WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to remove quarantined job: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit quarantine: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SaveState replaces a job's checkpoint state, which is handed back to
+// whichever worker leases the job next, so a retry can resume where a crashed
+// attempt left off. The payload is left alone. It fails with errInvalidLease
+// unless the job is still leased under leaseID and, when epoch is set, on
+// that lease epoch.
+func (s *PostgresStore) SaveState(ctx context.Context, jobID, leaseID string, epoch int64, state json.RawMessage) error {
+	defer s.observe("save_state", time.Now())
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE jobs
+		SET state = $1, updated_at = $2
+		WHERE id = $3 AND lease_id = $4 AND status IN ($5, $6)
+		  AND ($7 = 0 OR lease_epoch = $7)
+	`, string(state), time.Now(), jobID, leaseID, StatusLeased, StatusProcessing, epoch)
+	if err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+	if affected == 0 {
+		return errInvalidLease
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// QueueStatsPoint is a queue's job counts by status at one sample time.
+// Statuses with no jobs are omitted.
+type QueueStatsPoint struct {
+	SampledAt time.Time      `json:"sampled_at"`
+	Counts    map[string]int `json:"counts"`
+}
+
+// RecordQueueStatsSample snapshots the current job counts of every queue into
+// queue_stats_history at the given time, returning the rows written
+func (s *PostgresStore) RecordQueueStatsSample(ctx context.Context, at time.Time) (int64, error) {
+	defer s.observe("stats_sample", time.Now())
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO queue_stats_history (sampled_at, queue, status, count)
+		SELECT $1, queue, status, count FROM queue_stats
+	`, at)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record queue stats sample: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// PruneQueueStatsHistory deletes samples taken before the cutoff
+func (s *PostgresStore) PruneQueueStatsHistory(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM queue_stats_history WHERE sampled_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune queue stats history: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// GetQueueStatsHistory returns a queue's samples since the given time, oldest
+// first, downsampled to the last sample in each bucket-sized interval
+func (s *PostgresStore) GetQueueStatsHistory(ctx context.Context, queue string, since time.Time, bucket time.Duration) ([]QueueStatsPoint, error) {
+	defer s.observe("stats_history", time.Now())
+	bucketSeconds := bucket.Seconds()
+	if bucketSeconds < 1 {
+		bucketSeconds = 1
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		WITH bucketed AS (
+			SELECT FLOOR(EXTRACT(EPOCH FROM sampled_at) / $3) AS bucket, sampled_at, status, count
+			FROM queue_stats_history
+			WHERE queue = $1 AND sampled_at >= $2
+		), latest AS (
+			SELECT bucket, MAX(sampled_at) AS sampled_at FROM bucketed GROUP BY bucket
+		)
+		SELECT b.sampled_at, b.status, b.count
+		FROM bucketed b JOIN latest l ON l.bucket = b.bucket AND l.sampled_at = b.sampled_at
+		ORDER BY b.sampled_at, b.status
+	`, queue, since, bucketSeconds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query queue stats history: %w", err)
+	}
+	defer rows.Close()
+
+	var points []QueueStatsPoint
+	for rows.Next() {
+		var sampledAt time.Time
+		var status string
+		var count int
+		if err := rows.Scan(&sampledAt, &status, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan queue stats sample: %w", err)
+		}
+
+		if len(points) == 0 || !points[len(points)-1].SampledAt.Equal(sampledAt) {
+			points = append(points, QueueStatsPoint{SampledAt: sampledAt, Counts: make(map[string]int)})
+		}
+		points[len(points)-1].Counts[status] = count
+	}
+
+	return points, rows.Err()
+}
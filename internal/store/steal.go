@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AttemptStolen is the outcome of an attempt whose lease was revoked by StealJob
+const AttemptStolen = "stolen"
+
+// ErrJobNotLeased is returned by StealJob for a job no worker holds
+var ErrJobNotLeased = errors.New("job is not leased")
+
+// StealJob revokes a leased or processing job's lease and makes it pending
+// again, so the next lease request picks it up instead of waiting for the
+// lease to expire. The lease epoch is bumped, so the old holder's acks,
+// nacks and renewals are rejected. The attempt isn't counted against the
+// job's retries.
+func (s *PostgresStore) StealJob(ctx context.Context, id string) (*Job, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var status JobStatus
+	var leaseID sql.NullString
+	err = tx.QueryRowContext(ctx, `SELECT status, lease_id FROM jobs WHERE id = $1 FOR UPDATE`, id).Scan(&status, &leaseID)
+	if err == sql.ErrNoRows {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	if (status != StatusLeased && status != StatusProcessing) || !leaseID.Valid {
+		return nil, fmt.Errorf("%w: status is %s", ErrJobNotLeased, status)
+	}
+
+	now := time.Now()
+	_, err = tx.ExecContext(ctx, `
+		UPDATE jobs
+		SET status = $1, run_at = $2, lease_epoch = lease_epoch + 1,
+		    lease_id = NULL, leased_at = NULL, leased_by = NULL,
+		    lease_expires_at = NULL, visible_until = NULL, started_at = NULL, updated_at = $2
+		WHERE id = $3
+	`, StatusPending, now, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to steal job: %w", err)
+	}
+
+	if err := finishAttemptTx(ctx, tx, id, leaseID.String, AttemptStolen, "lease revoked"); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return s.GetJob(ctx, id)
+}
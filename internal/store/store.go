@@ -4,10 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // JobStatus represents the current state of a job
@@ -20,102 +22,800 @@ const (
 	StatusSucceeded  JobStatus = "succeeded"
 	StatusFailed     JobStatus = "failed"
 	StatusDead       JobStatus = "dead"
+	// StatusExpired marks jobs whose deadline passed before they could run
+	StatusExpired JobStatus = "expired"
+	// StatusBlocked marks workflow jobs waiting for their upstream nodes
+	StatusBlocked JobStatus = "blocked"
+	// StatusCancelled marks workflow jobs that will never run because an
+	// upstream node failed
+	StatusCancelled JobStatus = "cancelled"
+)
+
+// activeStatuses are the non-terminal job states
+var activeStatuses = []string{string(StatusPending), string(StatusLeased), string(StatusProcessing)}
+
+// JobKind separates jobs submitted by users from jobs the system creates for
+// its own machinery, such as callback delivery
+type JobKind string
+
+const (
+	KindUser   JobKind = "user"
+	KindSystem JobKind = "system"
+)
+
+// SystemQueue is the default queue for system jobs
+const SystemQueue = "_system"
+
+// DeadReason records why a job was moved to the dead-letter queue
+type DeadReason string
+
+const (
+	// DeadReasonMaxRetries means the job failed on every allowed attempt
+	DeadReasonMaxRetries DeadReason = "max_retries"
+	// DeadReasonExpired means the job's final attempt ended with an expired lease
+	DeadReasonExpired DeadReason = "expired"
+	// DeadReasonPermanent means the worker reported a non-retryable failure
+	DeadReasonPermanent DeadReason = "permanent_failure"
+	// DeadReasonPoison means the job can never be processed, e.g. an unparseable payload
+	DeadReasonPoison DeadReason = "poison"
+	// DeadReasonKilled means an operator gave up on the job with KillJob
+	DeadReasonKilled DeadReason = "killed_by_operator"
+	// DeadReasonRetryBudget means the job failed while its queue's retry
+	// budget was spent, so it was dead-lettered instead of retried
+	DeadReasonRetryBudget DeadReason = "retry_budget"
+	// DeadReasonFailFast means the job failed while its type was set to
+	// fail fast, so it was dead-lettered instead of retried
+	DeadReasonFailFast DeadReason = "fail_fast"
 )
 
 // Job represents a job in the queue
 type Job struct {
-	ID          string                 `json:"id"`
-	Type        string                 `json:"type"`
-	Payload     map[string]interface{} `json:"payload"`
-	Queue       string                 `json:"queue"`
-	Priority    int                    `json:"priority"`
-	Status      JobStatus              `json:"status"`
-	Attempts    int                    `json:"attempts"`
-	MaxRetries  int                    `json:"max_retries"`
-	LastError   string                 `json:"last_error,omitempty"`
-	LeaseID     string                 `json:"lease_id,omitempty"`
-	LeasedAt    *time.Time             `json:"leased_at,omitempty"`
-	LeasedBy    string                 `json:"leased_by,omitempty"`
-	RunAt       time.Time              `json:"run_at"`
-	CreatedAt   time.Time              `json:"created_at"`
-	UpdatedAt   time.Time              `json:"updated_at"`
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Payload    map[string]interface{} `json:"payload"`
+	Queue      string                 `json:"queue"`
+	Priority   int                    `json:"priority"`
+	Status     JobStatus              `json:"status"`
+	Kind       JobKind                `json:"kind"`
+	Attempts   int                    `json:"attempts"`
+	MaxRetries int                    `json:"max_retries"`
+	LastError  string                 `json:"last_error,omitempty"`
+	LeaseID    string                 `json:"lease_id,omitempty"`
+	LeasedAt   *time.Time             `json:"leased_at,omitempty"`
+	LeasedBy   string                 `json:"leased_by,omitempty"`
+	RunAt      time.Time              `json:"run_at"`
+	CreatedAt  time.Time              `json:"created_at"`
+	UpdatedAt  time.Time              `json:"updated_at"`
+
+	Labels         map[string]string `json:"labels,omitempty"`
+	TraceID        string            `json:"trace_id,omitempty"`
+	PartitionKey   string            `json:"partition_key,omitempty"`
+	Requires       []string          `json:"requires,omitempty"`
+	LeaseExpiresAt *time.Time        `json:"lease_expires_at,omitempty"`
+	LeaseEpoch     int64             `json:"lease_epoch,omitempty"`
+	PayloadOmitted bool              `json:"payload_omitted,omitempty"`
+	IdempotencyKey string            `json:"idempotency_key,omitempty"`
+	DeadReason     DeadReason        `json:"dead_reason,omitempty"`
+	Deadline       *time.Time        `json:"deadline,omitempty"`
+
+	BackoffStrategy    BackoffStrategy `json:"backoff_strategy,omitempty"`
+	BackoffBaseSeconds int             `json:"backoff_base_seconds,omitempty"`
+	BackoffCapSeconds  int             `json:"backoff_cap_seconds,omitempty"`
+	BackoffSchedule    []int           `json:"backoff_schedule,omitempty"`
+
+	// DeadRetry opts the job into automatic retries from the dead-letter
+	// queue; DeadRetryCount is how many it has had, separate from Attempts
+	DeadRetry      bool       `json:"dead_retry,omitempty"`
+	DeadRetryCount int        `json:"dead_retry_count,omitempty"`
+	DeadAt         *time.Time `json:"dead_at,omitempty"`
+
+	// KilledBy is the operator who killed the job with KillJob
+	KilledBy string `json:"killed_by,omitempty"`
+
+	// PayloadHash is the SHA-256 of the payload's canonical form (see
+	// CanonicalizePayload), equal for payloads that differ only in key
+	// order or number formatting
+	PayloadHash string `json:"payload_hash,omitempty"`
+
+	// PayloadPreview is the start of the payload's JSON on list responses
+	// that truncate payloads; see ApplyPayloadView
+	PayloadPreview string `json:"payload_preview,omitempty"`
+
+	// WorkflowID is set on jobs created as nodes of a workflow
+	WorkflowID string `json:"workflow_id,omitempty"`
+
+	// StartedAt is when the job's latest attempt went straight to
+	// processing, for jobs leased with StartImmediately
+	StartedAt *time.Time `json:"started_at,omitempty"`
+
+	// State is the JSON checkpoint last saved by a worker with SaveState.
+	// It survives retries, so a job leased again can resume from it.
+	State json.RawMessage `json:"state,omitempty"`
+
+	// Redeliveries counts lease expiries and redelivery nacks that were
+	// forgiven under the store's grace limit instead of counting as
+	// attempts; see SetGraceRedeliveries
+	Redeliveries int `json:"redeliveries"`
+
+	// UniqueKey is the composite key computed from the job's UniqueBy
+	// fields; see CreateJobRequest.UniqueBy
+	UniqueKey string `json:"unique_key,omitempty"`
+
+	// Deduplicated is set on the result of CreateJob when an existing job
+	// was returned instead of a new one, either because it has the same
+	// idempotency key or because the request was an enqueue-if-absent
+	Deduplicated bool `json:"deduplicated,omitempty"`
+
+	// Spooled is set when the primary store was unavailable and the job was
+	// spooled locally by a FailoverStore; it isn't readable until replayed
+	Spooled bool `json:"spooled,omitempty"`
 }
 
 // CreateJobRequest represents a request to create a new job
 type CreateJobRequest struct {
+	// ID is optional; when set it must be a UUID or ULID and is used instead
+	// of a generated ID, so clients can reuse their own identifiers
+	ID string `json:"id,omitempty"`
+
 	Type         string                 `json:"type"`
 	Payload      map[string]interface{} `json:"payload"`
 	Queue        string                 `json:"queue"`
 	Priority     int                    `json:"priority"`
 	DelaySeconds int                    `json:"delay_seconds"`
 	MaxRetries   int                    `json:"max_retries"`
+	Labels       map[string]string      `json:"labels,omitempty"`
+	TraceID      string                 `json:"trace_id,omitempty"`
+	PartitionKey string                 `json:"partition_key,omitempty"`
+	Requires     []string               `json:"requires,omitempty"`
+
+	// DelayMs delays the job with millisecond precision, and RunAt
+	// schedules it at an absolute time; like DelaySeconds they are
+	// alternatives, and RunAtFrom picks whichever is set
+	DelayMs int64      `json:"delay_ms,omitempty"`
+	RunAt   *time.Time `json:"run_at,omitempty"`
+
+	// Deadline is when the job stops being useful. Workers are cancelled at
+	// the deadline, and jobs still pending then are marked expired.
+	Deadline *time.Time `json:"deadline,omitempty"`
+
+	// Backoff overrides; zero values fall back to the queue's retry policy,
+	// then to the server-wide backoff settings
+	BackoffStrategy    BackoffStrategy `json:"backoff_strategy,omitempty"`
+	BackoffBaseSeconds int             `json:"backoff_base_seconds,omitempty"`
+	BackoffCapSeconds  int             `json:"backoff_cap_seconds,omitempty"`
+
+	// BackoffSchedule, in seconds, replaces the computed backoff: the Nth
+	// failure waits BackoffSchedule[N-1], and once the schedule is exhausted
+	// every further failure waits its last entry. The strategy, base, cap
+	// and server-wide backoff bounds don't apply to it.
+	BackoffSchedule []int `json:"backoff_schedule,omitempty"`
+
+	// DeadRetry makes the job eligible for automatic retries once it is
+	// dead-lettered, on the store's dead retry schedule. Defaults to the
+	// queue's setting.
+	DeadRetry bool `json:"dead_retry,omitempty"`
+
+	// Kind defaults to KindUser. It isn't accepted from API clients; system
+	// jobs are only created internally.
+	Kind JobKind `json:"-"`
+
+	// EnqueuedBy identifies where the request came from, such as the client
+	// IP. It is set by the API rather than by clients and, when enabled, is
+	// recorded in the job's enqueued_by label.
+	EnqueuedBy string `json:"-"`
+
+	// Inline runs the job synchronously during enqueue; only honored when
+	// the server enables inline execution for tests and development
+	Inline bool `json:"inline,omitempty"`
+
+	// IdempotencyKey collapses repeated enqueues into the queue's existing job
+	// with the same key, if it was created within the store's dedup window
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+
+	// EnqueueIfAbsent returns the existing job instead of creating a new one
+	// while a job with the same singleton key is pending or leased. The key
+	// is SingletonKey if set, otherwise the job's queue and type. Unlike
+	// idempotency keys there is no window: once that job finishes, the next
+	// enqueue creates a new one.
+	EnqueueIfAbsent bool   `json:"enqueue_if_absent,omitempty"`
+	SingletonKey    string `json:"singleton_key,omitempty"`
+
+	// UniqueBy names payload fields ("payload.customer_id", with dots for
+	// nested fields) and labels ("labels.region") whose values, with the
+	// job's type, form a composite key. While a job with the same key is
+	// active, enqueuing returns it instead of creating a new one.
+	UniqueBy []string `json:"unique_by,omitempty"`
+
+	// ScheduleCalendar names a BusinessCalendar; the job's run_at is moved
+	// forward to the calendar's next business time when it is enqueued
+	ScheduleCalendar string `json:"schedule_calendar,omitempty"`
+}
+
+// RunAtFrom returns when a job created at now first becomes leasable: RunAt
+// if set, otherwise now plus DelayMs or DelaySeconds. A RunAt in the past
+// means now. The result is in now's location, since run_at is stored without
+// a time zone and a client's offset would otherwise be dropped.
+func (r *CreateJobRequest) RunAtFrom(now time.Time) time.Time {
+	switch {
+	case r.RunAt != nil:
+		if r.RunAt.After(now) {
+			return r.RunAt.In(now.Location())
+		}
+	case r.DelayMs > 0:
+		return now.Add(time.Duration(r.DelayMs) * time.Millisecond)
+	case r.DelaySeconds > 0:
+		return now.Add(time.Duration(r.DelaySeconds) * time.Second)
+	}
+	return now
+}
+
+// Delayed reports whether the request asks for a delay
+func (r *CreateJobRequest) Delayed() bool {
+	return r.RunAt != nil || r.DelayMs > 0 || r.DelaySeconds > 0
+}
+
+// LeaseOptions holds optional per-lease behavior
+type LeaseOptions struct {
+	// VisibilityTimeout makes leased jobs re-leasable once it elapses, even if
+	// the lease TTL has not. The first such expiry re-queues the job without
+	// counting an attempt; later ones are treated as failures. Zero disables it.
+	VisibilityTimeout time.Duration
+
+	// OmitPayload returns leased jobs without their payloads; workers fetch
+	// them on demand with FetchPayload
+	OmitPayload bool
+
+	// FIFO leases jobs sharing a partition key one at a time, in enqueue order:
+	// a job is only leasable once every earlier job with its key has finished.
+	// Jobs without a partition key are unaffected.
+	FIFO bool
+
+	// Serial leases at most one job at a time from the whole queue: nothing
+	// is leased while any of its jobs is leased or processing
+	Serial bool
+
+	// Capabilities advertised by the leasing worker. Only jobs whose required
+	// capabilities are all among them are leased; jobs without requirements
+	// match any worker.
+	Capabilities []string
+
+	// LabelFilter restricts leasing to jobs whose labels include every given
+	// key/value pair, letting workers subscribe to a slice of a queue
+	LabelFilter map[string]string
+
+	// PriorityAtLeast and PriorityBelow, when set, restrict leasing to jobs
+	// with PriorityAtLeast <= priority < PriorityBelow
+	PriorityAtLeast *int
+	PriorityBelow   *int
+
+	// MinPriority is the leasing worker's priority floor: jobs below it are
+	// never leased, whatever the other priority bounds allow
+	MinPriority *int
+
+	// PriorityQuotas reserve part of each lease batch for higher-priority
+	// tiers; see queue.Manager.LeaseJobs. The store itself ignores them.
+	PriorityQuotas []PriorityQuota
+
+	// Weight is the leasing worker's relative capacity, recorded with its
+	// heartbeat; zero counts as 1. The store's lease query ignores it.
+	Weight int
+
+	// StartImmediately leases jobs straight into the processing state, with
+	// StartedAt set, for workers that start on them as soon as they arrive.
+	// Their leases expire and are reclaimed like any other.
+	StartImmediately bool
+}
+
+// PriorityQuota reserves Reserved slots of a lease batch for jobs with
+// priority >= MinPriority, so lower-priority jobs can't fill them
+type PriorityQuota struct {
+	MinPriority int
+	Reserved    int
+}
+
+// AckRequest acknowledges a leased job as succeeded or failed
+type AckRequest struct {
+	JobID        string
+	LeaseID      string
+	Success      bool
+	ErrorMessage string
+
+	// DeadReason, when set on a failure, dead-letters the job immediately
+	// instead of retrying. Only DeadReasonPermanent and DeadReasonPoison apply.
+	DeadReason DeadReason
+
+	// RequeueFront, on a failure that will be retried, skips the backoff and
+	// boosts the job's priority until it is next leased, so another worker
+	// picks it up right away. Each job gets at most the store's
+	// MaxFrontRequeues of these; later ones fall back to normal backoff.
+	RequeueFront bool
+
+	// RetryAfter, on a failure, retries the job after exactly this delay
+	// (capped at the store's MaxRetryAfter) instead of the computed backoff,
+	// e.g. honoring a downstream's Retry-After header. The downstream
+	// deferred the job rather than it failing, so the attempt is not counted
+	// and the backoff schedule doesn't advance. Each job gets at most the
+	// store's MaxDeferrals of these; later ones count as attempts, still
+	// with the requested delay.
+	RetryAfter time.Duration
+
+	// LeaseEpoch is the job's LeaseEpoch as leased. When set, the ack is
+	// rejected unless the job is still on that epoch, so a stale worker can't
+	// settle a job that has been reclaimed and re-leased. Stores configured
+	// with SetRequireLeaseEpoch reject acks without one.
+	LeaseEpoch int64
+
+	// Retryable, when set on a failure, is the worker's verdict on whether
+	// it's worth retrying: false dead-letters the job like a
+	// DeadReasonPermanent nack, true retries it under the usual policy.
+	Retryable *bool
+
+	// RetryDelay, on a failure that will be retried, replaces the computed
+	// backoff (capped at the store's MaxRetryAfter). Unlike RetryAfter the
+	// attempt is counted.
+	RetryDelay time.Duration
+
+	// Redelivery, on a failure, reports that the infrastructure rather than
+	// the handler failed, e.g. the worker's node is being evicted. Like a
+	// lease expiry, it's retried right away without counting as an attempt
+	// while the job has grace redeliveries left.
+	Redelivery bool
+}
+
+// permanentDeadReason returns the reason a failure skips its remaining
+// retries at the worker's request, or "" if it doesn't
+func (r AckRequest) permanentDeadReason() DeadReason {
+	switch {
+	case r.DeadReason == DeadReasonPermanent || r.DeadReason == DeadReasonPoison:
+		return r.DeadReason
+	case r.Retryable != nil && !*r.Retryable:
+		return DeadReasonPermanent
+	}
+	return ""
+}
+
+// retryDelay returns the delay a worker asked for on a retried failure,
+// capped at max, or false if it left the backoff to the server. A
+// RetryAfter that reaches here is a deferral past the job's cap.
+func (r AckRequest) retryDelay(max time.Duration) (time.Duration, bool) {
+	delay := r.RetryDelay
+	if delay <= 0 {
+		delay = r.RetryAfter
+	}
+	if delay <= 0 {
+		return 0, false
+	}
+	return min(delay, max), true
+}
+
+// AckResult reports the outcome of an acknowledgement
+type AckResult struct {
+	JobID        string
+	Acknowledged bool
+	Error        string
+
+	// Status is the job's state after the ack, and DeadReason is set if it was dead-lettered
+	Status     JobStatus
+	DeadReason DeadReason
+
+	// FrontRequeued is set when a RequeueFront nack was honored
+	FrontRequeued bool
+
+	// Queue, Type and CreatedAt describe the acked job, e.g. for end-to-end latency
+	Queue     string
+	Type      string
+	CreatedAt time.Time
+
+	// SLAMet is set when a job with a deadline succeeded or was
+	// dead-lettered, reporting whether it succeeded by its deadline
+	SLAMet *bool
+}
+
+// errInvalidLease is returned when an ack's lease ID or epoch doesn't match the job's current lease
+var errInvalidLease = errors.New("invalid lease ID")
+
+// ErrJobNotLeasable is returned by LeaseJob for a job that isn't pending
+// and due, such as one another worker has already leased
+var ErrJobNotLeasable = errors.New("job is not available for leasing")
+
+// SchedulingMode is the order in which a queue's pending jobs are leased
+type SchedulingMode string
+
+const (
+	// SchedulingPriority leases the highest-priority job first (the default)
+	SchedulingPriority SchedulingMode = "priority"
+	// SchedulingEDF leases the job with the earliest deadline first; jobs
+	// without a deadline come after all jobs with one, by priority
+	SchedulingEDF SchedulingMode = "edf"
+)
+
+// QueueConfig holds per-queue settings. Zero-valued retry fields are unset
+// and leave the server-wide defaults in effect. A positive MinWorkers holds
+// back leases until that many workers are polling the queue.
+type QueueConfig struct {
+	Queue              string          `json:"queue"`
+	MaxRetries         int             `json:"max_retries,omitempty"`
+	BackoffStrategy    BackoffStrategy `json:"backoff_strategy,omitempty"`
+	BackoffBaseSeconds int             `json:"backoff_base_seconds,omitempty"`
+	BackoffCapSeconds  int             `json:"backoff_cap_seconds,omitempty"`
+	DeadRetry          bool            `json:"dead_retry,omitempty"`
+	MinWorkers         int             `json:"min_workers,omitempty"`
+	Scheduling         SchedulingMode  `json:"scheduling,omitempty"`
+	// RetryBudgetPercent caps the share of the queue's recent leases that
+	// may be retries; past it, failures go straight to dead. 0 disables it.
+	RetryBudgetPercent int       `json:"retry_budget_percent,omitempty"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// ApplyDefaults fills retry settings the request leaves unset from the queue config
+func (c *QueueConfig) ApplyDefaults(req *CreateJobRequest) {
+	if req.MaxRetries == 0 {
+		req.MaxRetries = c.MaxRetries
+	}
+	if req.BackoffStrategy == "" {
+		req.BackoffStrategy = c.BackoffStrategy
+	}
+	if req.BackoffBaseSeconds == 0 {
+		req.BackoffBaseSeconds = c.BackoffBaseSeconds
+	}
+	if req.BackoffCapSeconds == 0 {
+		req.BackoffCapSeconds = c.BackoffCapSeconds
+	}
+	if c.DeadRetry {
+		req.DeadRetry = true
+	}
 }
 
 // QueueStats holds statistics for a queue
 type QueueStats struct {
-	Queue   string `json:"queue"`
-	Status  string `json:"status"`
-	Count   int    `json:"count"`
+	Queue  string `json:"queue"`
+	Status string `json:"status"`
+	Count  int    `json:"count"`
 }
 
 // Store defines the interface for job persistence
 type Store interface {
 	CreateJob(ctx context.Context, req *CreateJobRequest) (*Job, error)
+	CreateJobsBatch(ctx context.Context, reqs []*CreateJobRequest) ([]CreateJobResult, error)
 	GetJob(ctx context.Context, id string) (*Job, error)
+	GetJobs(ctx context.Context, ids []string) (map[string]*Job, error)
+	GetJobsByLeaseID(ctx context.Context, leaseID string) ([]*Job, error)
+	RenewLease(ctx context.Context, jobID, leaseID string, epoch int64, leaseTTL time.Duration) (time.Time, error)
+	SaveState(ctx context.Context, jobID, leaseID string, epoch int64, state json.RawMessage) error
 	UpdateJobStatus(ctx context.Context, id string, status JobStatus, lastError string) error
-	LeaseJobs(ctx context.Context, queue string, workerID string, maxJobs int, leaseTTL time.Duration) ([]*Job, error)
-	AckJob(ctx context.Context, jobID, leaseID string, success bool, errorMsg string) error
-	GetPendingDelayedJobs(ctx context.Context, limit int) ([]*Job, error)
-	MoveToReady(ctx context.Context, jobID string) error
+	LeaseJobs(ctx context.Context, queue string, workerID string, maxJobs int, leaseTTL time.Duration, opts LeaseOptions) ([]*Job, error)
+	LeaseJob(ctx context.Context, jobID, workerID string, leaseTTL time.Duration) (*Job, error)
+	ReclaimExpiredLeases(ctx context.Context) (reclaimed []string, dead []string, err error)
+	FetchPayload(ctx context.Context, jobID, leaseID string) (map[string]interface{}, error)
+	AckJob(ctx context.Context, req AckRequest) (*AckResult, error)
+	AckJobsBatch(ctx context.Context, acks []AckRequest) ([]AckResult, error)
 	GetQueueStats(ctx context.Context) ([]QueueStats, error)
-	GetRecentJobs(ctx context.Context, limit int) ([]*Job, error)
+	RecordQueueStatsSample(ctx context.Context, at time.Time) (int64, error)
+	PruneQueueStatsHistory(ctx context.Context, before time.Time) (int64, error)
+	GetQueueStatsHistory(ctx context.Context, queue string, since time.Time, bucket time.Duration) ([]QueueStatsPoint, error)
+	GetSLAStats(ctx context.Context, jobType string, since time.Time) (*SLAStats, error)
+	CountStuckJobs(ctx context.Context, ttlMultiple float64) (map[string]int, error)
+	CountInFlightByLease(ctx context.Context, leaseIDs []string) (map[string]int, error)
+	ExpireJobs(ctx context.Context, queue string) ([]string, error)
+	AgeJobs(ctx context.Context, increment, maxPriority int, waitingSince time.Time) (int64, error)
+	GetRecentJobs(ctx context.Context, kind JobKind, limit int) ([]*Job, error)
+	GetJobsByTimeRange(ctx context.Context, from, to time.Time, after *JobCursor, limit int) ([]*Job, error)
+	ListDeadJobs(ctx context.Context, queue string, reason DeadReason, limit int) ([]*Job, error)
+	RetryDeadJobs(ctx context.Context) ([]string, error)
+	CountDeadJobs(ctx context.Context, filter DeadJobFilter) (int, error)
+	ReplayDeadJobs(ctx context.Context, filter DeadJobFilter, limit int) ([]string, error)
+	KillJob(ctx context.Context, id, operator, reason string) (*Job, error)
+	StealJob(ctx context.Context, id string) (*Job, error)
+	ReleaseJob(ctx context.Context, jobID, leaseID string, epoch int64) error
+	CreateWorkflow(ctx context.Context, req *CreateWorkflowRequest) (*Workflow, error)
+	GetWorkflow(ctx context.Context, id string) (*Workflow, error)
+	RecordWorkerHeartbeat(ctx context.Context, workerID, queue string, weight int) error
+	CountHealthyWorkers(ctx context.Context, queue string, since time.Time) (int, error)
+	HealthyWorkerCapacity(ctx context.Context, queue string, since time.Time) (int, error)
+	ListWorkers(ctx context.Context, since time.Time) ([]*WorkerInfo, error)
+	PruneWorkerHeartbeats(ctx context.Context, before time.Time) (int64, error)
+	RequestWorkerDrain(ctx context.Context, workerID string) (time.Time, error)
+	WorkerDrainRequested(ctx context.Context, workerID string, startedAt time.Time) (bool, error)
+	GetQueueConfig(ctx context.Context, queue string) (*QueueConfig, error)
+	Ping(ctx context.Context) error
+	ListQueueConfigs(ctx context.Context) ([]*QueueConfig, error)
+	SetQueueConfig(ctx context.Context, cfg *QueueConfig) error
+	ListRoutingRules(ctx context.Context) ([]*RoutingRule, error)
+	SetRoutingRules(ctx context.Context, rules []*RoutingRule) error
+	GetCalendar(ctx context.Context, name string) (*BusinessCalendar, error)
+	PutCalendar(ctx context.Context, cal *BusinessCalendar) error
+	PauseJobType(ctx context.Context, jobType string) (*PausedJobType, error)
+	ResumeJobType(ctx context.Context, jobType string) (bool, error)
+	ListPausedJobTypes(ctx context.Context) ([]*PausedJobType, error)
+	MigrateQueue(ctx context.Context, from, to string, filter MigrateFilter) (int64, error)
+	PauseDispatch(ctx context.Context) (*DispatchPause, error)
+	ResumeDispatch(ctx context.Context) (bool, error)
+	GetDispatchPause(ctx context.Context) (*DispatchPause, error)
+	SetJobTypeFailFast(ctx context.Context, jobType string) (*FailFastJobType, error)
+	ClearJobTypeFailFast(ctx context.Context, jobType string) (bool, error)
+	ListFailFastJobTypes(ctx context.Context) ([]*FailFastJobType, error)
+	ExportJobs(ctx context.Context, queue, afterID string, limit int) ([]*Job, error)
+	ImportJob(ctx context.Context, job *Job, opts ImportOptions) (string, error)
+	ListJobAttempts(ctx context.Context, jobID string) ([]*JobAttempt, error)
 }
 
 // PostgresStore implements Store using PostgreSQL
 type PostgresStore struct {
-	db *sql.DB
+	db                *sql.DB
+	backoff           BackoffPolicy
+	dedupWindow       time.Duration
+	maxFrontRequeues  int
+	maxRetryAfter     time.Duration
+	maxDeferrals      int
+	deadRetrySchedule []time.Duration
+	requireEpoch      bool
+	graceRedeliveries int
+
+	// retryBudgetExhausted, when set, reports queues whose retry budget is
+	// spent; their failed jobs are dead-lettered instead of retried
+	retryBudgetExhausted func(queue string) bool
+
+	// backoffMultiplier, when set, scales the computed retry backoff of
+	// failed jobs by their type
+	backoffMultiplier func(jobType string) float64
+
+	// onCorruptRow, when set, makes list and lease queries skip rows they
+	// can't decode, reporting each one, instead of failing entirely
+	onCorruptRow func(query, jobID string, err error)
+
+	// queryObserver, when set, is called with the duration of each timed
+	// store operation
+	queryObserver func(operation string, duration time.Duration)
+
+	// idGenerator makes the IDs of jobs created or imported without one
+	idGenerator IDGenerator
 }
 
+// DefaultDedupWindow is how long an idempotency key is remembered by default
+const DefaultDedupWindow = 24 * time.Hour
+
+// DefaultMaxFrontRequeues is how many front-of-line retries a job gets by default
+const DefaultMaxFrontRequeues = 3
+
+// DefaultMaxRetryAfter caps the retry delay a nack may request by default
+const DefaultMaxRetryAfter = time.Hour
+
+// DefaultMaxDeferrals is how many RetryAfter nacks a job gets by default
+// before they count as attempts
+const DefaultMaxDeferrals = 10
+
+// frontRequeueBoost is added to a front-requeued job's priority until its next lease
+const frontRequeueBoost = 1000
+
 // NewPostgresStore creates a new PostgresStore
 func NewPostgresStore(db *sql.DB) *PostgresStore {
-	return &PostgresStore{db: db}
+	return &PostgresStore{
+		db:                db,
+		backoff:           DefaultBackoffPolicy(),
+		dedupWindow:       DefaultDedupWindow,
+		maxFrontRequeues:  DefaultMaxFrontRequeues,
+		maxRetryAfter:     DefaultMaxRetryAfter,
+		maxDeferrals:      DefaultMaxDeferrals,
+		deadRetrySchedule: DefaultDeadRetrySchedule,
+		idGenerator:       UUIDGenerator{},
+	}
+}
+
+// SetBackoffPolicy replaces the retry backoff bounds applied to failed jobs
+func (s *PostgresStore) SetBackoffPolicy(policy BackoffPolicy) {
+	s.backoff = policy
+}
+
+// SetDedupWindow sets how long after creation a job's idempotency key still
+// collapses new enqueues into it
+func (s *PostgresStore) SetDedupWindow(window time.Duration) {
+	s.dedupWindow = window
+}
+
+// SetMaxFrontRequeues caps how many RequeueFront nacks each job may use
+func (s *PostgresStore) SetMaxFrontRequeues(max int) {
+	s.maxFrontRequeues = max
+}
+
+// SetGraceRedeliveries sets how many lease expiries and redelivery nacks
+// each job gets before they count against its attempts
+func (s *PostgresStore) SetGraceRedeliveries(grace int) {
+	s.graceRedeliveries = grace
+}
+
+// SetMaxRetryAfter caps the delay a RetryAfter nack may request
+func (s *PostgresStore) SetMaxRetryAfter(max time.Duration) {
+	s.maxRetryAfter = max
+}
+
+// SetMaxDeferrals caps how many RetryAfter nacks each job may use without
+// counting an attempt, so a job can't be deferred forever
+func (s *PostgresStore) SetMaxDeferrals(max int) {
+	s.maxDeferrals = max
+}
+
+// SetIDGenerator replaces how IDs are made for jobs created or imported
+// without one, e.g. to make them deterministic in tests. Nil restores the
+// UUID default.
+func (s *PostgresStore) SetIDGenerator(gen IDGenerator) {
+	if gen == nil {
+		gen = UUIDGenerator{}
+	}
+	s.idGenerator = gen
+}
+
+// SetRequireLeaseEpoch makes acks that don't carry a lease epoch fail
+func (s *PostgresStore) SetRequireLeaseEpoch(require bool) {
+	s.requireEpoch = require
+}
+
+// SetRetryBudget makes AckJob dead-letter failures it would otherwise retry
+// while exhausted reports the job's queue over its retry budget
+func (s *PostgresStore) SetRetryBudget(exhausted func(queue string) bool) {
+	s.retryBudgetExhausted = exhausted
+}
+
+// SetBackoffMultiplier makes AckJob multiply the computed backoff of a
+// failed job by multiplier(job type)
+func (s *PostgresStore) SetBackoffMultiplier(multiplier func(jobType string) float64) {
+	s.backoffMultiplier = multiplier
+}
+
+// SetSkipCorruptRows makes GetRecentJobs and LeaseJobs skip job rows whose
+// payload, labels or requirements can't be decoded, passing each to
+// onCorrupt, rather than fail the whole query. Jobs skipped by a lease are
+// dead-lettered as poison in the lease's transaction. Nil restores the
+// strict default.
+func (s *PostgresStore) SetSkipCorruptRows(onCorrupt func(query, jobID string, err error)) {
+	s.onCorruptRow = onCorrupt
+}
+
+// skipCorruptRow reports whether a row that failed to decode with err
+// should be skipped rather than failing query
+func (s *PostgresStore) skipCorruptRow(query, jobID string, err error) bool {
+	if s.onCorruptRow == nil {
+		return false
+	}
+	s.onCorruptRow(query, jobID, err)
+	return true
+}
+
+// Ping checks that the database is reachable
+func (s *PostgresStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
 }
 
 // CreateJob creates a new job in the database
 func (s *PostgresStore) CreateJob(ctx context.Context, req *CreateJobRequest) (*Job, error) {
-	id := uuid.New().String()
-	now := time.Now()
-	runAt := now
-	if req.DelaySeconds > 0 {
-		runAt = now.Add(time.Duration(req.DelaySeconds) * time.Second)
+	defer s.observe("create", time.Now())
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
+	job, err := s.createJobTx(ctx, tx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return job, nil
+}
+
+// createJobTx creates a job within an existing transaction. ErrInvalidJobID
+// and ErrJobExists leave the transaction usable.
+func (s *PostgresStore) createJobTx(ctx context.Context, tx *sql.Tx, req *CreateJobRequest) (*Job, error) {
+	id := req.ID
+	if id == "" {
+		id = s.idGenerator.NewID()
+	} else if err := ValidateJobID(id); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	runAt := req.RunAtFrom(now)
+
+	if req.Kind == "" {
+		req.Kind = KindUser
+	}
 	if req.Queue == "" {
-		req.Queue = "default"
+		req.Queue = DefaultQueue(req.Kind)
 	}
 	if req.MaxRetries == 0 {
 		req.MaxRetries = 3
 	}
 
-	payloadJSON, err := json.Marshal(req.Payload)
+	payloadJSON, err := CanonicalizePayload(req.Payload)
+	if err != nil {
+		return nil, err
+	}
+	payloadHash := hashCanonical(payloadJSON)
+	unique, err := uniqueKey(req, payloadJSON)
+	if err != nil {
+		return nil, err
+	}
+	scheduleJSON, err := marshalSchedule(req.BackoffSchedule)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := req.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labelsJSON, err := json.Marshal(labels)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+		return nil, fmt.Errorf("failed to marshal labels: %w", err)
+	}
+
+	requiresJSON, err := marshalStrings(req.Requires)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal requires: %w", err)
+	}
+
+	if req.IdempotencyKey != "" || req.EnqueueIfAbsent || unique != "" {
+		var existingID string
+		if req.IdempotencyKey != "" {
+			existingID, err = s.findDuplicateTx(ctx, tx, req.Queue, req.IdempotencyKey, now)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if existingID == "" && req.EnqueueIfAbsent {
+			existingID, err = s.findActiveTx(ctx, tx, req)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if existingID == "" && unique != "" {
+			existingID, err = s.findUniqueTx(ctx, tx, unique)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if existingID != "" {
+			existing, err := scanJob(tx.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = $1`, existingID))
+			if err != nil {
+				return nil, fmt.Errorf("failed to get job: %w", err)
+			}
+			existing.Deduplicated = true
+			return existing, nil
+		}
 	}
 
 	query := `
-		INSERT INTO jobs (id, type, payload, queue, priority, status, max_retries, run_at, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-		RETURNING id, type, payload, queue, priority, status, attempts, max_retries, run_at, created_at, updated_at
+		INSERT INTO jobs (id, type, payload, queue, priority, status, max_retries, run_at, created_at, updated_at, labels, trace_id, partition_key, idempotency_key, requires,
+		                  backoff_strategy, backoff_base_seconds, backoff_cap_seconds, kind, deadline, singleton_key, dead_retry, payload_hash, backoff_schedule, unique_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25)
+		ON CONFLICT (id) DO NOTHING
+		RETURNING id, type, payload, queue, priority, status, kind, attempts, max_retries, run_at, created_at, updated_at
 	`
 
 	var job Job
 	var payloadStr string
 
-	err = s.db.QueryRowContext(ctx, query,
+	err = tx.QueryRowContext(ctx, query,
 		id, req.Type, payloadJSON, req.Queue, req.Priority, StatusPending, req.MaxRetries, runAt, now, now,
-	).Scan(&job.ID, &job.Type, &payloadStr, &job.Queue, &job.Priority, &job.Status,
+		labelsJSON, sql.NullString{String: req.TraceID, Valid: req.TraceID != ""},
+		sql.NullString{String: req.PartitionKey, Valid: req.PartitionKey != ""},
+		sql.NullString{String: req.IdempotencyKey, Valid: req.IdempotencyKey != ""},
+		requiresJSON,
+		sql.NullString{String: string(req.BackoffStrategy), Valid: req.BackoffStrategy != ""},
+		sql.NullInt64{Int64: int64(req.BackoffBaseSeconds), Valid: req.BackoffBaseSeconds > 0},
+		sql.NullInt64{Int64: int64(req.BackoffCapSeconds), Valid: req.BackoffCapSeconds > 0},
+		req.Kind, nullTime(req.Deadline),
+		sql.NullString{String: req.SingletonKey, Valid: req.SingletonKey != ""},
+		req.DeadRetry, payloadHash, scheduleJSON,
+		sql.NullString{String: unique, Valid: unique != ""},
+	).Scan(&job.ID, &job.Type, &payloadStr, &job.Queue, &job.Priority, &job.Status, &job.Kind,
 		&job.Attempts, &job.MaxRetries, &job.RunAt, &job.CreatedAt, &job.UpdatedAt)
 
+	if err == sql.ErrNoRows {
+		// Only a client-supplied ID can conflict
+		return nil, fmt.Errorf("%w: %s", ErrJobExists, id)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create job: %w", err)
 	}
@@ -124,35 +824,194 @@ func (s *PostgresStore) CreateJob(ctx context.Context, req *CreateJobRequest) (*
 		return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
 	}
 
+	if len(req.Labels) > 0 {
+		job.Labels = req.Labels
+	}
+	job.TraceID = req.TraceID
+	job.PartitionKey = req.PartitionKey
+	job.IdempotencyKey = req.IdempotencyKey
+	if len(req.Requires) > 0 {
+		job.Requires = req.Requires
+	}
+	job.BackoffStrategy = req.BackoffStrategy
+	job.BackoffBaseSeconds = req.BackoffBaseSeconds
+	job.BackoffCapSeconds = req.BackoffCapSeconds
+	job.BackoffSchedule = req.BackoffSchedule
+	job.Deadline = req.Deadline
+	job.DeadRetry = req.DeadRetry
+	job.PayloadHash = payloadHash
+	job.UniqueKey = unique
+
 	return &job, nil
 }
 
-// GetJob retrieves a job by ID
-func (s *PostgresStore) GetJob(ctx context.Context, id string) (*Job, error) {
-	query := `
-		SELECT id, type, payload, queue, priority, status, attempts, max_retries,
-		       last_error, lease_id, leased_at, leased_by, run_at, created_at, updated_at
-		FROM jobs
-		WHERE id = $1
-	`
+// DefaultQueue returns the queue used when a job of the given kind names none
+func DefaultQueue(kind JobKind) string {
+	if kind == KindSystem {
+		return SystemQueue
+	}
+	return "default"
+}
 
-	var job Job
-	var payloadStr string
-	var lastError, leaseID, leasedBy sql.NullString
-	var leasedAt sql.NullTime
+// findDuplicateTx returns the ID of the queue's job created with the same
+// idempotency key within the dedup window, or "" if there is none. It holds an
+// advisory lock on the key until the transaction ends so that concurrent
+// enqueues with the same key can't both miss and insert.
+func (s *PostgresStore) findDuplicateTx(ctx context.Context, tx *sql.Tx, queue, key string, now time.Time) (string, error) {
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1 || ':' || $2))", queue, key); err != nil {
+		return "", fmt.Errorf("failed to lock idempotency key: %w", err)
+	}
 
-	err := s.db.QueryRowContext(ctx, query, id).Scan(
-		&job.ID, &job.Type, &payloadStr, &job.Queue, &job.Priority, &job.Status,
-		&job.Attempts, &job.MaxRetries, &lastError, &leaseID, &leasedAt, &leasedBy,
-		&job.RunAt, &job.CreatedAt, &job.UpdatedAt,
-	)
+	var id string
+	err := tx.QueryRowContext(ctx, `
+		SELECT id FROM jobs
+		WHERE queue = $1 AND idempotency_key = $2 AND created_at > $3
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, queue, key, now.Add(-s.dedupWindow)).Scan(&id)
 
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up idempotency key: %w", err)
+	}
+	return id, nil
+}
+
+// findActiveTx returns the ID of a pending or leased job with the request's
+// singleton key, or "" if there is none. Like findDuplicateTx it holds an
+// advisory lock on the key until the transaction ends, so that of several
+// concurrent enqueue-if-absent requests only one creates a job.
+func (s *PostgresStore) findActiveTx(ctx context.Context, tx *sql.Tx, req *CreateJobRequest) (string, error) {
+	lockKey := "type:" + req.Queue + ":" + req.Type
+	query := `SELECT id FROM jobs WHERE queue = $1 AND type = $2 AND status = ANY($3) ORDER BY created_at LIMIT 1`
+	args := []interface{}{req.Queue, req.Type, pq.Array(activeStatuses)}
+	if req.SingletonKey != "" {
+		lockKey = "key:" + req.SingletonKey
+		query = `SELECT id FROM jobs WHERE singleton_key = $1 AND status = ANY($2) ORDER BY created_at LIMIT 1`
+		args = []interface{}{req.SingletonKey, pq.Array(activeStatuses)}
+	}
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", "singleton:"+lockKey); err != nil {
+		return "", fmt.Errorf("failed to lock singleton key: %w", err)
+	}
+
+	var id string
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up active job: %w", err)
+	}
+	return id, nil
+}
+
+// jobColumns are the columns read by scanJob, in order. A front-requeue
+// boost only orders leasing, so jobs are read with their own priority.
+const jobColumns = `id, type, payload, queue, priority - priority_boost, status, kind, attempts, max_retries,
+		       last_error, lease_id, leased_at, leased_by, run_at, created_at, updated_at,
+		       labels, trace_id, partition_key, idempotency_key, requires, lease_expires_at, dead_reason,
+		       backoff_strategy, backoff_base_seconds, backoff_cap_seconds, backoff_schedule, deadline,
+		       dead_retry, dead_retry_count, dead_at, killed_by, payload_hash, lease_epoch, workflow_id, started_at, state,
+		       redeliveries, unique_key`
+
+// GetJob retrieves a job by ID
+func (s *PostgresStore) GetJob(ctx context.Context, id string) (*Job, error) {
+	defer s.observe("get_job", time.Now())
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE id = $1`
+
+	job, err := scanJob(s.db.QueryRowContext(ctx, query, id))
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("job not found")
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get job: %w", err)
 	}
+	return job, nil
+}
+
+// GetJobs retrieves the jobs with the given IDs in one query, keyed by ID.
+// IDs that don't exist are absent from the result.
+func (s *PostgresStore) GetJobs(ctx context.Context, ids []string) (map[string]*Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE id = ANY($1)`
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := make(map[string]*Job, len(ids))
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs[job.ID] = job
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// GetJobsByLeaseID returns the jobs handed out under a lease ID, oldest first.
+// LeaseJobs assigns one lease ID per batch, so this is the whole batch. Jobs
+// are found through their attempt history, so it works after the lease ended.
+func (s *PostgresStore) GetJobsByLeaseID(ctx context.Context, leaseID string) ([]*Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs
+		WHERE lease_id = $1 OR id IN (SELECT job_id FROM job_attempts WHERE lease_id = $1)
+		ORDER BY created_at, id`
+
+	rows, err := s.db.QueryContext(ctx, query, leaseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query jobs by lease: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []*Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// scanJob reads a row selected with jobColumns
+func scanJob(row rowScanner) (*Job, error) {
+	var job Job
+	var payloadStr, labelsStr, requiresStr string
+	var lastError, leaseID, leasedBy, traceID, partitionKey, idempotencyKey, deadReason sql.NullString
+	var backoffStrategy, backoffSchedule, killedBy, payloadHash, workflowID, state, uniqueKey sql.NullString
+	var backoffBase, backoffCap sql.NullInt64
+	var leasedAt, leaseExpiresAt, deadline, deadAt, startedAt sql.NullTime
+
+	err := row.Scan(
+		&job.ID, &job.Type, &payloadStr, &job.Queue, &job.Priority, &job.Status, &job.Kind,
+		&job.Attempts, &job.MaxRetries, &lastError, &leaseID, &leasedAt, &leasedBy,
+		&job.RunAt, &job.CreatedAt, &job.UpdatedAt,
+		&labelsStr, &traceID, &partitionKey, &idempotencyKey, &requiresStr, &leaseExpiresAt, &deadReason,
+		&backoffStrategy, &backoffBase, &backoffCap, &backoffSchedule, &deadline,
+		&job.DeadRetry, &job.DeadRetryCount, &deadAt, &killedBy, &payloadHash, &job.LeaseEpoch, &workflowID, &startedAt, &state,
+		&job.Redeliveries, &uniqueKey,
+	)
+	if err != nil {
+		return nil, err
+	}
 
 	if err := json.Unmarshal([]byte(payloadStr), &job.Payload); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
@@ -170,10 +1029,132 @@ func (s *PostgresStore) GetJob(ctx context.Context, id string) (*Job, error) {
 	if leasedAt.Valid {
 		job.LeasedAt = &leasedAt.Time
 	}
+	if err := unmarshalLabels(labelsStr, &job); err != nil {
+		return nil, err
+	}
+	if err := unmarshalRequires(requiresStr, &job); err != nil {
+		return nil, err
+	}
+	if traceID.Valid {
+		job.TraceID = traceID.String
+	}
+	if partitionKey.Valid {
+		job.PartitionKey = partitionKey.String
+	}
+	if idempotencyKey.Valid {
+		job.IdempotencyKey = idempotencyKey.String
+	}
+	if leaseExpiresAt.Valid {
+		job.LeaseExpiresAt = &leaseExpiresAt.Time
+	}
+	if deadReason.Valid {
+		job.DeadReason = DeadReason(deadReason.String)
+	}
+	job.BackoffStrategy = BackoffStrategy(backoffStrategy.String)
+	job.BackoffBaseSeconds = int(backoffBase.Int64)
+	job.BackoffCapSeconds = int(backoffCap.Int64)
+	if job.BackoffSchedule, err = unmarshalSchedule(backoffSchedule); err != nil {
+		return nil, err
+	}
+	if deadline.Valid {
+		job.Deadline = &deadline.Time
+	}
+	if deadAt.Valid {
+		job.DeadAt = &deadAt.Time
+	}
+	job.KilledBy = killedBy.String
+	job.PayloadHash = payloadHash.String
+	job.WorkflowID = workflowID.String
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if state.Valid {
+		job.State = json.RawMessage(state.String)
+	}
+	job.UniqueKey = uniqueKey.String
 
 	return &job, nil
 }
 
+// unmarshalLabels decodes a labels JSONB column, leaving Labels nil when empty
+func unmarshalLabels(labelsStr string, job *Job) error {
+	if err := json.Unmarshal([]byte(labelsStr), &job.Labels); err != nil {
+		return fmt.Errorf("failed to unmarshal labels: %w", err)
+	}
+	if len(job.Labels) == 0 {
+		job.Labels = nil
+	}
+	return nil
+}
+
+// unmarshalRequires decodes a requires JSONB column, leaving Requires nil when empty
+func unmarshalRequires(requiresStr string, job *Job) error {
+	if err := json.Unmarshal([]byte(requiresStr), &job.Requires); err != nil {
+		return fmt.Errorf("failed to unmarshal requires: %w", err)
+	}
+	if len(job.Requires) == 0 {
+		job.Requires = nil
+	}
+	return nil
+}
+
+// marshalSchedule encodes a backoff schedule for its JSONB column; no
+// schedule is stored as NULL
+func marshalSchedule(schedule []int) (interface{}, error) {
+	if len(schedule) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(schedule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal backoff schedule: %w", err)
+	}
+	return data, nil
+}
+
+// unmarshalSchedule decodes a backoff_schedule column
+func unmarshalSchedule(col sql.NullString) ([]int, error) {
+	if !col.Valid {
+		return nil, nil
+	}
+	var schedule []int
+	if err := json.Unmarshal([]byte(col.String), &schedule); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal backoff schedule: %w", err)
+	}
+	return schedule, nil
+}
+
+// nullTime converts an optional time to a nullable query parameter
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
+// nullInt converts an optional int to a nullable query parameter
+func nullInt(v *int) sql.NullInt64 {
+	if v == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(*v), Valid: true}
+}
+
+// nullBool converts an optional bool to a nullable column value
+func nullBool(v *bool) sql.NullBool {
+	if v == nil {
+		return sql.NullBool{}
+	}
+	return sql.NullBool{Bool: *v, Valid: true}
+}
+
+// marshalStrings encodes a string list as a JSON array, never as null
+func marshalStrings(values []string) ([]byte, error) {
+	if values == nil {
+		values = []string{}
+	}
+	return json.Marshal(values)
+}
+
 // UpdateJobStatus updates the status of a job
 func (s *PostgresStore) UpdateJobStatus(ctx context.Context, id string, status JobStatus, lastError string) error {
 	query := `
@@ -185,188 +1166,680 @@ func (s *PostgresStore) UpdateJobStatus(ctx context.Context, id string, status J
 	return err
 }
 
-// LeaseJobs atomically leases available jobs for a worker
-func (s *PostgresStore) LeaseJobs(ctx context.Context, queue string, workerID string, maxJobs int, leaseTTL time.Duration) ([]*Job, error) {
-	leaseID := uuid.New().String()
+// LeaseJobs atomically leases available jobs for a worker
+func (s *PostgresStore) LeaseJobs(ctx context.Context, queue string, workerID string, maxJobs int, leaseTTL time.Duration, opts LeaseOptions) ([]*Job, error) {
+	defer s.observe("lease", time.Now())
+	leaseID := uuid.New().String()
+	now := time.Now()
+	leaseUntil := now.Add(leaseTTL)
+
+	var visibleUntil sql.NullTime
+	if opts.VisibilityTimeout > 0 {
+		visibleUntil = sql.NullTime{Time: now.Add(opts.VisibilityTimeout), Valid: true}
+	}
+
+	capabilitiesJSON, err := marshalStrings(opts.Capabilities)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal capabilities: %w", err)
+	}
+
+	labelFilter := opts.LabelFilter
+	if labelFilter == nil {
+		labelFilter = map[string]string{}
+	}
+	labelFilterJSON, err := json.Marshal(labelFilter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal label filter: %w", err)
+	}
+
+	var q interface {
+		QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	} = s.db
+	var tx *sql.Tx
+	if opts.Serial || s.onCorruptRow != nil {
+		// Corrupt rows skipped below are dead-lettered with the lease
+		tx, err = s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+		q = tx
+	}
+	if opts.Serial {
+		maxJobs = 1
+		// Two leases could otherwise both find the queue idle; the lock
+		// serializes them until this one's UPDATE commits
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", "serial:"+queue); err != nil {
+			return nil, fmt.Errorf("failed to lock serial queue: %w", err)
+		}
+	}
+
+	status := StatusLeased
+	var startedAt sql.NullTime
+	if opts.StartImmediately {
+		status = StatusProcessing
+		startedAt = sql.NullTime{Time: now, Valid: true}
+	}
+
+	// Use SELECT FOR UPDATE SKIP LOCKED for atomic job leasing, and start an
+	// attempt for each leased job. EDF queues order by deadline first; for
+	// other queues the deadline sort key is NULL and has no effect.
+	query := `
+		WITH leased AS (
+			UPDATE jobs
+			SET status = $21,
+			    started_at = $22,
+			    lease_id = $2,
+			    leased_at = $3,
+			    leased_by = $4,
+			    lease_expires_at = $9,
+			    lease_epoch = lease_epoch + 1,
+			    visible_until = $10,
+			    priority = priority - priority_boost,
+			    priority_boost = 0,
+			    updated_at = $3
+			WHERE id IN (
+				SELECT id FROM jobs j
+				WHERE queue = $5
+				  AND status = $6
+				  AND run_at <= $7
+				  AND (deadline IS NULL OR deadline > $7)
+				  AND requires <@ $13::jsonb
+				  AND labels @> $16::jsonb
+				  AND (NOT $17 OR NOT EXISTS (
+				      SELECT 1 FROM jobs busy
+				      WHERE busy.queue = j.queue AND busy.status IN ($1, $18)
+				  ))
+				  AND NOT EXISTS (SELECT 1 FROM paused_types p WHERE p.type = j.type)
+				  AND NOT EXISTS (SELECT 1 FROM dispatch_pause)
+				  AND ($14::int IS NULL OR priority - priority_boost >= $14)
+				  AND ($15::int IS NULL OR priority - priority_boost < $15)
+				  AND ($20::int IS NULL OR priority - priority_boost >= $20)
+				  AND (NOT $12 OR partition_key IS NULL OR NOT EXISTS (
+				      SELECT 1 FROM jobs prev
+				      WHERE prev.queue = j.queue
+				        AND prev.partition_key = j.partition_key
+				        AND prev.seq < j.seq
+				        AND prev.status IN ($6, $1, $18)
+				  ))
+				ORDER BY CASE WHEN (SELECT scheduling FROM queue_configs WHERE queue = $5) = $19 THEN deadline END ASC NULLS LAST,
+				         priority DESC, run_at ASC
+				LIMIT $8
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, type, CASE WHEN $11 THEN NULL ELSE payload END, queue, priority, status, attempts, max_retries,
+			          lease_id, leased_at, leased_by, run_at, created_at, updated_at,
+			          labels, trace_id, partition_key, requires, lease_expires_at, deadline, lease_epoch, started_at, state
+		), started AS (
+			INSERT INTO job_attempts (job_id, attempt, worker_id, lease_id, started_at)
+			SELECT id, attempts + 1, leased_by, lease_id, leased_at FROM leased
+		)
+		SELECT * FROM leased
+	`
+
+	rows, err := q.QueryContext(ctx, query,
+		StatusLeased, leaseID, now, workerID, queue, StatusPending, now, maxJobs, leaseUntil, visibleUntil,
+		opts.OmitPayload, opts.FIFO, capabilitiesJSON,
+		nullInt(opts.PriorityAtLeast), nullInt(opts.PriorityBelow), labelFilterJSON,
+		opts.Serial, StatusProcessing, SchedulingEDF, nullInt(opts.MinPriority),
+		status, startedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lease jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	corrupt := make(map[string]error)
+	for rows.Next() {
+		// Stop scanning once the caller has given up; jobs already leased by
+		// the UPDATE are reclaimed when their leases expire
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var job Job
+		var labelsStr, requiresStr string
+		var payloadStr, leaseID, leasedBy, traceID, partitionKey, state sql.NullString
+		var leasedAt, leaseExpiresAt, deadline, startedAt sql.NullTime
+
+		err := rows.Scan(
+			&job.ID, &job.Type, &payloadStr, &job.Queue, &job.Priority, &job.Status,
+			&job.Attempts, &job.MaxRetries, &leaseID, &leasedAt, &leasedBy,
+			&job.RunAt, &job.CreatedAt, &job.UpdatedAt,
+			&labelsStr, &traceID, &partitionKey, &requiresStr, &leaseExpiresAt, &deadline, &job.LeaseEpoch, &startedAt, &state,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+
+		if payloadStr.Valid {
+			if err := json.Unmarshal([]byte(payloadStr.String), &job.Payload); err != nil {
+				if s.skipCorruptRow("lease", job.ID, err) {
+					corrupt[job.ID] = err
+					continue
+				}
+				return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
+			}
+		} else {
+			job.PayloadOmitted = true
+		}
+
+		if leaseID.Valid {
+			job.LeaseID = leaseID.String
+		}
+		if leasedBy.Valid {
+			job.LeasedBy = leasedBy.String
+		}
+		if leasedAt.Valid {
+			job.LeasedAt = &leasedAt.Time
+		}
+		if err := unmarshalLabels(labelsStr, &job); err != nil {
+			if s.skipCorruptRow("lease", job.ID, err) {
+				corrupt[job.ID] = err
+				continue
+			}
+			return nil, err
+		}
+		if err := unmarshalRequires(requiresStr, &job); err != nil {
+			if s.skipCorruptRow("lease", job.ID, err) {
+				corrupt[job.ID] = err
+				continue
+			}
+			return nil, err
+		}
+		if traceID.Valid {
+			job.TraceID = traceID.String
+		}
+		if partitionKey.Valid {
+			job.PartitionKey = partitionKey.String
+		}
+		if leaseExpiresAt.Valid {
+			job.LeaseExpiresAt = &leaseExpiresAt.Time
+		}
+		if deadline.Valid {
+			job.Deadline = &deadline.Time
+		}
+		if startedAt.Valid {
+			job.StartedAt = &startedAt.Time
+		}
+		if state.Valid {
+			job.State = json.RawMessage(state.String)
+		}
+
+		jobs = append(jobs, &job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if len(corrupt) > 0 {
+		if err := deadLetterCorruptTx(ctx, tx, leaseID, corrupt); err != nil {
+			return nil, err
+		}
+	}
+
+	if tx != nil {
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to commit lease: %w", err)
+		}
+	}
+	return jobs, nil
+}
+
+// deadLetterCorruptTx dead-letters jobs a lease skipped because their rows
+// couldn't be decoded. They would fail to decode on every lease, so retrying
+// them would only burn their attempts.
+func deadLetterCorruptTx(ctx context.Context, tx *sql.Tx, leaseID string, corrupt map[string]error) error {
+	now := time.Now()
+	for id, decodeErr := range corrupt {
+		lastError := "corrupt row: " + decodeErr.Error()
+		var workflowID sql.NullString
+		err := tx.QueryRowContext(ctx, `
+			UPDATE jobs
+			SET status = $1, dead_reason = $2, dead_at = $3, last_error = $4, attempts = attempts + 1,
+			    sla_met = CASE WHEN deadline IS NOT NULL THEN FALSE END,
+			    lease_id = NULL, leased_at = NULL, leased_by = NULL,
+			    lease_expires_at = NULL, visible_until = NULL, updated_at = $3
+			WHERE id = $5
+			RETURNING workflow_id
+		`, StatusDead, DeadReasonPoison, now, lastError, id).Scan(&workflowID)
+		if err != nil {
+			return fmt.Errorf("failed to dead-letter corrupt job %s: %w", id, err)
+		}
+		if err := finishAttemptTx(ctx, tx, id, leaseID, AttemptFailed, lastError); err != nil {
+			return err
+		}
+		if workflowID.Valid {
+			if err := advanceWorkflowTx(ctx, tx, workflowID.String); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// LeaseJob leases one specific job, which must be pending and due, unless
+// dispatch or the job's type is paused
+func (s *PostgresStore) LeaseJob(ctx context.Context, jobID, workerID string, leaseTTL time.Duration) (*Job, error) {
+	defer s.observe("lease_job", time.Now())
 	now := time.Now()
-	leaseUntil := now.Add(leaseTTL)
-
-	// Use SELECT FOR UPDATE SKIP LOCKED for atomic job leasing
-	query := `
-		UPDATE jobs
-		SET status = $1,
-		    lease_id = $2,
-		    leased_at = $3,
-		    leased_by = $4,
-		    updated_at = $3
-		WHERE id IN (
-			SELECT id FROM jobs
-			WHERE queue = $5
-			  AND status = $6
-			  AND run_at <= $7
-			ORDER BY priority DESC, run_at ASC
-			LIMIT $8
-			FOR UPDATE SKIP LOCKED
+	result, err := s.db.ExecContext(ctx, `
+		WITH leased AS (
+			UPDATE jobs
+			SET status = $1, lease_id = $2, leased_at = $3, leased_by = $4,
+			    lease_expires_at = $5, lease_epoch = lease_epoch + 1,
+			    priority = priority - priority_boost, priority_boost = 0, updated_at = $3
+			WHERE id = $6 AND status = $7 AND run_at <= $3 AND (deadline IS NULL OR deadline > $3)
+			  AND NOT EXISTS (SELECT 1 FROM dispatch_pause)
+			  AND NOT EXISTS (SELECT 1 FROM paused_types p WHERE p.type = jobs.type)
+			RETURNING id, attempts
 		)
-		RETURNING id, type, payload, queue, priority, status, attempts, max_retries,
-		          lease_id, leased_at, leased_by, run_at, created_at, updated_at
-	`
-
-	rows, err := s.db.QueryContext(ctx, query,
-		StatusLeased, leaseID, now, workerID, queue, StatusPending, now, maxJobs,
-	)
+		INSERT INTO job_attempts (job_id, attempt, worker_id, lease_id, started_at)
+		SELECT id, attempts + 1, $4, $2, $3 FROM leased
+	`, StatusLeased, uuid.New().String(), now, workerID, now.Add(leaseTTL), jobID, StatusPending)
 	if err != nil {
-		return nil, fmt.Errorf("failed to lease jobs: %w", err)
+		return nil, fmt.Errorf("failed to lease job: %w", err)
 	}
-	defer rows.Close()
 
-	var jobs []*Job
-	for rows.Next() {
-		var job Job
-		var payloadStr string
-		var leaseID, leasedBy sql.NullString
-		var leasedAt sql.NullTime
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to lease job: %w", err)
+	}
+	if affected == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotLeasable, jobID)
+	}
 
-		err := rows.Scan(
-			&job.ID, &job.Type, &payloadStr, &job.Queue, &job.Priority, &job.Status,
-			&job.Attempts, &job.MaxRetries, &leaseID, &leasedAt, &leasedBy,
-			&job.RunAt, &job.CreatedAt, &job.UpdatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan job: %w", err)
-		}
+	return s.GetJob(ctx, jobID)
+}
 
-		if err := json.Unmarshal([]byte(payloadStr), &job.Payload); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
-		}
+// FetchPayload returns the payload of a leased job, verifying the caller holds the lease
+func (s *PostgresStore) FetchPayload(ctx context.Context, jobID, leaseID string) (map[string]interface{}, error) {
+	defer s.observe("fetch_payload", time.Now())
+	var payloadStr string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT payload FROM jobs WHERE id = $1 AND lease_id = $2
+	`, jobID, leaseID).Scan(&payloadStr)
 
-		if leaseID.Valid {
-			job.LeaseID = leaseID.String
-		}
-		if leasedBy.Valid {
-			job.LeasedBy = leasedBy.String
-		}
-		if leasedAt.Valid {
-			job.LeasedAt = &leasedAt.Time
-		}
+	if err == sql.ErrNoRows {
+		return nil, errInvalidLease
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch payload: %w", err)
+	}
 
-		jobs = append(jobs, &job)
+	var payload map[string]interface{}
+	if err := json.Unmarshal([]byte(payloadStr), &payload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
 	}
 
-	return jobs, rows.Err()
+	return payload, nil
 }
 
 // AckJob acknowledges job completion (success or failure)
-func (s *PostgresStore) AckJob(ctx context.Context, jobID, leaseID string, success bool, errorMsg string) error {
+func (s *PostgresStore) AckJob(ctx context.Context, req AckRequest) (*AckResult, error) {
+	defer s.observe("ack", time.Now())
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := s.ackJobTx(ctx, tx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// AckJobsBatch acknowledges multiple jobs in a single transaction.
+// Lease mismatches and missing jobs are reported per job rather than failing the batch.
+func (s *PostgresStore) AckJobsBatch(ctx context.Context, acks []AckRequest) ([]AckResult, error) {
+	defer s.observe("ack_batch", time.Now())
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
+	results := make([]AckResult, 0, len(acks))
+	for _, ack := range acks {
+		result, err := s.ackJobTx(ctx, tx, ack)
+		if errors.Is(err, errInvalidLease) || errors.Is(err, sql.ErrNoRows) {
+			result = &AckResult{JobID: ack.JobID, Error: err.Error()}
+		} else if err != nil {
+			return nil, err
+		}
+
+		results = append(results, *result)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit batch ack: %w", err)
+	}
+
+	return results, nil
+}
+
+// ackJobTx applies a single ack or nack within an existing transaction
+func (s *PostgresStore) ackJobTx(ctx context.Context, tx *sql.Tx, req AckRequest) (*AckResult, error) {
 	// Verify lease
-	var currentLeaseID sql.NullString
-	var attempts, maxRetries int
-	err = tx.QueryRowContext(ctx, "SELECT lease_id, attempts, max_retries FROM jobs WHERE id = $1 FOR UPDATE", jobID).
-		Scan(&currentLeaseID, &attempts, &maxRetries)
+	var currentLeaseID, backoffStrategy, backoffSchedule, workflowID sql.NullString
+	var attempts, maxRetries, frontRequeues, deferrals, redeliveries int
+	var leaseEpoch int64
+	var backoffBase, backoffCap sql.NullInt64
+	var queue, jobType string
+	var createdAt time.Time
+	var deadline sql.NullTime
+	var failFastType bool
+	err := tx.QueryRowContext(ctx, `
+		SELECT lease_id, lease_epoch, attempts, max_retries, backoff_strategy, backoff_base_seconds, backoff_cap_seconds, backoff_schedule, front_requeues,
+		       deferrals, redeliveries, queue, type, created_at, workflow_id, deadline,
+		       EXISTS (SELECT 1 FROM fail_fast_types f WHERE f.type = jobs.type)
+		FROM jobs WHERE id = $1 FOR UPDATE
+	`, req.JobID).Scan(&currentLeaseID, &leaseEpoch, &attempts, &maxRetries, &backoffStrategy, &backoffBase, &backoffCap, &backoffSchedule, &frontRequeues,
+		&deferrals, &redeliveries, &queue, &jobType, &createdAt, &workflowID, &deadline, &failFastType)
 	if err != nil {
-		return fmt.Errorf("failed to get job: %w", err)
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+
+	if !currentLeaseID.Valid || currentLeaseID.String != req.LeaseID {
+		return nil, errInvalidLease
+	}
+	if req.LeaseEpoch == 0 && s.requireEpoch {
+		return nil, fmt.Errorf("%w: lease epoch required", errInvalidLease)
+	}
+	if req.LeaseEpoch != 0 && req.LeaseEpoch != leaseEpoch {
+		return nil, fmt.Errorf("%w: stale lease epoch %d (current %d)", errInvalidLease, req.LeaseEpoch, leaseEpoch)
+	}
+
+	result := &AckResult{JobID: req.JobID, Acknowledged: true, Queue: queue, Type: jobType, CreatedAt: createdAt}
+	var jobDeadline *time.Time
+	if deadline.Valid {
+		jobDeadline = &deadline.Time
 	}
 
-	if !currentLeaseID.Valid || currentLeaseID.String != leaseID {
-		return fmt.Errorf("invalid lease ID")
+	outcome := AttemptFailed
+	if req.Success {
+		outcome = AttemptSucceeded
+	}
+	if err := finishAttemptTx(ctx, tx, req.JobID, req.LeaseID, outcome, req.ErrorMessage); err != nil {
+		return nil, err
 	}
 
-	if success {
+	if req.Success {
 		// Mark as succeeded
+		result.Status = StatusSucceeded
+		result.SLAMet = slaOutcome(jobDeadline, result.Status, time.Now())
 		_, err = tx.ExecContext(ctx, `
 			UPDATE jobs
-			SET status = $1, lease_id = NULL, leased_at = NULL, leased_by = NULL, updated_at = NOW()
+			SET status = $1, lease_id = NULL, leased_at = NULL, leased_by = NULL,
+			    lease_expires_at = NULL, visible_until = NULL, sla_met = $3, updated_at = NOW()
 			WHERE id = $2
-		`, StatusSucceeded, jobID)
+		`, StatusSucceeded, req.JobID, nullBool(result.SLAMet))
 	} else {
 		// Increment attempts and decide retry or DLQ
-		attempts++
-		var newStatus JobStatus
+		permanentReason := req.permanentDeadReason()
+		permanent := permanentReason != ""
+		failFast := failFastType && !permanent
+		deferred := req.RetryAfter > 0 && !permanent && !failFast && deferrals < s.maxDeferrals
+		grace := req.Redelivery && !permanent && !deferred && redeliveries < s.graceRedeliveries
+		if !deferred && !grace {
+			attempts++
+		}
 		var runAt time.Time
+		boost := 0
 
-		if attempts >= maxRetries {
-			newStatus = StatusDead
+		switch {
+		case permanent:
+			result.Status = StatusDead
+			result.DeadReason = permanentReason
 			runAt = time.Now()
-		} else {
-			newStatus = StatusPending
-			// Exponential backoff: 2^attempts seconds
-			backoffSeconds := 1 << uint(attempts)
-			if backoffSeconds > 3600 {
-				backoffSeconds = 3600 // Cap at 1 hour
+		case deferred:
+			result.Status = StatusPending
+			deferrals++
+			delay := req.RetryAfter
+			if delay > s.maxRetryAfter {
+				delay = s.maxRetryAfter
+			}
+			runAt = time.Now().Add(delay)
+		case grace:
+			result.Status = StatusPending
+			redeliveries++
+			runAt = time.Now()
+		case attempts >= maxRetries:
+			result.Status = StatusDead
+			result.DeadReason = DeadReasonMaxRetries
+			runAt = time.Now()
+		case failFast:
+			result.Status = StatusDead
+			result.DeadReason = DeadReasonFailFast
+			runAt = time.Now()
+		case s.retryBudgetExhausted != nil && s.retryBudgetExhausted(queue):
+			result.Status = StatusDead
+			result.DeadReason = DeadReasonRetryBudget
+			runAt = time.Now()
+		case req.RequeueFront && frontRequeues < s.maxFrontRequeues:
+			result.Status = StatusPending
+			result.FrontRequeued = true
+			frontRequeues++
+			boost = frontRequeueBoost
+			runAt = time.Now()
+		default:
+			result.Status = StatusPending
+			if delay, ok := req.retryDelay(s.maxRetryAfter); ok {
+				runAt = time.Now().Add(delay)
+				break
+			}
+			schedule, err := unmarshalSchedule(backoffSchedule)
+			if err != nil {
+				return nil, err
+			}
+			var delay time.Duration
+			if len(schedule) > 0 {
+				delay = ScheduleDelay(schedule, attempts)
+			} else {
+				policy := s.backoff.WithJobOverrides(BackoffStrategy(backoffStrategy.String), int(backoffBase.Int64), int(backoffCap.Int64))
+				delay = policy.Delay(attempts)
+			}
+			if s.backoffMultiplier != nil {
+				delay = time.Duration(float64(delay) * s.backoffMultiplier(jobType))
 			}
-			runAt = time.Now().Add(time.Duration(backoffSeconds) * time.Second)
+			runAt = time.Now().Add(delay)
 		}
+		result.SLAMet = slaOutcome(jobDeadline, result.Status, time.Now())
 
 		_, err = tx.ExecContext(ctx, `
 			UPDATE jobs
-			SET status = $1, attempts = $2, last_error = $3, run_at = $4,
-			    lease_id = NULL, leased_at = NULL, leased_by = NULL, updated_at = NOW()
+			SET status = $1, attempts = $2, last_error = $3, run_at = $4, dead_reason = $6,
+			    dead_at = $9, sla_met = $10,
+			    front_requeues = $7, priority = priority + $8, priority_boost = priority_boost + $8,
+			    redeliveries = $11, deferrals = $12,
+			    lease_id = NULL, leased_at = NULL, leased_by = NULL,
+			    lease_expires_at = NULL, visible_until = NULL, updated_at = NOW()
 			WHERE id = $5
-		`, newStatus, attempts, errorMsg, runAt, jobID)
+		`, result.Status, attempts, req.ErrorMessage, runAt, req.JobID,
+			sql.NullString{String: string(result.DeadReason), Valid: result.DeadReason != ""},
+			frontRequeues, boost,
+			sql.NullTime{Time: runAt, Valid: result.Status == StatusDead}, nullBool(result.SLAMet), redeliveries, deferrals)
 	}
 
 	if err != nil {
-		return fmt.Errorf("failed to update job: %w", err)
+		return nil, fmt.Errorf("failed to update job: %w", err)
 	}
 
-	return tx.Commit()
+	// A finished workflow node may unblock its downstream nodes or fail the workflow
+	if workflowID.Valid && (result.Status == StatusSucceeded || result.Status == StatusDead) {
+		if err := advanceWorkflowTx(ctx, tx, workflowID.String); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
 }
 
-// GetPendingDelayedJobs retrieves jobs that are scheduled but not yet ready
-func (s *PostgresStore) GetPendingDelayedJobs(ctx context.Context, limit int) ([]*Job, error) {
-	query := `
-		SELECT id, type, payload, queue, priority, status, attempts, max_retries, run_at, created_at, updated_at
-		FROM jobs
-		WHERE status = $1 AND run_at <= $2
-		ORDER BY run_at ASC
-		LIMIT $3
-	`
+// ReclaimExpiredLeases returns leased and processing jobs whose lease or visibility timeout
+// has elapsed to the pending state, returning the IDs of all reclaimed jobs
+// and, separately, those that exhausted their retries and were dead-lettered.
+// A job's first visibility expiry is a silent re-queue that doesn't count as an
+// attempt, and so are its first SetGraceRedeliveries lease expiries, which
+// are counted as redeliveries instead; every other expiry is recorded as a
+// failure with normal backoff.
+func (s *PostgresStore) ReclaimExpiredLeases(ctx context.Context) ([]string, []string, error) {
+	defer s.observe("reclaim", time.Now())
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	// Close the attempts of every lease about to be reclaimed
+	_, err = tx.ExecContext(ctx, `
+		UPDATE job_attempts a
+		SET finished_at = $1, outcome = $2, error = 'lease expired'
+		FROM jobs j
+		WHERE a.job_id = j.id
+		  AND a.lease_id = j.lease_id
+		  AND a.finished_at IS NULL
+		  AND j.status IN ($3, $4)
+		  AND (j.lease_expires_at <= $1 OR j.visible_until <= $1)
+	`, now, AttemptExpired, StatusLeased, StatusProcessing)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to record expired attempts: %w", err)
+	}
+
+	// First visibility expiry: re-queue without touching attempts
+	requeued, err := queryIDs(ctx, tx, `
+		UPDATE jobs
+		SET status = $1, run_at = $2, visibility_requeued = TRUE,
+		    lease_id = NULL, leased_at = NULL, leased_by = NULL,
+		    lease_expires_at = NULL, visible_until = NULL, updated_at = $2
+		WHERE status IN ($3, $4)
+		  AND visible_until <= $2
+		  AND NOT visibility_requeued
+		RETURNING id
+	`, StatusPending, now, StatusLeased, StatusProcessing)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to requeue invisible jobs: %w", err)
+	}
+
+	// Expiries within the grace limit: redeliver right away without touching attempts
+	redelivered, err := queryIDs(ctx, tx, `
+		UPDATE jobs
+		SET status = $1, run_at = $2, redeliveries = redeliveries + 1, last_error = 'lease expired',
+		    lease_id = NULL, leased_at = NULL, leased_by = NULL,
+		    lease_expires_at = NULL, visible_until = NULL, updated_at = $2
+		WHERE status IN ($3, $4)
+		  AND (lease_expires_at <= $2 OR visible_until <= $2)
+		  AND redeliveries < $5
+		RETURNING id
+	`, StatusPending, now, StatusLeased, StatusProcessing, s.graceRedeliveries)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to redeliver expired jobs: %w", err)
+	}
+
+	baseSeconds := s.backoff.Base.Seconds()
+	if baseSeconds <= 0 {
+		baseSeconds = 1
+	}
 
-	rows, err := s.db.QueryContext(ctx, query, StatusPending, time.Now(), limit)
+	// Remaining expiries count as failed attempts
+	rows, err := tx.QueryContext(ctx, `
+		UPDATE jobs
+		SET attempts = attempts + 1,
+		    status = CASE WHEN attempts + 1 >= max_retries THEN $1 ELSE $2 END,
+		    dead_reason = CASE WHEN attempts + 1 >= max_retries THEN $5 END,
+		    dead_at = CASE WHEN attempts + 1 >= max_retries THEN $3 END,
+		    sla_met = CASE WHEN attempts + 1 >= max_retries AND deadline IS NOT NULL THEN FALSE ELSE sla_met END,
+		    run_at = CASE WHEN attempts + 1 >= max_retries THEN $3
+		                  WHEN backoff_schedule IS NOT NULL THEN $3 +
+		                      (backoff_schedule->>LEAST(attempts, jsonb_array_length(backoff_schedule) - 1))::int * INTERVAL '1 second'
+		                  ELSE $3 + GREATEST(LEAST(
+		                      CASE COALESCE(backoff_strategy, $8)
+		                          WHEN 'fixed' THEN COALESCE(backoff_base_seconds, $9)
+		                          WHEN 'linear' THEN COALESCE(backoff_base_seconds, $9) * (attempts + 1)
+		                          ELSE COALESCE(backoff_base_seconds, $9) * POWER(2, attempts + 1)
+		                      END,
+		                      COALESCE(backoff_cap_seconds, $7)), $6) * INTERVAL '1 second' END,
+		    last_error = 'lease expired',
+		    lease_id = NULL, leased_at = NULL, leased_by = NULL,
+		    lease_expires_at = NULL, visible_until = NULL, updated_at = $3
+		WHERE status IN ($4, $10)
+		  AND (lease_expires_at <= $3 OR visible_until <= $3)
+		RETURNING id, status, workflow_id
+	`, StatusDead, StatusPending, now, StatusLeased, DeadReasonExpired,
+		s.backoff.Min.Seconds(), s.backoff.Max.Seconds(), string(s.backoff.Strategy), baseSeconds, StatusProcessing)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query delayed jobs: %w", err)
+		return nil, nil, fmt.Errorf("failed to reclaim expired leases: %w", err)
 	}
 	defer rows.Close()
 
-	var jobs []*Job
+	reclaimed := append(requeued, redelivered...)
+	var dead, workflows []string
 	for rows.Next() {
-		var job Job
-		var payloadStr string
-
-		err := rows.Scan(&job.ID, &job.Type, &payloadStr, &job.Queue, &job.Priority,
-			&job.Status, &job.Attempts, &job.MaxRetries, &job.RunAt, &job.CreatedAt, &job.UpdatedAt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan job: %w", err)
+		var id string
+		var status JobStatus
+		var workflowID sql.NullString
+		if err := rows.Scan(&id, &status, &workflowID); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan reclaimed job: %w", err)
+		}
+		reclaimed = append(reclaimed, id)
+		if status == StatusDead {
+			dead = append(dead, id)
+			if workflowID.Valid {
+				workflows = append(workflows, workflowID.String)
+			}
 		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	rows.Close()
 
-		if err := json.Unmarshal([]byte(payloadStr), &job.Payload); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
+	for _, workflowID := range workflows {
+		if err := advanceWorkflowTx(ctx, tx, workflowID); err != nil {
+			return nil, nil, err
 		}
+	}
 
-		jobs = append(jobs, &job)
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit reclaim: %w", err)
 	}
 
-	return jobs, rows.Err()
+	return reclaimed, dead, nil
 }
 
-// MoveToReady marks a delayed job as ready to be processed
-func (s *PostgresStore) MoveToReady(ctx context.Context, jobID string) error {
-	_, err := s.db.ExecContext(ctx, `
-		UPDATE jobs
-		SET status = $1, updated_at = NOW()
-		WHERE id = $2 AND status = $3
-	`, StatusPending, jobID, StatusPending)
-	return err
+// queryIDs runs a query returning a single id column and collects the results
+func queryIDs(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
 }
 
 // GetQueueStats returns statistics for all queues
 func (s *PostgresStore) GetQueueStats(ctx context.Context) ([]QueueStats, error) {
+	defer s.observe("stats", time.Now())
 	query := `SELECT queue, status, count FROM queue_stats ORDER BY queue, status`
 
 	rows, err := s.db.QueryContext(ctx, query)
@@ -377,6 +1850,10 @@ func (s *PostgresStore) GetQueueStats(ctx context.Context) ([]QueueStats, error)
 
 	var stats []QueueStats
 	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		var stat QueueStats
 		if err := rows.Scan(&stat.Queue, &stat.Status, &stat.Count); err != nil {
 			return nil, fmt.Errorf("failed to scan stat: %w", err)
@@ -387,17 +1864,132 @@ func (s *PostgresStore) GetQueueStats(ctx context.Context) ([]QueueStats, error)
 	return stats, rows.Err()
 }
 
-// GetRecentJobs returns the most recently created jobs
-func (s *PostgresStore) GetRecentJobs(ctx context.Context, limit int) ([]*Job, error) {
+// ExpireJobs marks the queue's pending jobs whose deadline has passed as
+// expired, returning their IDs
+func (s *PostgresStore) ExpireJobs(ctx context.Context, queue string) ([]string, error) {
+	defer s.observe("expire", time.Now())
+	now := time.Now()
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE jobs
+		SET status = $1, sla_met = FALSE, updated_at = $2
+		WHERE queue = $3 AND status = $4 AND deadline <= $2
+		RETURNING id
+	`, StatusExpired, now, queue, StatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan expired job: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// AgeJobs raises the priority of jobs that have been due and untouched since
+// waitingSince by increment, capped at maxPriority, and returns how many were
+// raised. Bumping updated_at means each job ages at most once per period.
+func (s *PostgresStore) AgeJobs(ctx context.Context, increment, maxPriority int, waitingSince time.Time) (int64, error) {
+	defer s.observe("age", time.Now())
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE jobs
+		SET priority = LEAST(priority + $1, $2), updated_at = $3
+		WHERE status = $4
+		  AND priority < $2
+		  AND run_at <= $5
+		  AND updated_at <= $5
+	`, increment, maxPriority, time.Now(), StatusPending, waitingSince)
+	if err != nil {
+		return 0, fmt.Errorf("failed to age jobs: %w", err)
+	}
+
+	aged, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to age jobs: %w", err)
+	}
+	return aged, nil
+}
+
+// CountStuckJobs counts, per queue, the leased jobs held for longer than
+// ttlMultiple times their lease TTL. Queues without stuck jobs are omitted.
+func (s *PostgresStore) CountStuckJobs(ctx context.Context, ttlMultiple float64) (map[string]int, error) {
+	defer s.observe("stuck", time.Now())
+	query := `
+		SELECT queue, COUNT(*)
+		FROM jobs
+		WHERE status IN ($1, $2)
+		  AND leased_at IS NOT NULL AND lease_expires_at IS NOT NULL
+		  AND $3 - leased_at > (lease_expires_at - leased_at) * $4::float8
+		GROUP BY queue
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, StatusLeased, StatusProcessing, time.Now(), ttlMultiple)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count stuck jobs: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var queue string
+		var count int
+		if err := rows.Scan(&queue, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan stuck job count: %w", err)
+		}
+		counts[queue] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// CountInFlightByLease counts the jobs still leased or processing under each
+// of leaseIDs. Leases that no longer hold any job are left out.
+func (s *PostgresStore) CountInFlightByLease(ctx context.Context, leaseIDs []string) (map[string]int, error) {
+	defer s.observe("in_flight", time.Now())
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT lease_id, COUNT(*) FROM jobs
+		WHERE status IN ($1, $2) AND lease_id = ANY($3)
+		GROUP BY lease_id
+	`, StatusLeased, StatusProcessing, pq.Array(leaseIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count in-flight jobs: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var leaseID string
+		var count int
+		if err := rows.Scan(&leaseID, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan in-flight count: %w", err)
+		}
+		counts[leaseID] = count
+	}
+	return counts, rows.Err()
+}
+
+// GetRecentJobs returns the most recently created jobs. An empty kind matches all jobs.
+func (s *PostgresStore) GetRecentJobs(ctx context.Context, kind JobKind, limit int) ([]*Job, error) {
+	defer s.observe("recent_jobs", time.Now())
 	query := `
-		SELECT id, type, payload, queue, priority, status, attempts, max_retries,
+		SELECT id, type, payload, queue, priority - priority_boost, status, kind, attempts, max_retries,
 		       last_error, run_at, created_at, updated_at
 		FROM jobs
+		WHERE ($1 = '' OR kind = $1)
 		ORDER BY created_at DESC
-		LIMIT $1
+		LIMIT $2
 	`
 
-	rows, err := s.db.QueryContext(ctx, query, limit)
+	rows, err := s.db.QueryContext(ctx, query, string(kind), limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query recent jobs: %w", err)
 	}
@@ -405,12 +1997,71 @@ func (s *PostgresStore) GetRecentJobs(ctx context.Context, limit int) ([]*Job, e
 
 	var jobs []*Job
 	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		var job Job
 		var payloadStr string
 		var lastError sql.NullString
 
 		err := rows.Scan(&job.ID, &job.Type, &payloadStr, &job.Queue, &job.Priority,
-			&job.Status, &job.Attempts, &job.MaxRetries, &lastError,
+			&job.Status, &job.Kind, &job.Attempts, &job.MaxRetries, &lastError,
+			&job.RunAt, &job.CreatedAt, &job.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+
+		if err := json.Unmarshal([]byte(payloadStr), &job.Payload); err != nil {
+			if s.skipCorruptRow("recent_jobs", job.ID, err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
+		}
+
+		if lastError.Valid {
+			job.LastError = lastError.String
+		}
+
+		jobs = append(jobs, &job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// ListDeadJobs returns dead-lettered jobs, most recently updated first.
+// Empty queue or reason values match all jobs.
+func (s *PostgresStore) ListDeadJobs(ctx context.Context, queue string, reason DeadReason, limit int) ([]*Job, error) {
+	defer s.observe("dead_jobs", time.Now())
+	query := `
+		SELECT id, type, payload, queue, priority, status, kind, attempts, max_retries,
+		       last_error, dead_reason, run_at, created_at, updated_at
+		FROM jobs
+		WHERE status = $1
+		  AND ($2 = '' OR queue = $2)
+		  AND ($3 = '' OR dead_reason = $3)
+		ORDER BY updated_at DESC
+		LIMIT $4
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, StatusDead, queue, string(reason), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dead jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var job Job
+		var payloadStr string
+		var lastError, deadReason sql.NullString
+
+		err := rows.Scan(&job.ID, &job.Type, &payloadStr, &job.Queue, &job.Priority,
+			&job.Status, &job.Kind, &job.Attempts, &job.MaxRetries, &lastError, &deadReason,
 			&job.RunAt, &job.CreatedAt, &job.UpdatedAt)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan job: %w", err)
@@ -423,9 +2074,112 @@ func (s *PostgresStore) GetRecentJobs(ctx context.Context, limit int) ([]*Job, e
 		if lastError.Valid {
 			job.LastError = lastError.String
 		}
+		if deadReason.Valid {
+			job.DeadReason = DeadReason(deadReason.String)
+		}
 
 		jobs = append(jobs, &job)
 	}
 
 	return jobs, rows.Err()
 }
+
+// GetQueueConfig returns a queue's config, or nil if none has been set
+func (s *PostgresStore) GetQueueConfig(ctx context.Context, queue string) (*QueueConfig, error) {
+	row := s.db.QueryRowContext(ctx, `
+		SELECT queue, max_retries, backoff_strategy, backoff_base_seconds, backoff_cap_seconds, dead_retry, min_workers, scheduling, retry_budget_percent, updated_at
+		FROM queue_configs
+		WHERE queue = $1
+	`, queue)
+
+	cfg, err := scanQueueConfig(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get queue config: %w", err)
+	}
+	return cfg, nil
+}
+
+// ListQueueConfigs returns all queue configs ordered by queue name
+func (s *PostgresStore) ListQueueConfigs(ctx context.Context) ([]*QueueConfig, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT queue, max_retries, backoff_strategy, backoff_base_seconds, backoff_cap_seconds, dead_retry, min_workers, scheduling, retry_budget_percent, updated_at
+		FROM queue_configs
+		ORDER BY queue
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query queue configs: %w", err)
+	}
+	defer rows.Close()
+
+	var configs []*QueueConfig
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		cfg, err := scanQueueConfig(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan queue config: %w", err)
+		}
+		configs = append(configs, cfg)
+	}
+
+	return configs, rows.Err()
+}
+
+// SetQueueConfig creates or replaces a queue's config, setting cfg.UpdatedAt
+func (s *PostgresStore) SetQueueConfig(ctx context.Context, cfg *QueueConfig) error {
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO queue_configs (queue, max_retries, backoff_strategy, backoff_base_seconds, backoff_cap_seconds, dead_retry, min_workers, scheduling, retry_budget_percent, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW())
+		ON CONFLICT (queue) DO UPDATE
+		SET max_retries = EXCLUDED.max_retries,
+		    backoff_strategy = EXCLUDED.backoff_strategy,
+		    backoff_base_seconds = EXCLUDED.backoff_base_seconds,
+		    backoff_cap_seconds = EXCLUDED.backoff_cap_seconds,
+		    dead_retry = EXCLUDED.dead_retry,
+		    min_workers = EXCLUDED.min_workers,
+		    scheduling = EXCLUDED.scheduling,
+		    retry_budget_percent = EXCLUDED.retry_budget_percent,
+		    updated_at = NOW()
+		RETURNING updated_at
+	`, cfg.Queue,
+		sql.NullInt64{Int64: int64(cfg.MaxRetries), Valid: cfg.MaxRetries > 0},
+		sql.NullString{String: string(cfg.BackoffStrategy), Valid: cfg.BackoffStrategy != ""},
+		sql.NullInt64{Int64: int64(cfg.BackoffBaseSeconds), Valid: cfg.BackoffBaseSeconds > 0},
+		sql.NullInt64{Int64: int64(cfg.BackoffCapSeconds), Valid: cfg.BackoffCapSeconds > 0},
+		cfg.DeadRetry, cfg.MinWorkers,
+		sql.NullString{String: string(cfg.Scheduling), Valid: cfg.Scheduling != ""},
+		cfg.RetryBudgetPercent,
+	).Scan(&cfg.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to set queue config: %w", err)
+	}
+	return nil
+}
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanQueueConfig scans a queue_configs row selected in the standard column order
+func scanQueueConfig(row rowScanner) (*QueueConfig, error) {
+	var cfg QueueConfig
+	var maxRetries, backoffBase, backoffCap sql.NullInt64
+	var backoffStrategy, scheduling sql.NullString
+
+	if err := row.Scan(&cfg.Queue, &maxRetries, &backoffStrategy, &backoffBase, &backoffCap, &cfg.DeadRetry, &cfg.MinWorkers, &scheduling, &cfg.RetryBudgetPercent, &cfg.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	cfg.MaxRetries = int(maxRetries.Int64)
+	cfg.BackoffStrategy = BackoffStrategy(backoffStrategy.String)
+	cfg.BackoffBaseSeconds = int(backoffBase.Int64)
+	cfg.BackoffCapSeconds = int(backoffCap.Int64)
+	cfg.Scheduling = SchedulingMode(scheduling.String)
+	return &cfg, nil
+}
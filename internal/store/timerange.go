@@ -0,0 +1,91 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned by ParseJobCursor for a malformed cursor
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// JobCursor marks where a page of GetJobsByTimeRange ended: the creation
+// time and ID of its last job
+type JobCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// String encodes the cursor as an opaque token for API clients
+func (c JobCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.CreatedAt.UTC().Format(time.RFC3339Nano) + "," + c.ID))
+}
+
+// ParseJobCursor decodes a token produced by JobCursor.String
+func ParseJobCursor(token string) (*JobCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), ",")
+	if !ok || id == "" {
+		return nil, ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &JobCursor{CreatedAt: t, ID: id}, nil
+}
+
+// maxCreatedAt stands in for an open-ended upper bound on created_at
+var maxCreatedAt = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// GetJobsByTimeRange returns up to limit jobs created at or after from and
+// before to, newest first. A zero from or to leaves that end of the range
+// open. Callers page through the range by passing the cursor of each page's
+// last job as after; the query seeks straight to it on the (created_at, id)
+// index, so later pages cost the same as the first.
+func (s *PostgresStore) GetJobsByTimeRange(ctx context.Context, from, to time.Time, after *JobCursor, limit int) ([]*Job, error) {
+	// created_at has no time zone and is written in the server's, so bind
+	// the bounds in it rather than at whatever offset the caller passed
+	from = from.In(time.Local)
+	if to.IsZero() {
+		to = maxCreatedAt
+	}
+	to = to.In(time.Local)
+	cursorAt, cursorID := to, ""
+	if after != nil {
+		cursorAt, cursorID = after.CreatedAt, after.ID
+	}
+
+	// Without a cursor, (created_at, id) < (to, '') is just created_at < to,
+	// so both cases share one plan
+	query := `SELECT ` + jobColumns + ` FROM jobs
+		WHERE created_at >= $1 AND created_at < $2
+		  AND (created_at, id) < ($3, $4)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $5`
+
+	rows, err := s.db.QueryContext(ctx, query, from, to, cursorAt, cursorID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query jobs by time range: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
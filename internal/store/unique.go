@@ -0,0 +1,139 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// ErrInvalidUniqueBy is returned when a job's unique_by names a field that
+// is malformed or missing from the job
+var ErrInvalidUniqueBy = errors.New("invalid unique_by")
+
+// Field prefixes accepted in unique_by
+const (
+	uniquePayloadPrefix = "payload."
+	uniqueLabelPrefix   = "labels."
+)
+
+// ValidateUniqueBy checks that each unique_by field is "payload.<path>",
+// with a dot-separated path into the payload, or "labels.<key>"
+func ValidateUniqueBy(fields []string) error {
+	for _, field := range fields {
+		var rest string
+		switch {
+		case strings.HasPrefix(field, uniquePayloadPrefix):
+			rest = strings.TrimPrefix(field, uniquePayloadPrefix)
+		case strings.HasPrefix(field, uniqueLabelPrefix):
+			rest = strings.TrimPrefix(field, uniqueLabelPrefix)
+		default:
+			return fmt.Errorf("%w: field %q must start with payload. or labels.", ErrInvalidUniqueBy, field)
+		}
+		for _, part := range strings.Split(rest, ".") {
+			if part == "" {
+				return fmt.Errorf("%w: field %q has an empty name", ErrInvalidUniqueBy, field)
+			}
+		}
+	}
+	return nil
+}
+
+// uniqueKey returns the composite key of a job created from req: a hash of
+// its type and the canonical values of its unique_by fields, so at most one
+// active job of a type has each combination. Field order doesn't matter. It
+// returns "" when the request has no unique_by.
+func uniqueKey(req *CreateJobRequest, canonicalPayload []byte) (string, error) {
+	if len(req.UniqueBy) == 0 {
+		return "", nil
+	}
+	if err := ValidateUniqueBy(req.UniqueBy); err != nil {
+		return "", err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(canonicalPayload))
+	dec.UseNumber()
+	var payload interface{}
+	if err := dec.Decode(&payload); err != nil {
+		return "", fmt.Errorf("failed to decode payload: %w", err)
+	}
+
+	fields := append([]string(nil), req.UniqueBy...)
+	sort.Strings(fields)
+
+	key := []interface{}{req.Type}
+	for i, field := range fields {
+		if i > 0 && field == fields[i-1] {
+			continue
+		}
+
+		var value interface{}
+		if label, ok := strings.CutPrefix(field, uniqueLabelPrefix); ok {
+			v, ok := req.Labels[label]
+			if !ok {
+				return "", fmt.Errorf("%w: job has no label %q", ErrInvalidUniqueBy, label)
+			}
+			value = v
+		} else {
+			value = payload
+			for _, part := range strings.Split(strings.TrimPrefix(field, uniquePayloadPrefix), ".") {
+				obj, ok := value.(map[string]interface{})
+				if !ok {
+					return "", fmt.Errorf("%w: payload has no field %q", ErrInvalidUniqueBy, field)
+				}
+				if value, ok = obj[part]; !ok {
+					return "", fmt.Errorf("%w: payload has no field %q", ErrInvalidUniqueBy, field)
+				}
+			}
+		}
+		key = append(key, field, value)
+	}
+
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, key); err != nil {
+		return "", err
+	}
+	return hashCanonical(buf.Bytes()), nil
+}
+
+// findUniqueTx returns the ID of an active job with the given unique key, or
+// "" if there is none. Like findActiveTx it holds an advisory lock on the
+// key until the transaction ends, so of several concurrent enqueues sharing
+// a key only one creates a job.
+func (s *PostgresStore) findUniqueTx(ctx context.Context, tx *sql.Tx, key string) (string, error) {
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", "unique:"+key); err != nil {
+		return "", fmt.Errorf("failed to lock unique key: %w", err)
+	}
+
+	var id string
+	err := tx.QueryRowContext(ctx, `
+		SELECT id FROM jobs WHERE unique_key = $1 AND status = ANY($2) ORDER BY created_at LIMIT 1
+	`, key, pq.Array(activeStatuses)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up unique key: %w", err)
+	}
+	return id, nil
+}
+
+// findUniqueLocked returns the oldest active job with the given unique key, or nil
+func (s *InMemoryStore) findUniqueLocked(key string) *memJob {
+	var found *memJob
+	for _, m := range s.jobs {
+		if m.job.UniqueKey != key || !isActiveStatus(m.job.Status) {
+			continue
+		}
+		if found == nil || m.seq < found.seq {
+			found = m
+		}
+	}
+	return found
+}
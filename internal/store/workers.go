@@ -0,0 +1,102 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// WorkerInfo describes a worker in the heartbeat registry
+type WorkerInfo struct {
+	WorkerID string    `json:"worker_id"`
+	Weight   int       `json:"weight"`
+	Queues   []string  `json:"queues"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// RecordWorkerHeartbeat notes that workerID, with the given capacity weight,
+// just polled queue. Weights below 1 are recorded as 1.
+func (s *PostgresStore) RecordWorkerHeartbeat(ctx context.Context, workerID, queue string, weight int) error {
+	defer s.observe("heartbeat", time.Now())
+	if weight < 1 {
+		weight = 1
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO worker_heartbeats (worker_id, queue, last_seen, weight)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (worker_id, queue) DO UPDATE SET last_seen = EXCLUDED.last_seen, weight = EXCLUDED.weight
+	`, workerID, queue, time.Now(), weight)
+	if err != nil {
+		return fmt.Errorf("failed to record worker heartbeat: %w", err)
+	}
+	return nil
+}
+
+// CountHealthyWorkers returns how many workers have polled queue since the given time
+func (s *PostgresStore) CountHealthyWorkers(ctx context.Context, queue string, since time.Time) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM worker_heartbeats WHERE queue = $1 AND last_seen >= $2
+	`, queue, since).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count healthy workers: %w", err)
+	}
+	return count, nil
+}
+
+// HealthyWorkerCapacity returns the summed weight of the workers that have
+// polled queue since the given time
+func (s *PostgresStore) HealthyWorkerCapacity(ctx context.Context, queue string, since time.Time) (int, error) {
+	var capacity int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(weight), 0) FROM worker_heartbeats WHERE queue = $1 AND last_seen >= $2
+	`, queue, since).Scan(&capacity)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum healthy worker capacity: %w", err)
+	}
+	return capacity, nil
+}
+
+// ListWorkers returns the workers that have polled any queue since the given
+// time, with their most recently reported weight
+func (s *PostgresStore) ListWorkers(ctx context.Context, since time.Time) ([]*WorkerInfo, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT worker_id,
+		       (ARRAY_AGG(weight ORDER BY last_seen DESC))[1],
+		       ARRAY_AGG(queue ORDER BY queue),
+		       MAX(last_seen)
+		FROM worker_heartbeats
+		WHERE last_seen >= $1
+		GROUP BY worker_id
+		ORDER BY worker_id
+	`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workers: %w", err)
+	}
+	defer rows.Close()
+
+	workers := []*WorkerInfo{}
+	for rows.Next() {
+		var w WorkerInfo
+		if err := rows.Scan(&w.WorkerID, &w.Weight, pq.Array(&w.Queues), &w.LastSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan worker: %w", err)
+		}
+		workers = append(workers, &w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list workers: %w", err)
+	}
+	return workers, nil
+}
+
+// PruneWorkerHeartbeats forgets workers that haven't polled since before and
+// returns how many were removed
+func (s *PostgresStore) PruneWorkerHeartbeats(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM worker_heartbeats WHERE last_seen < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune worker heartbeats: %w", err)
+	}
+	return result.RowsAffected()
+}
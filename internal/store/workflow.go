@@ -0,0 +1,504 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// WorkflowStatus is the overall state of a workflow
+type WorkflowStatus string
+
+const (
+	WorkflowRunning   WorkflowStatus = "running"
+	WorkflowSucceeded WorkflowStatus = "succeeded"
+	WorkflowFailed    WorkflowStatus = "failed"
+)
+
+// WorkflowFailurePolicy decides what happens to the rest of a workflow when
+// one of its nodes goes dead
+type WorkflowFailurePolicy string
+
+const (
+	// WorkflowFailFast fails the workflow as soon as any node goes dead and
+	// cancels every node still waiting on its upstreams. Nodes already
+	// pending or running are left to finish.
+	WorkflowFailFast WorkflowFailurePolicy = "fail_fast"
+	// WorkflowContinue cancels only the dead node's descendants; independent
+	// branches run to completion before the workflow is marked failed
+	WorkflowContinue WorkflowFailurePolicy = "continue"
+)
+
+// MaxWorkflowNodes caps the number of nodes in a single workflow
+const MaxWorkflowNodes = 100
+
+var (
+	// ErrWorkflowNotFound is returned by GetWorkflow for an unknown workflow ID
+	ErrWorkflowNotFound = errors.New("workflow not found")
+	// ErrInvalidWorkflow is returned for a malformed workflow, such as one
+	// with a cycle or a dependency on an unknown node
+	ErrInvalidWorkflow = errors.New("invalid workflow")
+)
+
+// WorkflowNodeRequest is one node of a CreateWorkflowRequest: the job to run
+// and the names of the nodes that must succeed before it starts
+type WorkflowNodeRequest struct {
+	Name      string           `json:"name"`
+	DependsOn []string         `json:"depends_on,omitempty"`
+	Job       CreateJobRequest `json:"job"`
+}
+
+// CreateWorkflowRequest describes a DAG of jobs
+type CreateWorkflowRequest struct {
+	FailurePolicy WorkflowFailurePolicy `json:"failure_policy,omitempty"`
+	Nodes         []WorkflowNodeRequest `json:"nodes"`
+}
+
+// Workflow is a DAG of jobs and the state of each node
+type Workflow struct {
+	ID            string                `json:"id"`
+	Status        WorkflowStatus        `json:"status"`
+	FailurePolicy WorkflowFailurePolicy `json:"failure_policy"`
+	CreatedAt     time.Time             `json:"created_at"`
+	UpdatedAt     time.Time             `json:"updated_at"`
+	FinishedAt    *time.Time            `json:"finished_at,omitempty"`
+	Nodes         []*WorkflowNode       `json:"nodes"`
+}
+
+// WorkflowNode is a node of a workflow and the current state of its job
+type WorkflowNode struct {
+	Name      string    `json:"name"`
+	DependsOn []string  `json:"depends_on"`
+	JobID     string    `json:"job_id"`
+	Status    JobStatus `json:"status"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// ValidateWorkflow checks a workflow's shape: a known failure policy, unique
+// node names, dependencies on known nodes and no cycles. Job options that
+// could make a node's job something other than a fresh job of its own
+// (idempotency keys, enqueue-if-absent, inline execution) aren't supported,
+// nor are deadlines and dead-letter retries, which would let a node expire
+// while blocked or come back after the workflow has finished.
+func ValidateWorkflow(req *CreateWorkflowRequest) error {
+	switch req.FailurePolicy {
+	case "", WorkflowFailFast, WorkflowContinue:
+	default:
+		return fmt.Errorf("%w: unknown failure_policy %q", ErrInvalidWorkflow, req.FailurePolicy)
+	}
+	if len(req.Nodes) == 0 {
+		return fmt.Errorf("%w: nodes must not be empty", ErrInvalidWorkflow)
+	}
+	if len(req.Nodes) > MaxWorkflowNodes {
+		return fmt.Errorf("%w: at most %d nodes are allowed, got %d", ErrInvalidWorkflow, MaxWorkflowNodes, len(req.Nodes))
+	}
+
+	names := make(map[string]bool, len(req.Nodes))
+	for _, node := range req.Nodes {
+		if node.Name == "" {
+			return fmt.Errorf("%w: node name is required", ErrInvalidWorkflow)
+		}
+		if names[node.Name] {
+			return fmt.Errorf("%w: duplicate node name %q", ErrInvalidWorkflow, node.Name)
+		}
+		names[node.Name] = true
+
+		job := node.Job
+		switch {
+		case job.IdempotencyKey != "":
+			return fmt.Errorf("%w: node %q: idempotency_key is not supported in workflows", ErrInvalidWorkflow, node.Name)
+		case job.EnqueueIfAbsent:
+			return fmt.Errorf("%w: node %q: enqueue_if_absent is not supported in workflows", ErrInvalidWorkflow, node.Name)
+		case len(job.UniqueBy) > 0:
+			return fmt.Errorf("%w: node %q: unique_by is not supported in workflows", ErrInvalidWorkflow, node.Name)
+		case job.Inline:
+			return fmt.Errorf("%w: node %q: inline is not supported in workflows", ErrInvalidWorkflow, node.Name)
+		case job.Deadline != nil:
+			return fmt.Errorf("%w: node %q: deadline is not supported in workflows", ErrInvalidWorkflow, node.Name)
+		case job.RunAt != nil:
+			return fmt.Errorf("%w: node %q: run_at is not supported in workflows", ErrInvalidWorkflow, node.Name)
+		case job.DeadRetry:
+			return fmt.Errorf("%w: node %q: dead_retry is not supported in workflows", ErrInvalidWorkflow, node.Name)
+		case job.ScheduleCalendar != "":
+			return fmt.Errorf("%w: node %q: schedule_calendar is not supported in workflows", ErrInvalidWorkflow, node.Name)
+		}
+	}
+
+	// Kahn's algorithm: repeatedly take nodes with no unvisited upstreams;
+	// anything left over is part of a cycle
+	upstreams := make(map[string]map[string]bool, len(req.Nodes))
+	downstreams := make(map[string][]string, len(req.Nodes))
+	for _, node := range req.Nodes {
+		upstreams[node.Name] = make(map[string]bool, len(node.DependsOn))
+		for _, dep := range node.DependsOn {
+			if !names[dep] {
+				return fmt.Errorf("%w: node %q depends on unknown node %q", ErrInvalidWorkflow, node.Name, dep)
+			}
+			if !upstreams[node.Name][dep] {
+				upstreams[node.Name][dep] = true
+				downstreams[dep] = append(downstreams[dep], node.Name)
+			}
+		}
+	}
+
+	var ready []string
+	for _, node := range req.Nodes {
+		if len(upstreams[node.Name]) == 0 {
+			ready = append(ready, node.Name)
+		}
+	}
+	visited := 0
+	for len(ready) > 0 {
+		name := ready[0]
+		ready = ready[1:]
+		visited++
+		for _, down := range downstreams[name] {
+			delete(upstreams[down], name)
+			if len(upstreams[down]) == 0 {
+				ready = append(ready, down)
+			}
+		}
+	}
+	if visited < len(req.Nodes) {
+		return fmt.Errorf("%w: dependencies form a cycle", ErrInvalidWorkflow)
+	}
+	return nil
+}
+
+// CreateWorkflow validates the workflow and creates a job for every node in
+// a single transaction. Nodes without dependencies are enqueued as pending
+// right away; the rest are created blocked and are released by
+// advanceWorkflowTx as their upstreams succeed.
+func (s *PostgresStore) CreateWorkflow(ctx context.Context, req *CreateWorkflowRequest) (*Workflow, error) {
+	if err := ValidateWorkflow(req); err != nil {
+		return nil, err
+	}
+	policy := req.FailurePolicy
+	if policy == "" {
+		policy = WorkflowFailFast
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	wf := &Workflow{
+		ID:            uuid.New().String(),
+		Status:        WorkflowRunning,
+		FailurePolicy: policy,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		Nodes:         make([]*WorkflowNode, 0, len(req.Nodes)),
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO workflows (id, status, failure_policy, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $4)
+	`, wf.ID, wf.Status, wf.FailurePolicy, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workflow: %w", err)
+	}
+
+	for i := range req.Nodes {
+		node := &req.Nodes[i]
+		job, err := s.createJobTx(ctx, tx, &node.Job)
+		if err != nil {
+			return nil, fmt.Errorf("node %q: %w", node.Name, err)
+		}
+
+		status := StatusPending
+		if len(node.DependsOn) > 0 {
+			status = StatusBlocked
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE jobs SET workflow_id = $1, status = $2 WHERE id = $3`, wf.ID, status, job.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to attach job to workflow: %w", err)
+		}
+
+		dependsOn := node.DependsOn
+		if dependsOn == nil {
+			dependsOn = []string{}
+		}
+		dependsOnJSON, err := marshalStrings(dependsOn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal depends_on: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO workflow_nodes (workflow_id, name, job_id, depends_on)
+			VALUES ($1, $2, $3, $4)
+		`, wf.ID, node.Name, job.ID, dependsOnJSON)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create workflow node: %w", err)
+		}
+
+		wf.Nodes = append(wf.Nodes, &WorkflowNode{
+			Name:      node.Name,
+			DependsOn: dependsOn,
+			JobID:     job.ID,
+			Status:    status,
+		})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit workflow: %w", err)
+	}
+	return wf, nil
+}
+
+// GetWorkflow returns a workflow with the current status of each node
+func (s *PostgresStore) GetWorkflow(ctx context.Context, id string) (*Workflow, error) {
+	var wf Workflow
+	var finishedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, status, failure_policy, created_at, updated_at, finished_at
+		FROM workflows WHERE id = $1
+	`, id).Scan(&wf.ID, &wf.Status, &wf.FailurePolicy, &wf.CreatedAt, &wf.UpdatedAt, &finishedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrWorkflowNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workflow: %w", err)
+	}
+	if finishedAt.Valid {
+		wf.FinishedAt = &finishedAt.Time
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT n.name, n.depends_on, n.job_id, j.status, j.attempts, j.last_error
+		FROM workflow_nodes n
+		JOIN jobs j ON j.id = n.job_id
+		WHERE n.workflow_id = $1
+		ORDER BY j.created_at, n.name
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workflow nodes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var node WorkflowNode
+		var dependsOn string
+		var lastError sql.NullString
+		if err := rows.Scan(&node.Name, &dependsOn, &node.JobID, &node.Status, &node.Attempts, &lastError); err != nil {
+			return nil, fmt.Errorf("failed to scan workflow node: %w", err)
+		}
+		if err := json.Unmarshal([]byte(dependsOn), &node.DependsOn); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal depends_on: %w", err)
+		}
+		node.LastError = lastError.String
+		wf.Nodes = append(wf.Nodes, &node)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &wf, nil
+}
+
+// workflowNodeState is a node's dependencies and job status as seen by
+// advanceWorkflowTx
+type workflowNodeState struct {
+	jobID     string
+	dependsOn []string
+	status    JobStatus
+}
+
+// nodeFailed reports whether a node's job finished without succeeding
+func nodeFailed(status JobStatus) bool {
+	return status == StatusDead || status == StatusExpired || status == StatusCancelled
+}
+
+// advanceWorkflowTx moves a running workflow forward after one of its jobs
+// finished: blocked nodes whose upstreams have all succeeded become pending,
+// nodes that can no longer run are cancelled according to the failure
+// policy, and the workflow is marked finished once nothing is left to do.
+// The workflow row is locked so concurrent acks of sibling nodes are applied
+// one at a time.
+func advanceWorkflowTx(ctx context.Context, tx *sql.Tx, workflowID string) error {
+	var status WorkflowStatus
+	var policy WorkflowFailurePolicy
+	err := tx.QueryRowContext(ctx, `
+		SELECT status, failure_policy FROM workflows WHERE id = $1 FOR UPDATE
+	`, workflowID).Scan(&status, &policy)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock workflow: %w", err)
+	}
+	if status != WorkflowRunning {
+		return nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT n.name, n.depends_on, n.job_id, j.status
+		FROM workflow_nodes n
+		JOIN jobs j ON j.id = n.job_id
+		WHERE n.workflow_id = $1
+	`, workflowID)
+	if err != nil {
+		return fmt.Errorf("failed to get workflow nodes: %w", err)
+	}
+	nodes := make(map[string]*workflowNodeState)
+	for rows.Next() {
+		var name, dependsOn string
+		node := &workflowNodeState{}
+		if err := rows.Scan(&name, &dependsOn, &node.jobID, &node.status); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan workflow node: %w", err)
+		}
+		if err := json.Unmarshal([]byte(dependsOn), &node.dependsOn); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to unmarshal depends_on: %w", err)
+		}
+		nodes[name] = node
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return err
+	}
+	rows.Close()
+
+	plan := planWorkflowAdvance(policy, nodes)
+
+	now := time.Now()
+	if len(plan.unblock) > 0 {
+		// Delays count from the moment a node is released, not from when
+		// the workflow was created
+		_, err = tx.ExecContext(ctx, `
+			UPDATE jobs
+			SET status = $1, run_at = $2 + (run_at - created_at), updated_at = $2
+			WHERE id = ANY($3) AND status = $4
+		`, StatusPending, now, pq.Array(plan.unblock), StatusBlocked)
+		if err != nil {
+			return fmt.Errorf("failed to unblock workflow nodes: %w", err)
+		}
+	}
+	for jobID, reason := range plan.cancelled {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE jobs SET status = $1, last_error = $2, updated_at = $3
+			WHERE id = $4 AND status = $5
+		`, StatusCancelled, reason, now, jobID, StatusBlocked)
+		if err != nil {
+			return fmt.Errorf("failed to cancel workflow node: %w", err)
+		}
+	}
+
+	if plan.status == WorkflowRunning {
+		_, err = tx.ExecContext(ctx, `UPDATE workflows SET updated_at = $1 WHERE id = $2`, now, workflowID)
+		if err != nil {
+			return fmt.Errorf("failed to update workflow: %w", err)
+		}
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE workflows SET status = $1, updated_at = $2, finished_at = $2 WHERE id = $3
+	`, plan.status, now, workflowID)
+	if err != nil {
+		return fmt.Errorf("failed to finish workflow: %w", err)
+	}
+	return nil
+}
+
+// workflowAdvance is what planWorkflowAdvance decided for a workflow: the
+// blocked jobs to release, the blocked jobs to cancel with their reasons, and
+// the workflow's status afterwards
+type workflowAdvance struct {
+	unblock   []string
+	cancelled map[string]string
+	status    WorkflowStatus
+}
+
+// planWorkflowAdvance works out how a running workflow moves forward from
+// its nodes' current job statuses, updating those statuses as it goes. It is
+// shared by the stores so they settle workflows the same way.
+func planWorkflowAdvance(policy WorkflowFailurePolicy, nodes map[string]*workflowNodeState) workflowAdvance {
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	failedNode := ""
+	for _, name := range names {
+		if status := nodes[name].status; status == StatusDead || status == StatusExpired {
+			failedNode = name
+			break
+		}
+	}
+
+	plan := workflowAdvance{cancelled: make(map[string]string), status: WorkflowRunning}
+	if failedNode != "" && policy == WorkflowFailFast {
+		for _, name := range names {
+			if node := nodes[name]; node.status == StatusBlocked {
+				node.status = StatusCancelled
+				plan.cancelled[node.jobID] = fmt.Sprintf("cancelled: workflow node %q failed", failedNode)
+			}
+		}
+	} else {
+		// Settle blocked nodes until nothing changes, so a cancellation
+		// cascades through every descendant in one pass
+		for changed := true; changed; {
+			changed = false
+			for _, name := range names {
+				node := nodes[name]
+				if node.status != StatusBlocked {
+					continue
+				}
+				ready := true
+				failedDep := ""
+				for _, dep := range node.dependsOn {
+					depStatus := nodes[dep].status
+					if depStatus != StatusSucceeded {
+						ready = false
+					}
+					if nodeFailed(depStatus) {
+						failedDep = dep
+						break
+					}
+				}
+				switch {
+				case failedDep != "":
+					node.status = StatusCancelled
+					plan.cancelled[node.jobID] = fmt.Sprintf("cancelled: upstream node %q did not succeed", failedDep)
+					changed = true
+				case ready:
+					node.status = StatusPending
+					plan.unblock = append(plan.unblock, node.jobID)
+					changed = true
+				}
+			}
+		}
+	}
+
+	finished, succeeded := true, true
+	for _, node := range nodes {
+		switch {
+		case node.status == StatusSucceeded:
+		case nodeFailed(node.status):
+			succeeded = false
+		default:
+			finished = false
+		}
+	}
+
+	switch {
+	case failedNode != "" && policy == WorkflowFailFast:
+		plan.status = WorkflowFailed
+	case finished && succeeded:
+		plan.status = WorkflowSucceeded
+	case finished:
+		plan.status = WorkflowFailed
+	}
+	return plan
+}
@@ -0,0 +1,101 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	pb "github.com/goquorra/goquorra/internal/grpc"
+)
+
+// ackBatcher accumulates job acks and nacks and flushes them to the server
+// in batches, either when a batch fills up or when the flush interval elapses
+type ackBatcher struct {
+	client   pb.WorkerServiceClient
+	logger   *log.Logger
+	size     int
+	interval time.Duration
+
+	mu    sync.Mutex
+	acks  []*pb.JobAck
+	nacks []*pb.JobAck
+}
+
+func newAckBatcher(client pb.WorkerServiceClient, size int, interval time.Duration, logger *log.Logger) *ackBatcher {
+	return &ackBatcher{
+		client:   client,
+		logger:   logger,
+		size:     size,
+		interval: interval,
+	}
+}
+
+// add queues an ack or nack, flushing immediately if the batch is full
+func (b *ackBatcher) add(ack *pb.JobAck) {
+	b.mu.Lock()
+	if ack.Success {
+		b.acks = append(b.acks, ack)
+	} else {
+		b.nacks = append(b.nacks, ack)
+	}
+	full := len(b.acks) >= b.size || len(b.nacks) >= b.size
+	b.mu.Unlock()
+
+	if full {
+		b.flush(context.Background())
+	}
+}
+
+// run flushes pending acks on every interval until ctx is cancelled,
+// then performs a final flush so no acknowledgements are lost on shutdown
+func (b *ackBatcher) run(ctx context.Context) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			b.flush(context.Background())
+			return
+		case <-ticker.C:
+			b.flush(ctx)
+		}
+	}
+}
+
+// flush sends all pending acks and nacks to the server
+func (b *ackBatcher) flush(ctx context.Context) {
+	b.mu.Lock()
+	acks, nacks := b.acks, b.nacks
+	b.acks, b.nacks = nil, nil
+	b.mu.Unlock()
+
+	if len(acks) > 0 {
+		resp, err := b.client.AckJobs(ctx, &pb.BatchAck{Acks: acks})
+		if err != nil {
+			b.logger.Printf("Failed to ack batch of %d jobs: %v", len(acks), err)
+		} else {
+			b.logResults(resp, "completed successfully")
+		}
+	}
+
+	if len(nacks) > 0 {
+		resp, err := b.client.NackJobs(ctx, &pb.BatchNack{Nacks: nacks})
+		if err != nil {
+			b.logger.Printf("Failed to nack batch of %d jobs: %v", len(nacks), err)
+		} else {
+			b.logResults(resp, "failure recorded")
+		}
+	}
+}
+
+func (b *ackBatcher) logResults(resp *pb.BatchAckResponse, outcome string) {
+	for _, result := range resp.Results {
+		if result.Acknowledged {
+			b.logger.Printf("Job %s %s", result.JobId, outcome)
+		} else {
+			b.logger.Printf("Job %s not acknowledged: %s", result.JobId, result.Message)
+		}
+	}
+}
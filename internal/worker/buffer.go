@@ -0,0 +1,148 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/goquorra/goquorra/internal/grpc"
+)
+
+// BufferedJob is a leased job the worker hasn't started yet
+type BufferedJob struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Queue      string    `json:"queue"`
+	LeaseID    string    `json:"lease_id"`
+	BufferedAt time.Time `json:"buffered_at"`
+}
+
+// jobBuffer holds jobs between being received from a lease and starting to
+// run, including while their payload is fetched. Whoever removes a job from
+// it owns it: processJob by claiming it, or ReleaseBuffered by returning it
+// to the server.
+type jobBuffer struct {
+	mu   sync.Mutex
+	jobs map[string]*bufferedJob
+}
+
+type bufferedJob struct {
+	job        *pb.Job
+	queue      string
+	bufferedAt time.Time
+}
+
+func newJobBuffer() *jobBuffer {
+	return &jobBuffer{jobs: make(map[string]*bufferedJob)}
+}
+
+func (b *jobBuffer) add(job *pb.Job, queue string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.jobs[job.Id] = &bufferedJob{job: job, queue: queue, bufferedAt: time.Now()}
+}
+
+// claim removes a job so it can start, reporting false if it was released
+func (b *jobBuffer) claim(jobID string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.jobs[jobID]; !ok {
+		return false
+	}
+	delete(b.jobs, jobID)
+	return true
+}
+
+// takeAll removes and returns every buffered job
+func (b *jobBuffer) takeAll() []*bufferedJob {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	jobs := make([]*bufferedJob, 0, len(b.jobs))
+	for id, j := range b.jobs {
+		jobs = append(jobs, j)
+		delete(b.jobs, id)
+	}
+	return jobs
+}
+
+// BufferedJobs lists the leased jobs the worker hasn't started, oldest first
+func (w *Worker) BufferedJobs() []BufferedJob {
+	w.buffer.mu.Lock()
+	defer w.buffer.mu.Unlock()
+
+	jobs := make([]BufferedJob, 0, len(w.buffer.jobs))
+	for _, j := range w.buffer.jobs {
+		jobs = append(jobs, BufferedJob{
+			ID:         j.job.Id,
+			Type:       j.job.Type,
+			Queue:      j.queue,
+			LeaseID:    j.job.LeaseId,
+			BufferedAt: j.bufferedAt,
+		})
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].BufferedAt.Before(jobs[k].BufferedAt) })
+	return jobs
+}
+
+// ReleaseBuffered returns every buffered job to the server so other workers
+// can lease it. Jobs are nacked with Release set, which the server doesn't
+// count as an attempt. It returns the IDs of the released
+// jobs and of those whose nack failed; the latter are reclaimed once their
+// lease expires.
+func (w *Worker) ReleaseBuffered(ctx context.Context) (released, failed []string) {
+	for _, j := range w.buffer.takeAll() {
+		_, err := w.client.NackJob(ctx, &pb.JobAck{
+			JobId:      j.job.Id,
+			WorkerId:   w.id,
+			LeaseId:    j.job.LeaseId,
+			LeaseEpoch: j.job.LeaseEpoch,
+			Success:    false,
+			Release:    true,
+		})
+		if err != nil {
+			w.logger.Printf("Failed to release buffered job %s: %v", j.job.Id, err)
+			failed = append(failed, j.job.Id)
+			continue
+		}
+		w.logger.Printf("Released buffered job %s", j.job.Id)
+		released = append(released, j.job.Id)
+	}
+	return released, failed
+}
+
+// RegisterBufferHandlers adds the worker's buffer debug endpoints to mux:
+// GET /buffer lists buffered jobs and POST /drain releases them
+func (w *Worker) RegisterBufferHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/buffer", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			rw.Header().Set("Allow", http.MethodGet)
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		jobs := w.BufferedJobs()
+		writeJSON(rw, map[string]interface{}{"jobs": jobs, "count": len(jobs)})
+	})
+	mux.HandleFunc("/drain", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			rw.Header().Set("Allow", http.MethodPost)
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		released, failed := w.ReleaseBuffered(r.Context())
+		if released == nil {
+			released = []string{}
+		}
+		if failed == nil {
+			failed = []string{}
+		}
+		writeJSON(rw, map[string]interface{}{"released": released, "failed": failed})
+	})
+}
+
+func writeJSON(rw http.ResponseWriter, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(v)
+}
@@ -0,0 +1,54 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	pb "github.com/goquorra/goquorra/internal/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// drainCheckInterval is how often the worker heartbeats to learn whether it
+// has been asked to drain
+const drainCheckInterval = 10 * time.Second
+
+// watchDrain heartbeats the server until it asks this worker to drain, then
+// starts draining so the worker stops leasing and exits once its in-flight
+// jobs finish
+func (w *Worker) watchDrain(ctx context.Context) {
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+
+	req := &pb.HeartbeatRequest{WorkerId: w.id, StartedAt: timestamppb.New(w.startedAt)}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			resp, err := w.client.Heartbeat(ctx, req)
+			if status.Code(err) == codes.Unimplemented {
+				w.logger.Printf("Server doesn't support heartbeats; worker %s can't be drained remotely", w.id)
+				return
+			}
+			if err != nil {
+				w.logger.Printf("Heartbeat failed: %v", err)
+				continue
+			}
+			if resp.Draining {
+				w.startDrain("asked to drain")
+				return
+			}
+		}
+	}
+}
+
+// drain waits for the queue pollers to stop and then for every job they
+// leased to finish
+func (w *Worker) drain() {
+	w.pollers.Wait()
+	w.logger.Printf("Worker %s draining: waiting for in-flight jobs", w.id)
+	w.inFlight.Wait()
+	w.logger.Printf("Worker %s drained", w.id)
+}
@@ -0,0 +1,56 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	pb "github.com/goquorra/goquorra/internal/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// healthCheckInterval is how often the worker checks the server's gRPC
+// health before leasing
+const healthCheckInterval = 5 * time.Second
+
+// watchServerHealth checks the server with the standard gRPC health
+// protocol and pauses leasing while it reports anything but SERVING, such
+// as while its database is down or it is shutting down. Servers without the
+// health service are assumed healthy.
+func (w *Worker) watchServerHealth(ctx context.Context) {
+	client := healthpb.NewHealthClient(w.conn)
+	req := &healthpb.HealthCheckRequest{Service: pb.HealthServiceName}
+
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		resp, err := client.Check(ctx, req)
+		switch {
+		case status.Code(err) == codes.Unimplemented:
+			w.logger.Printf("Server doesn't support gRPC health checks; worker %s leases without them", w.id)
+			w.serverUnhealthy.Store(false)
+			return
+		case err != nil:
+			// Lease failures already surface connection problems
+			if ctx.Err() == nil {
+				w.logger.Printf("Health check failed: %v", err)
+			}
+		default:
+			serving := resp.GetStatus() == healthpb.HealthCheckResponse_SERVING
+			if wasUnhealthy := w.serverUnhealthy.Swap(!serving); wasUnhealthy == serving {
+				if serving {
+					w.logger.Printf("Server is serving again; worker %s resumes leasing", w.id)
+				} else {
+					w.logger.Printf("Server reports %s; worker %s pauses leasing", resp.GetStatus(), w.id)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
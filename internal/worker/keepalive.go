@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	pb "github.com/goquorra/goquorra/internal/grpc"
+)
+
+// DefaultMaxLeaseDuration caps how long the worker keeps renewing a single
+// job's lease by default
+const DefaultMaxLeaseDuration = time.Hour
+
+// startKeepAlive renews job's lease in the background until the returned
+// stop function is called, so long-running jobs aren't reclaimed while the
+// worker is still healthy. It is a no-op when keepalives are disabled.
+func (w *Worker) startKeepAlive(job *pb.Job) (stop func()) {
+	if w.keepAliveInterval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go w.keepAlive(job, done)
+	return func() { close(done) }
+}
+
+// keepAlive sends a RenewLease every keepAliveInterval until done is closed.
+// Once the job has been held for maxLeaseDuration it stops renewing, so a
+// genuinely stuck job still expires and gets reclaimed.
+func (w *Worker) keepAlive(job *pb.Job, done <-chan struct{}) {
+	ticker := time.NewTicker(w.keepAliveInterval)
+	defer ticker.Stop()
+
+	var giveUp <-chan time.Time
+	if w.maxLeaseDuration > 0 {
+		timer := time.NewTimer(w.maxLeaseDuration)
+		defer timer.Stop()
+		giveUp = timer.C
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-giveUp:
+			w.logger.Printf("Job %s has held its lease for %v, no longer renewing it", job.Id, w.maxLeaseDuration)
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), w.keepAliveInterval)
+			_, err := w.client.RenewLease(ctx, &pb.RenewLeaseRequest{
+				JobId:           job.Id,
+				WorkerId:        w.id,
+				LeaseId:         job.LeaseId,
+				LeaseEpoch:      job.LeaseEpoch,
+				LeaseTtlSeconds: int32(w.leaseTTL.Seconds()),
+			})
+			cancel()
+			if err != nil {
+				// Keep trying: a transient failure shouldn't let the lease lapse
+				w.logger.Printf("Failed to renew lease for job %s: %v", job.Id, err)
+			}
+		}
+	}
+}
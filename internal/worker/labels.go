@@ -0,0 +1,30 @@
+package worker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseLabelFilter parses a comma-separated list of "key=value" labels,
+// e.g. "region=eu,tier=gold". It returns nil for an empty string.
+func ParseLabelFilter(s string) (map[string]string, error) {
+	var filter map[string]string
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(part, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label filter %q: expected key=value", part)
+		}
+
+		if filter == nil {
+			filter = make(map[string]string)
+		}
+		filter[key] = strings.TrimSpace(value)
+	}
+	return filter, nil
+}
@@ -0,0 +1,44 @@
+package worker
+
+import "fmt"
+
+// reserveLifetimeJobs reserves up to n of the jobs the worker may still
+// lease under MaxLifetimeJobs, returning how many it got. Reserving before
+// leasing keeps concurrent pollers from overshooting the limit.
+func (w *Worker) reserveLifetimeJobs(n int) int {
+	if w.maxLifetimeJobs <= 0 {
+		return n
+	}
+	for {
+		reserved := w.lifetimeReserved.Load()
+		grant := min(int64(n), w.maxLifetimeJobs-reserved)
+		if grant <= 0 {
+			return 0
+		}
+		if w.lifetimeReserved.CompareAndSwap(reserved, reserved+grant) {
+			return int(grant)
+		}
+	}
+}
+
+// settleLifetimeJobs returns the reserved jobs a lease didn't fill and, once
+// the worker has leased its last job, starts draining it so it exits after
+// acking them
+func (w *Worker) settleLifetimeJobs(reserved, leased int) {
+	if w.maxLifetimeJobs <= 0 {
+		return
+	}
+	w.lifetimeReserved.Add(int64(leased - reserved))
+	if w.lifetimeLeased.Add(int64(leased)) >= w.maxLifetimeJobs {
+		w.startDrain(fmt.Sprintf("leased its lifetime limit of %d jobs", w.maxLifetimeJobs))
+	}
+}
+
+// startDrain stops the worker leasing so Start returns once its in-flight
+// jobs finish; reason is logged the first time
+func (w *Worker) startDrain(reason string) {
+	w.drainOnce.Do(func() {
+		w.logger.Printf("Worker %s %s; no longer leasing", w.id, reason)
+		close(w.drained)
+	})
+}
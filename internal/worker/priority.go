@@ -0,0 +1,42 @@
+package worker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PriorityQuota reserves Reserved slots of each lease batch for jobs with
+// priority >= MinPriority
+type PriorityQuota struct {
+	MinPriority int
+	Reserved    int
+}
+
+// ParsePriorityQuotas parses a comma-separated list of "min_priority:reserved"
+// pairs, e.g. "10:2,5:1"
+func ParsePriorityQuotas(s string) ([]PriorityQuota, error) {
+	var quotas []PriorityQuota
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		minStr, reservedStr, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid priority quota %q: expected min_priority:reserved", part)
+		}
+		minPriority, err := strconv.Atoi(strings.TrimSpace(minStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid priority quota %q: %w", part, err)
+		}
+		reserved, err := strconv.Atoi(strings.TrimSpace(reservedStr))
+		if err != nil || reserved < 0 {
+			return nil, fmt.Errorf("invalid priority quota %q: reserved must be a non-negative integer", part)
+		}
+
+		quotas = append(quotas, PriorityQuota{MinPriority: minPriority, Reserved: reserved})
+	}
+	return quotas, nil
+}
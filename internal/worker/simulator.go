@@ -0,0 +1,65 @@
+package worker
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// SimulatorConfig controls the simulated work done by the bundled worker
+type SimulatorConfig struct {
+	// Seed makes runs reproducible; zero seeds from the current time
+	Seed int64
+
+	// FailureRate is the fraction of jobs, from 0 to 1, that fail
+	FailureRate float64
+
+	// Each job sleeps for a uniformly random time in [MinDuration, MaxDuration]
+	MinDuration time.Duration
+	MaxDuration time.Duration
+}
+
+// DefaultSimulatorConfig fails 10% of jobs and takes 0.5-2.5s per job
+func DefaultSimulatorConfig() SimulatorConfig {
+	return SimulatorConfig{
+		FailureRate: 0.1,
+		MinDuration: 500 * time.Millisecond,
+		MaxDuration: 2500 * time.Millisecond,
+	}
+}
+
+// simulator draws processing times and outcomes from a per-worker source.
+// rand.Rand isn't safe for concurrent use, so draws are serialized.
+type simulator struct {
+	cfg SimulatorConfig
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func newSimulator(cfg SimulatorConfig) *simulator {
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	if cfg.MaxDuration < cfg.MinDuration {
+		cfg.MaxDuration = cfg.MinDuration
+	}
+
+	return &simulator{
+		cfg: cfg,
+		rng: rand.New(rand.NewSource(cfg.Seed)),
+	}
+}
+
+// next returns how long the next job should take and whether it succeeds
+func (s *simulator) next() (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	duration := s.cfg.MinDuration
+	if spread := s.cfg.MaxDuration - s.cfg.MinDuration; spread > 0 {
+		duration += time.Duration(s.rng.Int63n(int64(spread) + 1))
+	}
+
+	return duration, s.rng.Float64() >= s.cfg.FailureRate
+}
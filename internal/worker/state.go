@@ -0,0 +1,45 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	pb "github.com/goquorra/goquorra/internal/grpc"
+)
+
+// SaveState checkpoints a job's progress on the server. The state is
+// marshaled to JSON and handed back in job.State when the job is leased
+// again, for example after this worker crashes, so the next attempt can
+// resume instead of starting over. It fails once the job's lease is lost.
+func (w *Worker) SaveState(ctx context.Context, job *pb.Job, state interface{}) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	_, err = w.client.SaveState(ctx, &pb.SaveStateRequest{
+		JobId:      job.Id,
+		WorkerId:   w.id,
+		LeaseId:    job.LeaseId,
+		LeaseEpoch: job.LeaseEpoch,
+		State:      data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save state of job %s: %w", job.Id, err)
+	}
+	job.State = data
+	return nil
+}
+
+// LoadState decodes the state last saved for job into v, reporting whether
+// there was any
+func LoadState(job *pb.Job, v interface{}) (bool, error) {
+	if len(job.State) == 0 {
+		return false, nil
+	}
+	if err := json.Unmarshal(job.State, v); err != nil {
+		return false, fmt.Errorf("failed to unmarshal state of job %s: %w", job.Id, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,123 @@
+package worker
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Queue selection strategies for weighted queues
+const (
+	// QueueSelectionRoundRobin deals slots out by smooth weighted
+	// round-robin, so every worker with the same weights leases the same mix
+	QueueSelectionRoundRobin = "round_robin"
+	// QueueSelectionWeightedRandom picks each slot's queue at random with
+	// probability weight/total, so workers don't poll in lockstep
+	QueueSelectionWeightedRandom = "weighted_random"
+)
+
+// ParseQueueWeights parses a comma-separated list of "queue=weight" pairs,
+// e.g. "critical=3,bulk=1". It returns nil for an empty string.
+func ParseQueueWeights(s string) (map[string]int, error) {
+	var weights map[string]int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		queue, weightStr, ok := strings.Cut(part, "=")
+		queue = strings.TrimSpace(queue)
+		if !ok || queue == "" {
+			return nil, fmt.Errorf("invalid queue weight %q: expected queue=weight", part)
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(weightStr))
+		if err != nil || weight < 1 {
+			return nil, fmt.Errorf("invalid queue weight %q: weight must be a positive integer", part)
+		}
+
+		if weights == nil {
+			weights = make(map[string]int)
+		}
+		weights[queue] = weight
+	}
+	return weights, nil
+}
+
+// WeightedQueues splits a worker's lease slots between its queues in
+// proportion to their weights. It uses smooth weighted round-robin and keeps
+// its state between calls, so shares that don't divide a batch evenly still
+// even out over successive batches. With a random source it instead draws
+// each slot's queue by weight. It isn't safe for concurrent use.
+type WeightedQueues struct {
+	queues  []string
+	weights []int
+	current []int
+	total   int
+	rng     *rand.Rand
+}
+
+// NewWeightedQueues creates a WeightedQueues for queues; queues missing
+// from weights get weight 1
+func NewWeightedQueues(queues []string, weights map[string]int) *WeightedQueues {
+	wq := &WeightedQueues{
+		queues:  queues,
+		weights: make([]int, len(queues)),
+		current: make([]int, len(queues)),
+	}
+	for i, queue := range queues {
+		weight := weights[queue]
+		if weight < 1 {
+			weight = 1
+		}
+		wq.weights[i] = weight
+		wq.total += weight
+	}
+	return wq
+}
+
+// NewWeightedRandomQueues creates a WeightedQueues that picks each slot's
+// queue at random by weight; a nil rng is seeded from the clock
+func NewWeightedRandomQueues(queues []string, weights map[string]int, rng *rand.Rand) *WeightedQueues {
+	wq := NewWeightedQueues(queues, weights)
+	if rng == nil {
+		rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	wq.rng = rng
+	return wq
+}
+
+// Allocate assigns slots lease slots to queues, returning how many each gets
+func (wq *WeightedQueues) Allocate(slots int) map[string]int {
+	alloc := make(map[string]int, len(wq.queues))
+	if len(wq.queues) == 0 {
+		return alloc
+	}
+	if wq.rng != nil {
+		for n := 0; n < slots; n++ {
+			pick := wq.rng.Intn(wq.total)
+			for i, weight := range wq.weights {
+				if pick < weight {
+					alloc[wq.queues[i]]++
+					break
+				}
+				pick -= weight
+			}
+		}
+		return alloc
+	}
+	for n := 0; n < slots; n++ {
+		best := 0
+		for i := range wq.queues {
+			wq.current[i] += wq.weights[i]
+			if wq.current[i] > wq.current[best] {
+				best = i
+			}
+		}
+		wq.current[best] -= wq.total
+		alloc[wq.queues[best]]++
+	}
+	return alloc
+}
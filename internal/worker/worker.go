@@ -6,12 +6,16 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"math/rand"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	pb "github.com/goquorra/goquorra/internal/grpc"
+	"github.com/goquorra/goquorra/internal/metrics"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
 )
 
 // Worker represents a job worker
@@ -22,8 +26,57 @@ type Worker struct {
 	maxJobs    int
 	leaseTTL   time.Duration
 	logger     *log.Logger
-	client     pb.WorkerServiceClient
-	conn       *grpc.ClientConn
+
+	pollInterval    time.Duration
+	queueWeights    map[string]int
+	queueSelection  string
+	traceSampleRate float64
+
+	visibilityTimeout time.Duration
+	payloadMode       string
+	capabilities      []string
+	labelFilter       map[string]string
+	weight            int
+	compression       string
+	maxMsgBytes       int
+	connectTimeout    time.Duration
+	priorityQuotas    []*pb.PriorityQuota
+	minPriority       *int32
+	startImmediately  bool
+	simulator         *simulator
+	metrics           *metrics.WorkerCollector
+	client            pb.WorkerServiceClient
+	conn              *grpc.ClientConn
+
+	ackBatchSize     int
+	ackFlushInterval time.Duration
+	batcher          *ackBatcher
+
+	keepAliveInterval time.Duration
+	maxLeaseDuration  time.Duration
+
+	// buffer holds leased jobs that haven't started yet
+	buffer *jobBuffer
+
+	// startedAt identifies this worker process to drain requests. drained is
+	// closed once the server asks the worker to drain or it reaches its
+	// lifetime limit; pollers and inFlight track the queue pollers and jobs
+	// still running.
+	startedAt time.Time
+	drained   chan struct{}
+	drainOnce sync.Once
+	pollers   sync.WaitGroup
+	inFlight  sync.WaitGroup
+
+	// serverUnhealthy is set while the server's gRPC health check reports
+	// it isn't serving; leasing is skipped meanwhile
+	serverUnhealthy atomic.Bool
+
+	// maxLifetimeJobs, when positive, is how many jobs the worker leases
+	// before draining; lifetimeReserved and lifetimeLeased count towards it
+	maxLifetimeJobs  int64
+	lifetimeReserved atomic.Int64
+	lifetimeLeased   atomic.Int64
 }
 
 // Config holds worker configuration
@@ -33,8 +86,96 @@ type Config struct {
 	Queues     []string
 	MaxJobs    int
 	LeaseTTL   time.Duration
+
+	// PollInterval is how often each queue is polled for jobs; zero uses
+	// DefaultPollInterval. It bounds how promptly delayed jobs start.
+	PollInterval time.Duration
+
+	// QueueWeights, when set, makes the worker split MaxJobs between its
+	// queues in proportion to these weights each poll, instead of leasing up
+	// to MaxJobs from every queue. Queues without a weight get 1.
+	QueueWeights map[string]int
+
+	// QueueSelection is how weighted slots are dealt out: round_robin
+	// (the default) or weighted_random
+	QueueSelection string
+
+	// TraceSampleRate is the fraction of jobs, from 0 to 1, whose lease and
+	// processing are logged in detail; the rest only log their outcome. Jobs
+	// are picked by pb.TraceSampled, consistently with the server.
+	TraceSampleRate float64
+
+	// VisibilityTimeout opts leases into SQS-style visibility semantics; zero disables it
+	VisibilityTimeout time.Duration
+
+	// PayloadMode is "full" (default) or "metadata_only" to fetch payloads on demand
+	PayloadMode string
+
+	// Capabilities are advertised on every lease so the server only hands out
+	// jobs whose requirements this worker satisfies
+	Capabilities []string
+
+	// LabelFilter, when set, restricts leases to jobs carrying all these labels
+	LabelFilter map[string]string
+
+	// Weight is this worker's capacity relative to others, reported with
+	// every lease; zero counts as 1
+	Weight int
+
+	// Compression is "gzip" to compress all RPCs, including the lease stream
+	// the server sends back; empty or "none" disables it
+	Compression string
+
+	// MaxMsgBytes raises gRPC's 4MB message limit to match the server's
+	// QUORRA_GRPC_MAX_MSG_BYTES; zero keeps the default
+	MaxMsgBytes int
+
+	// ConnectTimeout bounds how long Start waits for the server connection
+	// to become ready before giving up; zero uses DefaultConnectTimeout
+	ConnectTimeout time.Duration
+
+	// PriorityQuotas reserve part of every lease batch for higher-priority jobs
+	PriorityQuotas []PriorityQuota
+
+	// MinPriority, when set, dedicates the worker to jobs of at least this
+	// priority; lower-priority jobs are left to other workers
+	MinPriority *int
+
+	// StartImmediately has jobs leased straight into the processing state,
+	// skipping leased, since the worker starts them as soon as they arrive
+	StartImmediately bool
+
+	// Simulator configures the simulated job execution; nil uses DefaultSimulatorConfig
+	Simulator *SimulatorConfig
+
+	// AckBatchSize is the number of acks accumulated before a batch flush.
+	// A size of 1 disables batching and acks each job individually.
+	AckBatchSize     int
+	AckFlushInterval time.Duration
+
+	// KeepAliveInterval is how often in-flight jobs have their lease renewed;
+	// zero uses LeaseTTL/3 and a negative value disables keepalives
+	KeepAliveInterval time.Duration
+
+	// MaxLeaseDuration caps how long a single job's lease is kept alive so
+	// stuck jobs are still reclaimed; zero uses DefaultMaxLeaseDuration
+	MaxLeaseDuration time.Duration
+
+	// Metrics, when set, records per-worker job and lease metrics
+	Metrics *metrics.WorkerCollector
+
+	// MaxLifetimeJobs, when positive, makes the worker stop leasing after
+	// that many jobs and return from Start once they are acked, so an
+	// orchestrator restarts it fresh; zero is unlimited
+	MaxLifetimeJobs int
 }
 
+// DefaultConnectTimeout is how long Start waits for the server by default
+const DefaultConnectTimeout = 10 * time.Second
+
+// DefaultPollInterval is how often each queue is polled by default
+const DefaultPollInterval = 2 * time.Second
+
 // New creates a new worker
 func New(cfg *Config, logger *log.Logger) *Worker {
 	if len(cfg.Queues) == 0 {
@@ -46,71 +187,298 @@ func New(cfg *Config, logger *log.Logger) *Worker {
 	if cfg.LeaseTTL == 0 {
 		cfg.LeaseTTL = 30 * time.Second
 	}
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	if cfg.AckBatchSize == 0 {
+		cfg.AckBatchSize = 1
+	}
+	if cfg.ConnectTimeout == 0 {
+		cfg.ConnectTimeout = DefaultConnectTimeout
+	}
+	if cfg.AckFlushInterval == 0 {
+		cfg.AckFlushInterval = 200 * time.Millisecond
+	}
+	if cfg.KeepAliveInterval == 0 {
+		cfg.KeepAliveInterval = cfg.LeaseTTL / 3
+	}
+	if cfg.MaxLeaseDuration == 0 {
+		cfg.MaxLeaseDuration = DefaultMaxLeaseDuration
+	}
+	simCfg := DefaultSimulatorConfig()
+	if cfg.Simulator != nil {
+		simCfg = *cfg.Simulator
+	}
+	var minPriority *int32
+	if cfg.MinPriority != nil {
+		floor := int32(*cfg.MinPriority)
+		minPriority = &floor
+	}
+	quotas := make([]*pb.PriorityQuota, 0, len(cfg.PriorityQuotas))
+	for _, q := range cfg.PriorityQuotas {
+		quotas = append(quotas, &pb.PriorityQuota{MinPriority: int32(q.MinPriority), Reserved: int32(q.Reserved)})
+	}
 
 	return &Worker{
-		id:         cfg.ID,
-		serverAddr: cfg.ServerAddr,
-		queues:     cfg.Queues,
-		maxJobs:    cfg.MaxJobs,
-		leaseTTL:   cfg.LeaseTTL,
-		logger:     logger,
+		id:               cfg.ID,
+		serverAddr:       cfg.ServerAddr,
+		queues:           cfg.Queues,
+		maxJobs:          cfg.MaxJobs,
+		leaseTTL:         cfg.LeaseTTL,
+		logger:           logger,
+		ackBatchSize:     cfg.AckBatchSize,
+		ackFlushInterval: cfg.AckFlushInterval,
+
+		pollInterval:      cfg.PollInterval,
+		queueWeights:      cfg.QueueWeights,
+		queueSelection:    cfg.QueueSelection,
+		traceSampleRate:   cfg.TraceSampleRate,
+		visibilityTimeout: cfg.VisibilityTimeout,
+		payloadMode:       cfg.PayloadMode,
+		capabilities:      cfg.Capabilities,
+		labelFilter:       cfg.LabelFilter,
+		weight:            cfg.Weight,
+		compression:       cfg.Compression,
+		maxMsgBytes:       cfg.MaxMsgBytes,
+		connectTimeout:    cfg.ConnectTimeout,
+		priorityQuotas:    quotas,
+		minPriority:       minPriority,
+		startImmediately:  cfg.StartImmediately,
+		simulator:         newSimulator(simCfg),
+		metrics:           cfg.Metrics,
+		keepAliveInterval: cfg.KeepAliveInterval,
+		maxLeaseDuration:  cfg.MaxLeaseDuration,
+		buffer:            newJobBuffer(),
+		drained:           make(chan struct{}),
+		maxLifetimeJobs:   int64(cfg.MaxLifetimeJobs),
 	}
 }
 
-// Start connects to the server and starts processing jobs
+// Start connects to the server and starts processing jobs. It returns when
+// ctx is cancelled, or once the worker has drained at the server's request
+// or after reaching MaxLifetimeJobs.
 func (w *Worker) Start(ctx context.Context) error {
+	w.startedAt = time.Now()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	// Connect to gRPC server
-	conn, err := grpc.Dial(w.serverAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	var callOpts []grpc.CallOption
+	if w.compression == gzip.Name {
+		callOpts = append(callOpts, grpc.UseCompressor(gzip.Name))
+	}
+	if w.maxMsgBytes > 0 {
+		callOpts = append(callOpts, grpc.MaxCallRecvMsgSize(w.maxMsgBytes), grpc.MaxCallSendMsgSize(w.maxMsgBytes))
+	}
+	if len(callOpts) > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(callOpts...))
+	}
+	conn, err := grpc.Dial(w.serverAddr, opts...)
 	if err != nil {
 		return fmt.Errorf("failed to connect to server: %w", err)
 	}
+	// Dial returns before the connection is up; leasing before then only
+	// produces errors, so wait for it
+	if err := w.waitForReady(ctx, conn); err != nil {
+		conn.Close()
+		return err
+	}
 	w.conn = conn
 	w.client = pb.NewWorkerServiceClient(conn)
 
-	w.logger.Printf("Worker %s connected to %s", w.id, w.serverAddr)
+	w.logger.Printf("Worker %s connected to %s (simulator seed=%d)", w.id, w.serverAddr, w.simulator.cfg.Seed)
 
-	// Process jobs from each queue
-	for _, queue := range w.queues {
-		go w.processQueue(ctx, queue)
+	// Batch acks when configured
+	batcherDone := make(chan struct{})
+	if w.ackBatchSize > 1 {
+		w.batcher = newAckBatcher(w.client, w.ackBatchSize, w.ackFlushInterval, w.logger)
+		go func() {
+			w.batcher.run(ctx)
+			close(batcherDone)
+		}()
+	} else {
+		close(batcherDone)
 	}
 
-	// Wait for context cancellation
-	<-ctx.Done()
+	go w.watchServerHealth(ctx)
+
+	// Process jobs from each queue, sharing one lease budget when weighted
+	if len(w.queueWeights) > 0 && len(w.queues) > 1 {
+		w.pollers.Add(1)
+		go func() {
+			defer w.pollers.Done()
+			w.processWeightedQueues(ctx)
+		}()
+	} else {
+		for _, queue := range w.queues {
+			w.pollers.Add(1)
+			go func(queue string) {
+				defer w.pollers.Done()
+				w.processQueue(ctx, queue)
+			}(queue)
+		}
+	}
+	go w.watchDrain(ctx)
+
+	// Wait for context cancellation or a drain request
+	select {
+	case <-ctx.Done():
+	case <-w.drained:
+		w.drain()
+		cancel()
+	}
 	w.logger.Printf("Worker %s shutting down", w.id)
+
+	// Let the batcher flush pending acks before closing the connection
+	<-batcherDone
 	return w.conn.Close()
 }
 
+// waitForReady blocks until conn is ready, failing after w.connectTimeout
+func (w *Worker) waitForReady(ctx context.Context, conn *grpc.ClientConn) error {
+	ctx, cancel := context.WithTimeout(ctx, w.connectTimeout)
+	defer cancel()
+
+	conn.Connect()
+	for {
+		state := conn.GetState()
+		if state == connectivity.Ready {
+			return nil
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			if ctx.Err() == context.DeadlineExceeded {
+				return fmt.Errorf("server %s not reachable within %v (connection %s); check QUORRA_GRPC_ADDR or raise QUORRA_WORKER_CONNECT_TIMEOUT",
+					w.serverAddr, w.connectTimeout, state)
+			}
+			return ctx.Err()
+		}
+	}
+}
+
 // processQueue continuously processes jobs from a specific queue
 func (w *Worker) processQueue(ctx context.Context, queue string) {
-	ticker := time.NewTicker(2 * time.Second)
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	failing := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.drained:
+			return
+		case <-ticker.C:
+			_, ok := w.leaseAndProcessJobs(ctx, queue, w.maxJobs)
+			w.recordLeaseOutcome(queue, ok, failing)
+			failing = !ok
+		}
+	}
+}
+
+// processWeightedQueues polls all queues together, splitting each poll's
+// MaxJobs between them by weight. Slots a queue can't fill go to the queues
+// that filled theirs, so weights only matter while queues compete.
+func (w *Worker) processWeightedQueues(ctx context.Context) {
+	ticker := time.NewTicker(w.pollInterval)
 	defer ticker.Stop()
 
+	weighted := NewWeightedQueues(w.queues, w.queueWeights)
+	if w.queueSelection == QueueSelectionWeightedRandom {
+		weighted = NewWeightedRandomQueues(w.queues, w.queueWeights, nil)
+	}
+	failing := make(map[string]bool, len(w.queues))
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-w.drained:
+			return
 		case <-ticker.C:
-			w.leaseAndProcessJobs(ctx, queue)
+			alloc := weighted.Allocate(w.maxJobs)
+			spare := 0
+			var saturated []string
+			for _, queue := range w.queues {
+				if alloc[queue] == 0 {
+					continue
+				}
+				leased, ok := w.leaseAndProcessJobs(ctx, queue, alloc[queue])
+				w.recordLeaseOutcome(queue, ok, failing[queue])
+				failing[queue] = !ok
+				spare += alloc[queue] - leased
+				if leased == alloc[queue] {
+					saturated = append(saturated, queue)
+				}
+			}
+			for _, queue := range saturated {
+				if spare == 0 {
+					break
+				}
+				leased, ok := w.leaseAndProcessJobs(ctx, queue, spare)
+				w.recordLeaseOutcome(queue, ok, failing[queue])
+				failing[queue] = !ok
+				spare -= leased
+			}
 		}
 	}
 }
 
-// leaseAndProcessJobs leases jobs from the server and processes them
-func (w *Worker) leaseAndProcessJobs(ctx context.Context, queue string) {
+// recordLeaseOutcome records a lease error, or a reconnect if the previous
+// lease from queue had failed
+func (w *Worker) recordLeaseOutcome(queue string, ok, failing bool) {
+	if w.metrics == nil {
+		return
+	}
+	if !ok {
+		w.metrics.RecordLeaseError(queue)
+	} else if failing {
+		w.metrics.RecordReconnect(queue)
+	}
+}
+
+// leaseAndProcessJobs leases up to maxJobs jobs from the server and
+// processes them. It returns how many were leased, and false if the lease
+// stream failed. Nothing is leased while the server reports it isn't serving.
+func (w *Worker) leaseAndProcessJobs(ctx context.Context, queue string, maxJobs int) (int, bool) {
+	if w.serverUnhealthy.Load() {
+		return 0, true
+	}
+	reserved := w.reserveLifetimeJobs(maxJobs)
+	if reserved == 0 {
+		return 0, true
+	}
+	maxJobs = reserved
+
 	req := &pb.LeaseRequest{
 		WorkerId:        w.id,
 		Queue:           queue,
-		MaxJobs:         int32(w.maxJobs),
+		MaxJobs:         int32(maxJobs),
 		LeaseTtlSeconds: int32(w.leaseTTL.Seconds()),
+
+		VisibilityTimeoutSeconds: int32(w.visibilityTimeout.Seconds()),
+		PayloadMode:              w.payloadMode,
+		Capabilities:             w.capabilities,
+		PriorityQuotas:           w.priorityQuotas,
+		LabelFilter:              w.labelFilter,
+		Weight:                   int32(w.weight),
+		MinPriority:              w.minPriority,
+		StartImmediately:         w.startImmediately,
+	}
+
+	if w.metrics != nil {
+		w.metrics.RecordLease(queue)
 	}
 
 	stream, err := w.client.LeaseJobs(ctx, req)
 	if err != nil {
 		w.logger.Printf("Failed to lease jobs from queue %s: %v", queue, err)
-		return
+		w.settleLifetimeJobs(reserved, 0)
+		return 0, false
 	}
 
+	ok := true
 	jobCount := 0
+	defer func() { w.settleLifetimeJobs(reserved, jobCount) }()
 	for {
 		job, err := stream.Recv()
 		if err == io.EOF {
@@ -118,35 +486,97 @@ func (w *Worker) leaseAndProcessJobs(ctx context.Context, queue string) {
 		}
 		if err != nil {
 			w.logger.Printf("Error receiving job: %v", err)
+			ok = ctx.Err() != nil
 			break
 		}
 
 		jobCount++
-		w.logger.Printf("Leased job %s (type=%s) from queue %s", job.Id, job.Type, queue)
+		if w.traced(job.Id) {
+			w.logger.Printf("Leased job %s (type=%s) from queue %s", job.Id, job.Type, queue)
+		}
 
-		// Process job in goroutine
-		go w.processJob(context.Background(), job)
+		// Process job in goroutine; it stays buffered until it starts
+		w.buffer.add(job, queue)
+		w.inFlight.Add(1)
+		go func(job *pb.Job) {
+			defer w.inFlight.Done()
+			w.processJob(context.Background(), job)
+		}(job)
 	}
 
 	if jobCount > 0 {
 		w.logger.Printf("Leased %d jobs from queue %s", jobCount, queue)
 	}
+	return jobCount, ok
+}
+
+// traced reports whether a job gets verbose lifecycle logging
+func (w *Worker) traced(jobID string) bool {
+	return pb.TraceSampled(jobID, w.traceSampleRate)
 }
 
 // processJob processes a single job
 func (w *Worker) processJob(ctx context.Context, job *pb.Job) {
-	w.logger.Printf("Processing job %s (type=%s, attempt=%d/%d)", job.Id, job.Type, job.Attempts+1, job.MaxRetries)
+	traced := w.traced(job.Id)
+	if traced {
+		w.logger.Printf("Processing job %s (type=%s, attempt=%d/%d)", job.Id, job.Type, job.Attempts+1, job.MaxRetries)
+	}
+	if w.metrics != nil {
+		w.metrics.JobStarted()
+		defer w.metrics.JobFinished()
+	}
+
+	// Keep the lease alive while the job runs, without handler involvement
+	stopKeepAlive := w.startKeepAlive(job)
+	defer stopKeepAlive()
+
+	// Fetch the payload if it was omitted from the lease
+	if job.PayloadOmitted {
+		resp, err := w.client.FetchPayload(ctx, &pb.FetchPayloadRequest{
+			JobId:    job.Id,
+			WorkerId: w.id,
+			LeaseId:  job.LeaseId,
+		})
+		if err != nil {
+			w.logger.Printf("Failed to fetch payload for job %s: %v", job.Id, err)
+			if w.buffer.claim(job.Id) {
+				w.nackJob(ctx, job, fmt.Sprintf("Failed to fetch payload: %v", err))
+			}
+			return
+		}
+		job.Payload = resp.Payload
+	}
+
+	// Start the job unless it was released from the buffer meanwhile
+	if !w.buffer.claim(job.Id) {
+		w.logger.Printf("Job %s was released before it started", job.Id)
+		return
+	}
 
 	// Parse payload
 	var payload map[string]interface{}
 	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		// Retrying won't fix an unparseable payload
 		w.logger.Printf("Failed to parse job payload: %v", err)
-		w.nackJob(ctx, job, fmt.Sprintf("Invalid payload: %v", err))
+		w.nackJobWithReason(ctx, job, fmt.Sprintf("Invalid payload: %v", err), "poison")
 		return
 	}
 
+	// Stop working on the job once its deadline passes
+	jobCtx := ctx
+	if job.Deadline != nil {
+		var cancel context.CancelFunc
+		jobCtx, cancel = context.WithDeadline(ctx, job.Deadline.AsTime())
+		defer cancel()
+	}
+
 	// Simulate work
-	success := w.executeJob(job.Type, payload)
+	success, err := w.executeJob(jobCtx, job.Type, payload, traced)
+	if err != nil {
+		w.logger.Printf("Job %s abandoned: %v", job.Id, err)
+		w.nackJob(ctx, job, fmt.Sprintf("Job abandoned: %v", err))
+		return
+	}
 
 	// Ack or nack
 	if success {
@@ -156,25 +586,40 @@ func (w *Worker) processJob(ctx context.Context, job *pb.Job) {
 	}
 }
 
-// executeJob simulates job execution
-func (w *Worker) executeJob(jobType string, payload map[string]interface{}) bool {
-	// Simulate random processing time
-	processingTime := time.Duration(500+rand.Intn(2000)) * time.Millisecond
-	time.Sleep(processingTime)
+// executeJob simulates job execution, logging the details of traced jobs.
+// It returns ctx's error if ctx is done before the job finishes.
+func (w *Worker) executeJob(ctx context.Context, jobType string, payload map[string]interface{}, traced bool) (bool, error) {
+	// Simulate processing time and failures
+	processingTime, ok := w.simulator.next()
+	select {
+	case <-time.After(processingTime):
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
 
-	w.logger.Printf("Job type=%s, payload=%v, took=%v", jobType, payload, processingTime)
+	if traced {
+		w.logger.Printf("Job type=%s, payload=%v, took=%v", jobType, payload, processingTime)
+	}
 
-	// Simulate 10% failure rate
-	return rand.Float64() > 0.1
+	return ok, nil
 }
 
 // ackJob acknowledges successful job completion
 func (w *Worker) ackJob(ctx context.Context, job *pb.Job) {
 	ack := &pb.JobAck{
-		JobId:    job.Id,
-		WorkerId: w.id,
-		LeaseId:  job.LeaseId,
-		Success:  true,
+		JobId:      job.Id,
+		WorkerId:   w.id,
+		LeaseId:    job.LeaseId,
+		LeaseEpoch: job.LeaseEpoch,
+		Success:    true,
+	}
+	if w.metrics != nil {
+		w.metrics.RecordJobProcessed()
+	}
+
+	if w.batcher != nil {
+		w.batcher.add(ack)
+		return
 	}
 
 	resp, err := w.client.AckJob(ctx, ack)
@@ -190,21 +635,87 @@ func (w *Worker) ackJob(ctx context.Context, job *pb.Job) {
 
 // nackJob signals job failure
 func (w *Worker) nackJob(ctx context.Context, job *pb.Job, errorMsg string) {
-	ack := &pb.JobAck{
+	w.nackJobWithReason(ctx, job, errorMsg, "")
+}
+
+// nackJobWithReason signals job failure, optionally dead-lettering it
+// immediately with the given reason ("permanent_failure" or "poison")
+func (w *Worker) nackJobWithReason(ctx context.Context, job *pb.Job, errorMsg, deadReason string) {
+	w.sendNack(ctx, &pb.JobAck{
 		JobId:        job.Id,
 		WorkerId:     w.id,
 		LeaseId:      job.LeaseId,
+		LeaseEpoch:   job.LeaseEpoch,
 		Success:      false,
 		ErrorMessage: errorMsg,
+		DeadReason:   deadReason,
+	})
+}
+
+// NackWithDelay signals job failure and asks for the job to be retried after
+// exactly delay, e.g. a downstream's Retry-After, instead of the normal
+// backoff. The server caps the delay and doesn't count it as an attempt.
+func (w *Worker) NackWithDelay(ctx context.Context, job *pb.Job, err error, delay time.Duration) {
+	w.sendNack(ctx, &pb.JobAck{
+		JobId:             job.Id,
+		WorkerId:          w.id,
+		LeaseId:           job.LeaseId,
+		LeaseEpoch:        job.LeaseEpoch,
+		Success:           false,
+		ErrorMessage:      err.Error(),
+		RetryAfterSeconds: ceilSeconds(delay),
+	})
+}
+
+// NackWithRetry signals job failure along with the handler's verdict on it:
+// a non-retryable failure (e.g. a 400 from a downstream) is dead-lettered
+// straight away, while a retryable one (e.g. a 503) is retried after delay,
+// or the normal backoff if delay is zero. Unlike NackWithDelay the attempt
+// counts towards the job's max_retries.
+func (w *Worker) NackWithRetry(ctx context.Context, job *pb.Job, err error, retryable bool, delay time.Duration) {
+	ack := &pb.JobAck{
+		JobId:        job.Id,
+		WorkerId:     w.id,
+		LeaseId:      job.LeaseId,
+		LeaseEpoch:   job.LeaseEpoch,
+		Success:      false,
+		ErrorMessage: err.Error(),
+		Retryable:    &retryable,
+	}
+	if retryable {
+		ack.RetryDelaySeconds = ceilSeconds(delay)
+	}
+	w.sendNack(ctx, ack)
+}
+
+// ceilSeconds converts d to whole seconds, rounding up so a delay is never
+// cut short
+func ceilSeconds(d time.Duration) int32 {
+	seconds := int32(d / time.Second)
+	if d%time.Second != 0 {
+		seconds++
+	}
+	return seconds
+}
+
+// sendNack reports a failed job, through the batcher when batching is on
+func (w *Worker) sendNack(ctx context.Context, ack *pb.JobAck) {
+	if w.metrics != nil {
+		w.metrics.RecordJobFailed()
+	}
+
+	if w.batcher != nil {
+		w.batcher.add(ack)
+		return
 	}
 
 	resp, err := w.client.NackJob(ctx, ack)
 	if err != nil {
-		w.logger.Printf("Failed to nack job %s: %v", job.Id, err)
+		w.logger.Printf("Failed to nack job %s: %v", ack.JobId, err)
 		return
 	}
 
 	if resp.Acknowledged {
-		w.logger.Printf("Job %s failed: %s", job.Id, errorMsg)
+		w.logger.Printf("Job %s failed: %s", ack.JobId, ack.ErrorMessage)
 	}
 }
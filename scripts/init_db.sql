@@ -8,23 +8,182 @@ CREATE TABLE IF NOT EXISTS jobs (
     queue VARCHAR(255) NOT NULL DEFAULT 'default',
     priority INT NOT NULL DEFAULT 0,
     status VARCHAR(50) NOT NULL DEFAULT 'pending',
+    kind VARCHAR(20) NOT NULL DEFAULT 'user',
     attempts INT NOT NULL DEFAULT 0,
     max_retries INT NOT NULL DEFAULT 3,
     last_error TEXT,
     lease_id VARCHAR(255),
     leased_at TIMESTAMP,
     leased_by VARCHAR(255),
+    lease_expires_at TIMESTAMP,
+    visible_until TIMESTAMP,
+    visibility_requeued BOOLEAN NOT NULL DEFAULT FALSE,
+    lease_epoch BIGINT NOT NULL DEFAULT 0,
+    labels JSONB NOT NULL DEFAULT '{}',
+    trace_id VARCHAR(255),
+    partition_key VARCHAR(255),
+    idempotency_key VARCHAR(255),
+    requires JSONB NOT NULL DEFAULT '[]',
+    backoff_strategy VARCHAR(20),
+    backoff_base_seconds INT,
+    backoff_cap_seconds INT,
+    seq BIGSERIAL,
+    dead_reason VARCHAR(50),
+    deadline TIMESTAMP,
+    singleton_key VARCHAR(255),
+    front_requeues INT NOT NULL DEFAULT 0,
+    deferrals INT NOT NULL DEFAULT 0,
+    priority_boost INT NOT NULL DEFAULT 0,
+    dead_retry BOOLEAN NOT NULL DEFAULT FALSE,
+    dead_retry_count INT NOT NULL DEFAULT 0,
+    dead_at TIMESTAMP,
+    killed_by VARCHAR(255),
+    payload_hash CHAR(64),
+    backoff_schedule JSONB,
+    workflow_id VARCHAR(36),
+    started_at TIMESTAMP,
+    sla_met BOOLEAN,
+    state JSONB,
+    redeliveries INT NOT NULL DEFAULT 0,
+    unique_key CHAR(64),
     run_at TIMESTAMP NOT NULL DEFAULT NOW(),
     created_at TIMESTAMP NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMP NOT NULL DEFAULT NOW()
 );
 
+-- One row per lease of a job, closed when it is acked, nacked or expires
+CREATE TABLE IF NOT EXISTS job_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    job_id VARCHAR(36) NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+    attempt INT NOT NULL,
+    worker_id VARCHAR(255) NOT NULL,
+    lease_id VARCHAR(255) NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP,
+    outcome VARCHAR(20),
+    error TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_job_attempts_job ON job_attempts(job_id, lease_id);
+CREATE INDEX IF NOT EXISTS idx_job_attempts_lease ON job_attempts(lease_id);
+
+-- Per-queue settings; NULL columns fall back to server-wide defaults
+CREATE TABLE IF NOT EXISTS queue_configs (
+    queue VARCHAR(255) PRIMARY KEY,
+    max_retries INT,
+    backoff_strategy VARCHAR(20),
+    backoff_base_seconds INT,
+    backoff_cap_seconds INT,
+    dead_retry BOOLEAN NOT NULL DEFAULT FALSE,
+    min_workers INT NOT NULL DEFAULT 0,
+    scheduling VARCHAR(20),
+    retry_budget_percent INT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Type-to-queue routing rules applied at enqueue; type_pattern may use wildcards
+CREATE TABLE IF NOT EXISTS routing_rules (
+    type_pattern VARCHAR(255) PRIMARY KEY,
+    queue VARCHAR(255) NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Named business calendars; jobs with a schedule_calendar run only in its business hours
+CREATE TABLE IF NOT EXISTS business_calendars (
+    name VARCHAR(255) PRIMARY KEY,
+    timezone VARCHAR(64) NOT NULL DEFAULT '',
+    weekend TEXT[] NOT NULL DEFAULT '{}',
+    holidays TEXT[] NOT NULL DEFAULT '{}',
+    open_time VARCHAR(5),
+    close_time VARCHAR(5),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Workers seen leasing from each queue, for min_workers dispatch checks
+CREATE TABLE IF NOT EXISTS worker_heartbeats (
+    worker_id VARCHAR(255) NOT NULL,
+    queue VARCHAR(255) NOT NULL,
+    last_seen TIMESTAMP NOT NULL,
+    weight INT NOT NULL DEFAULT 1 CHECK (weight > 0),
+    PRIMARY KEY (worker_id, queue)
+);
+CREATE INDEX IF NOT EXISTS idx_worker_heartbeats_queue ON worker_heartbeats(queue, last_seen);
+
+-- Drain requests; they apply to worker processes started before requested_at
+CREATE TABLE IF NOT EXISTS worker_drains (
+    worker_id VARCHAR(255) PRIMARY KEY,
+    requested_at TIMESTAMP NOT NULL
+);
+
+-- Job types excluded from leasing on every queue until resumed
+CREATE TABLE IF NOT EXISTS paused_types (
+    type VARCHAR(255) PRIMARY KEY,
+    paused_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- At most one row; while it exists no job on any queue is leased
+CREATE TABLE IF NOT EXISTS dispatch_pause (
+    singleton BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (singleton),
+    paused_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Job types whose failures are dead-lettered without retrying until cleared
+CREATE TABLE IF NOT EXISTS fail_fast_types (
+    type VARCHAR(255) PRIMARY KEY,
+    enabled_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Workflows: DAGs of jobs where each node runs once its upstreams succeed
+CREATE TABLE IF NOT EXISTS workflows (
+    id VARCHAR(36) PRIMARY KEY,
+    status VARCHAR(20) NOT NULL DEFAULT 'running',
+    failure_policy VARCHAR(20) NOT NULL DEFAULT 'fail_fast',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP
+);
+
+-- One row per workflow node, naming the job it runs and its upstream nodes
+CREATE TABLE IF NOT EXISTS workflow_nodes (
+    workflow_id VARCHAR(36) NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    job_id VARCHAR(36) NOT NULL,
+    depends_on JSONB NOT NULL DEFAULT '[]',
+    PRIMARY KEY (workflow_id, name)
+);
+
 -- Indexes for efficient queries
 CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status);
 CREATE INDEX IF NOT EXISTS idx_jobs_queue ON jobs(queue);
 CREATE INDEX IF NOT EXISTS idx_jobs_run_at ON jobs(run_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_kind_created ON jobs(kind, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_jobs_created ON jobs(created_at, id);
 CREATE INDEX IF NOT EXISTS idx_jobs_priority ON jobs(priority DESC);
 CREATE INDEX IF NOT EXISTS idx_jobs_lease ON jobs(lease_id) WHERE lease_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_jobs_dead_reason ON jobs(queue, dead_reason) WHERE status = 'dead';
+CREATE INDEX IF NOT EXISTS idx_jobs_dead_retry ON jobs(dead_at) WHERE status = 'dead' AND dead_retry;
+CREATE INDEX IF NOT EXISTS idx_jobs_sla ON jobs(updated_at, type) WHERE sla_met IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_jobs_lease_expiry ON jobs(lease_expires_at) WHERE status IN ('leased', 'processing');
+CREATE INDEX IF NOT EXISTS idx_jobs_idempotency
+    ON jobs(queue, idempotency_key, created_at)
+    WHERE idempotency_key IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_jobs_partition
+    ON jobs(queue, partition_key, seq)
+    WHERE partition_key IS NOT NULL AND status IN ('pending', 'leased', 'processing');
+CREATE INDEX IF NOT EXISTS idx_jobs_singleton
+    ON jobs(singleton_key)
+    WHERE singleton_key IS NOT NULL AND status IN ('pending', 'leased', 'processing');
+CREATE INDEX IF NOT EXISTS idx_jobs_unique_key
+    ON jobs(unique_key)
+    WHERE unique_key IS NOT NULL AND status IN ('pending', 'leased', 'processing');
+CREATE INDEX IF NOT EXISTS idx_jobs_deadline
+    ON jobs(queue, deadline)
+    WHERE deadline IS NOT NULL AND status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_jobs_workflow
+    ON jobs(workflow_id)
+    WHERE workflow_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_jobs_labels
+    ON jobs USING GIN (labels jsonb_path_ops)
+    WHERE status = 'pending';
 
 -- Composite index for job leasing queries
 CREATE INDEX IF NOT EXISTS idx_jobs_lease_query
@@ -40,6 +199,17 @@ SELECT
 FROM jobs
 GROUP BY queue, status;
 
+-- Periodic samples of queue_stats, for trend charts; pruned by the scheduler
+CREATE TABLE IF NOT EXISTS queue_stats_history (
+    sampled_at TIMESTAMP NOT NULL,
+    queue VARCHAR(255) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    count INT NOT NULL,
+    PRIMARY KEY (queue, sampled_at, status)
+);
+
+CREATE INDEX IF NOT EXISTS idx_queue_stats_history_sampled ON queue_stats_history(sampled_at);
+
 -- Update timestamp trigger
 CREATE OR REPLACE FUNCTION update_updated_at_column()
 RETURNS TRIGGER AS $$
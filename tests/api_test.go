@@ -0,0 +1,324 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/goquorra/goquorra/internal/api"
+	"github.com/goquorra/goquorra/internal/config"
+	"github.com/goquorra/goquorra/internal/queue"
+	"github.com/goquorra/goquorra/internal/store"
+)
+
+// newTestAPI serves the HTTP API over s with the config read from the
+// environment, so tests set QUORRA_* variables before calling it. The
+// manager is returned unused so tests can still configure it.
+func newTestAPI(t *testing.T, s store.Store) (*httptest.Server, *queue.Manager) {
+	t.Helper()
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	logger := log.New(io.Discard, "", 0)
+	qm := queue.NewManager(s, nil, testCollector(), logger)
+	queueLimits, _ := cfg.QueueRateLimitsByQueue()
+	qm.SetQueueRateLimits(queueLimits)
+	h := api.NewHandler(s, qm, testCollector(), cfg, logger)
+
+	srv := httptest.NewServer(h.Router())
+	t.Cleanup(srv.Close)
+	return srv, qm
+}
+
+// apiRequest sends body to path with the configured API key and decodes the
+// JSON response
+func apiRequest(t *testing.T, srv *httptest.Server, method, path, body string) (int, map[string]interface{}) {
+	t.Helper()
+	req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "test-api-key")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to %s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	var result map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result
+}
+
+func TestRateLimitBodyLimit(t *testing.T) {
+	t.Setenv("QUORRA_API_KEY", "test-api-key")
+	t.Setenv("QUORRA_MAX_REQUEST_BYTES", "1024")
+	t.Setenv("QUORRA_QUEUE_RATE_LIMITS", "limited=1")
+	srv, _ := newTestAPI(t, store.NewInMemoryStore())
+
+	big := `{"type":"test_rate_limit","queue":"limited","payload":{"data":"` + strings.Repeat("x", 2048) + `"}}`
+	if status, _ := apiRequest(t, srv, "POST", "/v1/jobs", big); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 for an oversized body, got %d", status)
+	}
+
+	small := `{"type":"test_rate_limit","queue":"limited","payload":{"n":1}}`
+	if status, result := apiRequest(t, srv, "POST", "/v1/jobs", small); status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d %v", status, result)
+	}
+	status, result := apiRequest(t, srv, "POST", "/v1/jobs", small)
+	if status != http.StatusTooManyRequests || result["limit"] != "queue:limited" {
+		t.Errorf("Expected 429 for queue:limited, got %d %v", status, result)
+	}
+
+	if status, _ := apiRequest(t, srv, "POST", "/v1/jobs", `{"queue":`); status != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a malformed body, got %d", status)
+	}
+}
+
+func TestQueueRateLimitAllRoutes(t *testing.T) {
+	t.Setenv("QUORRA_API_KEY", "test-api-key")
+	t.Setenv("QUORRA_QUEUE_RATE_LIMITS", "limited=1")
+	srv, qm := newTestAPI(t, store.NewInMemoryStore())
+
+	// Routing decides the queue charged, not the queue in the request
+	err := qm.SetRoutingRules(context.Background(), []*store.RoutingRule{
+		{TypePattern: "test_rate_routed", Queue: "limited"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to set routing rules: %v", err)
+	}
+	if status, result := apiRequest(t, srv, "POST", "/v1/jobs", `{"type":"test_rate_routed"}`); status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d %v", status, result)
+	}
+
+	status, result := apiRequest(t, srv, "POST", "/v1/jobs/batch", `{"jobs":[{"type":"test_rate_routed"},{"type":"test_rate_other"}]}`)
+	if status != http.StatusCreated {
+		t.Fatalf("Expected status 201 for a partly limited batch, got %d %v", status, result)
+	}
+	errs, _ := result["errors"].([]interface{})
+	if len(errs) != 1 {
+		t.Fatalf("Expected one error, got %v", result["errors"])
+	}
+	if e := errs[0].(map[string]interface{}); e["index"] != float64(0) || e["code"] != "rate_limited" {
+		t.Errorf("Expected index 0 to be rate_limited, got %v", e)
+	}
+	if jobs, _ := result["jobs"].([]interface{}); len(jobs) != 1 {
+		t.Errorf("Expected the other queue's job to be created, got %v", result["jobs"])
+	}
+
+	status, result = apiRequest(t, srv, "POST", "/v1/workflows", `{"nodes":[{"name":"a","job":{"type":"test_rate_wf","queue":"limited"}}]}`)
+	if status != http.StatusTooManyRequests || result["limit"] != "queue:limited" {
+		t.Errorf("Expected 429 for queue:limited on a workflow, got %d %v", status, result)
+	}
+
+	status, result = apiRequest(t, srv, "POST", "/v1/import", `{"type":"test_rate_import","queue":"limited","payload":{}}`)
+	if status != http.StatusOK || result["imported"] != float64(0) || result["failed"] != float64(1) {
+		t.Errorf("Expected the import line to fail on the rate limit, got %d %v", status, result)
+	}
+}
+
+func TestCreateJobsBatchValidationErrors(t *testing.T) {
+	t.Setenv("QUORRA_API_KEY", "test-api-key")
+	t.Setenv("QUORRA_GRPC_MAX_MSG_BYTES", "65636") // 100 bytes left for payloads
+	t.Setenv("QUORRA_MAX_PAYLOAD_DEPTH", "3")
+	s := store.NewInMemoryStore()
+	srv, _ := newTestAPI(t, s)
+
+	body := `{"jobs":[
+		{"type":"test_batch_ok","queue":"test_batch"},
+		{"queue":"test_batch"},
+		{"type":"test_batch","queue":"bad queue!"},
+		{"type":"test_batch","queue":"test_batch","payload":{"data":"` + strings.Repeat("x", 200) + `"}},
+		{"type":"test_batch_ok","queue":"test_batch"},
+		{"type":"test_batch","queue":"test_batch","payload":{"a":{"b":{"c":{"d":1}}}}},
+		{"type":"test_batch","queue":"_system"}
+	]}`
+	status, result := apiRequest(t, srv, "POST", "/v1/jobs/batch", body)
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422, got %d %v", status, result)
+	}
+
+	want := []struct {
+		index       float64
+		field, code string
+	}{
+		{1, "type", "required"},
+		{2, "queue", "invalid"},
+		{3, "payload", "too_large"},
+		{5, "payload", "too_complex"},
+		{6, "queue", "reserved"},
+	}
+	errs, _ := result["errors"].([]interface{})
+	if len(errs) != len(want) {
+		t.Fatalf("Expected %d errors, got %v", len(want), result["errors"])
+	}
+	for i, w := range want {
+		e := errs[i].(map[string]interface{})
+		if e["index"] != w.index || e["field"] != w.field || e["code"] != w.code || e["message"] == "" {
+			t.Errorf("Expected error %d at index %v on %s with code %s, got %v", i, w.index, w.field, w.code, e)
+		}
+	}
+
+	// Nothing is created when any job fails validation
+	jobs, err := s.GetRecentJobs(context.Background(), store.KindUser, 10)
+	if err != nil {
+		t.Fatalf("Failed to list jobs: %v", err)
+	}
+	if len(jobs) != 0 {
+		t.Errorf("Expected no jobs created, got %d", len(jobs))
+	}
+}
+
+func TestCreateJobsBatchFailureStatus(t *testing.T) {
+	t.Setenv("QUORRA_API_KEY", "test-api-key")
+	srv, _ := newTestAPI(t, store.NewInMemoryStore())
+
+	// Bad requests detected at insert time are still the client's fault
+	body := `{"jobs":[{"type":"test_batch","queue":"test_batch","schedule_calendar":"test_missing"}]}`
+	if status, result := apiRequest(t, srv, "POST", "/v1/jobs/batch", body); status != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d %v", status, result)
+	}
+
+	id := uuid.NewString()
+	body = `{"jobs":[{"id":"` + id + `","type":"test_batch","queue":"test_batch"}]}`
+	if status, result := apiRequest(t, srv, "POST", "/v1/jobs/batch", body); status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d %v", status, result)
+	}
+	body = `{"jobs":[{"id":"` + id + `","type":"test_batch","queue":"test_batch"},{"type":"test_batch","queue":"test_batch","schedule_calendar":"test_missing"}]}`
+	if status, result := apiRequest(t, srv, "POST", "/v1/jobs/batch", body); status != http.StatusConflict {
+		t.Errorf("Expected status 409 with a conflict among the failures, got %d %v", status, result)
+	}
+}
+
+func TestCreateJobsBatchSpooled(t *testing.T) {
+	t.Setenv("QUORRA_API_KEY", "test-api-key")
+	primary := &flakyStore{Store: store.NewInMemoryStore(), down: true}
+	s := store.NewFailoverStore(primary, &memorySpool{}, log.New(io.Discard, "", 0))
+	srv, _ := newTestAPI(t, s)
+
+	status, result := apiRequest(t, srv, "POST", "/v1/jobs/batch", `{"jobs":[{"type":"test_batch","queue":"test_batch"}]}`)
+	jobs, _ := result["jobs"].([]interface{})
+	if status != http.StatusCreated || len(jobs) != 1 || jobs[0].(map[string]interface{})["spooled"] != true {
+		t.Errorf("Expected the job created as spooled, got %d %v", status, result)
+	}
+}
+
+func TestCreateInlineJobRejections(t *testing.T) {
+	t.Setenv("QUORRA_API_KEY", "test-api-key")
+	srv, qm := newTestAPI(t, store.NewInMemoryStore())
+	qm.EnableInlineExecution()
+	qm.RegisterInlineHandler("test_inline", func(ctx context.Context, job *store.Job) error {
+		return nil
+	})
+
+	for _, body := range []string{
+		`{"type":"test_inline_unknown","queue":"test_inline","inline":true}`,
+		`{"type":"test_inline","queue":"test_inline","inline":true,"delay_seconds":60}`,
+	} {
+		if status, result := apiRequest(t, srv, "POST", "/v1/jobs", body); status != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d %v", body, status, result)
+		}
+	}
+
+	// Batches report the rejection against the job's index
+	body := `{"jobs":[{"type":"test_inline","queue":"test_inline","inline":true,"delay_ms":500}]}`
+	_, result := apiRequest(t, srv, "POST", "/v1/jobs/batch", body)
+	errs, _ := result["errors"].([]interface{})
+	if len(errs) != 1 || errs[0].(map[string]interface{})["field"] != "inline" {
+		t.Errorf("Expected an inline error for the delayed batch job, got %v", result)
+	}
+
+	status, result := apiRequest(t, srv, "POST", "/v1/jobs", `{"type":"test_inline","queue":"test_inline","inline":true}`)
+	if status != http.StatusCreated || result["status"] != "succeeded" {
+		t.Errorf("Expected the inline job to succeed, got %d %v", status, result)
+	}
+
+	if _, err := qm.PauseJobType(context.Background(), "test_inline"); err != nil {
+		t.Fatalf("Failed to pause job type: %v", err)
+	}
+	status, result = apiRequest(t, srv, "POST", "/v1/jobs", `{"type":"test_inline","queue":"test_inline","inline":true}`)
+	if status != http.StatusConflict {
+		t.Errorf("Expected status 409 while the type is paused, got %d %v", status, result)
+	}
+}
+
+// workerFirstStore leases a job to a polling worker just before the manager
+// leases it by ID, as a worker can between an inline job's insert and lease
+type workerFirstStore struct {
+	store.Store
+}
+
+func (s workerFirstStore) LeaseJob(ctx context.Context, jobID, workerID string, leaseTTL time.Duration) (*store.Job, error) {
+	job, err := s.GetJob(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.LeaseJobs(ctx, job.Queue, "polling-worker", 1, time.Minute, store.LeaseOptions{}); err != nil {
+		return nil, err
+	}
+	return s.Store.LeaseJob(ctx, jobID, workerID, leaseTTL)
+}
+
+func TestCreateInlineJobLeasedByWorker(t *testing.T) {
+	t.Setenv("QUORRA_API_KEY", "test-api-key")
+	s := store.NewInMemoryStore()
+	srv, qm := newTestAPI(t, workerFirstStore{s})
+	qm.EnableInlineExecution()
+	qm.RegisterInlineHandler("test_inline", func(ctx context.Context, job *store.Job) error {
+		t.Error("The inline handler ran for a job a worker holds")
+		return nil
+	})
+
+	status, result := apiRequest(t, srv, "POST", "/v1/jobs", `{"type":"test_inline","queue":"test_inline_race","inline":true}`)
+	if status != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d %v", status, result)
+	}
+
+	jobs, _ := s.GetRecentJobs(context.Background(), store.KindUser, 10)
+	if len(jobs) != 1 || jobs[0].LeasedBy != "polling-worker" {
+		t.Errorf("Expected the job left with the polling worker, got %v", jobs)
+	}
+}
+
+func TestJobLifecycleThroughAPI(t *testing.T) {
+	t.Setenv("QUORRA_API_KEY", "test-api-key")
+	srv, qm := newTestAPI(t, store.NewInMemoryStore())
+	ctx := context.Background()
+
+	status, created := apiRequest(t, srv, "POST", "/v1/jobs", `{"type":"test_lifecycle","queue":"test_lifecycle","payload":{"n":1},"max_retries":3}`)
+	if status != http.StatusCreated || created["status"] != string(store.StatusPending) {
+		t.Fatalf("Expected a pending job created, got %d %v", status, created)
+	}
+	id, _ := created["id"].(string)
+
+	// A worker leases the job and fails it for good
+	jobs, err := qm.LeaseJobs(ctx, "test_lifecycle", "test-worker", 1, 30*time.Second, store.LeaseOptions{})
+	if err != nil || len(jobs) != 1 || jobs[0].ID != id {
+		t.Fatalf("Failed to lease the created job: %v", err)
+	}
+	if _, err := qm.AckJob(ctx, store.AckRequest{JobID: id, LeaseID: jobs[0].LeaseID, ErrorMessage: "bad input", DeadReason: store.DeadReasonPermanent}); err != nil {
+		t.Fatalf("Failed to nack job: %v", err)
+	}
+
+	status, job := apiRequest(t, srv, "GET", "/v1/jobs/"+id, "")
+	if status != http.StatusOK || job["status"] != string(store.StatusDead) || job["last_error"] != "bad input" {
+		t.Errorf("Expected the job dead with its error, got %d %v", status, job)
+	}
+
+	status, dead := apiRequest(t, srv, "GET", "/v1/dead?queue=test_lifecycle", "")
+	listed, _ := dead["jobs"].([]interface{})
+	if status != http.StatusOK || len(listed) != 1 || listed[0].(map[string]interface{})["id"] != id {
+		t.Errorf("Expected the job in the dead letter list, got %d %v", status, dead)
+	}
+
+	if status, _ := apiRequest(t, srv, "GET", "/v1/jobs/"+uuid.New().String(), ""); status != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown job, got %d", status)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -146,6 +147,47 @@ func TestMetricsEndpoint(t *testing.T) {
 	}
 }
 
+func TestDebugMetrics(t *testing.T) {
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	req, _ := http.NewRequest("POST", serverURL+"/v1/debug/metrics/reset", nil)
+	req.Header.Set("X-API-Key", apiKey)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to reset metrics: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		t.Skip("Server not started with QUORRA_DEBUG_ENDPOINTS=true")
+	}
+
+	for i := 0; i < 3; i++ {
+		createJob(t, map[string]interface{}{
+			"type":    "test_debug_metrics",
+			"payload": map[string]interface{}{},
+		})
+	}
+
+	req, _ = http.NewRequest("GET", serverURL+"/v1/debug/metrics", nil)
+	req.Header.Set("X-API-Key", apiKey)
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to get debug metrics: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Counters map[string]float64 `json:"counters"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if created := result.Counters[`quorra_jobs_created_total{kind="user"}`]; created != 3 {
+		t.Errorf("Expected exactly 3 jobs created since reset, got %v", created)
+	}
+}
+
 func TestDelayedJobScheduling(t *testing.T) {
 	jobReq := map[string]interface{}{
 		"type":          "test_delayed",
@@ -173,6 +215,64 @@ func TestDelayedJobScheduling(t *testing.T) {
 	t.Logf("Delayed job status after delay: %s", status)
 }
 
+func TestRequestBodyLimit(t *testing.T) {
+	// The server's default QUORRA_MAX_REQUEST_BYTES is 16 MB
+	job := `{"type":"test_body_limit","payload":{"data":"` + strings.Repeat("x", 17<<20) + `"}}`
+	bodies := map[string]string{
+		"/v1/jobs":       job,
+		"/v1/jobs/batch": `{"jobs":[` + job + `]}`,
+	}
+
+	for path, body := range bodies {
+		req, _ := http.NewRequest("POST", serverURL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", apiKey)
+
+		client := &http.Client{Timeout: 30 * time.Second}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to post to %s: %v", path, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected status 413 from %s, got %d", path, resp.StatusCode)
+		}
+	}
+}
+
+func TestPayloadComplexityLimits(t *testing.T) {
+	// The server's defaults are QUORRA_MAX_PAYLOAD_DEPTH=64 and QUORRA_MAX_PAYLOAD_KEYS=10000
+	var wide strings.Builder
+	for i := 0; i < 10001; i++ {
+		fmt.Fprintf(&wide, `"k%d":%d,`, i, i)
+	}
+	payloads := map[string]string{
+		"deep": strings.Repeat(`{"a":`, 100) + "1" + strings.Repeat("}", 100),
+		"wide": "{" + strings.TrimSuffix(wide.String(), ",") + "}",
+	}
+
+	for name, payload := range payloads {
+		body := `{"type":"test_payload_complexity","payload":` + payload + `}`
+		req, _ := http.NewRequest("POST", serverURL+"/v1/jobs", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", apiKey)
+
+		client := &http.Client{Timeout: 5 * time.Second}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to create %s job: %v", name, err)
+		}
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest || result["code"] != "too_complex" {
+			t.Errorf("Expected 400 too_complex for the %s payload, got %d %v", name, resp.StatusCode, result)
+		}
+	}
+}
+
 // Helper functions
 
 func createJob(t *testing.T, jobReq map[string]interface{}) string {
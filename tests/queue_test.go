@@ -1,13 +1,29 @@
 package tests
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"math"
+	"math/rand"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/goquorra/goquorra/internal/config"
+	pb "github.com/goquorra/goquorra/internal/grpc"
+	"github.com/goquorra/goquorra/internal/metrics"
 	"github.com/goquorra/goquorra/internal/queue"
 	"github.com/goquorra/goquorra/internal/store"
+	"github.com/goquorra/goquorra/internal/worker"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/encoding"
 )
 
 func TestQueueManager(t *testing.T) {
@@ -16,7 +32,7 @@ func TestQueueManager(t *testing.T) {
 
 	s := store.NewPostgresStore(db)
 	logger := log.New(os.Stdout, "[test] ", log.LstdFlags)
-	qm := queue.NewManager(s, nil, logger)
+	qm := queue.NewManager(s, nil, nil, logger)
 
 	ctx := context.Background()
 
@@ -48,3 +64,2767 @@ func TestQueueManager(t *testing.T) {
 		t.Error("Job ID mismatch")
 	}
 }
+
+func TestWaitForJobChange(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	s := store.NewPostgresStore(db)
+	logger := log.New(os.Stdout, "[test] ", log.LstdFlags)
+	qm := queue.NewManager(s, nil, nil, logger)
+
+	ctx := context.Background()
+
+	job, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:       "test_wait_change",
+		Payload:    map[string]interface{}{},
+		Queue:      "test_wait",
+		MaxRetries: 3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+
+	// Times out with the unchanged state
+	unchanged, err := qm.WaitForJobChange(ctx, job.ID, "", 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Failed to wait for job: %v", err)
+	}
+	if unchanged.Status != store.StatusPending {
+		t.Errorf("Expected status pending after timeout, got %s", unchanged.Status)
+	}
+
+	// Wakes when the job is leased
+	done := make(chan *store.Job, 1)
+	go func() {
+		changed, err := qm.WaitForJobChange(ctx, job.ID, store.StatusPending, 5*time.Second)
+		if err != nil {
+			t.Errorf("Failed to wait for job: %v", err)
+		}
+		done <- changed
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if _, err := qm.LeaseJobs(ctx, "test_wait", "test-worker", 1, 30*time.Second, store.LeaseOptions{}); err != nil {
+		t.Fatalf("Failed to lease job: %v", err)
+	}
+
+	select {
+	case changed := <-done:
+		if changed == nil || changed.Status != store.StatusLeased {
+			t.Errorf("Expected status leased, got %+v", changed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("WaitForJobChange did not wake on lease")
+	}
+}
+
+func TestFIFOPartitionOrdering(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	s := store.NewPostgresStore(db)
+	logger := log.New(os.Stdout, "[test] ", log.LstdFlags)
+	qm := queue.NewManager(s, nil, nil, logger)
+	qm.SetFIFOQueues([]string{"test_fifo"})
+
+	ctx := context.Background()
+
+	const numJobs = 10
+	for i := 0; i < numJobs; i++ {
+		_, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+			Type:         "test_fifo",
+			Payload:      map[string]interface{}{"seq": i},
+			Queue:        "test_fifo",
+			MaxRetries:   3,
+			PartitionKey: "user-1",
+		})
+		if err != nil {
+			t.Fatalf("Failed to enqueue job: %v", err)
+		}
+	}
+
+	var (
+		mu       sync.Mutex
+		order    []int
+		inFlight int
+	)
+
+	// Two workers race to lease from the same partition
+	worker := func(workerID string) {
+		deadline := time.Now().Add(10 * time.Second)
+		for time.Now().Before(deadline) {
+			mu.Lock()
+			done := len(order) == numJobs
+			mu.Unlock()
+			if done {
+				return
+			}
+
+			jobs, err := qm.LeaseJobs(ctx, "test_fifo", workerID, 5, 30*time.Second, store.LeaseOptions{})
+			if err != nil {
+				t.Errorf("Failed to lease jobs: %v", err)
+				return
+			}
+			if len(jobs) > 1 {
+				t.Errorf("Leased %d jobs from one partition at once", len(jobs))
+			}
+
+			for _, job := range jobs {
+				mu.Lock()
+				inFlight++
+				if inFlight > 1 {
+					t.Errorf("More than one job in flight for the partition")
+				}
+				order = append(order, int(job.Payload["seq"].(float64)))
+				mu.Unlock()
+
+				time.Sleep(5 * time.Millisecond)
+
+				mu.Lock()
+				inFlight--
+				mu.Unlock()
+
+				if _, err := qm.AckJob(ctx, store.AckRequest{JobID: job.ID, LeaseID: job.LeaseID, Success: true}); err != nil {
+					t.Errorf("Failed to ack job: %v", err)
+				}
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, id := range []string{"fifo-worker-1", "fifo-worker-2"} {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			worker(id)
+		}(id)
+	}
+	wg.Wait()
+
+	if len(order) != numJobs {
+		t.Fatalf("Expected %d jobs processed, got %d", numJobs, len(order))
+	}
+	for i, seq := range order {
+		if seq != i {
+			t.Fatalf("Jobs processed out of order: %v", order)
+		}
+	}
+}
+
+func TestSerialQueue(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	s := store.NewPostgresStore(db)
+	logger := log.New(os.Stdout, "[test] ", log.LstdFlags)
+	qm := queue.NewManager(s, nil, nil, logger)
+	qm.SetSerialQueues([]string{"test_serial"})
+
+	ctx := context.Background()
+
+	const numJobs = 10
+	for i := 0; i < numJobs; i++ {
+		// No partition keys: serial mode covers the whole queue
+		_, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+			Type:       "test_serial",
+			Payload:    map[string]interface{}{"seq": i},
+			Queue:      "test_serial",
+			MaxRetries: 3,
+		})
+		if err != nil {
+			t.Fatalf("Failed to enqueue job: %v", err)
+		}
+	}
+
+	var (
+		mu          sync.Mutex
+		processed   int
+		inFlight    int
+		maxInFlight int
+	)
+
+	worker := func(workerID string) {
+		deadline := time.Now().Add(10 * time.Second)
+		for time.Now().Before(deadline) {
+			mu.Lock()
+			done := processed == numJobs
+			mu.Unlock()
+			if done {
+				return
+			}
+
+			jobs, err := qm.LeaseJobs(ctx, "test_serial", workerID, 5, 30*time.Second, store.LeaseOptions{})
+			if err != nil {
+				t.Errorf("Failed to lease jobs: %v", err)
+				return
+			}
+			if len(jobs) > 1 {
+				t.Errorf("Leased %d jobs from a serial queue at once", len(jobs))
+			}
+
+			for _, job := range jobs {
+				mu.Lock()
+				inFlight++
+				if inFlight > maxInFlight {
+					maxInFlight = inFlight
+				}
+				mu.Unlock()
+
+				time.Sleep(5 * time.Millisecond)
+
+				// Leave the critical section before the ack frees the queue
+				mu.Lock()
+				inFlight--
+				processed++
+				mu.Unlock()
+
+				if _, err := qm.AckJob(ctx, store.AckRequest{JobID: job.ID, LeaseID: job.LeaseID, Success: true}); err != nil {
+					t.Errorf("Failed to ack job: %v", err)
+				}
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, id := range []string{"serial-worker-1", "serial-worker-2"} {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			worker(id)
+		}(id)
+	}
+	wg.Wait()
+
+	if processed != numJobs {
+		t.Fatalf("Expected %d jobs processed, got %d", numJobs, processed)
+	}
+	if maxInFlight != 1 {
+		t.Errorf("Expected one job in flight at a time, saw %d", maxInFlight)
+	}
+}
+
+func TestQueueRetryPolicyDefaults(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	s := store.NewPostgresStore(db)
+	logger := log.New(os.Stdout, "[test] ", log.LstdFlags)
+	qm := queue.NewManager(s, nil, nil, logger)
+
+	ctx := context.Background()
+
+	err := qm.SetQueueConfig(ctx, &store.QueueConfig{
+		Queue:              "test_webhooks",
+		MaxRetries:         10,
+		BackoffStrategy:    store.BackoffFixed,
+		BackoffBaseSeconds: 2,
+	})
+	if err != nil {
+		t.Fatalf("Failed to set queue config: %v", err)
+	}
+
+	// Unset fields come from the queue config
+	job, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:    "test_retry_policy",
+		Payload: map[string]interface{}{},
+		Queue:   "test_webhooks",
+	})
+	if err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+	if job.MaxRetries != 10 || job.BackoffStrategy != store.BackoffFixed || job.BackoffBaseSeconds != 2 {
+		t.Errorf("Expected queue retry policy, got max_retries=%d strategy=%s base=%d",
+			job.MaxRetries, job.BackoffStrategy, job.BackoffBaseSeconds)
+	}
+
+	// Request-level values still win
+	job, err = qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:            "test_retry_policy",
+		Payload:         map[string]interface{}{},
+		Queue:           "test_webhooks",
+		MaxRetries:      1,
+		BackoffStrategy: store.BackoffExponential,
+	})
+	if err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+	if job.MaxRetries != 1 || job.BackoffStrategy != store.BackoffExponential || job.BackoffBaseSeconds != 2 {
+		t.Errorf("Expected request overrides, got max_retries=%d strategy=%s base=%d",
+			job.MaxRetries, job.BackoffStrategy, job.BackoffBaseSeconds)
+	}
+}
+
+func TestQueueMinWorkers(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	s := store.NewPostgresStore(db)
+	logger := log.New(os.Stdout, "[test] ", log.LstdFlags)
+	qm := queue.NewManager(s, nil, nil, logger)
+
+	ctx := context.Background()
+
+	if err := qm.SetQueueConfig(ctx, &store.QueueConfig{Queue: "test_min_workers", MinWorkers: 2}); err != nil {
+		t.Fatalf("Failed to set queue config: %v", err)
+	}
+	job, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:    "test_min_workers",
+		Payload: map[string]interface{}{},
+		Queue:   "test_min_workers",
+	})
+	if err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+
+	// A lone survivor gets nothing
+	jobs, err := qm.LeaseJobs(ctx, "test_min_workers", "worker-a", 5, 30*time.Second, store.LeaseOptions{})
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(jobs) != 0 {
+		t.Fatalf("Expected no jobs with one healthy worker, got %d", len(jobs))
+	}
+
+	healthy, err := qm.CountHealthyWorkers(ctx, "test_min_workers")
+	if err != nil {
+		t.Fatalf("Failed to count healthy workers: %v", err)
+	}
+	if healthy != 1 {
+		t.Errorf("Expected 1 healthy worker, got %d", healthy)
+	}
+
+	// Once a second worker polls, the queue dispatches
+	jobs, err = qm.LeaseJobs(ctx, "test_min_workers", "worker-b", 5, 30*time.Second, store.LeaseOptions{})
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != job.ID {
+		t.Fatalf("Expected job %s once two workers are healthy, got %d jobs", job.ID, len(jobs))
+	}
+}
+
+func TestSystemJobKind(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	s := store.NewPostgresStore(db)
+	logger := log.New(os.Stdout, "[test] ", log.LstdFlags)
+	qm := queue.NewManager(s, nil, nil, logger)
+
+	ctx := context.Background()
+
+	systemJob, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:    "test_callback_delivery",
+		Payload: map[string]interface{}{},
+		Kind:    store.KindSystem,
+	})
+	if err != nil {
+		t.Fatalf("Failed to enqueue system job: %v", err)
+	}
+	if systemJob.Kind != store.KindSystem || systemJob.Queue != store.SystemQueue {
+		t.Errorf("Expected system job in %s, got kind=%s queue=%s", store.SystemQueue, systemJob.Kind, systemJob.Queue)
+	}
+
+	userJob, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:    "test_user_job",
+		Payload: map[string]interface{}{},
+	})
+	if err != nil {
+		t.Fatalf("Failed to enqueue user job: %v", err)
+	}
+	if userJob.Kind != store.KindUser || userJob.Queue != "default" {
+		t.Errorf("Expected user job in default, got kind=%s queue=%s", userJob.Kind, userJob.Queue)
+	}
+
+	recent, err := qm.GetRecentJobs(ctx, store.KindUser, 100)
+	if err != nil {
+		t.Fatalf("Failed to get recent jobs: %v", err)
+	}
+	for _, job := range recent {
+		if job.Kind != store.KindUser {
+			t.Errorf("kind=user filter returned %s job %s", job.Kind, job.ID)
+		}
+		if job.ID == systemJob.ID {
+			t.Error("kind=user filter returned the system job")
+		}
+	}
+}
+
+func TestInlineExecution(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	s := store.NewPostgresStore(db)
+	logger := log.New(os.Stdout, "[test] ", log.LstdFlags)
+	qm := queue.NewManager(s, nil, nil, logger)
+
+	ctx := context.Background()
+
+	req := &store.CreateJobRequest{
+		Type:    "test_inline_ok",
+		Payload: map[string]interface{}{"n": 1},
+		Queue:   "test_inline",
+		Inline:  true,
+	}
+	if _, err := qm.EnqueueJob(ctx, req); !errors.Is(err, queue.ErrInlineDisabled) {
+		t.Fatalf("Expected ErrInlineDisabled, got %v", err)
+	}
+
+	qm.EnableInlineExecution()
+	qm.RegisterInlineHandler("test_inline_ok", func(ctx context.Context, job *store.Job) error {
+		return nil
+	})
+	qm.RegisterInlineHandler("test_inline_fail", func(ctx context.Context, job *store.Job) error {
+		return errors.New("boom")
+	})
+
+	job, err := qm.EnqueueJob(ctx, req)
+	if err != nil {
+		t.Fatalf("Failed to run inline job: %v", err)
+	}
+	if job.Status != store.StatusSucceeded {
+		t.Errorf("Expected inline job to succeed, got %s", job.Status)
+	}
+
+	job, err = qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:       "test_inline_fail",
+		Payload:    map[string]interface{}{},
+		Queue:      "test_inline",
+		MaxRetries: 3,
+		Inline:     true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to run inline job: %v", err)
+	}
+	if job.Status != store.StatusPending || job.Attempts != 1 || job.LastError != "boom" {
+		t.Errorf("Expected failed attempt queued for retry, got status=%s attempts=%d error=%q",
+			job.Status, job.Attempts, job.LastError)
+	}
+}
+
+func TestLeasePriorityQuotas(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	s := store.NewPostgresStore(db)
+	logger := log.New(os.Stdout, "[test] ", log.LstdFlags)
+	qm := queue.NewManager(s, nil, nil, logger)
+
+	ctx := context.Background()
+	opts := store.LeaseOptions{
+		PriorityQuotas: []store.PriorityQuota{{MinPriority: 10, Reserved: 2}},
+	}
+
+	// Flood the queue with normal jobs
+	for i := 0; i < 20; i++ {
+		_, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+			Type:    "test_normal",
+			Payload: map[string]interface{}{"n": i},
+			Queue:   "test_quota",
+		})
+		if err != nil {
+			t.Fatalf("Failed to enqueue job: %v", err)
+		}
+	}
+
+	jobs, err := qm.LeaseJobs(ctx, "test_quota", "worker-1", 10, 30*time.Second, opts)
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(jobs) != 8 {
+		t.Errorf("Expected 8 normal jobs with 2 slots reserved, got %d", len(jobs))
+	}
+
+	critical, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:     "test_critical",
+		Payload:  map[string]interface{}{},
+		Queue:    "test_quota",
+		Priority: 10,
+	})
+	if err != nil {
+		t.Fatalf("Failed to enqueue critical job: %v", err)
+	}
+
+	// The reserved slots go to the critical job even with normal jobs waiting
+	jobs, err = qm.LeaseJobs(ctx, "test_quota", "worker-2", 2, 30*time.Second, opts)
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != critical.ID {
+		t.Errorf("Expected only the critical job, got %d jobs", len(jobs))
+	}
+}
+
+func TestLeaseMinPriority(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	s := store.NewPostgresStore(db)
+	logger := log.New(os.Stdout, "[test] ", log.LstdFlags)
+	qm := queue.NewManager(s, nil, nil, logger)
+
+	ctx := context.Background()
+	floor := 100
+	opts := store.LeaseOptions{MinPriority: &floor}
+
+	low, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:     "test_low",
+		Payload:  map[string]interface{}{},
+		Queue:    "test_min_priority",
+		Priority: 10,
+	})
+	if err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+
+	// The only job available is below the floor, so nothing is leased
+	jobs, err := qm.LeaseJobs(ctx, "test_min_priority", "critical-worker", 5, 30*time.Second, opts)
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(jobs) != 0 {
+		t.Fatalf("Expected no jobs below min_priority, got %d", len(jobs))
+	}
+
+	critical, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:     "test_critical",
+		Payload:  map[string]interface{}{},
+		Queue:    "test_min_priority",
+		Priority: 100,
+	})
+	if err != nil {
+		t.Fatalf("Failed to enqueue critical job: %v", err)
+	}
+
+	jobs, err = qm.LeaseJobs(ctx, "test_min_priority", "critical-worker", 5, 30*time.Second, opts)
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != critical.ID {
+		t.Errorf("Expected only the critical job, got %d jobs", len(jobs))
+	}
+
+	// A worker without a floor still picks up the low-priority job
+	jobs, err = qm.LeaseJobs(ctx, "test_min_priority", "worker-1", 5, 30*time.Second, store.LeaseOptions{})
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != low.ID {
+		t.Errorf("Expected the low-priority job, got %d jobs", len(jobs))
+	}
+}
+
+func TestLeaseMinPriorityIgnoresBoostInMemory(t *testing.T) {
+	s := store.NewInMemoryStore()
+	logger := log.New(io.Discard, "", 0)
+	qm := queue.NewManager(s, nil, nil, logger)
+	ctx := context.Background()
+
+	if _, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:       "test_low",
+		Payload:    map[string]interface{}{},
+		Queue:      "test_min_priority_boost",
+		Priority:   10,
+		MaxRetries: 3,
+	}); err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+	jobs, err := qm.LeaseJobs(ctx, "test_min_priority_boost", "worker-1", 1, 30*time.Second, store.LeaseOptions{})
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("Failed to lease job: %v", err)
+	}
+	if _, err := qm.AckJob(ctx, store.AckRequest{JobID: jobs[0].ID, LeaseID: jobs[0].LeaseID, ErrorMessage: "boom", RequeueFront: true}); err != nil {
+		t.Fatalf("Failed to nack job: %v", err)
+	}
+
+	// Reads report the job's own priority while it's boosted
+	requeued, err := qm.GetJob(ctx, jobs[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if requeued.Priority != 10 {
+		t.Errorf("Expected the boosted job to report priority 10, got %d", requeued.Priority)
+	}
+
+	// The front requeue boost moves the job up its queue, not past priority filters
+	floor, below := 100, 50
+	for _, opts := range []store.LeaseOptions{{MinPriority: &floor}, {PriorityAtLeast: &floor}} {
+		jobs, err = qm.LeaseJobs(ctx, "test_min_priority_boost", "critical-worker", 1, 30*time.Second, opts)
+		if err != nil {
+			t.Fatalf("Failed to lease jobs: %v", err)
+		}
+		if len(jobs) != 0 {
+			t.Errorf("Expected the boosted low-priority job to stay below the floor, got %d jobs", len(jobs))
+		}
+	}
+	jobs, err = qm.LeaseJobs(ctx, "test_min_priority_boost", "worker-1", 1, 30*time.Second, store.LeaseOptions{PriorityBelow: &below})
+	if err != nil || len(jobs) != 1 {
+		t.Errorf("Expected the boosted job in the low tier, got %d jobs (%v)", len(jobs), err)
+	}
+}
+
+func TestDelayedJobBecomesLeasable(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	s := store.NewPostgresStore(db)
+	logger := log.New(os.Stdout, "[test] ", log.LstdFlags)
+	qm := queue.NewManager(s, nil, nil, logger)
+
+	ctx := context.Background()
+
+	job, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:         "test_delayed",
+		Payload:      map[string]interface{}{},
+		Queue:        "test_delayed",
+		DelaySeconds: 1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+
+	jobs, err := qm.LeaseJobs(ctx, "test_delayed", "worker-1", 1, 30*time.Second, store.LeaseOptions{})
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(jobs) != 0 {
+		t.Fatal("Leased a delayed job before its run_at")
+	}
+
+	// No scheduler is running: a due job is leasable without being promoted
+	time.Sleep(time.Until(job.RunAt) + 100*time.Millisecond)
+
+	jobs, err = qm.LeaseJobs(ctx, "test_delayed", "worker-1", 1, 30*time.Second, store.LeaseOptions{})
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != job.ID {
+		t.Errorf("Expected the delayed job to be leasable after its run_at, got %d jobs", len(jobs))
+	}
+}
+
+func TestJobEnrichment(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	s := store.NewPostgresStore(db)
+	logger := log.New(os.Stdout, "[test] ", log.LstdFlags)
+	qm := queue.NewManager(s, nil, nil, logger)
+	qm.SetEnrichment(queue.Enrichment{
+		Labels:          map[string]string{"env": "staging", "team": "platform"},
+		StampEnqueuedBy: true,
+	})
+
+	ctx := context.Background()
+	job, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:       "test_enrich",
+		Payload:    map[string]interface{}{},
+		Queue:      "test_enrich",
+		Labels:     map[string]string{"team": "billing", queue.EnqueuedByLabel: "spoofed"},
+		EnqueuedBy: "10.0.0.7",
+	})
+	if err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+
+	got, err := qm.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	// Defaults fill in, the producer's labels win, and enqueued_by can't be spoofed
+	if got.Labels["env"] != "staging" || got.Labels["team"] != "billing" || got.Labels[queue.EnqueuedByLabel] != "10.0.0.7" {
+		t.Errorf("Unexpected labels %v", got.Labels)
+	}
+}
+
+func TestRoutingRules(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	s := store.NewPostgresStore(db)
+	logger := log.New(os.Stdout, "[test] ", log.LstdFlags)
+	qm := queue.NewManager(s, nil, nil, logger)
+
+	ctx := context.Background()
+
+	err := qm.SetRoutingRules(ctx, []*store.RoutingRule{
+		{TypePattern: "test_route_*", Queue: "test_routed_wildcard"},
+		{TypePattern: "test_route_exact", Queue: "test_routed_exact"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to set routing rules: %v", err)
+	}
+	defer qm.SetRoutingRules(ctx, nil)
+
+	cases := map[string]string{
+		"test_route_exact": "test_routed_exact",
+		"test_route_any":   "test_routed_wildcard",
+		"test_not_routed":  "test_origin",
+	}
+	for jobType, wantQueue := range cases {
+		job, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+			Type:    jobType,
+			Payload: map[string]interface{}{},
+			Queue:   "test_origin",
+		})
+		if err != nil {
+			t.Fatalf("Failed to enqueue job: %v", err)
+		}
+		if job.Queue != wantQueue {
+			t.Errorf("Expected %s to be routed to %s, got %s", jobType, wantQueue, job.Queue)
+		}
+	}
+}
+
+func TestExpiredDeadlineSkipsLease(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	s := store.NewPostgresStore(db)
+	logger := log.New(os.Stdout, "[test] ", log.LstdFlags)
+	qm := queue.NewManager(s, nil, nil, logger)
+
+	ctx := context.Background()
+
+	deadline := time.Now().Add(500 * time.Millisecond)
+	job, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:     "test_deadline",
+		Payload:  map[string]interface{}{},
+		Queue:    "test_deadline",
+		Deadline: &deadline,
+	})
+	if err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+
+	time.Sleep(time.Until(deadline) + 100*time.Millisecond)
+
+	jobs, err := qm.LeaseJobs(ctx, "test_deadline", "worker-1", 1, 30*time.Second, store.LeaseOptions{})
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(jobs) != 0 {
+		t.Error("Leased a job past its deadline")
+	}
+
+	expired, err := qm.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if expired.Status != store.StatusExpired {
+		t.Errorf("Expected status %s, got %s", store.StatusExpired, expired.Status)
+	}
+}
+
+func TestQueueMinWorkersWeighted(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	s := store.NewPostgresStore(db)
+	logger := log.New(os.Stdout, "[test] ", log.LstdFlags)
+	qm := queue.NewManager(s, nil, nil, logger)
+
+	ctx := context.Background()
+
+	if err := qm.SetQueueConfig(ctx, &store.QueueConfig{Queue: "test_weighted_workers", MinWorkers: 8}); err != nil {
+		t.Fatalf("Failed to set queue config: %v", err)
+	}
+	if _, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:    "test_weighted_workers",
+		Payload: map[string]interface{}{},
+		Queue:   "test_weighted_workers",
+	}); err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+
+	// Two small workers fall short of the required capacity
+	for _, id := range []string{"worker-small-a", "worker-small-b"} {
+		jobs, err := qm.LeaseJobs(ctx, "test_weighted_workers", id, 5, 30*time.Second, store.LeaseOptions{})
+		if err != nil {
+			t.Fatalf("Failed to lease jobs: %v", err)
+		}
+		if len(jobs) != 0 {
+			t.Fatalf("Expected no jobs with capacity below 8, got %d", len(jobs))
+		}
+	}
+
+	// One big worker makes up the difference on its own
+	jobs, err := qm.LeaseJobs(ctx, "test_weighted_workers", "worker-big", 5, 30*time.Second, store.LeaseOptions{Weight: 16})
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("Expected the job once capacity reaches 8, got %d jobs", len(jobs))
+	}
+
+	capacity, err := qm.HealthyWorkerCapacity(ctx, "test_weighted_workers")
+	if err != nil {
+		t.Fatalf("Failed to sum capacity: %v", err)
+	}
+	if capacity != 18 {
+		t.Errorf("Expected capacity 18, got %d", capacity)
+	}
+
+	workers, err := qm.ListWorkers(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list workers: %v", err)
+	}
+	found := false
+	for _, w := range workers {
+		if w.WorkerID == "worker-big" {
+			found = true
+			if w.Weight != 16 || len(w.Queues) != 1 || w.Queues[0] != "test_weighted_workers" {
+				t.Errorf("Unexpected worker info: %+v", w)
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected worker-big in the worker list")
+	}
+}
+
+func TestSubscribeJobEvents(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	s := store.NewPostgresStore(db)
+	logger := log.New(os.Stdout, "[test] ", log.LstdFlags)
+	qm := queue.NewManager(s, nil, nil, logger)
+
+	ctx := context.Background()
+
+	events, unsubscribe := qm.SubscribeJobEvents(queue.JobEventFilter{Queue: "test_job_events"})
+	defer unsubscribe()
+
+	next := func(want queue.JobEventType) *store.Job {
+		t.Helper()
+		select {
+		case event := <-events:
+			if event.Type != want {
+				t.Fatalf("Expected %s event, got %s", want, event.Type)
+			}
+			return event.Job
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for %s event", want)
+		}
+		return nil
+	}
+
+	// Jobs on other queues are filtered out
+	if _, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:    "test_job_events",
+		Payload: map[string]interface{}{},
+		Queue:   "test_job_events_other",
+	}); err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+	job, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:    "test_job_events",
+		Payload: map[string]interface{}{},
+		Queue:   "test_job_events",
+	})
+	if err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+	if got := next(queue.EventCreated); got.ID != job.ID {
+		t.Fatalf("Expected created event for %s, got %s", job.ID, got.ID)
+	}
+
+	jobs, err := qm.LeaseJobs(ctx, "test_job_events", "worker-1", 1, 30*time.Second, store.LeaseOptions{})
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("Failed to lease job: %v", err)
+	}
+	next(queue.EventLeased)
+
+	if _, err := qm.AckJob(ctx, store.AckRequest{JobID: job.ID, LeaseID: jobs[0].LeaseID, Success: true}); err != nil {
+		t.Fatalf("Failed to ack job: %v", err)
+	}
+	if got := next(queue.EventSucceeded); got.Status != store.StatusSucceeded {
+		t.Errorf("Expected a succeeded snapshot, got %s", got.Status)
+	}
+}
+
+func TestSubscribeJobEventsQuickChangesInMemory(t *testing.T) {
+	s := store.NewInMemoryStore()
+	logger := log.New(io.Discard, "", 0)
+	qm := queue.NewManager(s, nil, nil, logger)
+	ctx := context.Background()
+
+	events, unsubscribe := qm.SubscribeJobEvents(queue.JobEventFilter{Queue: "test_job_events"})
+	defer unsubscribe()
+
+	// Every change lands before the first event is dispatched, so each
+	// event's type must come from its change rather than the job's state
+	job, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:       "test_job_events",
+		Payload:    map[string]interface{}{},
+		Queue:      "test_job_events",
+		MaxRetries: 1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+	jobs, err := qm.LeaseJobs(ctx, "test_job_events", "worker-1", 1, 30*time.Second, store.LeaseOptions{})
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("Failed to lease job: %v", err)
+	}
+	if _, err := qm.AckJob(ctx, store.AckRequest{JobID: job.ID, LeaseID: jobs[0].LeaseID, ErrorMessage: "boom"}); err != nil {
+		t.Fatalf("Failed to nack job: %v", err)
+	}
+
+	for _, want := range []queue.JobEventType{queue.EventCreated, queue.EventLeased, queue.EventDead} {
+		select {
+		case event := <-events:
+			if event.Type != want {
+				t.Fatalf("Expected %s event, got %s", want, event.Type)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for %s event", want)
+		}
+	}
+}
+
+func TestStartReplay(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	s := store.NewPostgresStore(db)
+	logger := log.New(os.Stdout, "[test] ", log.LstdFlags)
+	qm := queue.NewManager(s, nil, nil, logger)
+
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		job, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+			Type:       "test_start_replay",
+			Payload:    map[string]interface{}{},
+			Queue:      "test_start_replay",
+			MaxRetries: 3,
+		})
+		if err != nil {
+			t.Fatalf("Failed to enqueue job: %v", err)
+		}
+		if _, err := s.KillJob(ctx, job.ID, "alice", ""); err != nil {
+			t.Fatalf("Failed to kill job: %v", err)
+		}
+	}
+
+	// Two jobs per second takes two batches to drain three jobs
+	replay, err := qm.StartReplay(ctx, store.DeadJobFilter{Queue: "test_start_replay"}, 2)
+	if err != nil {
+		t.Fatalf("Failed to start replay: %v", err)
+	}
+	if replay.Total != 3 || replay.Status != queue.ReplayRunning {
+		t.Fatalf("Expected a running replay of 3 jobs, got %+v", replay)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		replay = qm.GetReplay(replay.ID)
+		if replay.Status != queue.ReplayRunning {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for replay, got %+v", replay)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if replay.Status != queue.ReplayCompleted || replay.Replayed != 3 || replay.FinishedAt == nil {
+		t.Errorf("Expected replay completed with 3 jobs, got %+v", replay)
+	}
+	if qm.GetReplay("unknown") != nil {
+		t.Error("Expected nil for an unknown replay")
+	}
+}
+
+func TestCreateBatching(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	s := store.NewPostgresStore(db)
+	logger := log.New(os.Stdout, "[test] ", log.LstdFlags)
+	qm := queue.NewManager(s, nil, nil, logger)
+	qm.EnableCreateBatching(20*time.Millisecond, 10)
+
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	jobs := make([]*store.Job, 25)
+	errs := make([]error, 25)
+	for i := range jobs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			jobs[i], errs[i] = qm.EnqueueJob(ctx, &store.CreateJobRequest{
+				Type:    "test_create_batching",
+				Payload: map[string]interface{}{"i": i},
+				Queue:   "test_create_batching",
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for i, job := range jobs {
+		if errs[i] != nil {
+			t.Fatalf("Failed to enqueue job %d: %v", i, errs[i])
+		}
+		if job.Payload["i"] != float64(i) {
+			t.Errorf("Job %d got the wrong result: payload %v", i, job.Payload)
+		}
+		seen[job.ID] = true
+	}
+	if len(seen) != len(jobs) {
+		t.Errorf("Expected %d distinct jobs, got %d", len(jobs), len(seen))
+	}
+
+	// A bad request fails on its own
+	if _, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		ID:      "not-an-id",
+		Type:    "test_create_batching",
+		Payload: map[string]interface{}{},
+		Queue:   "test_create_batching",
+	}); !errors.Is(err, store.ErrInvalidJobID) {
+		t.Errorf("Expected ErrInvalidJobID, got %v", err)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	s := store.NewPostgresStore(db)
+	logger := log.New(os.Stdout, "[test] ", log.LstdFlags)
+	qm := queue.NewManager(s, nil, nil, logger)
+	s.SetRetryBudget(qm.RetryBudgetExhausted)
+
+	ctx := context.Background()
+	const queueName = "test_retry_budget"
+
+	if err := qm.SetQueueConfig(ctx, &store.QueueConfig{Queue: queueName, RetryBudgetPercent: 25}); err != nil {
+		t.Fatalf("Failed to set queue config: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		if _, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+			Type:       "test_retry_budget",
+			Payload:    map[string]interface{}{"n": i},
+			Queue:      queueName,
+			MaxRetries: 5,
+		}); err != nil {
+			t.Fatalf("Failed to enqueue job: %v", err)
+		}
+	}
+
+	// Twenty fresh leases, all failing; with no retries yet every failure
+	// is retried, straight away thanks to requeue_front
+	jobs, err := qm.LeaseJobs(ctx, queueName, "worker-1", 20, 30*time.Second, store.LeaseOptions{})
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(jobs) != 20 {
+		t.Fatalf("Expected 20 jobs, got %d", len(jobs))
+	}
+	for _, job := range jobs {
+		result, err := qm.AckJob(ctx, store.AckRequest{JobID: job.ID, LeaseID: job.LeaseID, ErrorMessage: "downstream down", RequeueFront: true})
+		if err != nil {
+			t.Fatalf("Failed to nack job: %v", err)
+		}
+		if result.Status != store.StatusPending {
+			t.Fatalf("Expected the job to be retried, got %s", result.Status)
+		}
+	}
+
+	// Leasing them again makes half the window retries, over the 25% budget
+	jobs, err = qm.LeaseJobs(ctx, queueName, "worker-1", 20, 30*time.Second, store.LeaseOptions{})
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	status, err := qm.RetryBudgetStatus(ctx, queueName)
+	if err != nil {
+		t.Fatalf("Failed to get retry budget: %v", err)
+	}
+	if status.FreshLeases != 20 || status.RetryLeases != len(jobs) || !status.Exhausted {
+		t.Fatalf("Expected 20 fresh and %d retry leases over budget, got %+v", len(jobs), status)
+	}
+
+	result, err := qm.AckJob(ctx, store.AckRequest{JobID: jobs[0].ID, LeaseID: jobs[0].LeaseID, ErrorMessage: "downstream down"})
+	if err != nil {
+		t.Fatalf("Failed to nack job: %v", err)
+	}
+	if result.Status != store.StatusDead || result.DeadReason != store.DeadReasonRetryBudget {
+		t.Errorf("Expected the failure dead-lettered by the retry budget, got status=%s reason=%s", result.Status, result.DeadReason)
+	}
+
+	// Successes are unaffected
+	result, err = qm.AckJob(ctx, store.AckRequest{JobID: jobs[1].ID, LeaseID: jobs[1].LeaseID, Success: true})
+	if err != nil {
+		t.Fatalf("Failed to ack job: %v", err)
+	}
+	if result.Status != store.StatusSucceeded {
+		t.Errorf("Expected the job to succeed, got %s", result.Status)
+	}
+}
+
+func TestInMemoryStore(t *testing.T) {
+	s := store.NewInMemoryStore()
+	logger := log.New(io.Discard, "", 0)
+	qm := queue.NewManager(s, nil, nil, logger)
+
+	ctx := context.Background()
+	const queueName = "test_memory"
+
+	job, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:            "test_in_memory",
+		Payload:         map[string]interface{}{"n": 1},
+		Queue:           queueName,
+		MaxRetries:      2,
+		BackoffSchedule: []int{0},
+	})
+	if err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+
+	jobs, err := qm.LeaseJobs(ctx, queueName, "worker-1", 10, 30*time.Second, store.LeaseOptions{})
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != job.ID || jobs[0].Payload["n"] != float64(1) {
+		t.Fatalf("Expected to lease job %s with its payload, got %+v", job.ID, jobs)
+	}
+	first := jobs[0]
+
+	result, err := qm.AckJob(ctx, store.AckRequest{JobID: job.ID, LeaseID: first.LeaseID, ErrorMessage: "boom"})
+	if err != nil {
+		t.Fatalf("Failed to nack job: %v", err)
+	}
+	if result.Status != store.StatusPending {
+		t.Fatalf("Expected the job to be retried, got %s", result.Status)
+	}
+
+	jobs, err = qm.LeaseJobs(ctx, queueName, "worker-2", 10, 30*time.Second, store.LeaseOptions{})
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].Attempts != 1 || jobs[0].LeaseEpoch != first.LeaseEpoch+1 {
+		t.Fatalf("Expected the job re-leased after 1 attempt on a new epoch, got %+v", jobs)
+	}
+
+	// The first worker's lease is gone, so its late ack is rejected
+	if _, err := qm.AckJob(ctx, store.AckRequest{JobID: job.ID, LeaseID: first.LeaseID, Success: true}); err == nil {
+		t.Fatal("Expected an ack under a stale lease to fail")
+	}
+
+	result, err = qm.AckJob(ctx, store.AckRequest{JobID: job.ID, LeaseID: jobs[0].LeaseID, ErrorMessage: "boom"})
+	if err != nil {
+		t.Fatalf("Failed to nack job: %v", err)
+	}
+	if result.Status != store.StatusDead || result.DeadReason != store.DeadReasonMaxRetries {
+		t.Fatalf("Expected the job dead-lettered after its last retry, got status=%s reason=%s", result.Status, result.DeadReason)
+	}
+
+	dead, err := s.ListDeadJobs(ctx, queueName, "", 10)
+	if err != nil {
+		t.Fatalf("Failed to list dead jobs: %v", err)
+	}
+	if len(dead) != 1 || dead[0].ID != job.ID {
+		t.Errorf("Expected job %s in the dead-letter queue, got %+v", job.ID, dead)
+	}
+	attempts, err := s.ListJobAttempts(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Failed to list attempts: %v", err)
+	}
+	if len(attempts) != 2 || attempts[1].WorkerID != "worker-2" || attempts[1].Outcome != store.AttemptFailed {
+		t.Errorf("Expected 2 failed attempts, got %+v", attempts)
+	}
+}
+
+func TestInMemoryStoreConcurrentLease(t *testing.T) {
+	s := store.NewInMemoryStore()
+	ctx := context.Background()
+	const queueName = "test_memory_concurrent"
+	const jobCount = 200
+
+	for i := 0; i < jobCount; i++ {
+		if _, err := s.CreateJob(ctx, &store.CreateJobRequest{
+			Type:    "test_in_memory",
+			Payload: map[string]interface{}{"n": i},
+			Queue:   queueName,
+		}); err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+	}
+
+	var mu sync.Mutex
+	leased := make(map[string]int)
+	var wg sync.WaitGroup
+	for w := 0; w < 10; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				jobs, err := s.LeaseJobs(ctx, queueName, "worker", 3, 30*time.Second, store.LeaseOptions{})
+				if err != nil {
+					t.Errorf("Failed to lease jobs: %v", err)
+					return
+				}
+				if len(jobs) == 0 {
+					return
+				}
+				mu.Lock()
+				for _, job := range jobs {
+					leased[job.ID]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(leased) != jobCount {
+		t.Fatalf("Expected all %d jobs leased, got %d", jobCount, len(leased))
+	}
+	for id, n := range leased {
+		if n != 1 {
+			t.Errorf("Job %s was leased %d times", id, n)
+		}
+	}
+}
+
+func TestAdaptiveBackoff(t *testing.T) {
+	s := store.NewInMemoryStore()
+	logger := log.New(io.Discard, "", 0)
+	qm := queue.NewManager(s, nil, nil, logger)
+	qm.SetAdaptiveBackoff(queue.AdaptiveBackoff{MaxMultiplier: 8, Window: time.Minute})
+	s.SetBackoffMultiplier(qm.BackoffMultiplier)
+
+	ctx := context.Background()
+	const queueName = "test_adaptive_backoff"
+	const jobType = "test_flaky_downstream"
+
+	var ids []string
+	for i := 0; i < 25; i++ {
+		job, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+			Type:            jobType,
+			Payload:         map[string]interface{}{"n": i},
+			Queue:           queueName,
+			MaxRetries:      5,
+			BackoffSchedule: []int{10},
+		})
+		if err != nil {
+			t.Fatalf("Failed to enqueue job: %v", err)
+		}
+		ids = append(ids, job.ID)
+	}
+
+	jobs, err := qm.LeaseJobs(ctx, queueName, "worker-1", 25, 30*time.Second, store.LeaseOptions{})
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(jobs) != 25 {
+		t.Fatalf("Expected 25 leased jobs, got %d", len(jobs))
+	}
+	leases := make(map[string]string)
+	for _, job := range jobs {
+		leases[job.ID] = job.LeaseID
+	}
+
+	// Fail every job; once 20 failures are in the window the type's backoff is inflated
+	for _, id := range ids {
+		if _, err := qm.AckJob(ctx, store.AckRequest{JobID: id, LeaseID: leases[id], ErrorMessage: "downstream down"}); err != nil {
+			t.Fatalf("Failed to nack job: %v", err)
+		}
+	}
+
+	if m := qm.BackoffMultiplier(jobType); m != 8 {
+		t.Errorf("Expected multiplier 8 with every ack failing, got %v", m)
+	}
+	if m := qm.BackoffMultiplier("test_other_type"); m != 1 {
+		t.Errorf("Expected other types unaffected, got multiplier %v", m)
+	}
+
+	first, err := qm.GetJob(ctx, ids[0])
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if delay := time.Until(first.RunAt); delay > 15*time.Second {
+		t.Errorf("Expected the first failure to use the plain 10s backoff, got %v", delay)
+	}
+	last, err := qm.GetJob(ctx, ids[len(ids)-1])
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if delay := time.Until(last.RunAt); delay < 60*time.Second {
+		t.Errorf("Expected the last failure's 10s backoff inflated to ~80s, got %v", delay)
+	}
+}
+
+func TestJobTypeFailFast(t *testing.T) {
+	s := store.NewInMemoryStore()
+	logger := log.New(io.Discard, "", 0)
+	qm := queue.NewManager(s, nil, nil, logger)
+
+	ctx := context.Background()
+	const queueName = "test_fail_fast"
+	const jobType = "test_broken_type"
+
+	if _, err := qm.SetJobTypeFailFast(ctx, jobType); err != nil {
+		t.Fatalf("Failed to set fail-fast: %v", err)
+	}
+	for _, typ := range []string{jobType, "test_healthy_type"} {
+		if _, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+			Type:       typ,
+			Payload:    map[string]interface{}{},
+			Queue:      queueName,
+			MaxRetries: 5,
+		}); err != nil {
+			t.Fatalf("Failed to enqueue job: %v", err)
+		}
+	}
+
+	// Jobs of a fail-fast type are still leased, but a failure skips its retries
+	jobs, err := qm.LeaseJobs(ctx, queueName, "worker-1", 2, 30*time.Second, store.LeaseOptions{})
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("Expected 2 leased jobs, got %d", len(jobs))
+	}
+	for _, job := range jobs {
+		result, err := qm.AckJob(ctx, store.AckRequest{JobID: job.ID, LeaseID: job.LeaseID, ErrorMessage: "broken"})
+		if err != nil {
+			t.Fatalf("Failed to nack job: %v", err)
+		}
+		if job.Type == jobType {
+			if result.Status != store.StatusDead || result.DeadReason != store.DeadReasonFailFast {
+				t.Errorf("Expected the fail-fast job dead-lettered, got status=%s reason=%s", result.Status, result.DeadReason)
+			}
+		} else if result.Status != store.StatusPending {
+			t.Errorf("Expected other types to be retried, got %s", result.Status)
+		}
+	}
+
+	types, err := qm.ListFailFastJobTypes(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list fail-fast types: %v", err)
+	}
+	if len(types) != 1 || types[0].Type != jobType {
+		t.Errorf("Expected only %s to be fail-fast, got %+v", jobType, types)
+	}
+
+	// Once cleared, failures of the type are retried again
+	if cleared, err := qm.ClearJobTypeFailFast(ctx, jobType); err != nil || !cleared {
+		t.Fatalf("Expected fail-fast to be cleared, got %v, %v", cleared, err)
+	}
+	if cleared, err := qm.ClearJobTypeFailFast(ctx, jobType); err != nil || cleared {
+		t.Errorf("Expected clearing twice to report false, got %v, %v", cleared, err)
+	}
+	job, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{Type: jobType, Payload: map[string]interface{}{}, Queue: "test_fail_fast_cleared", MaxRetries: 5})
+	if err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+	jobs, err = qm.LeaseJobs(ctx, "test_fail_fast_cleared", "worker-1", 1, 30*time.Second, store.LeaseOptions{})
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("Expected to lease the job, got %d jobs, %v", len(jobs), err)
+	}
+	result, err := qm.AckJob(ctx, store.AckRequest{JobID: job.ID, LeaseID: jobs[0].LeaseID, ErrorMessage: "broken"})
+	if err != nil {
+		t.Fatalf("Failed to nack job: %v", err)
+	}
+	if result.Status != store.StatusPending {
+		t.Errorf("Expected the job to be retried after clearing fail-fast, got %s", result.Status)
+	}
+}
+
+func TestDelayedDeliveryMs(t *testing.T) {
+	s := store.NewInMemoryStore()
+	logger := log.New(io.Discard, "", 0)
+	qm := queue.NewManager(s, nil, nil, logger)
+
+	ctx := context.Background()
+	const queueName = "test_delay_ms"
+
+	job, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:    "test_paced",
+		Payload: map[string]interface{}{},
+		Queue:   queueName,
+		DelayMs: 200,
+	})
+	if err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+	if delay := job.RunAt.Sub(job.CreatedAt); delay != 200*time.Millisecond {
+		t.Errorf("Expected run_at 200ms after creation, got %v", delay)
+	}
+
+	// A client's offset must survive the timezone-less run_at column
+	client := time.FixedZone("client", -7*60*60)
+	runAt := time.Now().Add(time.Hour).Truncate(time.Millisecond).In(client)
+	scheduled, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:    "test_paced",
+		Payload: map[string]interface{}{},
+		Queue:   queueName,
+		RunAt:   &runAt,
+	})
+	if err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+	if !scheduled.RunAt.Equal(runAt) {
+		t.Errorf("Expected run_at %v, got %v", runAt, scheduled.RunAt)
+	}
+
+	jobs, err := qm.LeaseJobs(ctx, queueName, "worker-1", 10, 30*time.Second, store.LeaseOptions{})
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(jobs) != 0 {
+		t.Fatalf("Expected no jobs leasable before the delay, got %d", len(jobs))
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	jobs, err = qm.LeaseJobs(ctx, queueName, "worker-1", 10, 30*time.Second, store.LeaseOptions{})
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != job.ID {
+		t.Fatalf("Expected only the 200ms-delayed job leasable, got %+v", jobs)
+	}
+}
+
+func TestRunAtFromClientOffset(t *testing.T) {
+	now := time.Now()
+	runAt := now.Add(time.Hour).In(time.FixedZone("client", 9*60*60+30*60))
+	req := &store.CreateJobRequest{RunAt: &runAt}
+
+	got := req.RunAtFrom(now)
+	if !got.Equal(runAt) || got.Location() != now.Location() {
+		t.Errorf("Expected run_at %v in %s, got %v", runAt, now.Location(), got)
+	}
+}
+
+func TestWorkerQueueWeights(t *testing.T) {
+	weights, err := worker.ParseQueueWeights("test_critical=3, test_bulk=1")
+	if err != nil {
+		t.Fatalf("Failed to parse queue weights: %v", err)
+	}
+	if _, err := worker.ParseQueueWeights("test_critical=0"); err == nil {
+		t.Error("Expected a zero weight to be rejected")
+	}
+
+	// With both queues saturated every slot is used, so the allocation is
+	// the leased ratio; 5 slots per poll doesn't divide 3:1 evenly
+	wq := worker.NewWeightedQueues([]string{"test_critical", "test_bulk", "test_unweighted"}, weights)
+	totals := make(map[string]int)
+	for poll := 0; poll < 100; poll++ {
+		alloc := wq.Allocate(5)
+		sum := 0
+		for queue, n := range alloc {
+			totals[queue] += n
+			sum += n
+		}
+		if sum != 5 {
+			t.Fatalf("Expected 5 slots allocated per poll, got %v", alloc)
+		}
+	}
+
+	if totals["test_critical"] != 300 || totals["test_bulk"] != 100 || totals["test_unweighted"] != 100 {
+		t.Errorf("Expected slots split 3:1:1, got %v", totals)
+	}
+}
+
+func TestWorkerQueueWeightsRandom(t *testing.T) {
+	weights := map[string]int{"test_critical": 6, "test_bulk": 3}
+	wq := worker.NewWeightedRandomQueues([]string{"test_critical", "test_bulk", "test_unweighted"}, weights, rand.New(rand.NewSource(42)))
+
+	// Each slot is drawn independently, so over many polls every queue's
+	// share should land near weight/total (6:3:1)
+	const polls, slots = 10000, 5
+	totals := make(map[string]int)
+	for poll := 0; poll < polls; poll++ {
+		sum := 0
+		for queue, n := range wq.Allocate(slots) {
+			totals[queue] += n
+			sum += n
+		}
+		if sum != slots {
+			t.Fatalf("Expected %d slots allocated per poll, got %d", slots, sum)
+		}
+	}
+
+	for queue, want := range map[string]float64{"test_critical": 0.6, "test_bulk": 0.3, "test_unweighted": 0.1} {
+		got := float64(totals[queue]) / (polls * slots)
+		if math.Abs(got-want) > 0.01 {
+			t.Errorf("Expected %s to get about %.0f%% of slots, got %.2f%%", queue, want*100, got*100)
+		}
+	}
+}
+
+func TestTraceSampled(t *testing.T) {
+	if !pb.TraceSampled("job", 1) || pb.TraceSampled("job", 0) {
+		t.Fatal("Expected rate 1 to trace every job and rate 0 none")
+	}
+
+	sampled := 0
+	for i := 0; i < 10000; i++ {
+		id := fmt.Sprintf("test-job-%d", i)
+		traced := pb.TraceSampled(id, 0.1)
+		if traced != pb.TraceSampled(id, 0.1) {
+			t.Fatalf("Expected job %s to be sampled consistently", id)
+		}
+		if traced {
+			sampled++
+			// A job sampled at some rate stays sampled at higher rates
+			if !pb.TraceSampled(id, 0.5) {
+				t.Errorf("Expected job %s sampled at 0.1 to be sampled at 0.5", id)
+			}
+		}
+	}
+	if sampled < 800 || sampled > 1200 {
+		t.Errorf("Expected about 10%% of 10000 jobs sampled, got %d", sampled)
+	}
+}
+
+func TestManagerTraceSampledNackLogs(t *testing.T) {
+	s := store.NewInMemoryStore()
+	var logs strings.Builder
+	qm := queue.NewManager(s, nil, nil, log.New(&logs, "", 0))
+	qm.SetTraceSampleRate(0)
+	ctx := context.Background()
+
+	job, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:       "test_trace_nack",
+		Payload:    map[string]interface{}{},
+		Queue:      "test_trace_nack",
+		MaxRetries: 2,
+	})
+	if err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+
+	// The retried nack isn't logged for an untraced job; its dead-lettering is
+	for i := 0; i < 2; i++ {
+		jobs, err := qm.LeaseJobs(ctx, "test_trace_nack", "worker-1", 1, 30*time.Second, store.LeaseOptions{})
+		if err != nil || len(jobs) != 1 {
+			t.Fatalf("Failed to lease job: %v", err)
+		}
+		if _, err := qm.AckJob(ctx, store.AckRequest{JobID: job.ID, LeaseID: jobs[0].LeaseID, ErrorMessage: "boom", RequeueFront: i == 0}); err != nil {
+			t.Fatalf("Failed to nack job: %v", err)
+		}
+	}
+	if strings.Contains(logs.String(), "failed") {
+		t.Errorf("Expected no retried nack logged for an untraced job, got:\n%s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "Job "+job.ID+" dead") {
+		t.Errorf("Expected the dead-lettering logged, got:\n%s", logs.String())
+	}
+}
+
+// benchmarkEnqueue enqueues jobs from many goroutines, as concurrent HTTP
+// creates would
+func benchmarkEnqueue(b *testing.B, batchWindow time.Duration) {
+	db := setupTestDB(b)
+	defer db.Close()
+
+	s := store.NewPostgresStore(db)
+	logger := log.New(io.Discard, "", 0)
+	qm := queue.NewManager(s, nil, nil, logger)
+	if batchWindow > 0 {
+		qm.EnableCreateBatching(batchWindow, 100)
+	}
+
+	ctx := context.Background()
+
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+				Type:    "test_bench_enqueue",
+				Payload: map[string]interface{}{"bench": true},
+				Queue:   "test_bench_enqueue",
+			}); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkEnqueueSingleInsert(b *testing.B) {
+	benchmarkEnqueue(b, 0)
+}
+
+func BenchmarkEnqueueBatchedInsert(b *testing.B) {
+	benchmarkEnqueue(b, 5*time.Millisecond)
+}
+
+// benchmarkPayload builds a JSON job payload of about size bytes: a list of
+// order records with the mix of IDs, names, amounts and timestamps real
+// payloads carry, so it compresses like one
+func benchmarkPayload(size int) []byte {
+	rng := rand.New(rand.NewSource(1))
+	names := []string{"alice", "bob", "carol", "dave", "erin", "frank", "grace", "heidi"}
+	statuses := []string{"pending", "paid", "shipped", "refunded"}
+	var orders []map[string]interface{}
+	for {
+		orders = append(orders, map[string]interface{}{
+			"order_id":   fmt.Sprintf("ord_%016x", rng.Uint64()),
+			"customer":   names[rng.Intn(len(names))] + fmt.Sprintf("%d@example.com", rng.Intn(10000)),
+			"amount":     math.Round(rng.Float64()*50000) / 100,
+			"currency":   "EUR",
+			"status":     statuses[rng.Intn(len(statuses))],
+			"created_at": time.Unix(1700000000+rng.Int63n(1e7), 0).UTC().Format(time.RFC3339),
+		})
+		payload, _ := json.Marshal(map[string]interface{}{"orders": orders})
+		if len(payload) >= size {
+			return payload
+		}
+	}
+}
+
+// BenchmarkGRPCGzipPayload measures what QUORRA_GRPC_COMPRESSION=gzip costs
+// per message with gRPC's gzip compressor, and reports the compressed size
+// as a percentage of the original
+func BenchmarkGRPCGzipPayload(b *testing.B) {
+	compressor := encoding.GetCompressor("gzip")
+	for _, size := range []int{256, 1 << 10, 10 << 10, 100 << 10} {
+		payload := benchmarkPayload(size)
+		b.Run(fmt.Sprintf("%dB", size), func(b *testing.B) {
+			var buf bytes.Buffer
+			b.SetBytes(int64(len(payload)))
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				w, err := compressor.Compress(&buf)
+				if err != nil {
+					b.Fatal(err)
+				}
+				w.Write(payload)
+				w.Close()
+			}
+			b.ReportMetric(float64(buf.Len())/float64(len(payload))*100, "%size")
+		})
+	}
+}
+
+// testCollector is shared by the tests because Prometheus metrics can only
+// be registered once per process
+var testCollector = sync.OnceValue(metrics.NewCollector)
+
+// leaseStream collects the jobs a LeaseJobs call sends
+type leaseStream struct {
+	pb.WorkerService_LeaseJobsServer
+	ctx  context.Context
+	jobs []*pb.Job
+}
+
+func (s *leaseStream) Context() context.Context { return s.ctx }
+
+func (s *leaseStream) Send(job *pb.Job) error {
+	s.jobs = append(s.jobs, job)
+	return nil
+}
+
+func TestMaxLeaseBatch(t *testing.T) {
+	s := store.NewInMemoryStore()
+	logger := log.New(io.Discard, "", 0)
+	qm := queue.NewManager(s, nil, nil, logger)
+	service := pb.NewWorkerService(qm, testCollector(), logger)
+	service.SetMaxLeaseBatch(10)
+
+	ctx := context.Background()
+	const queueName = "test_max_lease_batch"
+	for i := 0; i < 25; i++ {
+		if _, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+			Type:    "test_max_lease_batch",
+			Payload: map[string]interface{}{"n": i},
+			Queue:   queueName,
+		}); err != nil {
+			t.Fatalf("Failed to enqueue job: %v", err)
+		}
+	}
+
+	stream := &leaseStream{ctx: ctx}
+	req := &pb.LeaseRequest{WorkerId: "greedy-worker", Queue: queueName, MaxJobs: 100000, LeaseTtlSeconds: 30}
+	if err := service.LeaseJobs(req, stream); err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(stream.jobs) != 10 {
+		t.Errorf("Expected the absurd batch clamped to 10 jobs, got %d", len(stream.jobs))
+	}
+
+	// Without a cap the worker gets everything left
+	service.SetMaxLeaseBatch(0)
+	stream = &leaseStream{ctx: ctx}
+	if err := service.LeaseJobs(req, stream); err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(stream.jobs) != 15 {
+		t.Errorf("Expected the remaining 15 jobs without a cap, got %d", len(stream.jobs))
+	}
+}
+
+func TestWorkerServiceInMemory(t *testing.T) {
+	s := store.NewInMemoryStore()
+	logger := log.New(io.Discard, "", 0)
+	qm := queue.NewManager(s, nil, nil, logger)
+	service := pb.NewWorkerService(qm, testCollector(), logger)
+
+	ctx := context.Background()
+	const queueName = "test_worker_service"
+	ids := make(map[string]string)
+	for _, name := range []string{"ok", "retry", "permanent"} {
+		job, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+			Type:       "test_worker_service",
+			Payload:    map[string]interface{}{"name": name},
+			Queue:      queueName,
+			MaxRetries: 5,
+		})
+		if err != nil {
+			t.Fatalf("Failed to enqueue job: %v", err)
+		}
+		ids[name] = job.ID
+	}
+
+	stream := &leaseStream{ctx: ctx}
+	req := &pb.LeaseRequest{WorkerId: "test-worker", Queue: queueName, MaxJobs: 10, LeaseTtlSeconds: 30}
+	if err := service.LeaseJobs(req, stream); err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(stream.jobs) != 3 {
+		t.Fatalf("Expected 3 jobs, got %d", len(stream.jobs))
+	}
+	leased := make(map[string]*pb.Job)
+	for _, job := range stream.jobs {
+		var payload map[string]interface{}
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			t.Fatalf("Failed to decode payload of job %s: %v", job.Id, err)
+		}
+		leased[payload["name"].(string)] = job
+	}
+
+	// Nothing is left for a second worker while the leases are held
+	other := &leaseStream{ctx: ctx}
+	if err := service.LeaseJobs(&pb.LeaseRequest{WorkerId: "test-worker-2", Queue: queueName, MaxJobs: 10, LeaseTtlSeconds: 30}, other); err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(other.jobs) != 0 {
+		t.Errorf("Expected no jobs for a second worker, got %d", len(other.jobs))
+	}
+
+	ack := &pb.JobAck{JobId: leased["ok"].Id, WorkerId: "test-worker", LeaseId: leased["ok"].LeaseId, Success: true}
+	if resp, err := service.AckJob(ctx, ack); err != nil || !resp.Acknowledged {
+		t.Fatalf("Failed to ack job: %v", err)
+	}
+	// The lease is gone, so a repeated ack is refused
+	if resp, err := service.AckJob(ctx, ack); err == nil || resp.Acknowledged {
+		t.Error("Expected a repeated ack to be refused")
+	}
+
+	if _, err := service.NackJob(ctx, &pb.JobAck{JobId: leased["retry"].Id, WorkerId: "test-worker", LeaseId: leased["retry"].LeaseId, ErrorMessage: "transient"}); err != nil {
+		t.Fatalf("Failed to nack job: %v", err)
+	}
+	if _, err := service.NackJob(ctx, &pb.JobAck{JobId: leased["permanent"].Id, WorkerId: "test-worker", LeaseId: leased["permanent"].LeaseId, ErrorMessage: "bad input", DeadReason: "permanent_failure"}); err != nil {
+		t.Fatalf("Failed to nack job: %v", err)
+	}
+
+	for name, want := range map[string]store.JobStatus{"ok": store.StatusSucceeded, "retry": store.StatusPending, "permanent": store.StatusDead} {
+		job, err := qm.GetJob(ctx, ids[name])
+		if err != nil {
+			t.Fatalf("Failed to get job: %v", err)
+		}
+		if job.Status != want {
+			t.Errorf("Expected the %s job %s, got %s", name, want, job.Status)
+		}
+	}
+}
+
+func TestWaitForInFlightCountsLocalLeases(t *testing.T) {
+	// Two servers sharing one store
+	s := store.NewInMemoryStore()
+	logger := log.New(io.Discard, "", 0)
+	qmA := queue.NewManager(s, nil, nil, logger)
+	qmB := queue.NewManager(s, nil, nil, logger)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, err := qmA.EnqueueJob(ctx, &store.CreateJobRequest{
+			Type:       "test_drain",
+			Payload:    map[string]interface{}{},
+			Queue:      "test_drain",
+			MaxRetries: 3,
+		})
+		if err != nil {
+			t.Fatalf("Failed to enqueue job: %v", err)
+		}
+	}
+	leasedA, err := qmA.LeaseJobs(ctx, "test_drain", "worker-a", 1, time.Minute, store.LeaseOptions{})
+	if err != nil || len(leasedA) != 1 {
+		t.Fatalf("Failed to lease from server A: %v", err)
+	}
+	if leasedB, err := qmB.LeaseJobs(ctx, "test_drain", "worker-b", 1, time.Minute, store.LeaseOptions{}); err != nil || len(leasedB) != 1 {
+		t.Fatalf("Failed to lease from server B: %v", err)
+	}
+
+	qmA.StopLeasing()
+	if inFlight, err := qmA.CountInFlightJobs(ctx); err != nil || inFlight != 1 {
+		t.Fatalf("Expected server A to count only its own job, got %d (%v)", inFlight, err)
+	}
+
+	if _, err := qmA.AckJob(ctx, store.AckRequest{JobID: leasedA[0].ID, LeaseID: leasedA[0].LeaseID, Success: true}); err != nil {
+		t.Fatalf("Failed to ack job: %v", err)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	remaining, err := qmA.WaitForInFlight(waitCtx)
+	if err != nil || remaining != 0 {
+		t.Errorf("Expected server A to drain despite server B's job, got %d (%v)", remaining, err)
+	}
+	if waitCtx.Err() != nil {
+		t.Error("Expected the drain to finish before the timeout")
+	}
+}
+
+func TestReleaseJobInMemory(t *testing.T) {
+	s := store.NewInMemoryStore()
+	// Past the deferral cap, so a retry_after nack would count as an attempt
+	s.SetMaxDeferrals(0)
+	logger := log.New(io.Discard, "", 0)
+	qm := queue.NewManager(s, nil, nil, logger)
+	service := pb.NewWorkerService(qm, testCollector(), logger)
+	ctx := context.Background()
+
+	job, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:       "test_release",
+		Payload:    map[string]interface{}{},
+		Queue:      "test_release",
+		MaxRetries: 3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		stream := &leaseStream{ctx: ctx}
+		if err := service.LeaseJobs(&pb.LeaseRequest{WorkerId: "test-worker", Queue: "test_release", MaxJobs: 1, LeaseTtlSeconds: 30}, stream); err != nil {
+			t.Fatalf("Failed to lease jobs: %v", err)
+		}
+		if len(stream.jobs) != 1 {
+			t.Fatalf("Expected the released job leased again right away, got %d jobs", len(stream.jobs))
+		}
+		leased := stream.jobs[0]
+		resp, err := service.NackJob(ctx, &pb.JobAck{
+			JobId: leased.Id, WorkerId: "test-worker", LeaseId: leased.LeaseId, LeaseEpoch: leased.LeaseEpoch,
+			RetryAfterSeconds: 60, Release: true,
+		})
+		if err != nil || !resp.Acknowledged {
+			t.Fatalf("Failed to release job: %v", err)
+		}
+	}
+
+	released, err := qm.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if released.Status != store.StatusPending || released.Attempts != 0 || released.LeaseID != "" {
+		t.Errorf("Expected the job pending with no attempts and no lease, got status=%s attempts=%d lease=%q", released.Status, released.Attempts, released.LeaseID)
+	}
+	if released.RunAt.After(time.Now()) {
+		t.Error("Expected release to ignore retry_after_seconds")
+	}
+	attempts, err := qm.ListJobAttempts(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Failed to list attempts: %v", err)
+	}
+	if len(attempts) != 0 {
+		t.Errorf("Expected no attempts recorded for released leases, got %d", len(attempts))
+	}
+
+	// A release needs the current lease, like any nack
+	if _, err := service.NackJob(ctx, &pb.JobAck{JobId: job.ID, WorkerId: "test-worker", LeaseId: "stale", Release: true}); err == nil {
+		t.Error("Expected a release without the lease to be refused")
+	}
+	if _, err := service.NackJobs(ctx, &pb.BatchNack{Nacks: []*pb.JobAck{{JobId: job.ID, Release: true}}}); err == nil {
+		t.Error("Expected NackJobs to refuse a release")
+	}
+}
+
+func TestWorkerLeaseMetrics(t *testing.T) {
+	s := store.NewInMemoryStore()
+	logger := log.New(io.Discard, "", 0)
+	qm := queue.NewManager(s, nil, nil, logger)
+	// Counts accumulate across runs, so the test gets a collector of its own
+	collector := metrics.NewCollectorWith(prometheus.NewRegistry())
+	collector.SetWorkerLeaseLimit(2)
+	service := pb.NewWorkerService(qm, collector, logger)
+
+	ctx := context.Background()
+	const queueName = "test_worker_lease_metrics"
+	for i := 0; i < 10; i++ {
+		if _, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+			Type:    "test_worker_lease_metrics",
+			Payload: map[string]interface{}{"n": i},
+			Queue:   queueName,
+		}); err != nil {
+			t.Fatalf("Failed to enqueue job: %v", err)
+		}
+	}
+
+	// Only two workers get their own series; the third is counted as other
+	for _, lease := range []struct {
+		workerID string
+		maxJobs  int32
+	}{{"test-leaser-hot", 5}, {"test-leaser-cold", 1}, {"test-leaser-extra", 3}} {
+		stream := &leaseStream{ctx: ctx}
+		req := &pb.LeaseRequest{WorkerId: lease.workerID, Queue: queueName, MaxJobs: lease.maxJobs, LeaseTtlSeconds: 30}
+		if err := service.LeaseJobs(req, stream); err != nil {
+			t.Fatalf("Failed to lease jobs: %v", err)
+		}
+	}
+
+	snapshot := collector.Snapshot()
+	if got := snapshot[`quorra_worker_jobs_leased_total{worker_id="test-leaser-hot"}`]; got != 5 {
+		t.Errorf("Expected 5 jobs counted for the hot worker, got %v", got)
+	}
+	if got := snapshot[`quorra_worker_jobs_leased_total{worker_id="test-leaser-extra"}`]; got != 0 {
+		t.Errorf("Expected no series for a worker past the limit, got %v", got)
+	}
+
+	if got := snapshot[`quorra_worker_jobs_leased_total{worker_id="other"}`]; got != 3 {
+		t.Errorf("Expected 3 jobs counted under other, got %v", got)
+	}
+
+	// other is many workers, so it isn't ranked as one
+	top := collector.TopLeasers(10)
+	want := []metrics.WorkerLeaseCount{
+		{WorkerID: "test-leaser-hot", Leased: 5},
+		{WorkerID: "test-leaser-cold", Leased: 1},
+	}
+	if len(top) != len(want) {
+		t.Fatalf("Expected top leasers %v, got %v", want, top)
+	}
+	for i := range want {
+		if top[i] != want[i] {
+			t.Errorf("Expected top leasers %v, got %v", want, top)
+			break
+		}
+	}
+}
+
+func TestGRPCHealthReporter(t *testing.T) {
+	var pingErr error
+	reporter := pb.NewHealthReporter(func(ctx context.Context) error { return pingErr }, log.New(io.Discard, "", 0))
+	ctx := context.Background()
+
+	if reporter.Serving() {
+		t.Error("Expected NOT_SERVING before the first check")
+	}
+	if !reporter.Check(ctx) || !reporter.Serving() {
+		t.Error("Expected SERVING while the database is reachable")
+	}
+
+	pingErr = errors.New("connection refused")
+	if reporter.Check(ctx) || reporter.Serving() {
+		t.Error("Expected NOT_SERVING while the database is unreachable")
+	}
+
+	// Shutdown is final, even once the database is back
+	pingErr = nil
+	reporter.Check(ctx)
+	reporter.Shutdown()
+	if reporter.Check(ctx) || reporter.Serving() {
+		t.Error("Expected NOT_SERVING after shutdown")
+	}
+}
+
+func TestSLAStats(t *testing.T) {
+	s := store.NewInMemoryStore()
+	logger := log.New(io.Discard, "", 0)
+	qm := queue.NewManager(s, nil, nil, logger)
+
+	ctx := context.Background()
+	const queueName = "test_sla"
+	const jobType = "test_sla_type"
+
+	deadline := time.Now().Add(time.Hour)
+	for _, req := range []*store.CreateJobRequest{
+		{Type: jobType, Payload: map[string]interface{}{}, Queue: queueName, MaxRetries: 1, Deadline: &deadline},
+		{Type: jobType, Payload: map[string]interface{}{}, Queue: queueName, MaxRetries: 1, Deadline: &deadline},
+		{Type: jobType, Payload: map[string]interface{}{}, Queue: queueName, MaxRetries: 1},
+	} {
+		if _, err := qm.EnqueueJob(ctx, req); err != nil {
+			t.Fatalf("Failed to enqueue job: %v", err)
+		}
+	}
+
+	jobs, err := qm.LeaseJobs(ctx, queueName, "worker-1", 3, 30*time.Second, store.LeaseOptions{})
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(jobs) != 3 {
+		t.Fatalf("Expected 3 leased jobs, got %d", len(jobs))
+	}
+
+	// One job with a deadline succeeds in time and the other is dead-lettered
+	// as it has no retries left; the job without a deadline doesn't count
+	failed := false
+	for _, job := range jobs {
+		req := store.AckRequest{JobID: job.ID, LeaseID: job.LeaseID, Success: true}
+		if job.Deadline != nil && !failed {
+			req = store.AckRequest{JobID: job.ID, LeaseID: job.LeaseID, ErrorMessage: "failed"}
+			failed = true
+		}
+		result, err := qm.AckJob(ctx, req)
+		if err != nil {
+			t.Fatalf("Failed to ack job: %v", err)
+		}
+		if job.Deadline == nil && result.SLAMet != nil {
+			t.Errorf("Expected no SLA outcome for a job without a deadline")
+		}
+	}
+
+	stats, err := qm.GetSLAStats(ctx, jobType, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to get SLA stats: %v", err)
+	}
+	if stats.Met != 1 || stats.Missed != 1 {
+		t.Errorf("Expected 1 met and 1 missed, got met=%d missed=%d", stats.Met, stats.Missed)
+	}
+
+	other, err := qm.GetSLAStats(ctx, "test_other_type", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to get SLA stats: %v", err)
+	}
+	if other.Met != 0 || other.Missed != 0 {
+		t.Errorf("Expected no SLA outcomes for another type, got met=%d missed=%d", other.Met, other.Missed)
+	}
+
+	// Jobs that expire before they're leased, or die when their last lease
+	// lapses, miss their SLA as well
+	const expiredType = "test_sla_expired"
+	past := time.Now().Add(-time.Second)
+	if _, err := s.CreateJob(ctx, &store.CreateJobRequest{
+		Type: expiredType, Payload: map[string]interface{}{}, Queue: "test_sla_expired", MaxRetries: 1, Deadline: &past,
+	}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	if ids, err := s.ExpireJobs(ctx, "test_sla_expired"); err != nil || len(ids) != 1 {
+		t.Fatalf("Expected 1 expired job, got %v (%v)", ids, err)
+	}
+	if _, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type: expiredType, Payload: map[string]interface{}{}, Queue: queueName, MaxRetries: 1, Deadline: &deadline,
+	}); err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+	if _, err := qm.LeaseJobs(ctx, queueName, "worker-1", 1, time.Millisecond, store.LeaseOptions{}); err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, dead, err := s.ReclaimExpiredLeases(ctx); err != nil || len(dead) != 1 {
+		t.Fatalf("Expected 1 job dead-lettered by reclaim, got %v (%v)", dead, err)
+	}
+
+	expired, err := qm.GetSLAStats(ctx, expiredType, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to get SLA stats: %v", err)
+	}
+	if expired.Met != 0 || expired.Missed != 2 {
+		t.Errorf("Expected 2 missed, got met=%d missed=%d", expired.Met, expired.Missed)
+	}
+}
+
+func TestRecentJobsCache(t *testing.T) {
+	s := store.NewInMemoryStore()
+	logger := log.New(io.Discard, "", 0)
+	qm := queue.NewManager(s, nil, nil, logger)
+	qm.SetRecentJobsCacheTTL(time.Minute)
+
+	ctx := context.Background()
+	enqueue := func() {
+		if _, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+			Type:    "test_recent_cache",
+			Payload: map[string]interface{}{},
+			Queue:   "test_recent_cache",
+		}); err != nil {
+			t.Fatalf("Failed to enqueue job: %v", err)
+		}
+	}
+	recent := func(limit int) int {
+		jobs, err := qm.GetRecentJobs(ctx, "", limit)
+		if err != nil {
+			t.Fatalf("Failed to get recent jobs: %v", err)
+		}
+		return len(jobs)
+	}
+
+	enqueue()
+	if n := recent(10); n != 1 {
+		t.Fatalf("Expected 1 recent job, got %d", n)
+	}
+
+	// Within the TTL the same request reuses the cached result
+	enqueue()
+	if n := recent(10); n != 1 {
+		t.Errorf("Expected the cached 1 recent job, got %d", n)
+	}
+
+	// A different limit isn't served from the cache
+	if n := recent(20); n != 2 {
+		t.Errorf("Expected 2 recent jobs for a new limit, got %d", n)
+	}
+
+	// Disabling the cache always reads the store
+	qm.SetRecentJobsCacheTTL(0)
+	enqueue()
+	if n := recent(20); n != 3 {
+		t.Errorf("Expected 3 recent jobs with the cache disabled, got %d", n)
+	}
+}
+
+func TestNackRetryableInMemory(t *testing.T) {
+	s := store.NewInMemoryStore()
+	logger := log.New(io.Discard, "", 0)
+	qm := queue.NewManager(s, nil, nil, logger)
+	service := pb.NewWorkerService(qm, testCollector(), logger)
+
+	ctx := context.Background()
+	const queueName = "test_nack_retryable"
+	for i := 0; i < 2; i++ {
+		if _, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+			Type:       "test_nack_retryable",
+			Payload:    map[string]interface{}{},
+			Queue:      queueName,
+			MaxRetries: 5,
+		}); err != nil {
+			t.Fatalf("Failed to enqueue job: %v", err)
+		}
+	}
+	jobs, err := qm.LeaseJobs(ctx, queueName, "worker-1", 2, 30*time.Second, store.LeaseOptions{})
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("Expected 2 leased jobs, got %d", len(jobs))
+	}
+
+	// A non-retryable failure is dead-lettered despite the retries left
+	notRetryable := false
+	if _, err := service.NackJob(ctx, &pb.JobAck{
+		JobId:        jobs[0].ID,
+		WorkerId:     "worker-1",
+		LeaseId:      jobs[0].LeaseID,
+		ErrorMessage: "400 Bad Request",
+		Retryable:    &notRetryable,
+	}); err != nil {
+		t.Fatalf("Failed to nack job: %v", err)
+	}
+	dead, err := qm.GetJob(ctx, jobs[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if dead.Status != store.StatusDead || dead.DeadReason != store.DeadReasonPermanent {
+		t.Errorf("Expected the job dead-lettered as permanent_failure, got status=%s reason=%s", dead.Status, dead.DeadReason)
+	}
+
+	// A retryable failure waits the requested delay and counts as an attempt
+	retryable := true
+	before := time.Now()
+	if _, err := service.NackJob(ctx, &pb.JobAck{
+		JobId:             jobs[1].ID,
+		WorkerId:          "worker-1",
+		LeaseId:           jobs[1].LeaseID,
+		ErrorMessage:      "503 Service Unavailable",
+		Retryable:         &retryable,
+		RetryDelaySeconds: 120,
+	}); err != nil {
+		t.Fatalf("Failed to nack job: %v", err)
+	}
+	retried, err := qm.GetJob(ctx, jobs[1].ID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if retried.Status != store.StatusPending {
+		t.Fatalf("Expected the job pending for retry, got %s", retried.Status)
+	}
+	if retried.Attempts != 1 {
+		t.Errorf("Expected the retry to count as an attempt, got %d attempts", retried.Attempts)
+	}
+	if retried.RunAt.Before(before.Add(120*time.Second)) || retried.RunAt.After(time.Now().Add(120*time.Second)) {
+		t.Errorf("Expected run_at 120s after the nack, got %v", retried.RunAt)
+	}
+}
+
+func TestPauseDispatchInMemory(t *testing.T) {
+	s := store.NewInMemoryStore()
+	logger := log.New(io.Discard, "", 0)
+	qm := queue.NewManager(s, nil, nil, logger)
+
+	ctx := context.Background()
+	const queueName = "test_pause_dispatch"
+	if _, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:    "test_pause_dispatch",
+		Payload: map[string]interface{}{},
+		Queue:   queueName,
+	}); err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+
+	if _, err := qm.PauseDispatch(ctx); err != nil {
+		t.Fatalf("Failed to pause dispatch: %v", err)
+	}
+	if !qm.DispatchPaused() {
+		t.Error("Expected dispatch to be reported paused")
+	}
+	jobs, err := qm.LeaseJobs(ctx, queueName, "worker-1", 10, 30*time.Second, store.LeaseOptions{})
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(jobs) != 0 {
+		t.Fatalf("Expected no jobs leased while dispatch is paused, got %d", len(jobs))
+	}
+
+	// Inline execution leases too, so it's refused before the job is created
+	qm.EnableInlineExecution()
+	qm.RegisterInlineHandler("test_pause_dispatch", func(ctx context.Context, job *store.Job) error {
+		return nil
+	})
+	if _, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:    "test_pause_dispatch",
+		Payload: map[string]interface{}{},
+		Queue:   "test_pause_dispatch_inline",
+		Inline:  true,
+	}); !errors.Is(err, queue.ErrInlinePaused) {
+		t.Errorf("Expected ErrInlinePaused, got %v", err)
+	}
+
+	resumed, err := qm.ResumeDispatch(ctx)
+	if err != nil || !resumed {
+		t.Fatalf("Failed to resume dispatch: resumed=%v err=%v", resumed, err)
+	}
+	if qm.DispatchPaused() {
+		t.Error("Expected dispatch to be reported resumed")
+	}
+	jobs, err = qm.LeaseJobs(ctx, queueName, "worker-1", 10, 30*time.Second, store.LeaseOptions{})
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("Expected the job leased after resuming, got %d", len(jobs))
+	}
+}
+
+func TestEffectiveSettings(t *testing.T) {
+	t.Setenv("QUORRA_API_KEY", "test-secret-key")
+	t.Setenv("DATABASE_URL", "postgres://quorra:test-secret-password@db:5432/quorra")
+	t.Setenv("QUORRA_LONG_POLL_MAX_WAIT", "45s")
+	t.Setenv("QUORRA_MAX_LEASE_BATCH", "lots")
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	settings := make(map[string]config.Setting)
+	for _, setting := range cfg.EffectiveSettings() {
+		settings[setting.Name] = setting
+	}
+
+	if got := settings["QUORRA_LONG_POLL_MAX_WAIT"]; got.Value != "45s" || got.Default {
+		t.Errorf("Expected QUORRA_LONG_POLL_MAX_WAIT=45s as set, got %+v", got)
+	}
+	// An unparseable value falls back to the default, and shows what was ignored
+	if got := settings["QUORRA_MAX_LEASE_BATCH"]; got.Value != "100" || !got.Default || got.Raw != "lots" {
+		t.Errorf("Expected QUORRA_MAX_LEASE_BATCH to default to 100 ignoring %q, got %+v", "lots", got)
+	}
+	if got := settings["QUORRA_GRPC_ADDR"]; got.Value != ":50051" || !got.Default {
+		t.Errorf("Expected QUORRA_GRPC_ADDR to default to :50051, got %+v", got)
+	}
+
+	// Secrets never appear
+	if got := settings["QUORRA_API_KEY"]; got.Value != "REDACTED" {
+		t.Errorf("Expected QUORRA_API_KEY redacted, got %+v", got)
+	}
+	if got := settings["DATABASE_URL"]; strings.Contains(got.Value, "test-secret-password") || !strings.Contains(got.Value, "db:5432") {
+		t.Errorf("Expected DATABASE_URL with only its password redacted, got %+v", got)
+	}
+}
+
+func TestConfigPayloadLimits(t *testing.T) {
+	// Zero disables the checks rather than falling back to the defaults
+	t.Setenv("QUORRA_MAX_PAYLOAD_DEPTH", "0")
+	t.Setenv("QUORRA_MAX_PAYLOAD_KEYS", "0")
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.MaxPayloadDepth != 0 || cfg.MaxPayloadKeys != 0 {
+		t.Errorf("Expected both limits disabled, got depth=%d keys=%d", cfg.MaxPayloadDepth, cfg.MaxPayloadKeys)
+	}
+
+	t.Setenv("QUORRA_MAX_PAYLOAD_DEPTH", "-1")
+	if _, err := config.Load(); err == nil || !strings.Contains(err.Error(), "QUORRA_MAX_PAYLOAD_DEPTH") {
+		t.Errorf("Expected a negative QUORRA_MAX_PAYLOAD_DEPTH to be rejected, got %v", err)
+	}
+}
+
+func TestMigrateQueueInMemory(t *testing.T) {
+	s := store.NewInMemoryStore()
+	logger := log.New(io.Discard, "", 0)
+	qm := queue.NewManager(s, nil, nil, logger)
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if _, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+			Type:    "test_migrate",
+			Payload: map[string]interface{}{},
+			Queue:   "test_migrate_old",
+		}); err != nil {
+			t.Fatalf("Failed to enqueue job: %v", err)
+		}
+	}
+	if _, err := qm.LeaseJobs(ctx, "test_migrate_old", "worker-1", 1, 30*time.Second, store.LeaseOptions{}); err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+
+	moved, err := qm.MigrateQueue(ctx, "test_migrate_old", "test_migrate_new", store.MigrateDue)
+	if err != nil {
+		t.Fatalf("Failed to migrate queue: %v", err)
+	}
+	if moved != 2 {
+		t.Errorf("Expected the 2 pending jobs moved and the leased one left, got %d moved", moved)
+	}
+
+	jobs, err := qm.LeaseJobs(ctx, "test_migrate_new", "worker-1", 10, 30*time.Second, store.LeaseOptions{})
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(jobs) != 2 {
+		t.Errorf("Expected 2 jobs leasable from the new queue, got %d", len(jobs))
+	}
+}
+
+func TestStealJobInMemory(t *testing.T) {
+	s := store.NewInMemoryStore()
+	ctx := context.Background()
+
+	job, err := s.CreateJob(ctx, &store.CreateJobRequest{
+		Type:    "test_steal",
+		Payload: map[string]interface{}{},
+		Queue:   "test_steal",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	leased, err := s.LeaseJob(ctx, job.ID, "worker-a", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to lease job: %v", err)
+	}
+
+	stolen, err := s.StealJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Failed to steal job: %v", err)
+	}
+	if stolen.Status != store.StatusPending || stolen.LeaseEpoch <= leased.LeaseEpoch {
+		t.Errorf("Expected pending job with a newer lease epoch, got status=%s epoch=%d", stolen.Status, stolen.LeaseEpoch)
+	}
+	if _, err := s.StealJob(ctx, job.ID); !errors.Is(err, store.ErrJobNotLeased) {
+		t.Errorf("Expected ErrJobNotLeased stealing a pending job, got %v", err)
+	}
+
+	jobs, err := s.LeaseJobs(ctx, "test_steal", "worker-b", 1, time.Hour, store.LeaseOptions{})
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("Expected the stolen job to be leasable, got %d jobs (err=%v)", len(jobs), err)
+	}
+	if _, err := s.AckJob(ctx, store.AckRequest{JobID: job.ID, LeaseID: leased.LeaseID, Success: true}); err == nil {
+		t.Error("Expected ack from the stale lease to fail")
+	}
+}
+
+func TestScheduleCalendarInMemory(t *testing.T) {
+	s := store.NewInMemoryStore()
+	logger := log.New(io.Discard, "", 0)
+	qm := queue.NewManager(s, nil, nil, logger)
+	ctx := context.Background()
+
+	// Every day but today is a holiday, so today's jobs wait until tomorrow
+	today := time.Now().UTC()
+	tomorrow := time.Date(today.Year(), today.Month(), today.Day()+1, 0, 0, 0, 0, time.UTC)
+	if err := qm.PutCalendar(ctx, &store.BusinessCalendar{
+		Name:     "test_calendar",
+		Weekend:  []string{},
+		Holidays: []string{today.Format(time.DateOnly)},
+	}); err != nil {
+		t.Fatalf("Failed to put calendar: %v", err)
+	}
+
+	job, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:             "test_calendar",
+		Payload:          map[string]interface{}{},
+		Queue:            "test_calendar",
+		ScheduleCalendar: "test_calendar",
+	})
+	if err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+	if !job.RunAt.Equal(tomorrow) {
+		t.Errorf("Expected run_at moved to %s, got %s", tomorrow, job.RunAt)
+	}
+	if job.RunAt.Location() != time.Local {
+		t.Errorf("Expected run_at in the server's zone, got %s", job.RunAt.Location())
+	}
+
+	// Rejected up front, rather than created and left unleasable until tomorrow
+	qm.EnableInlineExecution()
+	qm.RegisterInlineHandler("test_calendar", func(ctx context.Context, job *store.Job) error {
+		return nil
+	})
+	if _, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:             "test_calendar",
+		Payload:          map[string]interface{}{},
+		Queue:            "test_calendar",
+		ScheduleCalendar: "test_calendar",
+		Inline:           true,
+	}); !errors.Is(err, queue.ErrInlineScheduled) {
+		t.Errorf("Expected ErrInlineScheduled for an inline job with a schedule calendar, got %v", err)
+	}
+	stats, err := qm.GetQueueStats(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get queue stats: %v", err)
+	}
+	for _, st := range stats {
+		if st.Queue == "test_calendar" && st.Count != 1 {
+			t.Errorf("Expected only the first job created, got %d %s", st.Count, st.Status)
+		}
+	}
+
+	_, err = qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:             "test_calendar",
+		Payload:          map[string]interface{}{},
+		Queue:            "test_calendar",
+		ScheduleCalendar: "test_unknown",
+	})
+	if !errors.Is(err, store.ErrCalendarNotFound) {
+		t.Errorf("Expected ErrCalendarNotFound, got %v", err)
+	}
+}
+
+func TestGraceRedeliveriesInMemory(t *testing.T) {
+	s := store.NewInMemoryStore()
+	s.SetGraceRedeliveries(2)
+	s.SetBackoffPolicy(store.BackoffPolicy{Max: time.Millisecond})
+	ctx := context.Background()
+
+	job, err := s.CreateJob(ctx, &store.CreateJobRequest{
+		Type:       "test_grace_redelivery",
+		Payload:    map[string]interface{}{},
+		Queue:      "test_grace_redelivery",
+		MaxRetries: 1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	// A lease expiry and a redelivery nack use up the grace, so a job with
+	// a single attempt survives both
+	if _, err := s.LeaseJob(ctx, job.ID, "worker-1", 10*time.Millisecond); err != nil {
+		t.Fatalf("Failed to lease job: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, _, err := s.ReclaimExpiredLeases(ctx); err != nil {
+		t.Fatalf("Failed to reclaim leases: %v", err)
+	}
+
+	leased, err := s.LeaseJob(ctx, job.ID, "worker-1", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to lease job: %v", err)
+	}
+	result, err := s.AckJob(ctx, store.AckRequest{JobID: job.ID, LeaseID: leased.LeaseID, ErrorMessage: "shutting down", Redelivery: true})
+	if err != nil {
+		t.Fatalf("Failed to nack job: %v", err)
+	}
+	if result.Status != store.StatusPending {
+		t.Fatalf("Expected the redelivery nack to keep the job pending, got %s", result.Status)
+	}
+	got, _ := s.GetJob(ctx, job.ID)
+	if got.Attempts != 0 || got.Redeliveries != 2 {
+		t.Errorf("Expected attempts=0 and redeliveries=2, got %d/%d", got.Attempts, got.Redeliveries)
+	}
+
+	// Past the grace, a redelivery nack counts and exhausts the retries
+	leased, err = s.LeaseJob(ctx, job.ID, "worker-1", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to lease job: %v", err)
+	}
+	result, err = s.AckJob(ctx, store.AckRequest{JobID: job.ID, LeaseID: leased.LeaseID, ErrorMessage: "shutting down", Redelivery: true})
+	if err != nil {
+		t.Fatalf("Failed to nack job: %v", err)
+	}
+	if result.Status != store.StatusDead || result.DeadReason != store.DeadReasonMaxRetries {
+		t.Errorf("Expected the job dead-lettered for max_retries, got %s/%s", result.Status, result.DeadReason)
+	}
+}
+
+func TestUniqueByInMemory(t *testing.T) {
+	s := store.NewInMemoryStore()
+	ctx := context.Background()
+
+	req := store.CreateJobRequest{
+		Type:     "test_unique_by",
+		Payload:  map[string]interface{}{"customer": map[string]interface{}{"id": 7}},
+		Queue:    "test_unique_by",
+		Labels:   map[string]string{"report_type": "weekly"},
+		UniqueBy: []string{"payload.customer.id", "labels.report_type"},
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*store.Job, 5)
+	errs := make([]error, len(results))
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r := req
+			results[i], errs[i] = s.CreateJob(ctx, &r)
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for i, job := range results {
+		if errs[i] != nil {
+			t.Fatalf("Failed to create job: %v", errs[i])
+		}
+		if job.ID != results[0].ID {
+			t.Fatalf("Expected one job, got %s and %s", results[0].ID, job.ID)
+		}
+		if !job.Deduplicated {
+			created++
+		}
+	}
+	if created != 1 {
+		t.Errorf("Expected exactly one enqueue to create the job, got %d", created)
+	}
+
+	// Once the job finishes, the key is free again
+	leased, err := s.LeaseJobs(ctx, "test_unique_by", "worker-1", 1, time.Minute, store.LeaseOptions{})
+	if err != nil || len(leased) != 1 {
+		t.Fatalf("Failed to lease job: %v", err)
+	}
+	if _, err := s.AckJob(ctx, store.AckRequest{JobID: leased[0].ID, LeaseID: leased[0].LeaseID, Success: true}); err != nil {
+		t.Fatalf("Failed to ack job: %v", err)
+	}
+	r := req
+	next, err := s.CreateJob(ctx, &r)
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	if next.Deduplicated || next.ID == results[0].ID {
+		t.Error("Expected a new job once the active one finished")
+	}
+
+	if err := store.ValidateUniqueBy([]string{"customer_id"}); err == nil {
+		t.Error("Expected a unique_by field without a payload. or labels. prefix to be rejected")
+	}
+
+	// An import can't add a second active job with the key
+	exported, err := s.GetJob(ctx, next.ID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if _, err := s.ImportJob(ctx, exported, store.ImportOptions{}); !errors.Is(err, store.ErrJobExists) {
+		t.Errorf("Expected ErrJobExists importing a job with an active unique key, got %v", err)
+	}
+
+	// A unique_by field missing from the payload is the client's mistake, not an outage
+	spool := &memorySpool{}
+	failover := store.NewFailoverStore(&flakyStore{Store: s, down: true}, spool, log.New(io.Discard, "", 0))
+	_, err = failover.CreateJob(ctx, &store.CreateJobRequest{
+		Type:     "test_unique_by",
+		Payload:  map[string]interface{}{},
+		Queue:    "test_unique_by",
+		UniqueBy: []string{"payload.customer.id"},
+	})
+	if !errors.Is(err, store.ErrInvalidUniqueBy) {
+		t.Errorf("Expected ErrInvalidUniqueBy, got %v", err)
+	}
+	if len(spool.jobs) != 0 {
+		t.Errorf("Expected nothing spooled, got %d jobs", len(spool.jobs))
+	}
+}
+
+func TestSaveStateInMemory(t *testing.T) {
+	s := store.NewInMemoryStore()
+	ctx := context.Background()
+
+	job, err := s.CreateJob(ctx, &store.CreateJobRequest{
+		Type:       "test_save_state",
+		Payload:    map[string]interface{}{"items": 100},
+		Queue:      "test_save_state",
+		MaxRetries: 3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	leased, err := s.LeaseJobs(ctx, "test_save_state", "worker-1", 1, time.Hour, store.LeaseOptions{})
+	if err != nil || len(leased) != 1 {
+		t.Fatalf("Failed to lease job: %v", err)
+	}
+	first := leased[0]
+	if err := s.SaveState(ctx, job.ID, first.LeaseID, first.LeaseEpoch, json.RawMessage(`{"done":40}`)); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+	if err := s.SaveState(ctx, job.ID, first.LeaseID, first.LeaseEpoch+1, json.RawMessage(`{"done":99}`)); err == nil {
+		t.Error("Expected saving state on a stale lease epoch to fail")
+	}
+
+	// The worker crashes; its lease is revoked and the job retried elsewhere
+	if _, err := s.StealJob(ctx, job.ID); err != nil {
+		t.Fatalf("Failed to revoke lease: %v", err)
+	}
+	leased, err = s.LeaseJobs(ctx, "test_save_state", "worker-2", 1, time.Hour, store.LeaseOptions{})
+	if err != nil || len(leased) != 1 {
+		t.Fatalf("Failed to re-lease job: %v", err)
+	}
+	if got := string(leased[0].State); got != `{"done":40}` {
+		t.Errorf("Expected the retry to get the saved state, got %q", got)
+	}
+	if leased[0].Payload["items"] != float64(100) {
+		t.Errorf("Expected the payload to be untouched, got %v", leased[0].Payload)
+	}
+}
+
+func TestExportImportRoundTripInMemory(t *testing.T) {
+	source := store.NewInMemoryStore()
+	ctx := context.Background()
+
+	job, err := source.CreateJob(ctx, &store.CreateJobRequest{
+		Type:     "test_round_trip",
+		Payload:  map[string]interface{}{"customer": "c-1"},
+		Queue:    "test_round_trip",
+		UniqueBy: []string{"payload.customer"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	leased, err := source.LeaseJobs(ctx, "test_round_trip", "worker-1", 1, time.Hour, store.LeaseOptions{})
+	if err != nil || len(leased) != 1 {
+		t.Fatalf("Failed to lease job: %v", err)
+	}
+	if err := source.SaveState(ctx, job.ID, leased[0].LeaseID, leased[0].LeaseEpoch, json.RawMessage(`{"done":3}`)); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+	if _, err := source.KillJob(ctx, job.ID, "alice", "stuck"); err != nil {
+		t.Fatalf("Failed to kill job: %v", err)
+	}
+
+	exported, err := source.ExportJobs(ctx, "test_round_trip", "", 10)
+	if err != nil || len(exported) != 1 {
+		t.Fatalf("Failed to export jobs: %v", err)
+	}
+	want := exported[0]
+
+	target := store.NewInMemoryStore()
+	if _, err := target.ImportJob(ctx, want, store.ImportOptions{PreserveIDs: true, PreserveStatus: true}); err != nil {
+		t.Fatalf("Failed to import job: %v", err)
+	}
+	got, err := target.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Failed to get imported job: %v", err)
+	}
+
+	if got.Status != store.StatusDead || got.DeadReason != want.DeadReason || got.KilledBy != "alice" ||
+		got.DeadAt == nil || !got.DeadAt.Equal(*want.DeadAt) || got.DeadRetryCount != want.DeadRetryCount {
+		t.Errorf("Expected the dead-letter details to round-trip, got %+v", got)
+	}
+	if string(got.State) != `{"done":3}` || got.UniqueKey != want.UniqueKey || got.Redeliveries != want.Redeliveries {
+		t.Errorf("Expected state, unique key and redeliveries to round-trip, got %+v", got)
+	}
+}
+
+func TestNackDeferralCapInMemory(t *testing.T) {
+	s := store.NewInMemoryStore()
+	s.SetMaxDeferrals(2)
+	ctx := context.Background()
+
+	job, err := s.CreateJob(ctx, &store.CreateJobRequest{
+		Type:       "test_deferral_cap",
+		Payload:    map[string]interface{}{},
+		Queue:      "test_deferral_cap",
+		MaxRetries: 5,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		leased, err := s.LeaseJobs(ctx, "test_deferral_cap", "worker-1", 1, time.Minute, store.LeaseOptions{})
+		if err != nil || len(leased) != 1 {
+			t.Fatalf("Failed to lease job on try %d: %v", i, err)
+		}
+		result, err := s.AckJob(ctx, store.AckRequest{
+			JobID:        job.ID,
+			LeaseID:      leased[0].LeaseID,
+			ErrorMessage: "rate limited",
+			RetryAfter:   time.Millisecond,
+		})
+		if err != nil || result.Status != store.StatusPending {
+			t.Fatalf("Expected the deferred job to be pending, got %+v, err=%v", result, err)
+		}
+
+		stored, err := s.GetJob(ctx, job.ID)
+		if err != nil {
+			t.Fatalf("Failed to get job: %v", err)
+		}
+		// The third deferral is past the cap of 2, so it counts
+		wantAttempts := 0
+		if i == 3 {
+			wantAttempts = 1
+		}
+		if stored.Attempts != wantAttempts {
+			t.Errorf("After deferral %d expected %d attempts, got %d", i, wantAttempts, stored.Attempts)
+		}
+		if delay := stored.RunAt.Sub(stored.UpdatedAt); delay > time.Second {
+			t.Errorf("Expected deferral %d to keep the requested delay, got %v", i, delay)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReplicaPrimaryReadsInMemory(t *testing.T) {
+	// A replica that never catches up shows which reads reach the primary
+	primary := store.NewInMemoryStore()
+	s := store.NewReplicaStore(primary, store.NewInMemoryStore(), false)
+	qm := queue.NewManager(s, nil, nil, log.New(io.Discard, "", 0))
+	ctx := context.Background()
+
+	qm.EnableInlineExecution()
+	qm.RegisterInlineHandler("test_replica_inline", func(ctx context.Context, job *store.Job) error {
+		return nil
+	})
+	job, err := qm.EnqueueJob(ctx, &store.CreateJobRequest{
+		Type:    "test_replica_inline",
+		Payload: map[string]interface{}{},
+		Queue:   "test_replica",
+		Inline:  true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to run inline job: %v", err)
+	}
+	if job.Status != store.StatusSucceeded {
+		t.Errorf("Expected the inline job's result from the primary, got %s", job.Status)
+	}
+
+	job, err = qm.WaitForJobChange(ctx, job.ID, store.StatusPending, time.Second)
+	if err != nil {
+		t.Fatalf("Expected the watched job to be read from the primary: %v", err)
+	}
+	if job.Status != store.StatusSucceeded {
+		t.Errorf("Expected the watched job to be succeeded, got %s", job.Status)
+	}
+
+	if _, err := s.GetJob(ctx, job.ID); err == nil {
+		t.Error("Expected other reads to still go to the replica")
+	}
+}